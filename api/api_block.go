@@ -38,6 +38,8 @@ type ReqCacheData struct {
 	CandidateURL string
 	CardFileCid  string
 	CacheID      string
+	// ticket to download blocks from candidate
+	DownloadTicket string
 }
 
 type BlockOperationResult struct {
@@ -10,6 +10,10 @@ type Candidate interface {
 	Validate
 	WaitQuiet(ctx context.Context) error                         //perm:read
 	ValidateBlocks(ctx context.Context, req []ReqValidate) error //perm:read
+	// CheckReachability dial the tcp addresses, for nat detection of edge
+	CheckReachability(ctx context.Context, addrs []string) ([]bool, error) //perm:write
+	// AllowRelay accept the tunnel of the edge with the key
+	AllowRelay(ctx context.Context, deviceID, key string) error //perm:admin
 }
 
 type ReqValidate struct {
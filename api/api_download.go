@@ -7,9 +7,48 @@ type Download interface {
 	SetDownloadSpeed(ctx context.Context, speed int64) error //perm:write
 	// get download info
 	GetDownloadInfo(ctx context.Context) (DownloadInfo, error) //perm:read
+	// set limits of client ip, app and ticket, pushed by scheduler
+	SetDownloadLimits(ctx context.Context, limits DownloadLimits) error //perm:admin
+	// top cids and clients served in the last day
+	GetDownloadStats(ctx context.Context, top int) (DownloadStatsInfo, error) //perm:read
+	// set the denylist, pushed by scheduler when the denylist changed
+	SetDenylist(ctx context.Context, list Denylist) error //perm:admin
 }
 
 type DownloadInfo struct {
 	URL   string
 	Token string
+	// route score of the node for the user, higher is better
+	Score float64
+}
+
+// DownloadRank downloads of a cid or client
+type DownloadRank struct {
+	Key    string
+	Blocks int64
+	Bytes  int64
+}
+
+// DownloadStatsInfo top cids and clients of the node download server
+type DownloadStatsInfo struct {
+	// begin of the stats, unix time
+	Since      int64
+	TopCids    []DownloadRank
+	TopClients []DownloadRank
+}
+
+// DownloadLimit limit of a client ip, app or ticket, 0 is unlimited
+type DownloadLimit struct {
+	MaxConns    int
+	BytesPerSec int64
+	DailyBytes  int64
+}
+
+// DownloadLimits limits of the node download server
+type DownloadLimits struct {
+	PerIP     DownloadLimit
+	PerApp    DownloadLimit
+	PerTicket DownloadLimit
+	// app name:limit, override PerApp
+	Apps map[string]DownloadLimit
 }
@@ -11,11 +11,16 @@ type Locator interface {
 	ShowAccessPoint(ctx context.Context, areaID string) (AccessPoint, error)                                                //perm:admin
 
 	DeviceOnline(ctx context.Context, deviceID string, areaID string, port int) error //perm:write
-	DeviceOffline(ctx context.Context, deviceID string) error                         //perm:write
+	DeviceOffline(ctx context.Context, deviceID string, port int) error               //perm:write
 
 	GetDownloadInfosWithBlocks(ctx context.Context, cids []string) (map[string][]DownloadInfo, error) //perm:read
 	GetDownloadInfoWithBlocks(ctx context.Context, cids []string) (map[string]DownloadInfo, error)    //perm:read
 	GetDownloadInfoWithBlock(ctx context.Context, cid string) (DownloadInfo, error)                   //perm:read
+	GetDownloadTicket(ctx context.Context, req DownloadTicketReq) (DownloadInfo, error)               //perm:read
+	GetDownloadTickets(ctx context.Context, req DownloadTicketReq, max int) ([]DownloadInfo, error)   //perm:read
+
+	// ip empty is the ip of the caller
+	LookupIPGeo(ctx context.Context, ip string) (IPGeoInfo, error) //perm:read
 }
 
 type SchedulerAuth struct {
@@ -28,6 +33,14 @@ type SchedulerInfo struct {
 	Weight      int
 	Online      bool
 	AccessToken string
+
+	// health state probed by locator
+	Latency     float64 // moving average of probe latency (ms)
+	ErrorRate   float64 // moving average of probe error rate
+	CircuitOpen bool    // scheduler is not used until the circuit close
+	OnlineNodes int
+	Capacity    int // max nodes reported by scheduler, 0 is unknown
+	Standby     bool
 }
 type AccessPoint struct {
 	AreaID         string
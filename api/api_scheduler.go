@@ -16,37 +16,109 @@ type Scheduler interface {
 	Validate(ctx context.Context) error                                                                //perm:admin
 	QueryCacheStatWithNode(ctx context.Context, deviceID string) ([]CacheStat, error)                  //perm:read
 	QueryCachingBlocksWithNode(ctx context.Context, deviceID string) (CachingBlockList, error)         //perm:read
-	CacheCarfile(ctx context.Context, cid string, reliability int) error                               //perm:admin
-	RemoveCarfile(ctx context.Context, carfileID string) error                                         //perm:admin
-	RemoveCache(ctx context.Context, carfileID, cacheID string) error                                  //perm:admin
+	CacheCarfile(ctx context.Context, cid string, reliability int, selector string) error              //perm:read
+	RemoveCarfile(ctx context.Context, carfileID string) error                                         //perm:read
+	RemoveCache(ctx context.Context, carfileID, cacheID string) error                                  //perm:read
 	ShowDataTask(ctx context.Context, cid string) (CacheDataInfo, error)                               //perm:read
 	ListDatas(ctx context.Context, page int) (DataListInfo, error)                                     //perm:read
 	ShowDataTasks(ctx context.Context) ([]CacheDataInfo, error)                                        //perm:read
 	RegisterNode(ctx context.Context, t NodeType) (NodeRegisterInfo, error)                            //perm:admin
+	RevokeNodeSecret(ctx context.Context, deviceID string) error                                       //perm:admin
+	RotateNodeSecret(ctx context.Context, deviceID string) (NodeRegisterInfo, error)                   //perm:admin
 	DeleteBlockRecords(ctx context.Context, deviceID string, cids []string) (map[string]string, error) //perm:admin
-	CacheContinue(ctx context.Context, cid, cacheID string) error                                      //perm:admin
+	CacheContinue(ctx context.Context, cid, cacheID string) error                                      //perm:read
 	ValidateSwitch(ctx context.Context, open bool) error                                               //perm:admin
 
 	// call by locator
 	LocatorConnect(ctx context.Context, edgePort int, areaID, locatorID, locatorToken string) error //perm:write
+	GetSchedulerLoad(ctx context.Context) (SchedulerLoad, error)                                    //perm:read
+
+	// high availability
+	ResignLeader(ctx context.Context) error //perm:admin
 
 	// call by node
-	DownloadBlockResult(ctx context.Context, stat DownloadStat) error                                    //perm:write
-	GetToken(ctx context.Context, deviceID, secret string) (string, error)                               //perm:write
-	EdgeNodeConnect(ctx context.Context, edgePort int, token string) (externalIP string, err error)      //perm:write
+	DownloadBlockResult(ctx context.Context, stat DownloadStat) error                                   //perm:write
+	GetToken(ctx context.Context, deviceID, secret string) (string, error)                              //perm:write
+	GetNodeCert(ctx context.Context, deviceID, secret string, csr []byte) (NodeCertInfo, error)         //perm:write
+	GetDownloadCert(ctx context.Context, deviceID, secret string, csr []byte) (DownloadCertInfo, error) //perm:write
+	GetTicketPublicKey(ctx context.Context) ([]byte, error)                                             //perm:read
+	EdgeNodeConnect(ctx context.Context, edgePort int, token string) (externalIP string, err error)     //perm:write
+	// the edge behind nat is called through the tunnel to scheduler
+	EdgeNodeReverseConnect(ctx context.Context, token string) (ReverseConnectInfo, error)                //perm:write
 	ValidateBlockResult(ctx context.Context, validateResults ValidateResults) error                      //perm:write
 	CandidateNodeConnect(ctx context.Context, edgePort int, token string) (externalIP string, err error) //perm:write
 	CacheResult(ctx context.Context, deviceID string, resultInfo CacheResultInfo) (string, error)        //perm:write
 	UpdateDownloadServerAccessAuth(ctx context.Context, accessAuth DownloadServerAccessAuth) error       //perm:write
 
+	// download receipts signed by user, submit by node with the node token, token can be empty if node connect with tls certificate
+	SubmitDownloadReceipts(ctx context.Context, token string, receipts []DownloadReceipt) (DownloadReceiptResult, error) //perm:write
+	SubmitDownloadUsage(ctx context.Context, token string, report DownloadUsageReport) error                             //perm:write
+	// download stats aggregated by cid, client and hour, submit by node
+	SubmitDownloadStats(ctx context.Context, token string, stats []DownloadStat) error //perm:write
+
+	// reward and income
+	SetRewardFormula(ctx context.Context, formula RewardFormula) error                      //perm:admin
+	GetRewardFormula(ctx context.Context) (RewardFormula, error)                            //perm:read
+	BindDeviceUser(ctx context.Context, deviceID, userID string) error                      //perm:admin
+	GetDeviceIncome(ctx context.Context, deviceID string) (IncomeDailyRes, error)           //perm:read
+	GetUserIncome(ctx context.Context, userID string) (IndexPageRes, error)                 //perm:read
+	GetIncomeDaily(ctx context.Context, deviceID, month string) (IncomeDaily, error)        //perm:read
+	GetHourDataOfDaily(ctx context.Context, deviceID, date string) (HourDataOfDaily, error) //perm:read
+
+	// download limits of nodes and usage of apps
+	SetDownloadLimits(ctx context.Context, limits DownloadLimits) error                                 //perm:admin
+	GetDownloadLimits(ctx context.Context) (DownloadLimits, error)                                      //perm:read
+	GetAppDownloadUsages(ctx context.Context, date string) ([]AppDownloadUsage, error)                  //perm:read
+	GetDownloadViolations(ctx context.Context, deviceID string, limit int) ([]DownloadViolation, error) //perm:read
+
+	// reputation
+	GetReputationRanking(ctx context.Context, nodeType NodeTypeName, limit int) ([]ReputationInfo, error) //perm:read
+
+	// quarantine and ban
+	AddNodeRestriction(ctx context.Context, restriction NodeRestriction) error                           //perm:admin
+	RemoveNodeRestriction(ctx context.Context, target, reason string) error                              //perm:admin
+	ListNodeRestrictions(ctx context.Context) ([]NodeRestriction, error)                                 //perm:read
+	ListNodeRestrictionLogs(ctx context.Context, target string, limit int) ([]NodeRestrictionLog, error) //perm:admin
+
+	// served areas and ip allowlist
+	SetAreaPolicy(ctx context.Context, policy AreaPolicy) error  //perm:admin
+	RemoveAreaPolicy(ctx context.Context, area string) error     //perm:admin
+	ListAreaPolicies(ctx context.Context) ([]AreaPolicy, error)  //perm:read
+	AddIPAllowlist(ctx context.Context, entry IPAllowlist) error //perm:admin
+	RemoveIPAllowlist(ctx context.Context, target string) error  //perm:admin
+	ListIPAllowlists(ctx context.Context) ([]IPAllowlist, error) //perm:read
+	// ip empty is the ip of the caller
+	LookupIPGeo(ctx context.Context, ip string) (IPGeoInfo, error) //perm:read
+
+	// nat detection
+	ProbeNodeReachability(ctx context.Context, deviceID string) (NodeReachability, error) //perm:admin
+	GetNodeReachability(ctx context.Context, deviceID string) (NodeReachability, error)   //perm:read
+
+	// tenants own carfiles, tenant token is created by AuthNew with the permission of TenantPermission
+	SetTenant(ctx context.Context, tenant Tenant) error //perm:admin
+	ListTenants(ctx context.Context) ([]Tenant, error)  //perm:admin
+	// tenant id and month(2006-01) empty are the tenant of the caller and this month
+	GetTenantUsage(ctx context.Context, tenantID, month string) (TenantUsage, error) //perm:read
+
+	// content denylist, entries are cids, /ipfs/<cid> or //<hash> of bad bits format
+	AddDenylist(ctx context.Context, entries []string, reason string) (int64, error) //perm:admin
+	RemoveDenylist(ctx context.Context, entries []string) (int64, error)             //perm:admin
+	ListDenylist(ctx context.Context) ([]DenylistEntry, error)                       //perm:read
+	// entries are empty if the version is the latest
+	GetDenylist(ctx context.Context, version int64) (Denylist, error) //perm:read
+
 	// call by user
 	FindNodeWithBlock(ctx context.Context, cid string) (string, error)                                //perm:read
 	GetDownloadInfosWithBlocks(ctx context.Context, cids []string) (map[string][]DownloadInfo, error) //perm:read
 	GetDownloadInfoWithBlocks(ctx context.Context, cids []string) (map[string]DownloadInfo, error)    //perm:read
 	GetDownloadInfoWithBlock(ctx context.Context, cid string) (DownloadInfo, error)                   //perm:read
+	GetDownloadTicket(ctx context.Context, req DownloadTicketReq) (DownloadInfo, error)               //perm:read
+	GetDownloadTickets(ctx context.Context, req DownloadTicketReq, max int) ([]DownloadInfo, error)   //perm:read
 	GetDevicesInfo(ctx context.Context, deviceID string) (DevicesInfo, error)                         //perm:read
 	StateNetwork(ctx context.Context) (StateNetwork, error)                                           //perm:read
 	GetDownloadInfo(ctx context.Context, deviceID string) ([]*BlockDownloadInfo, error)               //perm:read
+	// download infos of every cid of the req, every info has the ticket of its cid, error is returned only if no cid is found
+	GetDownloadTicketsWithBlocks(ctx context.Context, req DownloadTicketReq, max int) (map[string][]DownloadInfo, error) //perm:read
 }
 
 // DataListInfo Data List Info
@@ -64,6 +136,235 @@ type NodeRegisterInfo struct {
 	Secret     string `db:"secret"`
 	CreateTime string `db:"create_time"`
 	NodeType   int    `db:"node_type"`
+	UserID     string `db:"user_id"`
+}
+
+// SchedulerLoad load and capacity of the scheduler
+type SchedulerLoad struct {
+	OnlineEdges      int
+	OnlineCandidates int
+	// max nodes the scheduler can serve, 0 is unknown
+	Capacity int
+	// scheduler is not the leader of the server, it does not serve nodes
+	Standby bool
+}
+
+// DownloadTicketReq download ticket request
+type DownloadTicketReq struct {
+	Cids    []string
+	RootCid string
+	// total bytes allowed to download, 0 is unlimited
+	MaxBytes int64
+	// ip of the user, set by locator
+	ClientIP string
+	// PKIX public key of the user, the user sign download receipts with it
+	ClientKey []byte
+}
+
+// DownloadReceipt signed by the user after download a block from node
+type DownloadReceipt struct {
+	Cid      string
+	Size     int64
+	DeviceID string
+	// unix time of the download
+	Time int64
+	// download ticket of the block
+	Ticket string
+	// signature of the user key in the ticket
+	Sign []byte
+}
+
+// DownloadUsageReport download usage and limit violations of the node since last report
+type DownloadUsageReport struct {
+	Apps       []AppDownloadUsage
+	Violations []DownloadViolation
+}
+
+// AppDownloadUsage download usage of an app on a day, for billing
+type AppDownloadUsage struct {
+	DeviceID string `db:"device_id"`
+	AppName  string `db:"app_name"`
+	// 2006-01-02
+	Date   string `db:"date"`
+	Bytes  int64  `db:"bytes"`
+	Blocks int64  `db:"blocks"`
+	// downloads rejected by limits
+	Rejected int64 `db:"rejected"`
+}
+
+// download limit scopes
+const (
+	DownloadScopeIP     = "ip"
+	DownloadScopeApp    = "app"
+	DownloadScopeTicket = "ticket"
+)
+
+// download limit kinds
+const (
+	DownloadLimitConns = "conns"
+	DownloadLimitDaily = "daily"
+)
+
+// DownloadViolation downloads rejected by a limit
+type DownloadViolation struct {
+	DeviceID string `db:"device_id"`
+	// DownloadScopeIP, DownloadScopeApp or DownloadScopeTicket
+	Scope string `db:"scope"`
+	// ip, app name or ticket id
+	Target string `db:"target"`
+	// DownloadLimitConns or DownloadLimitDaily
+	Limit    string `db:"limit_kind"`
+	ClientIP string `db:"client_ip"`
+	AppName  string `db:"app_name"`
+	// rejected times since last report
+	Count       int64 `db:"count"`
+	CreatedTime int64 `db:"created_time"`
+}
+
+// DownloadReceiptResult download receipts verify result
+type DownloadReceiptResult struct {
+	Accepted int
+	Rejected int
+}
+
+// RewardFormula income of node per unit of work
+type RewardFormula struct {
+	PerDownloadGiB     float64
+	PerDownload        float64
+	PerOnlineHour      float64
+	PerStorageGiBHour  float64
+	PerValidateSuccess float64
+	// usually negative, punish the failed validation
+	PerValidateFail float64
+}
+
+// ReputationInfo reputation score of device and its components
+type ReputationInfo struct {
+	DeviceID string
+	NodeType NodeType
+	// 0-100
+	Score float64
+	// components 0-1
+	Uptime   float64
+	Validate float64
+	Download float64
+	Cache    float64
+	Latency  float64
+}
+
+// restriction target type
+const (
+	RestrictionTargetDevice = "device"
+	RestrictionTargetIP     = "ip"
+	RestrictionTargetCIDR   = "cidr"
+)
+
+// restriction action
+const (
+	// node is excluded from placement and routing, but still validated
+	RestrictionQuarantine = "quarantine"
+	// node can not connect to scheduler
+	RestrictionBan = "ban"
+)
+
+// NodeRestriction quarantine or ban a device, ip or cidr
+type NodeRestriction struct {
+	Target     string `db:"target"`
+	TargetType string `db:"target_type"`
+	Action     string `db:"action"`
+	Reason     string `db:"reason"`
+	Operator   string `db:"operator"`
+	// unix time, 0 is never expire
+	ExpireTime  int64 `db:"expire_time"`
+	CreatedTime int64 `db:"created_time"`
+}
+
+// NodeRestrictionLog audit log of restriction change
+type NodeRestrictionLog struct {
+	ID         int
+	Target     string `db:"target"`
+	TargetType string `db:"target_type"`
+	Action     string `db:"action"`
+	// add or remove
+	Op          string `db:"op"`
+	Reason      string `db:"reason"`
+	Operator    string `db:"operator"`
+	CreatedTime int64  `db:"created_time"`
+}
+
+// AreaPolicy nodes of the area are served by the scheduler,
+// area is country, country-province or country-province-city, the most specific policy is applied
+type AreaPolicy struct {
+	Area            string `db:"area"`
+	AcceptEdge      bool   `db:"accept_edge"`
+	AcceptCandidate bool   `db:"accept_candidate"`
+	// max online nodes of the area, 0 is unlimited
+	MaxNodes    int    `db:"max_nodes"`
+	Operator    string `db:"operator"`
+	CreatedTime int64  `db:"created_time"`
+}
+
+// IPAllowlist ip or cidr accepted whatever its area,
+// the area of the node is overridden if Area is set
+type IPAllowlist struct {
+	Target      string `db:"target"`
+	Area        string `db:"area"`
+	Reason      string `db:"reason"`
+	Operator    string `db:"operator"`
+	CreatedTime int64  `db:"created_time"`
+}
+
+// Tenant owner of carfiles, quotas 0 are unlimited
+type Tenant struct {
+	ID   string `db:"tenant_id"`
+	Name string `db:"name"`
+	// bytes of the carfiles multiplied by replicas
+	StorageQuota int64 `db:"storage_quota"`
+	// max replicas of a carfile
+	ReplicaQuota int `db:"replica_quota"`
+	// bytes downloaded from the carfiles in a month
+	BandwidthQuota int64 `db:"bandwidth_quota"`
+	// the tokens of disabled tenant are rejected
+	Disabled    bool  `db:"disabled"`
+	CreatedTime int64 `db:"created_time"`
+}
+
+// TenantUsage usage of the tenant in the month
+type TenantUsage struct {
+	TenantID       string
+	Month          string
+	Carfiles       int
+	StorageBytes   int64
+	BandwidthBytes int64
+	Tenant         Tenant
+}
+
+// DenylistEntry double hash of the denied cid
+type DenylistEntry struct {
+	Hash        string `db:"hash"`
+	Reason      string `db:"reason"`
+	Operator    string `db:"operator"`
+	CreatedTime int64  `db:"created_time"`
+}
+
+// Denylist hashes of the denied cids, signed by the ticket key of scheduler
+type Denylist struct {
+	Version   int64
+	Entries   []string
+	Signature []byte
+}
+
+// NodeCertInfo node tls certificate signed by scheduler ca
+type NodeCertInfo struct {
+	Cert   []byte
+	CACert []byte
+}
+
+// DownloadCertInfo server certificate of the download server, leaf first
+type DownloadCertInfo struct {
+	Certs [][]byte
+	// per-node hostname in the certificate, empty if scheduler has no download domain
+	Hostname string
 }
 
 // CacheResultInfo cache data result info
@@ -75,7 +376,10 @@ type CacheResultInfo struct {
 	From          string
 	DownloadSpeed float32
 	// links cid
-	Links     []string
+	Links []string
+	// links name and dag size, same order as Links
+	LinkNames []string
+	LinkSizes []uint64
 	BlockSize int
 	LinksSize uint64
 
@@ -87,10 +391,13 @@ type CacheResultInfo struct {
 // CacheDataInfo Cache Data Info
 type CacheDataInfo struct {
 	Cid             string
-	NeedReliability int // 预期可靠性
-	CurReliability  int // 当前可靠性
-	TotalSize       int // 总大小
-	Blocks          int // 总block个数
+	RootCid         string // carfile root cid
+	Selector        string // 缓存的子图, 空为整个carfile
+	NeedReliability int    // 预期可靠性
+	CurReliability  int    // 当前可靠性
+	TotalSize       int    // 总大小
+	Blocks          int    // 总block个数
+	Owner           string // tenant of the carfile, empty is owned by admin
 
 	CacheInfos []CacheInfo
 }
@@ -120,6 +427,10 @@ type DownloadStat struct {
 	BlockSize     int
 	DownloadSpeed int64
 	ClientIP      string
+	// blocks of the batch download, Cid is the root or first block
+	Blocks int
+	// hour of the stat aggregated by node, 2006-01-02 15
+	Hour string
 }
 
 type DownloadServerAccessAuth struct {
@@ -2,20 +2,154 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/linguohua/titan/api"
 
 	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/gorilla/websocket"
 
 	"github.com/linguohua/titan/lib/rpcenc"
 )
 
+var (
+	// tls config with the certificate of the node
+	tlsConfig *tls.Config
+
+	addrTLSLock sync.RWMutex
+	// host:port:tls config, the peers at the addresses are checked by the config
+	addrTLSConfigs = make(map[string]*tls.Config)
+
+	useDialerOnce sync.Once
+)
+
+// Dialer websocket dialer of titan clients, the tls connections are dialed with the config set for the address
+var Dialer = &websocket.Dialer{
+	Proxy:             http.ProxyFromEnvironment,
+	HandshakeTimeout:  45 * time.Second,
+	NetDialTLSContext: dialTLS,
+}
+
+// useDialer jsonrpc only dial websocket by websocket.DefaultDialer, it is replaced by Dialer
+// once the process set tls config for the rpc addresses, the default dialer itself is not changed
+func useDialer() {
+	useDialerOnce.Do(func() {
+		websocket.DefaultDialer = Dialer
+	})
+}
+
+// SetTLSConfig tls config with the certificate of the node, it is not used by rpc clients until set for the addresses
+func SetTLSConfig(cfg *tls.Config) {
+	tlsConfig = cfg
+}
+
+// TLSConfig tls config set by SetTLSConfig, it trust the scheduler ca which issue the download certificates
+func TLSConfig() *tls.Config {
+	return tlsConfig
+}
+
+// SetAddrTLSConfig tls config for the rpc clients connect to the url, nil config remove it,
+// url not in tls is ignored
+func SetAddrTLSConfig(rawURL string, cfg *tls.Config) {
+	addr, ok := tlsHostPort(rawURL)
+	if !ok {
+		return
+	}
+
+	addrTLSLock.Lock()
+	defer addrTLSLock.Unlock()
+
+	if cfg == nil {
+		delete(addrTLSConfigs, addr)
+		return
+	}
+
+	addrTLSConfigs[addr] = cfg
+	useDialer()
+}
+
+// tlsHostPort host:port of the tls url
+func tlsHostPort(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+
+	if u.Scheme != "https" && u.Scheme != "wss" {
+		return "", false
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), true
+}
+
+// dialTLS addresses without config are verified by the system roots
+func dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrTLSLock.RLock()
+	cfg, ok := addrTLSConfigs[addr]
+	addrTLSLock.RUnlock()
+
+	if ok {
+		cfg = cfg.Clone()
+	} else {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	dialer := &tls.Dialer{Config: cfg}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// TLSURL url of the tls rpc
+func TLSURL(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "https"
+	}
+
+	return u.String()
+}
+
+// tls rpc go through websocket, http client of jsonrpc can not set tls config
+func tlsAddr(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme != "https" {
+		return addr
+	}
+
+	u.Scheme = "wss"
+	return u.String()
+}
+
 // NewScheduler creates a new http jsonrpc client.
 func NewScheduler(ctx context.Context, addr string, requestHeader http.Header) (api.Scheduler, jsonrpc.ClientCloser, error) {
+	addr = tlsAddr(addr)
+
 	var res api.SchedulerStruct
 
 	closer, err := jsonrpc.NewMergeClient(ctx, addr, "titan",
@@ -43,6 +177,7 @@ func getPushUrl(addr string) (string, error) {
 
 // NewCandicate creates a new http jsonrpc client for miner
 func NewCandicate(ctx context.Context, addr string, requestHeader http.Header, opts ...jsonrpc.Option) (api.Candidate, jsonrpc.ClientCloser, error) {
+	addr = tlsAddr(addr)
 	pushUrl, err := getPushUrl(addr)
 	if err != nil {
 		return nil, nil, err
@@ -59,6 +194,7 @@ func NewCandicate(ctx context.Context, addr string, requestHeader http.Header, o
 }
 
 func NewEdge(ctx context.Context, addr string, requestHeader http.Header) (api.Edge, jsonrpc.ClientCloser, error) {
+	addr = tlsAddr(addr)
 	pushUrl, err := getPushUrl(addr)
 	if err != nil {
 		return nil, nil, err
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// the default dialer before any test
+var defaultDialer = websocket.DefaultDialer
+
+func TestTLSHostPort(t *testing.T) {
+	cases := []struct {
+		url  string
+		addr string
+		ok   bool
+	}{
+		{"https://1.2.3.4:3456/rpc/v0", "1.2.3.4:3456", true},
+		{"wss://1.2.3.4:3456/rpc/v0", "1.2.3.4:3456", true},
+		{"https://example.com/rpc/v0", "example.com:443", true},
+		{"wss://[::1]/rpc/v0", "[::1]:443", true},
+		{"http://1.2.3.4:3456/rpc/v0", "", false},
+		{"ws://1.2.3.4:3456/rpc/v0", "", false},
+	}
+
+	for _, c := range cases {
+		addr, ok := tlsHostPort(c.url)
+		if addr != c.addr || ok != c.ok {
+			t.Errorf("%s: got %s,%v, want %s,%v", c.url, addr, ok, c.addr, c.ok)
+		}
+	}
+}
+
+func TestSetAddrTLSConfig(t *testing.T) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	SetAddrTLSConfig("https://1.2.3.4:3456/rpc/v0", cfg)
+	SetAddrTLSConfig("http://1.2.3.4:3457/rpc/v0", cfg)
+	if addrTLSConfigs["1.2.3.4:3456"] != cfg || len(addrTLSConfigs) != 1 {
+		t.Errorf("configs %v", addrTLSConfigs)
+	}
+
+	SetAddrTLSConfig("wss://1.2.3.4:3456/rpc/v0", nil)
+	if len(addrTLSConfigs) != 0 {
+		t.Error("config of the address is not removed")
+	}
+}
+
+func TestUseDialer(t *testing.T) {
+	SetAddrTLSConfig("https://1.2.3.4:3456/rpc/v0", &tls.Config{})
+	defer SetAddrTLSConfig("https://1.2.3.4:3456/rpc/v0", nil)
+
+	if websocket.DefaultDialer != Dialer {
+		t.Error("rpc clients do not dial by the titan dialer")
+	}
+
+	if defaultDialer.NetDialTLSContext != nil || defaultDialer.TLSClientConfig != nil {
+		t.Error("the default dialer of websocket is changed")
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"strings"
+
 	"github.com/filecoin-project/go-jsonrpc/auth"
 )
 
@@ -13,9 +15,43 @@ const (
 	PermAdmin auth.Permission = "admin" // Manage permissions
 )
 
+// the tenant of the token, it is not a method permission
+const tenantPermPrefix = "tenant:"
+
+// the node the token is issued to by scheduler, it is not a method permission
+const nodePermPrefix = "node:"
+
 var AllPermissions = []auth.Permission{PermRead, PermWrite, PermSign, PermAdmin}
 var DefaultPerms = []auth.Permission{PermRead}
 
+// TenantPermission add it to the permissions of AuthNew to create token of the tenant
+func TenantPermission(tenantID string) auth.Permission {
+	return auth.Permission(tenantPermPrefix + tenantID)
+}
+
+// TenantOfPermission tenant id of the permission, empty if it is not a tenant permission
+func TenantOfPermission(perm auth.Permission) string {
+	if !strings.HasPrefix(string(perm), tenantPermPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(string(perm), tenantPermPrefix)
+}
+
+// NodePermission add it to the permissions of AuthNew to create token only for calling the node
+func NodePermission(deviceID string) auth.Permission {
+	return auth.Permission(nodePermPrefix + deviceID)
+}
+
+// NodeOfPermission device id of the permission, empty if it is not a node permission
+func NodeOfPermission(perm auth.Permission) string {
+	if !strings.HasPrefix(string(perm), nodePermPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(string(perm), nodePermPrefix)
+}
+
 func permissionedProxies(in, out interface{}) {
 	outs := GetInternalStructs(out)
 	for _, o := range outs {
@@ -63,6 +63,10 @@ type CandidateStruct struct {
 
 	Internal struct {
 
+		AllowRelay func(p0 context.Context, p1 string, p2 string) (error) `perm:"admin"`
+
+		CheckReachability func(p0 context.Context, p1 []string) ([]bool, error) `perm:"write"`
+
 		ValidateBlocks func(p0 context.Context, p1 []ReqValidate) (error) `perm:"read"`
 
 		WaitQuiet func(p0 context.Context) (error) `perm:"read"`
@@ -138,6 +142,12 @@ type DownloadStruct struct {
 
 		GetDownloadInfo func(p0 context.Context) (DownloadInfo, error) `perm:"read"`
 
+		GetDownloadStats func(p0 context.Context, p1 int) (DownloadStatsInfo, error) `perm:"read"`
+
+		SetDenylist func(p0 context.Context, p1 Denylist) (error) `perm:"admin"`
+
+		SetDownloadLimits func(p0 context.Context, p1 DownloadLimits) (error) `perm:"admin"`
+
 		SetDownloadSpeed func(p0 context.Context, p1 int64) (error) `perm:"write"`
 
 	}
@@ -188,7 +198,7 @@ type LocatorStruct struct {
 
 		AddAccessPoints func(p0 context.Context, p1 string, p2 string, p3 int, p4 string) (error) `perm:"admin"`
 
-		DeviceOffline func(p0 context.Context, p1 string) (error) `perm:"write"`
+		DeviceOffline func(p0 context.Context, p1 string, p2 int) (error) `perm:"write"`
 
 		DeviceOnline func(p0 context.Context, p1 string, p2 string, p3 int) (error) `perm:"write"`
 
@@ -200,8 +210,14 @@ type LocatorStruct struct {
 
 		GetDownloadInfosWithBlocks func(p0 context.Context, p1 []string) (map[string][]DownloadInfo, error) `perm:"read"`
 
+		GetDownloadTicket func(p0 context.Context, p1 DownloadTicketReq) (DownloadInfo, error) `perm:"read"`
+
+		GetDownloadTickets func(p0 context.Context, p1 DownloadTicketReq, p2 int) ([]DownloadInfo, error) `perm:"read"`
+
 		ListAccessPoints func(p0 context.Context) ([]string, error) `perm:"admin"`
 
+		LookupIPGeo func(p0 context.Context, p1 string) (IPGeoInfo, error) `perm:"read"`
+
 		RemoveAccessPoints func(p0 context.Context, p1 string) (error) `perm:"admin"`
 
 		ShowAccessPoint func(p0 context.Context, p1 string) (AccessPoint, error) `perm:"admin"`
@@ -221,9 +237,17 @@ type SchedulerStruct struct {
 
 	Internal struct {
 
-		CacheCarfile func(p0 context.Context, p1 string, p2 int) (error) `perm:"admin"`
+		AddDenylist func(p0 context.Context, p1 []string, p2 string) (int64, error) `perm:"admin"`
+
+		AddIPAllowlist func(p0 context.Context, p1 IPAllowlist) (error) `perm:"admin"`
+
+		AddNodeRestriction func(p0 context.Context, p1 NodeRestriction) (error) `perm:"admin"`
+
+		BindDeviceUser func(p0 context.Context, p1 string, p2 string) (error) `perm:"admin"`
+
+		CacheCarfile func(p0 context.Context, p1 string, p2 int, p3 string) (error) `perm:"read"`
 
-		CacheContinue func(p0 context.Context, p1 string, p2 string) (error) `perm:"admin"`
+		CacheContinue func(p0 context.Context, p1 string, p2 string) (error) `perm:"read"`
 
 		CacheResult func(p0 context.Context, p1 string, p2 CacheResultInfo) (string, error) `perm:"write"`
 
@@ -235,12 +259,22 @@ type SchedulerStruct struct {
 
 		EdgeNodeConnect func(p0 context.Context, p1 int, p2 string) (string, error) `perm:"write"`
 
+		EdgeNodeReverseConnect func(p0 context.Context, p1 string) (ReverseConnectInfo, error) `perm:"write"`
+
 		ElectionValidators func(p0 context.Context) (error) `perm:"admin"`
 
 		FindNodeWithBlock func(p0 context.Context, p1 string) (string, error) `perm:"read"`
 
+		GetAppDownloadUsages func(p0 context.Context, p1 string) ([]AppDownloadUsage, error) `perm:"read"`
+
+		GetDenylist func(p0 context.Context, p1 int64) (Denylist, error) `perm:"read"`
+
+		GetDeviceIncome func(p0 context.Context, p1 string) (IncomeDailyRes, error) `perm:"read"`
+
 		GetDevicesInfo func(p0 context.Context, p1 string) (DevicesInfo, error) `perm:"read"`
 
+		GetDownloadCert func(p0 context.Context, p1 string, p2 string, p3 []byte) (DownloadCertInfo, error) `perm:"write"`
+
 		GetDownloadInfo func(p0 context.Context, p1 string) ([]*BlockDownloadInfo, error) `perm:"read"`
 
 		GetDownloadInfoWithBlock func(p0 context.Context, p1 string) (DownloadInfo, error) `perm:"read"`
@@ -249,23 +283,91 @@ type SchedulerStruct struct {
 
 		GetDownloadInfosWithBlocks func(p0 context.Context, p1 []string) (map[string][]DownloadInfo, error) `perm:"read"`
 
+		GetDownloadLimits func(p0 context.Context) (DownloadLimits, error) `perm:"read"`
+
+		GetDownloadTicket func(p0 context.Context, p1 DownloadTicketReq) (DownloadInfo, error) `perm:"read"`
+
+		GetDownloadTickets func(p0 context.Context, p1 DownloadTicketReq, p2 int) ([]DownloadInfo, error) `perm:"read"`
+
+		GetDownloadTicketsWithBlocks func(p0 context.Context, p1 DownloadTicketReq, p2 int) (map[string][]DownloadInfo, error) `perm:"read"`
+
+		GetDownloadViolations func(p0 context.Context, p1 string, p2 int) ([]DownloadViolation, error) `perm:"read"`
+
+		GetHourDataOfDaily func(p0 context.Context, p1 string, p2 string) (HourDataOfDaily, error) `perm:"read"`
+
+		GetIncomeDaily func(p0 context.Context, p1 string, p2 string) (IncomeDaily, error) `perm:"read"`
+
+		GetNodeCert func(p0 context.Context, p1 string, p2 string, p3 []byte) (NodeCertInfo, error) `perm:"write"`
+
+		GetNodeReachability func(p0 context.Context, p1 string) (NodeReachability, error) `perm:"read"`
+
 		GetOnlineDeviceIDs func(p0 context.Context, p1 NodeTypeName) ([]string, error) `perm:"read"`
 
+		GetReputationRanking func(p0 context.Context, p1 NodeTypeName, p2 int) ([]ReputationInfo, error) `perm:"read"`
+
+		GetRewardFormula func(p0 context.Context) (RewardFormula, error) `perm:"read"`
+
+		GetSchedulerLoad func(p0 context.Context) (SchedulerLoad, error) `perm:"read"`
+
+		GetTenantUsage func(p0 context.Context, p1 string, p2 string) (TenantUsage, error) `perm:"read"`
+
+		GetTicketPublicKey func(p0 context.Context) ([]byte, error) `perm:"read"`
+
 		GetToken func(p0 context.Context, p1 string, p2 string) (string, error) `perm:"write"`
 
+		GetUserIncome func(p0 context.Context, p1 string) (IndexPageRes, error) `perm:"read"`
+
+		ListAreaPolicies func(p0 context.Context) ([]AreaPolicy, error) `perm:"read"`
+
 		ListDatas func(p0 context.Context, p1 int) (DataListInfo, error) `perm:"read"`
 
+		ListDenylist func(p0 context.Context) ([]DenylistEntry, error) `perm:"read"`
+
+		ListIPAllowlists func(p0 context.Context) ([]IPAllowlist, error) `perm:"read"`
+
+		ListNodeRestrictionLogs func(p0 context.Context, p1 string, p2 int) ([]NodeRestrictionLog, error) `perm:"admin"`
+
+		ListNodeRestrictions func(p0 context.Context) ([]NodeRestriction, error) `perm:"read"`
+
+		ListTenants func(p0 context.Context) ([]Tenant, error) `perm:"admin"`
+
 		LocatorConnect func(p0 context.Context, p1 int, p2 string, p3 string, p4 string) (error) `perm:"write"`
 
+		LookupIPGeo func(p0 context.Context, p1 string) (IPGeoInfo, error) `perm:"read"`
+
+		ProbeNodeReachability func(p0 context.Context, p1 string) (NodeReachability, error) `perm:"admin"`
+
 		QueryCacheStatWithNode func(p0 context.Context, p1 string) ([]CacheStat, error) `perm:"read"`
 
 		QueryCachingBlocksWithNode func(p0 context.Context, p1 string) (CachingBlockList, error) `perm:"read"`
 
 		RegisterNode func(p0 context.Context, p1 NodeType) (NodeRegisterInfo, error) `perm:"admin"`
 
-		RemoveCache func(p0 context.Context, p1 string, p2 string) (error) `perm:"admin"`
+		RemoveAreaPolicy func(p0 context.Context, p1 string) (error) `perm:"admin"`
+
+		RemoveCache func(p0 context.Context, p1 string, p2 string) (error) `perm:"read"`
+
+		RemoveCarfile func(p0 context.Context, p1 string) (error) `perm:"read"`
+
+		RemoveDenylist func(p0 context.Context, p1 []string) (int64, error) `perm:"admin"`
+
+		RemoveIPAllowlist func(p0 context.Context, p1 string) (error) `perm:"admin"`
+
+		RemoveNodeRestriction func(p0 context.Context, p1 string, p2 string) (error) `perm:"admin"`
+
+		ResignLeader func(p0 context.Context) (error) `perm:"admin"`
 
-		RemoveCarfile func(p0 context.Context, p1 string) (error) `perm:"admin"`
+		RevokeNodeSecret func(p0 context.Context, p1 string) (error) `perm:"admin"`
+
+		RotateNodeSecret func(p0 context.Context, p1 string) (NodeRegisterInfo, error) `perm:"admin"`
+
+		SetAreaPolicy func(p0 context.Context, p1 AreaPolicy) (error) `perm:"admin"`
+
+		SetDownloadLimits func(p0 context.Context, p1 DownloadLimits) (error) `perm:"admin"`
+
+		SetRewardFormula func(p0 context.Context, p1 RewardFormula) (error) `perm:"admin"`
+
+		SetTenant func(p0 context.Context, p1 Tenant) (error) `perm:"admin"`
 
 		ShowDataTask func(p0 context.Context, p1 string) (CacheDataInfo, error) `perm:"read"`
 
@@ -273,6 +375,12 @@ type SchedulerStruct struct {
 
 		StateNetwork func(p0 context.Context) (StateNetwork, error) `perm:"read"`
 
+		SubmitDownloadReceipts func(p0 context.Context, p1 string, p2 []DownloadReceipt) (DownloadReceiptResult, error) `perm:"write"`
+
+		SubmitDownloadStats func(p0 context.Context, p1 string, p2 []DownloadStat) (error) `perm:"write"`
+
+		SubmitDownloadUsage func(p0 context.Context, p1 string, p2 DownloadUsageReport) (error) `perm:"write"`
+
 		UpdateDownloadServerAccessAuth func(p0 context.Context, p1 DownloadServerAccessAuth) (error) `perm:"write"`
 
 		Validate func(p0 context.Context) (error) `perm:"admin"`
@@ -442,6 +550,28 @@ func (s *BlockStub) ScrubBlocks(p0 context.Context, p1 ScrubBlocks) (error) {
 
 
 
+func (s *CandidateStruct) AllowRelay(p0 context.Context, p1 string, p2 string) (error) {
+	if s.Internal.AllowRelay == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.AllowRelay(p0, p1, p2)
+}
+
+func (s *CandidateStub) AllowRelay(p0 context.Context, p1 string, p2 string) (error) {
+	return ErrNotSupported
+}
+
+func (s *CandidateStruct) CheckReachability(p0 context.Context, p1 []string) ([]bool, error) {
+	if s.Internal.CheckReachability == nil {
+		return *new([]bool), ErrNotSupported
+	}
+	return s.Internal.CheckReachability(p0, p1)
+}
+
+func (s *CandidateStub) CheckReachability(p0 context.Context, p1 []string) ([]bool, error) {
+	return *new([]bool), ErrNotSupported
+}
+
 func (s *CandidateStruct) ValidateBlocks(p0 context.Context, p1 []ReqValidate) (error) {
 	if s.Internal.ValidateBlocks == nil {
 		return ErrNotSupported
@@ -627,6 +757,39 @@ func (s *DownloadStub) GetDownloadInfo(p0 context.Context) (DownloadInfo, error)
 	return *new(DownloadInfo), ErrNotSupported
 }
 
+func (s *DownloadStruct) GetDownloadStats(p0 context.Context, p1 int) (DownloadStatsInfo, error) {
+	if s.Internal.GetDownloadStats == nil {
+		return *new(DownloadStatsInfo), ErrNotSupported
+	}
+	return s.Internal.GetDownloadStats(p0, p1)
+}
+
+func (s *DownloadStub) GetDownloadStats(p0 context.Context, p1 int) (DownloadStatsInfo, error) {
+	return *new(DownloadStatsInfo), ErrNotSupported
+}
+
+func (s *DownloadStruct) SetDenylist(p0 context.Context, p1 Denylist) (error) {
+	if s.Internal.SetDenylist == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.SetDenylist(p0, p1)
+}
+
+func (s *DownloadStub) SetDenylist(p0 context.Context, p1 Denylist) (error) {
+	return ErrNotSupported
+}
+
+func (s *DownloadStruct) SetDownloadLimits(p0 context.Context, p1 DownloadLimits) (error) {
+	if s.Internal.SetDownloadLimits == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.SetDownloadLimits(p0, p1)
+}
+
+func (s *DownloadStub) SetDownloadLimits(p0 context.Context, p1 DownloadLimits) (error) {
+	return ErrNotSupported
+}
+
 func (s *DownloadStruct) SetDownloadSpeed(p0 context.Context, p1 int64) (error) {
 	if s.Internal.SetDownloadSpeed == nil {
 		return ErrNotSupported
@@ -666,14 +829,14 @@ func (s *LocatorStub) AddAccessPoints(p0 context.Context, p1 string, p2 string,
 	return ErrNotSupported
 }
 
-func (s *LocatorStruct) DeviceOffline(p0 context.Context, p1 string) (error) {
+func (s *LocatorStruct) DeviceOffline(p0 context.Context, p1 string, p2 int) (error) {
 	if s.Internal.DeviceOffline == nil {
 		return ErrNotSupported
 	}
-	return s.Internal.DeviceOffline(p0, p1)
+	return s.Internal.DeviceOffline(p0, p1, p2)
 }
 
-func (s *LocatorStub) DeviceOffline(p0 context.Context, p1 string) (error) {
+func (s *LocatorStub) DeviceOffline(p0 context.Context, p1 string, p2 int) (error) {
 	return ErrNotSupported
 }
 
@@ -732,6 +895,28 @@ func (s *LocatorStub) GetDownloadInfosWithBlocks(p0 context.Context, p1 []string
 	return *new(map[string][]DownloadInfo), ErrNotSupported
 }
 
+func (s *LocatorStruct) GetDownloadTicket(p0 context.Context, p1 DownloadTicketReq) (DownloadInfo, error) {
+	if s.Internal.GetDownloadTicket == nil {
+		return *new(DownloadInfo), ErrNotSupported
+	}
+	return s.Internal.GetDownloadTicket(p0, p1)
+}
+
+func (s *LocatorStub) GetDownloadTicket(p0 context.Context, p1 DownloadTicketReq) (DownloadInfo, error) {
+	return *new(DownloadInfo), ErrNotSupported
+}
+
+func (s *LocatorStruct) GetDownloadTickets(p0 context.Context, p1 DownloadTicketReq, p2 int) ([]DownloadInfo, error) {
+	if s.Internal.GetDownloadTickets == nil {
+		return *new([]DownloadInfo), ErrNotSupported
+	}
+	return s.Internal.GetDownloadTickets(p0, p1, p2)
+}
+
+func (s *LocatorStub) GetDownloadTickets(p0 context.Context, p1 DownloadTicketReq, p2 int) ([]DownloadInfo, error) {
+	return *new([]DownloadInfo), ErrNotSupported
+}
+
 func (s *LocatorStruct) ListAccessPoints(p0 context.Context) ([]string, error) {
 	if s.Internal.ListAccessPoints == nil {
 		return *new([]string), ErrNotSupported
@@ -743,6 +928,17 @@ func (s *LocatorStub) ListAccessPoints(p0 context.Context) ([]string, error) {
 	return *new([]string), ErrNotSupported
 }
 
+func (s *LocatorStruct) LookupIPGeo(p0 context.Context, p1 string) (IPGeoInfo, error) {
+	if s.Internal.LookupIPGeo == nil {
+		return *new(IPGeoInfo), ErrNotSupported
+	}
+	return s.Internal.LookupIPGeo(p0, p1)
+}
+
+func (s *LocatorStub) LookupIPGeo(p0 context.Context, p1 string) (IPGeoInfo, error) {
+	return *new(IPGeoInfo), ErrNotSupported
+}
+
 func (s *LocatorStruct) RemoveAccessPoints(p0 context.Context, p1 string) (error) {
 	if s.Internal.RemoveAccessPoints == nil {
 		return ErrNotSupported
@@ -768,14 +964,58 @@ func (s *LocatorStub) ShowAccessPoint(p0 context.Context, p1 string) (AccessPoin
 
 
 
-func (s *SchedulerStruct) CacheCarfile(p0 context.Context, p1 string, p2 int) (error) {
+func (s *SchedulerStruct) AddDenylist(p0 context.Context, p1 []string, p2 string) (int64, error) {
+	if s.Internal.AddDenylist == nil {
+		return 0, ErrNotSupported
+	}
+	return s.Internal.AddDenylist(p0, p1, p2)
+}
+
+func (s *SchedulerStub) AddDenylist(p0 context.Context, p1 []string, p2 string) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+func (s *SchedulerStruct) AddIPAllowlist(p0 context.Context, p1 IPAllowlist) (error) {
+	if s.Internal.AddIPAllowlist == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.AddIPAllowlist(p0, p1)
+}
+
+func (s *SchedulerStub) AddIPAllowlist(p0 context.Context, p1 IPAllowlist) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) AddNodeRestriction(p0 context.Context, p1 NodeRestriction) (error) {
+	if s.Internal.AddNodeRestriction == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.AddNodeRestriction(p0, p1)
+}
+
+func (s *SchedulerStub) AddNodeRestriction(p0 context.Context, p1 NodeRestriction) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) BindDeviceUser(p0 context.Context, p1 string, p2 string) (error) {
+	if s.Internal.BindDeviceUser == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.BindDeviceUser(p0, p1, p2)
+}
+
+func (s *SchedulerStub) BindDeviceUser(p0 context.Context, p1 string, p2 string) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) CacheCarfile(p0 context.Context, p1 string, p2 int, p3 string) (error) {
 	if s.Internal.CacheCarfile == nil {
 		return ErrNotSupported
 	}
-	return s.Internal.CacheCarfile(p0, p1, p2)
+	return s.Internal.CacheCarfile(p0, p1, p2, p3)
 }
 
-func (s *SchedulerStub) CacheCarfile(p0 context.Context, p1 string, p2 int) (error) {
+func (s *SchedulerStub) CacheCarfile(p0 context.Context, p1 string, p2 int, p3 string) (error) {
 	return ErrNotSupported
 }
 
@@ -845,6 +1085,17 @@ func (s *SchedulerStub) EdgeNodeConnect(p0 context.Context, p1 int, p2 string) (
 	return "", ErrNotSupported
 }
 
+func (s *SchedulerStruct) EdgeNodeReverseConnect(p0 context.Context, p1 string) (ReverseConnectInfo, error) {
+	if s.Internal.EdgeNodeReverseConnect == nil {
+		return *new(ReverseConnectInfo), ErrNotSupported
+	}
+	return s.Internal.EdgeNodeReverseConnect(p0, p1)
+}
+
+func (s *SchedulerStub) EdgeNodeReverseConnect(p0 context.Context, p1 string) (ReverseConnectInfo, error) {
+	return *new(ReverseConnectInfo), ErrNotSupported
+}
+
 func (s *SchedulerStruct) ElectionValidators(p0 context.Context) (error) {
 	if s.Internal.ElectionValidators == nil {
 		return ErrNotSupported
@@ -867,6 +1118,39 @@ func (s *SchedulerStub) FindNodeWithBlock(p0 context.Context, p1 string) (string
 	return "", ErrNotSupported
 }
 
+func (s *SchedulerStruct) GetAppDownloadUsages(p0 context.Context, p1 string) ([]AppDownloadUsage, error) {
+	if s.Internal.GetAppDownloadUsages == nil {
+		return *new([]AppDownloadUsage), ErrNotSupported
+	}
+	return s.Internal.GetAppDownloadUsages(p0, p1)
+}
+
+func (s *SchedulerStub) GetAppDownloadUsages(p0 context.Context, p1 string) ([]AppDownloadUsage, error) {
+	return *new([]AppDownloadUsage), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetDenylist(p0 context.Context, p1 int64) (Denylist, error) {
+	if s.Internal.GetDenylist == nil {
+		return *new(Denylist), ErrNotSupported
+	}
+	return s.Internal.GetDenylist(p0, p1)
+}
+
+func (s *SchedulerStub) GetDenylist(p0 context.Context, p1 int64) (Denylist, error) {
+	return *new(Denylist), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetDeviceIncome(p0 context.Context, p1 string) (IncomeDailyRes, error) {
+	if s.Internal.GetDeviceIncome == nil {
+		return *new(IncomeDailyRes), ErrNotSupported
+	}
+	return s.Internal.GetDeviceIncome(p0, p1)
+}
+
+func (s *SchedulerStub) GetDeviceIncome(p0 context.Context, p1 string) (IncomeDailyRes, error) {
+	return *new(IncomeDailyRes), ErrNotSupported
+}
+
 func (s *SchedulerStruct) GetDevicesInfo(p0 context.Context, p1 string) (DevicesInfo, error) {
 	if s.Internal.GetDevicesInfo == nil {
 		return *new(DevicesInfo), ErrNotSupported
@@ -878,6 +1162,17 @@ func (s *SchedulerStub) GetDevicesInfo(p0 context.Context, p1 string) (DevicesIn
 	return *new(DevicesInfo), ErrNotSupported
 }
 
+func (s *SchedulerStruct) GetDownloadCert(p0 context.Context, p1 string, p2 string, p3 []byte) (DownloadCertInfo, error) {
+	if s.Internal.GetDownloadCert == nil {
+		return *new(DownloadCertInfo), ErrNotSupported
+	}
+	return s.Internal.GetDownloadCert(p0, p1, p2, p3)
+}
+
+func (s *SchedulerStub) GetDownloadCert(p0 context.Context, p1 string, p2 string, p3 []byte) (DownloadCertInfo, error) {
+	return *new(DownloadCertInfo), ErrNotSupported
+}
+
 func (s *SchedulerStruct) GetDownloadInfo(p0 context.Context, p1 string) ([]*BlockDownloadInfo, error) {
 	if s.Internal.GetDownloadInfo == nil {
 		return *new([]*BlockDownloadInfo), ErrNotSupported
@@ -922,6 +1217,105 @@ func (s *SchedulerStub) GetDownloadInfosWithBlocks(p0 context.Context, p1 []stri
 	return *new(map[string][]DownloadInfo), ErrNotSupported
 }
 
+func (s *SchedulerStruct) GetDownloadLimits(p0 context.Context) (DownloadLimits, error) {
+	if s.Internal.GetDownloadLimits == nil {
+		return *new(DownloadLimits), ErrNotSupported
+	}
+	return s.Internal.GetDownloadLimits(p0)
+}
+
+func (s *SchedulerStub) GetDownloadLimits(p0 context.Context) (DownloadLimits, error) {
+	return *new(DownloadLimits), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetDownloadTicket(p0 context.Context, p1 DownloadTicketReq) (DownloadInfo, error) {
+	if s.Internal.GetDownloadTicket == nil {
+		return *new(DownloadInfo), ErrNotSupported
+	}
+	return s.Internal.GetDownloadTicket(p0, p1)
+}
+
+func (s *SchedulerStub) GetDownloadTicket(p0 context.Context, p1 DownloadTicketReq) (DownloadInfo, error) {
+	return *new(DownloadInfo), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetDownloadTickets(p0 context.Context, p1 DownloadTicketReq, p2 int) ([]DownloadInfo, error) {
+	if s.Internal.GetDownloadTickets == nil {
+		return *new([]DownloadInfo), ErrNotSupported
+	}
+	return s.Internal.GetDownloadTickets(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetDownloadTickets(p0 context.Context, p1 DownloadTicketReq, p2 int) ([]DownloadInfo, error) {
+	return *new([]DownloadInfo), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetDownloadTicketsWithBlocks(p0 context.Context, p1 DownloadTicketReq, p2 int) (map[string][]DownloadInfo, error) {
+	if s.Internal.GetDownloadTicketsWithBlocks == nil {
+		return *new(map[string][]DownloadInfo), ErrNotSupported
+	}
+	return s.Internal.GetDownloadTicketsWithBlocks(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetDownloadTicketsWithBlocks(p0 context.Context, p1 DownloadTicketReq, p2 int) (map[string][]DownloadInfo, error) {
+	return *new(map[string][]DownloadInfo), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetDownloadViolations(p0 context.Context, p1 string, p2 int) ([]DownloadViolation, error) {
+	if s.Internal.GetDownloadViolations == nil {
+		return *new([]DownloadViolation), ErrNotSupported
+	}
+	return s.Internal.GetDownloadViolations(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetDownloadViolations(p0 context.Context, p1 string, p2 int) ([]DownloadViolation, error) {
+	return *new([]DownloadViolation), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetHourDataOfDaily(p0 context.Context, p1 string, p2 string) (HourDataOfDaily, error) {
+	if s.Internal.GetHourDataOfDaily == nil {
+		return *new(HourDataOfDaily), ErrNotSupported
+	}
+	return s.Internal.GetHourDataOfDaily(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetHourDataOfDaily(p0 context.Context, p1 string, p2 string) (HourDataOfDaily, error) {
+	return *new(HourDataOfDaily), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetIncomeDaily(p0 context.Context, p1 string, p2 string) (IncomeDaily, error) {
+	if s.Internal.GetIncomeDaily == nil {
+		return *new(IncomeDaily), ErrNotSupported
+	}
+	return s.Internal.GetIncomeDaily(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetIncomeDaily(p0 context.Context, p1 string, p2 string) (IncomeDaily, error) {
+	return *new(IncomeDaily), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetNodeCert(p0 context.Context, p1 string, p2 string, p3 []byte) (NodeCertInfo, error) {
+	if s.Internal.GetNodeCert == nil {
+		return *new(NodeCertInfo), ErrNotSupported
+	}
+	return s.Internal.GetNodeCert(p0, p1, p2, p3)
+}
+
+func (s *SchedulerStub) GetNodeCert(p0 context.Context, p1 string, p2 string, p3 []byte) (NodeCertInfo, error) {
+	return *new(NodeCertInfo), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetNodeReachability(p0 context.Context, p1 string) (NodeReachability, error) {
+	if s.Internal.GetNodeReachability == nil {
+		return *new(NodeReachability), ErrNotSupported
+	}
+	return s.Internal.GetNodeReachability(p0, p1)
+}
+
+func (s *SchedulerStub) GetNodeReachability(p0 context.Context, p1 string) (NodeReachability, error) {
+	return *new(NodeReachability), ErrNotSupported
+}
+
 func (s *SchedulerStruct) GetOnlineDeviceIDs(p0 context.Context, p1 NodeTypeName) ([]string, error) {
 	if s.Internal.GetOnlineDeviceIDs == nil {
 		return *new([]string), ErrNotSupported
@@ -933,6 +1327,61 @@ func (s *SchedulerStub) GetOnlineDeviceIDs(p0 context.Context, p1 NodeTypeName)
 	return *new([]string), ErrNotSupported
 }
 
+func (s *SchedulerStruct) GetReputationRanking(p0 context.Context, p1 NodeTypeName, p2 int) ([]ReputationInfo, error) {
+	if s.Internal.GetReputationRanking == nil {
+		return *new([]ReputationInfo), ErrNotSupported
+	}
+	return s.Internal.GetReputationRanking(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetReputationRanking(p0 context.Context, p1 NodeTypeName, p2 int) ([]ReputationInfo, error) {
+	return *new([]ReputationInfo), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetRewardFormula(p0 context.Context) (RewardFormula, error) {
+	if s.Internal.GetRewardFormula == nil {
+		return *new(RewardFormula), ErrNotSupported
+	}
+	return s.Internal.GetRewardFormula(p0)
+}
+
+func (s *SchedulerStub) GetRewardFormula(p0 context.Context) (RewardFormula, error) {
+	return *new(RewardFormula), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetSchedulerLoad(p0 context.Context) (SchedulerLoad, error) {
+	if s.Internal.GetSchedulerLoad == nil {
+		return *new(SchedulerLoad), ErrNotSupported
+	}
+	return s.Internal.GetSchedulerLoad(p0)
+}
+
+func (s *SchedulerStub) GetSchedulerLoad(p0 context.Context) (SchedulerLoad, error) {
+	return *new(SchedulerLoad), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetTenantUsage(p0 context.Context, p1 string, p2 string) (TenantUsage, error) {
+	if s.Internal.GetTenantUsage == nil {
+		return *new(TenantUsage), ErrNotSupported
+	}
+	return s.Internal.GetTenantUsage(p0, p1, p2)
+}
+
+func (s *SchedulerStub) GetTenantUsage(p0 context.Context, p1 string, p2 string) (TenantUsage, error) {
+	return *new(TenantUsage), ErrNotSupported
+}
+
+func (s *SchedulerStruct) GetTicketPublicKey(p0 context.Context) ([]byte, error) {
+	if s.Internal.GetTicketPublicKey == nil {
+		return *new([]byte), ErrNotSupported
+	}
+	return s.Internal.GetTicketPublicKey(p0)
+}
+
+func (s *SchedulerStub) GetTicketPublicKey(p0 context.Context) ([]byte, error) {
+	return *new([]byte), ErrNotSupported
+}
+
 func (s *SchedulerStruct) GetToken(p0 context.Context, p1 string, p2 string) (string, error) {
 	if s.Internal.GetToken == nil {
 		return "", ErrNotSupported
@@ -944,6 +1393,28 @@ func (s *SchedulerStub) GetToken(p0 context.Context, p1 string, p2 string) (stri
 	return "", ErrNotSupported
 }
 
+func (s *SchedulerStruct) GetUserIncome(p0 context.Context, p1 string) (IndexPageRes, error) {
+	if s.Internal.GetUserIncome == nil {
+		return *new(IndexPageRes), ErrNotSupported
+	}
+	return s.Internal.GetUserIncome(p0, p1)
+}
+
+func (s *SchedulerStub) GetUserIncome(p0 context.Context, p1 string) (IndexPageRes, error) {
+	return *new(IndexPageRes), ErrNotSupported
+}
+
+func (s *SchedulerStruct) ListAreaPolicies(p0 context.Context) ([]AreaPolicy, error) {
+	if s.Internal.ListAreaPolicies == nil {
+		return *new([]AreaPolicy), ErrNotSupported
+	}
+	return s.Internal.ListAreaPolicies(p0)
+}
+
+func (s *SchedulerStub) ListAreaPolicies(p0 context.Context) ([]AreaPolicy, error) {
+	return *new([]AreaPolicy), ErrNotSupported
+}
+
 func (s *SchedulerStruct) ListDatas(p0 context.Context, p1 int) (DataListInfo, error) {
 	if s.Internal.ListDatas == nil {
 		return *new(DataListInfo), ErrNotSupported
@@ -955,6 +1426,61 @@ func (s *SchedulerStub) ListDatas(p0 context.Context, p1 int) (DataListInfo, err
 	return *new(DataListInfo), ErrNotSupported
 }
 
+func (s *SchedulerStruct) ListDenylist(p0 context.Context) ([]DenylistEntry, error) {
+	if s.Internal.ListDenylist == nil {
+		return *new([]DenylistEntry), ErrNotSupported
+	}
+	return s.Internal.ListDenylist(p0)
+}
+
+func (s *SchedulerStub) ListDenylist(p0 context.Context) ([]DenylistEntry, error) {
+	return *new([]DenylistEntry), ErrNotSupported
+}
+
+func (s *SchedulerStruct) ListIPAllowlists(p0 context.Context) ([]IPAllowlist, error) {
+	if s.Internal.ListIPAllowlists == nil {
+		return *new([]IPAllowlist), ErrNotSupported
+	}
+	return s.Internal.ListIPAllowlists(p0)
+}
+
+func (s *SchedulerStub) ListIPAllowlists(p0 context.Context) ([]IPAllowlist, error) {
+	return *new([]IPAllowlist), ErrNotSupported
+}
+
+func (s *SchedulerStruct) ListNodeRestrictionLogs(p0 context.Context, p1 string, p2 int) ([]NodeRestrictionLog, error) {
+	if s.Internal.ListNodeRestrictionLogs == nil {
+		return *new([]NodeRestrictionLog), ErrNotSupported
+	}
+	return s.Internal.ListNodeRestrictionLogs(p0, p1, p2)
+}
+
+func (s *SchedulerStub) ListNodeRestrictionLogs(p0 context.Context, p1 string, p2 int) ([]NodeRestrictionLog, error) {
+	return *new([]NodeRestrictionLog), ErrNotSupported
+}
+
+func (s *SchedulerStruct) ListNodeRestrictions(p0 context.Context) ([]NodeRestriction, error) {
+	if s.Internal.ListNodeRestrictions == nil {
+		return *new([]NodeRestriction), ErrNotSupported
+	}
+	return s.Internal.ListNodeRestrictions(p0)
+}
+
+func (s *SchedulerStub) ListNodeRestrictions(p0 context.Context) ([]NodeRestriction, error) {
+	return *new([]NodeRestriction), ErrNotSupported
+}
+
+func (s *SchedulerStruct) ListTenants(p0 context.Context) ([]Tenant, error) {
+	if s.Internal.ListTenants == nil {
+		return *new([]Tenant), ErrNotSupported
+	}
+	return s.Internal.ListTenants(p0)
+}
+
+func (s *SchedulerStub) ListTenants(p0 context.Context) ([]Tenant, error) {
+	return *new([]Tenant), ErrNotSupported
+}
+
 func (s *SchedulerStruct) LocatorConnect(p0 context.Context, p1 int, p2 string, p3 string, p4 string) (error) {
 	if s.Internal.LocatorConnect == nil {
 		return ErrNotSupported
@@ -966,6 +1492,28 @@ func (s *SchedulerStub) LocatorConnect(p0 context.Context, p1 int, p2 string, p3
 	return ErrNotSupported
 }
 
+func (s *SchedulerStruct) LookupIPGeo(p0 context.Context, p1 string) (IPGeoInfo, error) {
+	if s.Internal.LookupIPGeo == nil {
+		return *new(IPGeoInfo), ErrNotSupported
+	}
+	return s.Internal.LookupIPGeo(p0, p1)
+}
+
+func (s *SchedulerStub) LookupIPGeo(p0 context.Context, p1 string) (IPGeoInfo, error) {
+	return *new(IPGeoInfo), ErrNotSupported
+}
+
+func (s *SchedulerStruct) ProbeNodeReachability(p0 context.Context, p1 string) (NodeReachability, error) {
+	if s.Internal.ProbeNodeReachability == nil {
+		return *new(NodeReachability), ErrNotSupported
+	}
+	return s.Internal.ProbeNodeReachability(p0, p1)
+}
+
+func (s *SchedulerStub) ProbeNodeReachability(p0 context.Context, p1 string) (NodeReachability, error) {
+	return *new(NodeReachability), ErrNotSupported
+}
+
 func (s *SchedulerStruct) QueryCacheStatWithNode(p0 context.Context, p1 string) ([]CacheStat, error) {
 	if s.Internal.QueryCacheStatWithNode == nil {
 		return *new([]CacheStat), ErrNotSupported
@@ -999,6 +1547,17 @@ func (s *SchedulerStub) RegisterNode(p0 context.Context, p1 NodeType) (NodeRegis
 	return *new(NodeRegisterInfo), ErrNotSupported
 }
 
+func (s *SchedulerStruct) RemoveAreaPolicy(p0 context.Context, p1 string) (error) {
+	if s.Internal.RemoveAreaPolicy == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.RemoveAreaPolicy(p0, p1)
+}
+
+func (s *SchedulerStub) RemoveAreaPolicy(p0 context.Context, p1 string) (error) {
+	return ErrNotSupported
+}
+
 func (s *SchedulerStruct) RemoveCache(p0 context.Context, p1 string, p2 string) (error) {
 	if s.Internal.RemoveCache == nil {
 		return ErrNotSupported
@@ -1021,6 +1580,116 @@ func (s *SchedulerStub) RemoveCarfile(p0 context.Context, p1 string) (error) {
 	return ErrNotSupported
 }
 
+func (s *SchedulerStruct) RemoveDenylist(p0 context.Context, p1 []string) (int64, error) {
+	if s.Internal.RemoveDenylist == nil {
+		return 0, ErrNotSupported
+	}
+	return s.Internal.RemoveDenylist(p0, p1)
+}
+
+func (s *SchedulerStub) RemoveDenylist(p0 context.Context, p1 []string) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+func (s *SchedulerStruct) RemoveIPAllowlist(p0 context.Context, p1 string) (error) {
+	if s.Internal.RemoveIPAllowlist == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.RemoveIPAllowlist(p0, p1)
+}
+
+func (s *SchedulerStub) RemoveIPAllowlist(p0 context.Context, p1 string) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) RemoveNodeRestriction(p0 context.Context, p1 string, p2 string) (error) {
+	if s.Internal.RemoveNodeRestriction == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.RemoveNodeRestriction(p0, p1, p2)
+}
+
+func (s *SchedulerStub) RemoveNodeRestriction(p0 context.Context, p1 string, p2 string) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) ResignLeader(p0 context.Context) (error) {
+	if s.Internal.ResignLeader == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.ResignLeader(p0)
+}
+
+func (s *SchedulerStub) ResignLeader(p0 context.Context) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) RevokeNodeSecret(p0 context.Context, p1 string) (error) {
+	if s.Internal.RevokeNodeSecret == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.RevokeNodeSecret(p0, p1)
+}
+
+func (s *SchedulerStub) RevokeNodeSecret(p0 context.Context, p1 string) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) RotateNodeSecret(p0 context.Context, p1 string) (NodeRegisterInfo, error) {
+	if s.Internal.RotateNodeSecret == nil {
+		return *new(NodeRegisterInfo), ErrNotSupported
+	}
+	return s.Internal.RotateNodeSecret(p0, p1)
+}
+
+func (s *SchedulerStub) RotateNodeSecret(p0 context.Context, p1 string) (NodeRegisterInfo, error) {
+	return *new(NodeRegisterInfo), ErrNotSupported
+}
+
+func (s *SchedulerStruct) SetAreaPolicy(p0 context.Context, p1 AreaPolicy) (error) {
+	if s.Internal.SetAreaPolicy == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.SetAreaPolicy(p0, p1)
+}
+
+func (s *SchedulerStub) SetAreaPolicy(p0 context.Context, p1 AreaPolicy) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) SetDownloadLimits(p0 context.Context, p1 DownloadLimits) (error) {
+	if s.Internal.SetDownloadLimits == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.SetDownloadLimits(p0, p1)
+}
+
+func (s *SchedulerStub) SetDownloadLimits(p0 context.Context, p1 DownloadLimits) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) SetRewardFormula(p0 context.Context, p1 RewardFormula) (error) {
+	if s.Internal.SetRewardFormula == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.SetRewardFormula(p0, p1)
+}
+
+func (s *SchedulerStub) SetRewardFormula(p0 context.Context, p1 RewardFormula) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) SetTenant(p0 context.Context, p1 Tenant) (error) {
+	if s.Internal.SetTenant == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.SetTenant(p0, p1)
+}
+
+func (s *SchedulerStub) SetTenant(p0 context.Context, p1 Tenant) (error) {
+	return ErrNotSupported
+}
+
 func (s *SchedulerStruct) ShowDataTask(p0 context.Context, p1 string) (CacheDataInfo, error) {
 	if s.Internal.ShowDataTask == nil {
 		return *new(CacheDataInfo), ErrNotSupported
@@ -1054,6 +1723,39 @@ func (s *SchedulerStub) StateNetwork(p0 context.Context) (StateNetwork, error) {
 	return *new(StateNetwork), ErrNotSupported
 }
 
+func (s *SchedulerStruct) SubmitDownloadReceipts(p0 context.Context, p1 string, p2 []DownloadReceipt) (DownloadReceiptResult, error) {
+	if s.Internal.SubmitDownloadReceipts == nil {
+		return *new(DownloadReceiptResult), ErrNotSupported
+	}
+	return s.Internal.SubmitDownloadReceipts(p0, p1, p2)
+}
+
+func (s *SchedulerStub) SubmitDownloadReceipts(p0 context.Context, p1 string, p2 []DownloadReceipt) (DownloadReceiptResult, error) {
+	return *new(DownloadReceiptResult), ErrNotSupported
+}
+
+func (s *SchedulerStruct) SubmitDownloadStats(p0 context.Context, p1 string, p2 []DownloadStat) (error) {
+	if s.Internal.SubmitDownloadStats == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.SubmitDownloadStats(p0, p1, p2)
+}
+
+func (s *SchedulerStub) SubmitDownloadStats(p0 context.Context, p1 string, p2 []DownloadStat) (error) {
+	return ErrNotSupported
+}
+
+func (s *SchedulerStruct) SubmitDownloadUsage(p0 context.Context, p1 string, p2 DownloadUsageReport) (error) {
+	if s.Internal.SubmitDownloadUsage == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.SubmitDownloadUsage(p0, p1, p2)
+}
+
+func (s *SchedulerStub) SubmitDownloadUsage(p0 context.Context, p1 string, p2 DownloadUsageReport) (error) {
+	return ErrNotSupported
+}
+
 func (s *SchedulerStruct) UpdateDownloadServerAccessAuth(p0 context.Context, p1 DownloadServerAccessAuth) (error) {
 	if s.Internal.UpdateDownloadServerAccessAuth == nil {
 		return ErrNotSupported
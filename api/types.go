@@ -58,6 +58,53 @@ type AllMinerInfo struct {
 
 type StateNetwork struct {
 	AllMinerInfo
+	// online nodes of each isp
+	ISPs []ISPStat `json:"isps"`
+}
+
+// ISPStat online nodes of the isp, isp empty is unknown
+type ISPStat struct {
+	ISP              string  `json:"isp"`
+	OnlineEdges      int     `json:"online_edges"`
+	OnlineCandidates int     `json:"online_candidates"`
+	BandwidthUp      float64 `json:"bandwidth_up"` // 上行带宽B/s
+}
+
+// nat type of the edge, classified by the reachability probe of scheduler and candidates
+const (
+	// NatTypeUnknown no candidate probed the edge
+	NatTypeUnknown = "Unknown"
+	// NatTypeNoNAT public ip, reachable from candidates
+	NatTypeNoNAT = "NoNAT"
+	// NatTypeFullCone behind nat, reachable from candidates
+	NatTypeFullCone = "FullCone"
+	// NatTypeRestricted reachable from scheduler only
+	NatTypeRestricted = "Restricted"
+	// NatTypeUnreachable reachable from none
+	NatTypeUnreachable = "Unreachable"
+)
+
+// NodeReachability result of the reachability probe
+type NodeReachability struct {
+	DeviceID string
+	NatType  string
+	// successful probes percent
+	NatRatio     float64
+	RPCAddr      string
+	DownloadAddr string
+	// probe of scheduler, rpc and download address
+	SchedulerProbe []bool
+	// candidate device id : probe of rpc and download address
+	CandidateProbes map[string][]bool
+	ProbeTime       time.Time
+}
+
+// ReverseConnectInfo the edge keep the tunnel to relay candidate, users download from the edge through the relay
+type ReverseConnectInfo struct {
+	ExternalIP string
+	// tunnel url of relay candidate, empty if no relay
+	RelayTunnelURL string
+	RelayKey       string
 }
 
 type IndexPageSearch struct {
@@ -182,6 +229,10 @@ type DevicesInfo struct {
 	BandwidthDown float64 `json:"bandwidth_down" redis:"BandwidthDown"` // 下行带宽B/s
 	TotalDownload float64 `json:"total_download" redis:"TotalDownload"` // 总下载数据 MiB
 	TotalUpload   float64 `json:"total_upload" redis:"TotalUpload"`     // 总上传数据 MiB
+	// rejected download receipts
+	SuspiciousCount int64 `json:"suspicious_count" redis:"SuspiciousCount"`
+	// reputation score 0-100
+	Reputation float64 `json:"reputation" redis:"Reputation"`
 }
 
 // TableName IndexPage
@@ -338,3 +389,18 @@ type BlockDownloadInfo struct {
 	Reward      int64     `json:"reward" db:"reward"`
 	CreatedTime time.Time `json:"createdAt" db:"created_time"`
 }
+
+// IPGeoInfo location and isp of ip
+type IPGeoInfo struct {
+	IP        string
+	Geo       string
+	Country   string
+	Province  string
+	City      string
+	ISP       string
+	ASN       uint
+	Latitude  float64
+	Longitude float64
+	// geo is from the override table
+	Overridden bool
+}
@@ -29,6 +29,10 @@ var AuthCreateAdminToken = &cli.Command{
 			Name:  "perm",
 			Usage: "permission to assign to the token, one of: read, write, sign, admin",
 		},
+		&cli.StringFlag{
+			Name:  "tenant",
+			Usage: "create token of the tenant, only scheduler supports, the perm can not be admin",
+		},
 	},
 
 	Action: func(cctx *cli.Context) error {
@@ -57,7 +61,12 @@ var AuthCreateAdminToken = &cli.Command{
 		}
 
 		// slice on [:idx] so for example: 'sign' gives you [read, write, sign]
-		token, err := napi.AuthNew(ctx, api.AllPermissions[:idx])
+		perms := append([]auth.Permission{}, api.AllPermissions[:idx]...)
+		if tenant := cctx.String("tenant"); tenant != "" {
+			perms = append(perms, api.TenantPermission(tenant))
+		}
+
+		token, err := napi.AuthNew(ctx, perms)
 		if err != nil {
 			return err
 		}
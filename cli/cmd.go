@@ -54,10 +54,11 @@ var (
 )
 
 var (
-	GetSchedulerAPI = cliutil.GetSchedulerAPI
-	GetCandidateAPI = cliutil.GetCandidateAPI
-	GetEdgeAPI      = cliutil.GetEdgeAPI
-	GetLocatorAPI   = cliutil.GetLocatorAPI
+	GetSchedulerAPI    = cliutil.GetSchedulerAPI
+	GetSchedulerTLSAPI = cliutil.GetSchedulerTLSAPI
+	GetCandidateAPI    = cliutil.GetCandidateAPI
+	GetEdgeAPI         = cliutil.GetEdgeAPI
+	GetLocatorAPI      = cliutil.GetLocatorAPI
 )
 
 var CommonCommands = []*cli.Command{
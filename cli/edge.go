@@ -17,6 +17,7 @@ var EdgeCmds = []*cli.Command{
 	ValidateBlockCmd,
 	LimitRateCmd,
 	DownloadInfoCmd,
+	DownloadStatsCmd,
 	CacheStatCmd,
 	StoreKeyCmd,
 	DeleteAllBlocksCmd,
@@ -204,7 +205,7 @@ var LimitRateCmd = &cli.Command{
 
 var DownloadInfoCmd = &cli.Command{
 	Name:  "downinfo",
-	Usage: "get download server url and token",
+	Usage: "get download server url",
 	Flags: []cli.Flag{},
 	Action: func(cctx *cli.Context) error {
 		api, closer, err := GetEdgeAPI(cctx)
@@ -221,7 +222,42 @@ var DownloadInfoCmd = &cli.Command{
 		}
 
 		fmt.Printf("URL:%s\n", info.URL)
-		fmt.Printf("Token:%s\n", info.Token)
+		return nil
+	},
+}
+
+var DownloadStatsCmd = &cli.Command{
+	Name:  "download-stats",
+	Usage: "top cids and clients served in the last 24 hours",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "top",
+			Usage: "count of the cids and clients",
+			Value: 10,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetEdgeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+		info, err := api.GetDownloadStats(ctx, cctx.Int("top"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Since:%s\n", time.Unix(info.Since, 0).Format("2006-01-02 15:04:05"))
+		fmt.Println("Top cids:")
+		for _, rank := range info.TopCids {
+			fmt.Printf("%s blocks:%d bytes:%d\n", rank.Key, rank.Blocks, rank.Bytes)
+		}
+		fmt.Println("Top clients:")
+		for _, rank := range info.TopClients {
+			fmt.Printf("%s blocks:%d bytes:%d\n", rank.Key, rank.Blocks, rank.Bytes)
+		}
 		return nil
 	},
 }
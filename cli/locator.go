@@ -3,11 +3,44 @@ package cli
 import (
 	"fmt"
 
+	"github.com/linguohua/titan/api"
 	"github.com/urfave/cli/v2"
 )
 
 var LocationCmds = []*cli.Command{
 	accesspointCmd,
+	locatorLookupIPCmd,
+}
+
+var locatorLookupIPCmd = &cli.Command{
+	Name:      "lookup-ip",
+	Usage:     "show the location and isp of ip",
+	ArgsUsage: "[ip, the ip of caller if not set]",
+
+	Action: func(cctx *cli.Context) error {
+		locatorAPI, closer, err := GetLocatorAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		info, err := locatorAPI.LookupIPGeo(ReqContext(cctx), cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		printIPGeoInfo(info)
+		return nil
+	},
+}
+
+func printIPGeoInfo(info api.IPGeoInfo) {
+	fmt.Printf("IP:%s\n", info.IP)
+	fmt.Printf("Geo:%s\n", info.Geo)
+	fmt.Printf("ISP:%s\n", info.ISP)
+	fmt.Printf("ASN:%d\n", info.ASN)
+	fmt.Printf("Location:%f,%f\n", info.Latitude, info.Longitude)
+	fmt.Printf("Overridden:%v\n", info.Overridden)
 }
 
 var accesspointCmd = &cli.Command{
@@ -157,7 +190,8 @@ var infoCmd = &cli.Command{
 
 		fmt.Printf("AreaID:%s\n", accesspoint.AreaID)
 		for _, info := range accesspoint.SchedulerInfos {
-			fmt.Printf("URL:%s   Weight:%d\n", info.URL, info.Weight)
+			fmt.Printf("URL:%s   Weight:%d   Online:%v   Standby:%v   Latency:%.1fms   ErrorRate:%.2f   CircuitOpen:%v   Nodes:%d/%d\n",
+				info.URL, info.Weight, info.Online, info.Standby, info.Latency, info.ErrorRate, info.CircuitOpen, info.OnlineNodes, info.Capacity)
 		}
 
 		return nil
@@ -2,10 +2,13 @@ package cli
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/denylist"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 )
@@ -24,12 +27,41 @@ var SchedulerCmds = []*cli.Command{
 	cacheCarfileCmd,
 	showDataInfoCmd,
 	registerNodeCmd,
+	revokeSecretCmd,
+	rotateSecretCmd,
 	cacheContinueCmd,
 	listDataCmd,
 	validateSwitchCmd,
 	removeCarfileCmd,
 	removeCacheCmd,
 	showDatasInfoCmd,
+	setRewardFormulaCmd,
+	setDownloadLimitCmd,
+	showDownloadLimitsCmd,
+	appDownloadUsageCmd,
+	downloadViolationsCmd,
+	bindDeviceUserCmd,
+	deviceIncomeCmd,
+	reputationRankingCmd,
+	restrictNodeCmd,
+	unrestrictNodeCmd,
+	listRestrictionsCmd,
+	setAreaPolicyCmd,
+	removeAreaPolicyCmd,
+	listAreaPoliciesCmd,
+	allowIPCmd,
+	disallowIPCmd,
+	listAllowlistCmd,
+	denyCidCmd,
+	allowCidCmd,
+	listDenylistCmd,
+	setTenantCmd,
+	listTenantsCmd,
+	tenantUsageCmd,
+	schedulerLookupIPCmd,
+	probeReachabilityCmd,
+	showReachabilityCmd,
+	resignLeaderCmd,
 }
 
 var (
@@ -98,6 +130,18 @@ var (
 		Usage: "page",
 		Value: 0,
 	}
+
+	selectorFlag = &cli.StringFlag{
+		Name:  "selector",
+		Usage: "cache part of carfile, example: --selector=path:/dir/file;range:0-1048575;depth:2, or the ipld selector in dag-json",
+		Value: "",
+	}
+
+	userIDFlag = &cli.StringFlag{
+		Name:  "user-id",
+		Usage: "user id",
+		Value: "",
+	}
 )
 
 var registerNodeCmd = &cli.Command{
@@ -135,6 +179,373 @@ var registerNodeCmd = &cli.Command{
 	},
 }
 
+var revokeSecretCmd = &cli.Command{
+	Name:  "revoke-secret",
+	Usage: "revoke node secret, node can not connect until rotate secret",
+	Flags: []cli.Flag{
+		deviceIDFlag,
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		deviceID := cctx.String("device-id")
+		ctx := ReqContext(cctx)
+
+		if deviceID == "" {
+			return xerrors.New("device-id is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.RevokeNodeSecret(ctx, deviceID)
+	},
+}
+
+var rotateSecretCmd = &cli.Command{
+	Name:  "rotate-secret",
+	Usage: "create a new node secret, old secret will be invalid",
+	Flags: []cli.Flag{
+		deviceIDFlag,
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		deviceID := cctx.String("device-id")
+		ctx := ReqContext(cctx)
+
+		if deviceID == "" {
+			return xerrors.New("device-id is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		info, err := schedulerAPI.RotateNodeSecret(ctx, deviceID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\nDeviceID:%s\nSecret:%s", info.DeviceID, info.Secret)
+		return nil
+	},
+}
+
+var setRewardFormulaCmd = &cli.Command{
+	Name:  "set-reward-formula",
+	Usage: "set the income of node per unit of work, unset flags keep the current value",
+	Flags: []cli.Flag{
+		&cli.Float64Flag{Name: "per-download-gib", Usage: "income per GiB downloaded"},
+		&cli.Float64Flag{Name: "per-download", Usage: "income per download"},
+		&cli.Float64Flag{Name: "per-online-hour", Usage: "income per online hour"},
+		&cli.Float64Flag{Name: "per-storage-gib-hour", Usage: "income per GiB stored per online hour"},
+		&cli.Float64Flag{Name: "per-validate-success", Usage: "income per validation success"},
+		&cli.Float64Flag{Name: "per-validate-fail", Usage: "income per validation failure, usually negative"},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		formula, err := schedulerAPI.GetRewardFormula(ctx)
+		if err != nil {
+			return err
+		}
+
+		if cctx.IsSet("per-download-gib") {
+			formula.PerDownloadGiB = cctx.Float64("per-download-gib")
+		}
+		if cctx.IsSet("per-download") {
+			formula.PerDownload = cctx.Float64("per-download")
+		}
+		if cctx.IsSet("per-online-hour") {
+			formula.PerOnlineHour = cctx.Float64("per-online-hour")
+		}
+		if cctx.IsSet("per-storage-gib-hour") {
+			formula.PerStorageGiBHour = cctx.Float64("per-storage-gib-hour")
+		}
+		if cctx.IsSet("per-validate-success") {
+			formula.PerValidateSuccess = cctx.Float64("per-validate-success")
+		}
+		if cctx.IsSet("per-validate-fail") {
+			formula.PerValidateFail = cctx.Float64("per-validate-fail")
+		}
+
+		err = schedulerAPI.SetRewardFormula(ctx, formula)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%+v\n", formula)
+		return nil
+	},
+}
+
+var setDownloadLimitCmd = &cli.Command{
+	Name:  "set-download-limit",
+	Usage: "set the download limit of client ip, app or ticket on nodes, unset flags keep the current value",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "scope", Usage: "ip, app or ticket", Value: api.DownloadScopeIP},
+		&cli.StringFlag{Name: "app", Usage: "limit of the app, override the limit of scope app"},
+		&cli.BoolFlag{Name: "remove", Usage: "remove the limit of the app"},
+		&cli.IntFlag{Name: "max-conns", Usage: "concurrent connections, 0 is unlimited"},
+		&cli.Int64Flag{Name: "bytes-per-sec", Usage: "bytes per second, 0 is unlimited"},
+		&cli.Int64Flag{Name: "daily-bytes", Usage: "bytes per day, 0 is unlimited"},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		limits, err := schedulerAPI.GetDownloadLimits(ctx)
+		if err != nil {
+			return err
+		}
+
+		app := cctx.String("app")
+		if app != "" && cctx.Bool("remove") {
+			delete(limits.Apps, app)
+			return schedulerAPI.SetDownloadLimits(ctx, limits)
+		}
+
+		var limit *api.DownloadLimit
+		switch {
+		case app != "":
+			if limits.Apps == nil {
+				limits.Apps = make(map[string]api.DownloadLimit)
+			}
+			l, ok := limits.Apps[app]
+			if !ok {
+				l = limits.PerApp
+			}
+			limit = &l
+		case cctx.String("scope") == api.DownloadScopeIP:
+			limit = &limits.PerIP
+		case cctx.String("scope") == api.DownloadScopeApp:
+			limit = &limits.PerApp
+		case cctx.String("scope") == api.DownloadScopeTicket:
+			limit = &limits.PerTicket
+		default:
+			return xerrors.Errorf("unknown scope %s", cctx.String("scope"))
+		}
+
+		if cctx.IsSet("max-conns") {
+			limit.MaxConns = cctx.Int("max-conns")
+		}
+		if cctx.IsSet("bytes-per-sec") {
+			limit.BytesPerSec = cctx.Int64("bytes-per-sec")
+		}
+		if cctx.IsSet("daily-bytes") {
+			limit.DailyBytes = cctx.Int64("daily-bytes")
+		}
+
+		if app != "" {
+			limits.Apps[app] = *limit
+		}
+
+		err = schedulerAPI.SetDownloadLimits(ctx, limits)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%+v\n", *limit)
+		return nil
+	},
+}
+
+var showDownloadLimitsCmd = &cli.Command{
+	Name:  "show-download-limits",
+	Usage: "show the download limits of nodes",
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		limits, err := schedulerAPI.GetDownloadLimits(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("ip: %+v\n", limits.PerIP)
+		fmt.Printf("app: %+v\n", limits.PerApp)
+		fmt.Printf("ticket: %+v\n", limits.PerTicket)
+		for app, limit := range limits.Apps {
+			fmt.Printf("app %s: %+v\n", app, limit)
+		}
+		return nil
+	},
+}
+
+var appDownloadUsageCmd = &cli.Command{
+	Name:  "app-download-usage",
+	Usage: "show the download usage of apps on the date",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "date",
+			Usage: "date of usage, example: 2006-01-02, today if not set",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		usages, err := schedulerAPI.GetAppDownloadUsages(ctx, cctx.String("date"))
+		if err != nil {
+			return err
+		}
+
+		for _, usage := range usages {
+			fmt.Printf("%s %s bytes:%d blocks:%d rejected:%d\n", usage.Date, usage.AppName, usage.Bytes, usage.Blocks, usage.Rejected)
+		}
+		return nil
+	},
+}
+
+var downloadViolationsCmd = &cli.Command{
+	Name:  "download-violations",
+	Usage: "show the downloads rejected by limits",
+	Flags: []cli.Flag{
+		deviceIDFlag,
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "max records",
+			Value: 100,
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		violations, err := schedulerAPI.GetDownloadViolations(ctx, cctx.String("device-id"), cctx.Int("limit"))
+		if err != nil {
+			return err
+		}
+
+		for _, v := range violations {
+			fmt.Printf("%s %s %s:%s limit:%s client:%s app:%s count:%d\n", time.Unix(v.CreatedTime, 0).Format("2006-01-02 15:04:05"),
+				v.DeviceID, v.Scope, v.Target, v.Limit, v.ClientIP, v.AppName, v.Count)
+		}
+		return nil
+	},
+}
+
+var bindDeviceUserCmd = &cli.Command{
+	Name:  "bind-user",
+	Usage: "bind the device to user",
+	Flags: []cli.Flag{
+		deviceIDFlag,
+		userIDFlag,
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		deviceID := cctx.String("device-id")
+		userID := cctx.String("user-id")
+		ctx := ReqContext(cctx)
+
+		if deviceID == "" || userID == "" {
+			return xerrors.New("device-id or user-id is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.BindDeviceUser(ctx, deviceID, userID)
+	},
+}
+
+var deviceIncomeCmd = &cli.Command{
+	Name:  "device-income",
+	Usage: "show income of the device",
+	Flags: []cli.Flag{
+		deviceIDFlag,
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		deviceID := cctx.String("device-id")
+		ctx := ReqContext(cctx)
+
+		if deviceID == "" {
+			return xerrors.New("device-id is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		info, err := schedulerAPI.GetDeviceIncome(ctx, deviceID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Today:%f\nYesterday:%f\nSevenDays:%f\nMonth:%f\nCumulative:%f\nOnlineTime:%s\nHighOnlineRatio:%s\n",
+			info.TodayProfit, info.YesterdayProfit, info.SevenDaysProfit, info.MonthProfit, info.CumulativeProfit, info.OnlineTime, info.HighOnlineRatio)
+		return nil
+	},
+}
+
 var removeCarfileCmd = &cli.Command{
 	Name:  "remove-carfile",
 	Usage: "remove a carfile",
@@ -350,6 +761,12 @@ var showDatasInfoCmd = &cli.Command{
 
 		for _, info := range infos {
 			fmt.Printf("Data CID:%s , Total Size:%d MB , Total Blocks:%d \n", info.Cid, info.TotalSize/(1024*1024), info.Blocks)
+			if info.Owner != "" {
+				fmt.Printf("Owner:%s\n", info.Owner)
+			}
+			if info.Selector != "" {
+				fmt.Printf("Carfile CID:%s , Selector:%s \n", info.RootCid, info.Selector)
+			}
 			for _, cache := range info.CacheInfos {
 				fmt.Printf("TaskID:%s ,  Status:%s , Done Size:%d MB ,Done Blocks:%d , Nodes:%d\n",
 					cache.CacheID, statusToStr(cache.Status), cache.DoneSize/(1024*1024), cache.DoneBlocks, cache.Nodes)
@@ -399,6 +816,9 @@ var showDataInfoCmd = &cli.Command{
 		}
 
 		fmt.Printf("Data CID:%s , Total Size:%d MB , Total Blocks:%d \n", info.Cid, info.TotalSize/(1024*1024), info.Blocks)
+		if info.Owner != "" {
+			fmt.Printf("Owner:%s\n", info.Owner)
+		}
 		for _, cache := range info.CacheInfos {
 			fmt.Printf("TaskID:%s ,  Status:%s , Done Size:%d MB ,Done Blocks:%d , Nodes:%d\n",
 				cache.CacheID, statusToStr(cache.Status), cache.DoneSize/(1024*1024), cache.DoneBlocks, cache.Nodes)
@@ -415,6 +835,7 @@ var cacheCarfileCmd = &cli.Command{
 		// schedulerURLFlag,
 		cidFlag,
 		reliabilityFlag,
+		selectorFlag,
 	},
 
 	Before: func(cctx *cli.Context) error {
@@ -423,6 +844,7 @@ var cacheCarfileCmd = &cli.Command{
 	Action: func(cctx *cli.Context) error {
 		// url := cctx.String("scheduler-url")
 		cid := cctx.String("cid")
+		selector := cctx.String("selector")
 		reliability := cctx.Int("reliability")
 		if reliability == 0 {
 			return xerrors.New("reliability is 0")
@@ -439,7 +861,7 @@ var cacheCarfileCmd = &cli.Command{
 			return xerrors.New("cid is nil")
 		}
 
-		err = schedulerAPI.CacheCarfile(ctx, cid, reliability)
+		err = schedulerAPI.CacheCarfile(ctx, cid, reliability, selector)
 		if err != nil {
 			return err
 		}
@@ -655,7 +1077,776 @@ var showOnlineNodeCmd = &cli.Command{
 	},
 }
 
-// var initDeviceIDsCmd = &cli.Command{
+var restrictNodeCmd = &cli.Command{
+	Name:  "restrict-node",
+	Usage: "quarantine or ban a device, ip or cidr",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "device id, ip or cidr",
+		},
+		&cli.StringFlag{
+			Name:  "target-type",
+			Usage: "device/ip/cidr",
+			Value: api.RestrictionTargetDevice,
+		},
+		&cli.StringFlag{
+			Name:  "action",
+			Usage: "quarantine/ban",
+			Value: api.RestrictionQuarantine,
+		},
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "reason of the restriction",
+		},
+		&cli.DurationFlag{
+			Name:  "expire",
+			Usage: "restriction expire after, 0 is never expire",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		restriction := api.NodeRestriction{
+			Target:     cctx.String("target"),
+			TargetType: cctx.String("target-type"),
+			Action:     cctx.String("action"),
+			Reason:     cctx.String("reason"),
+		}
+		if expire := cctx.Duration("expire"); expire > 0 {
+			restriction.ExpireTime = time.Now().Add(expire).Unix()
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.AddNodeRestriction(ctx, restriction)
+	},
+}
+
+var unrestrictNodeCmd = &cli.Command{
+	Name:  "unrestrict-node",
+	Usage: "remove the restriction of a device, ip or cidr",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "device id, ip or cidr",
+		},
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "reason of the remove",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		target := cctx.String("target")
+		if target == "" {
+			return xerrors.New("target is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.RemoveNodeRestriction(ctx, target, cctx.String("reason"))
+	},
+}
+
+var listRestrictionsCmd = &cli.Command{
+	Name:  "list-restrictions",
+	Usage: "show quarantined and banned devices, ips and cidrs",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "logs",
+			Usage: "show audit logs",
+		},
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "show audit logs of the target",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		if cctx.Bool("logs") {
+			logs, err := schedulerAPI.ListNodeRestrictionLogs(ctx, cctx.String("target"), 100)
+			if err != nil {
+				return err
+			}
+
+			for _, l := range logs {
+				fmt.Printf("%s %s %s:%s %s by %s, reason:%s\n", time.Unix(l.CreatedTime, 0).Format("2006-01-02 15:04:05"),
+					l.Op, l.TargetType, l.Target, l.Action, l.Operator, l.Reason)
+			}
+			return nil
+		}
+
+		list, err := schedulerAPI.ListNodeRestrictions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range list {
+			expire := "never"
+			if info.ExpireTime > 0 {
+				expire = time.Unix(info.ExpireTime, 0).Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%s:%s %s expire:%s by %s, reason:%s\n", info.TargetType, info.Target, info.Action, expire, info.Operator, info.Reason)
+		}
+
+		return nil
+	},
+}
+
+var setAreaPolicyCmd = &cli.Command{
+	Name:  "set-area-policy",
+	Usage: "serve the nodes of the area, country, country-province or country-province-city",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "area",
+			Usage: "area, example: CN-GD",
+		},
+		&cli.BoolFlag{
+			Name:  "accept-edge",
+			Usage: "accept edge nodes of the area",
+			Value: true,
+		},
+		&cli.BoolFlag{
+			Name:  "accept-candidate",
+			Usage: "accept candidate nodes of the area",
+			Value: true,
+		},
+		&cli.IntFlag{
+			Name:  "max-nodes",
+			Usage: "max online nodes of the area, 0 is unlimited",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		policy := api.AreaPolicy{
+			Area:            cctx.String("area"),
+			AcceptEdge:      cctx.Bool("accept-edge"),
+			AcceptCandidate: cctx.Bool("accept-candidate"),
+			MaxNodes:        cctx.Int("max-nodes"),
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.SetAreaPolicy(ctx, policy)
+	},
+}
+
+var removeAreaPolicyCmd = &cli.Command{
+	Name:  "remove-area-policy",
+	Usage: "remove the policy of the area",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "area",
+			Usage: "area, example: CN-GD",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		area := cctx.String("area")
+		if area == "" {
+			return xerrors.New("area is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.RemoveAreaPolicy(ctx, area)
+	},
+}
+
+var listAreaPoliciesCmd = &cli.Command{
+	Name:  "list-area-policies",
+	Usage: "show the areas served by scheduler",
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		list, err := schedulerAPI.ListAreaPolicies(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range list {
+			fmt.Printf("%s edge:%v candidate:%v max nodes:%d by %s\n", info.Area, info.AcceptEdge, info.AcceptCandidate, info.MaxNodes, info.Operator)
+		}
+
+		return nil
+	},
+}
+
+var allowIPCmd = &cli.Command{
+	Name:  "allow-ip",
+	Usage: "accept the nodes of ip or cidr whatever the area",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "ip or cidr",
+		},
+		&cli.StringFlag{
+			Name:  "area",
+			Usage: "override the area of the nodes, country-province-city",
+		},
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "reason of the allow",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		entry := api.IPAllowlist{
+			Target: cctx.String("target"),
+			Area:   cctx.String("area"),
+			Reason: cctx.String("reason"),
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.AddIPAllowlist(ctx, entry)
+	},
+}
+
+var disallowIPCmd = &cli.Command{
+	Name:  "disallow-ip",
+	Usage: "remove the ip or cidr from allowlist",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "ip or cidr",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		target := cctx.String("target")
+		if target == "" {
+			return xerrors.New("target is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.RemoveIPAllowlist(ctx, target)
+	},
+}
+
+var listAllowlistCmd = &cli.Command{
+	Name:  "list-allowlist",
+	Usage: "show the ips and cidrs of allowlist",
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		list, err := schedulerAPI.ListIPAllowlists(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range list {
+			area := info.Area
+			if area == "" {
+				area = "-"
+			}
+			fmt.Printf("%s area:%s by %s, reason:%s\n", info.Target, area, info.Operator, info.Reason)
+		}
+
+		return nil
+	},
+}
+
+// entries of denylist sent in a request
+const denylistBatch = 10000
+
+var denyCidCmd = &cli.Command{
+	Name:      "deny-cid",
+	Usage:     "add the cids to denylist, the carfiles of the cids are removed",
+	ArgsUsage: "[cid, /ipfs/<cid> or //<double hash> ...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "file",
+			Usage: "denylist file of bad bits format",
+		},
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "reason of the deny",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		entries := cctx.Args().Slice()
+		if path := cctx.String("file"); path != "" {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			hashes, err := denylist.Parse(f)
+			if err != nil {
+				return err
+			}
+
+			for _, hash := range hashes {
+				entries = append(entries, "//"+hash)
+			}
+		}
+
+		if len(entries) == 0 {
+			return xerrors.New("entries is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		version := int64(0)
+		for i := 0; i < len(entries); i += denylistBatch {
+			end := i + denylistBatch
+			if end > len(entries) {
+				end = len(entries)
+			}
+
+			version, err = schedulerAPI.AddDenylist(ctx, entries[i:end], cctx.String("reason"))
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("denylist version %d, added %d entries\n", version, len(entries))
+		return nil
+	},
+}
+
+var allowCidCmd = &cli.Command{
+	Name:      "allow-cid",
+	Usage:     "remove the cids from denylist",
+	ArgsUsage: "[cid, /ipfs/<cid> or //<double hash> ...]",
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		if cctx.NArg() == 0 {
+			return xerrors.New("entries is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		version, err := schedulerAPI.RemoveDenylist(ctx, cctx.Args().Slice())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("denylist version %d\n", version)
+		return nil
+	},
+}
+
+var listDenylistCmd = &cli.Command{
+	Name:  "list-denylist",
+	Usage: "show the double hashes of denylist",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "check",
+			Usage: "only check the cid is denied",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		if c := cctx.String("check"); c != "" {
+			hash, err := denylist.ParseEntry(c)
+			if err != nil {
+				return err
+			}
+
+			list, err := schedulerAPI.GetDenylist(ctx, 0)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range list.Entries {
+				if entry == hash {
+					fmt.Printf("%s is denied, //%s\n", c, hash)
+					return nil
+				}
+			}
+
+			fmt.Printf("%s is not denied\n", c)
+			return nil
+		}
+
+		entries, err := schedulerAPI.ListDenylist(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			fmt.Printf("//%s by %s at %s, reason:%s\n", entry.Hash, entry.Operator, time.Unix(entry.CreatedTime, 0).Format("2006-01-02 15:04:05"), entry.Reason)
+		}
+
+		return nil
+	},
+}
+
+var setTenantCmd = &cli.Command{
+	Name:      "set-tenant",
+	Usage:     "add or update tenant, quotas 0 are unlimited",
+	ArgsUsage: "[tenant id]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "name of the tenant",
+		},
+		&cli.Int64Flag{
+			Name:  "storage-quota",
+			Usage: "bytes of the carfiles multiplied by replicas",
+		},
+		&cli.IntFlag{
+			Name:  "replica-quota",
+			Usage: "max replicas of a carfile",
+		},
+		&cli.Int64Flag{
+			Name:  "bandwidth-quota",
+			Usage: "bytes downloaded from the carfiles in a month",
+		},
+		&cli.BoolFlag{
+			Name:  "disable",
+			Usage: "reject the tokens of the tenant",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return xerrors.New("tenant id is required")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.SetTenant(ReqContext(cctx), api.Tenant{
+			ID:             cctx.Args().First(),
+			Name:           cctx.String("name"),
+			StorageQuota:   cctx.Int64("storage-quota"),
+			ReplicaQuota:   cctx.Int("replica-quota"),
+			BandwidthQuota: cctx.Int64("bandwidth-quota"),
+			Disabled:       cctx.Bool("disable"),
+		})
+	},
+}
+
+var listTenantsCmd = &cli.Command{
+	Name:  "list-tenants",
+	Usage: "show tenants and their quotas",
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		tenants, err := schedulerAPI.ListTenants(ReqContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		for _, tenant := range tenants {
+			fmt.Printf("%s name:%s storage quota:%d replica quota:%d bandwidth quota:%d disabled:%v\n",
+				tenant.ID, tenant.Name, tenant.StorageQuota, tenant.ReplicaQuota, tenant.BandwidthQuota, tenant.Disabled)
+		}
+
+		return nil
+	},
+}
+
+var tenantUsageCmd = &cli.Command{
+	Name:      "tenant-usage",
+	Usage:     "show storage and bandwidth usage of the tenant",
+	ArgsUsage: "[tenant id, the tenant of the token if not set]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "month",
+			Usage: "month of the bandwidth, format 2006-01, this month if not set",
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		usage, err := schedulerAPI.GetTenantUsage(ReqContext(cctx), cctx.Args().First(), cctx.String("month"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("tenant:%s month:%s\n", usage.TenantID, usage.Month)
+		fmt.Printf("carfiles:%d storage:%d/%d replica quota:%d\n", usage.Carfiles, usage.StorageBytes, usage.Tenant.StorageQuota, usage.Tenant.ReplicaQuota)
+		fmt.Printf("bandwidth:%d/%d\n", usage.BandwidthBytes, usage.Tenant.BandwidthQuota)
+
+		return nil
+	},
+}
+
+var schedulerLookupIPCmd = &cli.Command{
+	Name:      "lookup-ip",
+	Usage:     "show the location and isp of ip",
+	ArgsUsage: "[ip, the ip of caller if not set]",
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		info, err := schedulerAPI.LookupIPGeo(ReqContext(cctx), cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		printIPGeoInfo(info)
+		return nil
+	},
+}
+
+var probeReachabilityCmd = &cli.Command{
+	Name:  "probe-reachability",
+	Usage: "probe the edge from scheduler and candidates to detect nat type",
+	Flags: []cli.Flag{
+		deviceIDFlag,
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		deviceID := cctx.String("device-id")
+		if deviceID == "" {
+			return xerrors.New("device-id is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		info, err := schedulerAPI.ProbeNodeReachability(ReqContext(cctx), deviceID)
+		if err != nil {
+			return err
+		}
+
+		printReachability(info)
+		return nil
+	},
+}
+
+var showReachabilityCmd = &cli.Command{
+	Name:  "show-reachability",
+	Usage: "show the last reachability probe of the edge",
+	Flags: []cli.Flag{
+		deviceIDFlag,
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		deviceID := cctx.String("device-id")
+		if deviceID == "" {
+			return xerrors.New("device-id is nil")
+		}
+
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		info, err := schedulerAPI.GetNodeReachability(ReqContext(cctx), deviceID)
+		if err != nil {
+			return err
+		}
+
+		printReachability(info)
+		return nil
+	},
+}
+
+func printReachability(info api.NodeReachability) {
+	fmt.Printf("DeviceID: %s\n", info.DeviceID)
+	fmt.Printf("NatType: %s\n", info.NatType)
+	fmt.Printf("NatRatio: %.0f%%\n", info.NatRatio)
+	fmt.Printf("RPCAddr: %s\n", info.RPCAddr)
+	fmt.Printf("DownloadAddr: %s\n", info.DownloadAddr)
+	fmt.Printf("Scheduler: %v\n", info.SchedulerProbe)
+	for deviceID, probes := range info.CandidateProbes {
+		fmt.Printf("Candidate %s: %v\n", deviceID, probes)
+	}
+	fmt.Printf("ProbeTime: %s\n", info.ProbeTime.Format("2006-01-02 15:04:05"))
+}
+
+var reputationRankingCmd = &cli.Command{
+	Name:  "reputation-ranking",
+	Usage: "show nodes sorted by reputation score",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "node-type",
+			Usage: "all/edge/candidate",
+			Value: string(api.TypeNameAll),
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "max nodes to show, 0 is unlimited",
+			Value: 20,
+		},
+	},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		list, err := schedulerAPI.GetReputationRanking(ctx, api.NodeTypeName(cctx.String("node-type")), cctx.Int("limit"))
+		if err != nil {
+			return err
+		}
+
+		for i, info := range list {
+			fmt.Printf("%d %s score:%.2f uptime:%.2f validate:%.2f download:%.2f cache:%.2f latency:%.2f\n",
+				i+1, info.DeviceID, info.Score, info.Uptime, info.Validate, info.Download, info.Cache, info.Latency)
+		}
+
+		return nil
+	},
+}
+
+// var initDeviceIDsCmd = &cli.Command{
 // 	Name:  "init-devices",
 // 	Usage: "init deviceIDs",
 // 	Flags: []cli.Flag{
@@ -760,3 +1951,23 @@ func loadCidsFromFile(configPath string) ([]string, error) {
 	c := &config
 	return c.Cids, nil
 }
+
+var resignLeaderCmd = &cli.Command{
+	Name:  "resign-leader",
+	Usage: "hand over the leader to standby scheduler, before restart or upgrade",
+	Flags: []cli.Flag{},
+
+	Before: func(cctx *cli.Context) error {
+		return nil
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+		schedulerAPI, closer, err := GetSchedulerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return schedulerAPI.ResignLeader(ctx)
+	},
+}
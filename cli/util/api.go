@@ -176,6 +176,16 @@ func GetSchedulerAPI(ctx *cli.Context) (api.Scheduler, jsonrpc.ClientCloser, err
 	return a, c, e
 }
 
+// GetSchedulerTLSAPI connect to scheduler by tls, the tls config of the scheduler is set by cert.NodeTLSConfig
+func GetSchedulerTLSAPI(ctx *cli.Context) (api.Scheduler, jsonrpc.ClientCloser, error) {
+	addr, headers, err := GetRawAPI(ctx, repo.FullNode, "v0")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client.NewScheduler(ctx.Context, client.TLSURL(addr), headers)
+}
+
 func GetCandidateAPI(ctx *cli.Context) (api.Candidate, jsonrpc.ClientCloser, error) {
 	addr, headers, err := GetRawAPI(ctx, repo.FullNode, "v0")
 	if err != nil {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -19,9 +20,11 @@ import (
 	"github.com/linguohua/titan/blockstore"
 	"github.com/linguohua/titan/build"
 	lcli "github.com/linguohua/titan/cli"
+	"github.com/linguohua/titan/lib/denylist"
 	"github.com/linguohua/titan/lib/titanlog"
 	"github.com/linguohua/titan/lib/ulimit"
 	"github.com/linguohua/titan/metrics"
+	"github.com/linguohua/titan/node/cert"
 	"github.com/linguohua/titan/node/device"
 	"github.com/linguohua/titan/node/helper"
 	"github.com/linguohua/titan/node/repo"
@@ -171,6 +174,49 @@ var runCmd = &cli.Command{
 			Usage: "connect to locator get scheduler url",
 			Value: false,
 		},
+		&cli.BoolFlag{
+			Name:  "tls",
+			Usage: "connect to scheduler with tls certificate issued by scheduler",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "tls-only",
+			Usage: "refuse plain rpc connections when tls is set, the local cli and other nodes must connect by tls",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:  "scheduler-ca-fingerprint",
+			Usage: "sha256 fingerprint of the scheduler ca, it is required before the scheduler ca trusted by tls",
+		},
+		&cli.StringFlag{
+			Name:  "download-tls",
+			Usage: "serve download by https and http/2, scheduler: certificate issued by scheduler, acme: certificate from acme server",
+		},
+		&cli.StringFlag{
+			Name:  "download-hostname",
+			Usage: "hostname in the download url, the hostname issued by scheduler or external ip if not set, required by acme",
+		},
+		&cli.StringFlag{
+			Name:  "download-acme-dir",
+			Usage: "directory url of the acme server",
+			Value: "https://acme-v02.api.letsencrypt.org/directory",
+		},
+		&cli.StringFlag{
+			Name:  "download-acme-email",
+			Usage: "contact email of the acme account",
+		},
+		&cli.StringFlag{
+			Name:  "download-acme-ca",
+			Usage: "pem root certificate of the acme server, for test ca",
+		},
+		&cli.StringFlag{
+			Name:  "download-access-log",
+			Usage: "json lines access log of the download server, download-access.log in the repo if not set, none to disable",
+		},
+		&cli.StringSliceFlag{
+			Name:  "download-trusted-proxy",
+			Usage: "ip or cidr of the proxy in front of the download server, X-Real-IP of the client ip is only trusted from it",
+		},
 	},
 
 	Before: func(cctx *cli.Context) error {
@@ -211,7 +257,9 @@ var runCmd = &cli.Command{
 		if err != nil {
 			return err
 		}
-		defer closer()
+		defer func() {
+			closer()
+		}()
 
 		ctx := lcli.ReqContext(cctx)
 		ctx, cancel := context.WithCancel(ctx)
@@ -226,7 +274,7 @@ var runCmd = &cli.Command{
 		}
 		log.Infof("Remote version %s", v)
 
-		tk, err := schedulerAPI.GetToken(ctx, deviceID, securityKey)
+		tk, err := helper.NewNodeToken(ctx, schedulerAPI, deviceID, securityKey)
 		if err != nil {
 			return err
 		}
@@ -313,6 +361,39 @@ var runCmd = &cli.Command{
 			return err
 		}
 
+		var tlsConfig *tls.Config
+		if cctx.Bool("tls") {
+			addr, headers, err := lcli.GetRawAPI(cctx, repo.FullNode, "v0")
+			if err != nil {
+				return err
+			}
+
+			tlsConfig, err = cert.NodeTLSConfig(ctx, lr, addr, headers, deviceID, securityKey, cctx.String("scheduler-ca-fingerprint"))
+			if err != nil {
+				return err
+			}
+
+			client.SetTLSConfig(tlsConfig)
+
+			// reconnect to scheduler by tls
+			closer()
+			schedulerAPI, closer, err = lcli.GetSchedulerTLSAPI(cctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		downloadTLS, downloadHostname, err := cert.DownloadTLSConfig(ctx, lr, schedulerAPI, deviceID, securityKey, cert.DownloadTLSOptions{
+			Mode:          cctx.String("download-tls"),
+			Hostname:      cctx.String("download-hostname"),
+			ACMEDirectory: cctx.String("download-acme-dir"),
+			ACMEEmail:     cctx.String("download-acme-email"),
+			ACMECA:        cctx.String("download-acme-ca"),
+		})
+		if err != nil {
+			return err
+		}
+
 		log.Info("Opening local storage; connecting to scheduler")
 
 		internalIP, err := extractRoutableIP(cctx)
@@ -328,13 +409,27 @@ var runCmd = &cli.Command{
 			cctx.Int64("bandwidth-up"),
 			cctx.Int64("bandwidth-down"))
 
+		accessLogPath := cctx.String("download-access-log")
+		switch accessLogPath {
+		case "":
+			accessLogPath = filepath.Join(lr.Path(), "download-access.log")
+		case "none":
+			accessLogPath = ""
+		}
+
 		nodeParams := &helper.NodeParams{
-			DS:              ds,
-			Scheduler:       schedulerAPI,
-			BlockStore:      blockStore,
-			DownloadSrvKey:  cctx.String("download-srv-key"),
-			DownloadSrvAddr: cctx.String("download-srv-addr"),
-			IPFSGateway:     cctx.String("ipfs-gateway"),
+			DS:                     ds,
+			Scheduler:              schedulerAPI,
+			NodeToken:              tk,
+			BlockStore:             blockStore,
+			DownloadSrvKey:         cctx.String("download-srv-key"),
+			DownloadSrvAddr:        cctx.String("download-srv-addr"),
+			IPFSGateway:            cctx.String("ipfs-gateway"),
+			DownloadTLS:            downloadTLS,
+			DownloadHostname:       downloadHostname,
+			AccessLogPath:          accessLogPath,
+			DownloadTrustedProxies: cctx.StringSlice("download-trusted-proxy"),
+			Denylist:               denylist.NewFilter(),
 		}
 
 		log.Info("ipfs-gateway " + nodeParams.IPFSGateway)
@@ -345,7 +440,7 @@ var runCmd = &cli.Command{
 		// log.Info("Setting up control endpoint at " + address)
 
 		srv := &http.Server{
-			Handler: WorkerHandler(schedulerAPI.AuthVerify, candidateApi, true),
+			Handler: WorkerHandler(helper.NodeAuthVerify(deviceID, schedulerAPI.AuthVerify), candidateApi, candidateApi.(*candidate.Candidate).RelayHandler(), true),
 			BaseContext: func(listener net.Listener) context.Context {
 				ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.APIInterface, "titan-candidate"))
 				return ctx
@@ -367,6 +462,10 @@ var runCmd = &cli.Command{
 			return err
 		}
 
+		if tlsConfig != nil {
+			nl = cert.NewListener(nl, tlsConfig, !cctx.Bool("tls-only"))
+		}
+
 		addressSlice := strings.Split(address, ":")
 		port, err := strconv.Atoi(addressSlice[1])
 		if err != nil {
@@ -418,7 +517,7 @@ var runCmd = &cli.Command{
 
 					select {
 					case <-readyCh:
-						externalIP, err := schedulerAPI.CandidateNodeConnect(ctx, port, tk)
+						externalIP, err := schedulerAPI.CandidateNodeConnect(ctx, port, tk.Get(ctx))
 						if err != nil {
 							log.Errorf("Registering worker failed: %+v", err)
 							cancel()
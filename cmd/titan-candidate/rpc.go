@@ -6,6 +6,7 @@ import (
 
 	"github.com/linguohua/titan/lib/rpcenc"
 	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/tunnel"
 
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/metrics/proxy"
@@ -22,7 +23,7 @@ import (
 // 	}
 // }
 
-func WorkerHandler(authv func(ctx context.Context, token string) ([]auth.Permission, error), a api.Candidate, permissioned bool) http.Handler {
+func WorkerHandler(authv func(ctx context.Context, token string) ([]auth.Permission, error), a api.Candidate, relay http.Handler, permissioned bool) http.Handler {
 	mux := mux.NewRouter()
 	readerHandler, readerServerOpt := rpcenc.ReaderParamDecoder()
 	rpcServer := jsonrpc.NewServer(readerServerOpt)
@@ -37,6 +38,9 @@ func WorkerHandler(authv func(ctx context.Context, token string) ([]auth.Permiss
 	mux.Handle("/rpc/v0", rpcServer)
 	// mux.Handle("/rpc/v0/block/get", blockDownload(a))
 	mux.Handle("/rpc/streams/v0/push/{uuid}", readerHandler)
+	// edges in reverse connection mode
+	mux.Handle(tunnel.Path, relay)
+	mux.PathPrefix(tunnel.RelayPath).Handler(relay)
 	mux.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
 
 	if !permissioned {
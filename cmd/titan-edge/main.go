@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -19,11 +20,14 @@ import (
 	"github.com/linguohua/titan/blockstore"
 	"github.com/linguohua/titan/build"
 	lcli "github.com/linguohua/titan/cli"
+	"github.com/linguohua/titan/lib/denylist"
 	"github.com/linguohua/titan/lib/titanlog"
 	"github.com/linguohua/titan/lib/ulimit"
 	"github.com/linguohua/titan/metrics"
+	"github.com/linguohua/titan/node/cert"
 	"github.com/linguohua/titan/node/device"
 	"github.com/linguohua/titan/node/helper"
+	"github.com/linguohua/titan/node/portmap"
 	"github.com/linguohua/titan/node/repo"
 	"github.com/shirou/gopsutil/v3/cpu"
 
@@ -139,6 +143,16 @@ var runCmd = &cli.Command{
 			Usage: "download server address for who download block, example: --download-srv-addr=192.168.0.136:3000",
 			Value: "0.0.0.0:3000", // should follow --repo default
 		},
+		&cli.BoolFlag{
+			Name:  "port-mapping",
+			Usage: "map the rpc and download ports by UPnP or NAT-PMP of the gateway, so the edge is reachable behind nat",
+			Value: true,
+		},
+		&cli.BoolFlag{
+			Name:  "reverse",
+			Usage: "keep outbound tunnel to scheduler and relay candidate, for edge behind nat can not be reached",
+			Value: false,
+		},
 		&cli.StringFlag{
 			Name:  "bandwidth-up",
 			Usage: "upload file bandwidth, unit is B/s example set 100MB/s: --bandwidth-up=104857600",
@@ -160,6 +174,49 @@ var runCmd = &cli.Command{
 			Usage: "connect to locator get scheduler url",
 			Value: false,
 		},
+		&cli.BoolFlag{
+			Name:  "tls",
+			Usage: "connect to scheduler with tls certificate issued by scheduler",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "tls-only",
+			Usage: "refuse plain rpc connections when tls is set, the local cli and other nodes must connect by tls",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:  "scheduler-ca-fingerprint",
+			Usage: "sha256 fingerprint of the scheduler ca, it is required before the scheduler ca trusted by tls",
+		},
+		&cli.StringFlag{
+			Name:  "download-tls",
+			Usage: "serve download by https and http/2, scheduler: certificate issued by scheduler, acme: certificate from acme server",
+		},
+		&cli.StringFlag{
+			Name:  "download-hostname",
+			Usage: "hostname in the download url, the hostname issued by scheduler or external ip if not set, required by acme",
+		},
+		&cli.StringFlag{
+			Name:  "download-acme-dir",
+			Usage: "directory url of the acme server",
+			Value: "https://acme-v02.api.letsencrypt.org/directory",
+		},
+		&cli.StringFlag{
+			Name:  "download-acme-email",
+			Usage: "contact email of the acme account",
+		},
+		&cli.StringFlag{
+			Name:  "download-acme-ca",
+			Usage: "pem root certificate of the acme server, for test ca",
+		},
+		&cli.StringFlag{
+			Name:  "download-access-log",
+			Usage: "json lines access log of the download server, download-access.log in the repo if not set, none to disable",
+		},
+		&cli.StringSliceFlag{
+			Name:  "download-trusted-proxy",
+			Usage: "ip or cidr of the proxy in front of the download server, X-Real-IP of the client ip is only trusted from it",
+		},
 	},
 
 	Before: func(cctx *cli.Context) error {
@@ -200,7 +257,9 @@ var runCmd = &cli.Command{
 		if err != nil {
 			return err
 		}
-		defer closer()
+		defer func() {
+			closer()
+		}()
 
 		ctx := lcli.ReqContext(cctx)
 		ctx, cancel := context.WithCancel(ctx)
@@ -216,7 +275,7 @@ var runCmd = &cli.Command{
 		}
 		log.Infof("Remote version %s", v)
 
-		tk, err := schedulerAPI.GetToken(ctx, deviceID, securityKey)
+		tk, err := helper.NewNodeToken(ctx, schedulerAPI, deviceID, securityKey)
 		if err != nil {
 			return err
 		}
@@ -303,6 +362,39 @@ var runCmd = &cli.Command{
 			return err
 		}
 
+		var tlsConfig *tls.Config
+		if cctx.Bool("tls") {
+			addr, headers, err := lcli.GetRawAPI(cctx, repo.FullNode, "v0")
+			if err != nil {
+				return err
+			}
+
+			tlsConfig, err = cert.NodeTLSConfig(ctx, lr, addr, headers, deviceID, securityKey, cctx.String("scheduler-ca-fingerprint"))
+			if err != nil {
+				return err
+			}
+
+			client.SetTLSConfig(tlsConfig)
+
+			// reconnect to scheduler by tls
+			closer()
+			schedulerAPI, closer, err = lcli.GetSchedulerTLSAPI(cctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		downloadTLS, downloadHostname, err := cert.DownloadTLSConfig(ctx, lr, schedulerAPI, deviceID, securityKey, cert.DownloadTLSOptions{
+			Mode:          cctx.String("download-tls"),
+			Hostname:      cctx.String("download-hostname"),
+			ACMEDirectory: cctx.String("download-acme-dir"),
+			ACMEEmail:     cctx.String("download-acme-email"),
+			ACMECA:        cctx.String("download-acme-ca"),
+		})
+		if err != nil {
+			return err
+		}
+
 		log.Info("Opening local storage; connecting to scheduler")
 
 		internalIP, err := extractRoutableIP(cctx)
@@ -318,19 +410,33 @@ var runCmd = &cli.Command{
 			cctx.Int64("bandwidth-up"),
 			cctx.Int64("bandwidth-down"))
 
+		accessLogPath := cctx.String("download-access-log")
+		switch accessLogPath {
+		case "":
+			accessLogPath = filepath.Join(lr.Path(), "download-access.log")
+		case "none":
+			accessLogPath = ""
+		}
+
 		params := &helper.NodeParams{
-			DS:              ds,
-			Scheduler:       schedulerAPI,
-			BlockStore:      blockStore,
-			DownloadSrvKey:  cctx.String("download-srv-key"),
-			DownloadSrvAddr: cctx.String("download-srv-addr"),
-			IPFSGateway:     cctx.String("ipfs-gateway"),
+			DS:                     ds,
+			Scheduler:              schedulerAPI,
+			NodeToken:              tk,
+			BlockStore:             blockStore,
+			DownloadSrvKey:         cctx.String("download-srv-key"),
+			DownloadSrvAddr:        cctx.String("download-srv-addr"),
+			IPFSGateway:            cctx.String("ipfs-gateway"),
+			DownloadTLS:            downloadTLS,
+			DownloadHostname:       downloadHostname,
+			AccessLogPath:          accessLogPath,
+			DownloadTrustedProxies: cctx.StringSlice("download-trusted-proxy"),
+			Denylist:               denylist.NewFilter(),
 		}
 
 		edgeApi := edge.NewLocalEdgeNode(context.Background(), device, params)
 
 		srv := &http.Server{
-			Handler: WorkerHandler(schedulerAPI.AuthVerify, edgeApi, true),
+			Handler: WorkerHandler(helper.NodeAuthVerify(deviceID, schedulerAPI.AuthVerify), edgeApi, true),
 			BaseContext: func(listener net.Listener) context.Context {
 				ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.APIInterface, "titan-edge"))
 				return ctx
@@ -352,6 +458,10 @@ var runCmd = &cli.Command{
 			return err
 		}
 
+		if tlsConfig != nil {
+			nl = cert.NewListener(nl, tlsConfig, !cctx.Bool("tls-only"))
+		}
+
 		log.Infof("Edge listen on %s", address)
 
 		addressSlice := strings.Split(address, ":")
@@ -360,6 +470,16 @@ var runCmd = &cli.Command{
 			return err
 		}
 
+		var reverse *reverseTunnel
+		if cctx.Bool("reverse") {
+			reverse, err = newReverseTunnel(ctx, cctx, deviceID, tk, address)
+			if err != nil {
+				return err
+			}
+		} else if cctx.Bool("port-mapping") {
+			port = mapPorts(ctx, device, edgeApi.(*edge.Edge), port, cctx.String("download-srv-addr"))
+		}
+
 		minerSession, err := schedulerAPI.Session(ctx, deviceID)
 		if err != nil {
 			return xerrors.Errorf("getting miner session: %w", err)
@@ -399,6 +519,10 @@ var runCmd = &cli.Command{
 							break
 						}
 
+						if reverse != nil && reverse.reconnected() {
+							break
+						}
+
 						if errCount > 0 {
 							break
 						}
@@ -406,7 +530,12 @@ var runCmd = &cli.Command{
 
 					select {
 					case <-readyCh:
-						externalIP, err := schedulerAPI.EdgeNodeConnect(ctx, port, tk)
+						var externalIP string
+						if reverse != nil {
+							externalIP, err = reverse.connect(ctx, schedulerAPI)
+						} else {
+							externalIP, err = schedulerAPI.EdgeNodeConnect(ctx, port, tk.Get(ctx))
+						}
 						if err != nil {
 							log.Errorf("Registering worker failed: %+v", err)
 							cancel()
@@ -434,6 +563,39 @@ var runCmd = &cli.Command{
 	},
 }
 
+// mapPorts map the rpc and download ports by gateway, return the rpc port for scheduler
+func mapPorts(ctx context.Context, device *device.Device, edgeNode *edge.Edge, rpcPort int, downloadAddr string) int {
+	mapper, err := portmap.NewMapper(ctx)
+	if err != nil {
+		log.Warnf("port mapping is not available: %s", err.Error())
+		return rpcPort
+	}
+
+	device.SetUpnp(mapper.Type())
+	go mapper.Renew(ctx)
+
+	externalPort, err := mapper.Map(rpcPort)
+	if err != nil {
+		log.Errorf("map rpc port %d err:%s", rpcPort, err.Error())
+		externalPort = rpcPort
+	}
+
+	addrSlice := strings.Split(downloadAddr, ":")
+	downloadPort, err := strconv.Atoi(addrSlice[len(addrSlice)-1])
+	if err != nil {
+		log.Errorf("parse download address %s err:%s", downloadAddr, err.Error())
+		return externalPort
+	}
+
+	if p, err := mapper.Map(downloadPort); err != nil {
+		log.Errorf("map download port %d err:%s", downloadPort, err.Error())
+	} else {
+		edgeNode.SetExternalPort(p)
+	}
+
+	return externalPort
+}
+
 func extractRoutableIP(cctx *cli.Context) (string, error) {
 	timeout, err := time.ParseDuration(cctx.String("timeout"))
 	if err != nil {
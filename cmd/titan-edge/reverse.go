@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	lcli "github.com/linguohua/titan/cli"
+	"github.com/linguohua/titan/node/helper"
+	"github.com/linguohua/titan/node/repo"
+	"github.com/linguohua/titan/node/tunnel"
+	"github.com/urfave/cli/v2"
+)
+
+// wait the tunnel established before connect to scheduler
+const tunnelWaitTimeout = 30 * time.Second
+
+// reverseTunnel the edge keep outbound tunnels to scheduler and relay candidate,
+// scheduler call the edge and users download from the edge through them
+type reverseTunnel struct {
+	deviceID string
+	token    *helper.NodeToken
+	// target:local address
+	targets map[string]string
+
+	scheduler *tunnel.Client
+	// generation of the scheduler tunnel when connected to scheduler, 0 is not connected
+	registered uint64
+
+	lk          sync.Mutex
+	relayCancel context.CancelFunc
+}
+
+func newReverseTunnel(ctx context.Context, cctx *cli.Context, deviceID string, token *helper.NodeToken, listenAddr string) (*reverseTunnel, error) {
+	addr, _, err := lcli.GetRawAPI(cctx, repo.FullNode, "v0")
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := tunnel.WebsocketURL(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cctx.Bool("tls") {
+		url = strings.Replace(url, "ws://", "wss://", 1)
+	}
+
+	targets := map[string]string{
+		tunnel.TargetRPC:      tunnel.LocalAddr(listenAddr),
+		tunnel.TargetDownload: tunnel.LocalAddr(cctx.String("download-srv-addr")),
+	}
+
+	r := &reverseTunnel{
+		deviceID:  deviceID,
+		token:     token,
+		targets:   targets,
+		scheduler: tunnel.NewClient(url, nil, targets),
+	}
+
+	// the token expires, it is got again before reconnect
+	r.scheduler.SetHeaderFunc(func() http.Header {
+		header := http.Header{}
+		header.Set(tunnel.HeaderToken, token.Get(ctx))
+		return header
+	})
+
+	go r.scheduler.Run(ctx)
+
+	return r, nil
+}
+
+// connect to scheduler through the tunnel, the relay tunnel is switched to the candidate assigned by scheduler
+func (r *reverseTunnel) connect(ctx context.Context, schedulerAPI api.Scheduler) (string, error) {
+	wctx, cancel := context.WithTimeout(ctx, tunnelWaitTimeout)
+	defer cancel()
+
+	if err := r.scheduler.WaitConnected(wctx); err != nil {
+		return "", err
+	}
+
+	generation := r.scheduler.Generation()
+
+	info, err := schedulerAPI.EdgeNodeReverseConnect(ctx, r.token.Get(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	r.registered = generation
+	r.switchRelay(ctx, info)
+
+	return info.ExternalIP, nil
+}
+
+// reconnected the scheduler tunnel is reconnected after connected to scheduler, report once
+func (r *reverseTunnel) reconnected() bool {
+	if r.registered == 0 || r.scheduler.Generation() == r.registered {
+		return false
+	}
+
+	r.registered = 0
+	return true
+}
+
+func (r *reverseTunnel) switchRelay(ctx context.Context, info api.ReverseConnectInfo) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if r.relayCancel != nil {
+		r.relayCancel()
+		r.relayCancel = nil
+	}
+
+	if info.RelayTunnelURL == "" {
+		log.Warn("no relay candidate, users can not download from the edge")
+		return
+	}
+
+	header := http.Header{}
+	header.Set(tunnel.HeaderDeviceID, r.deviceID)
+	header.Set(tunnel.HeaderRelayKey, info.RelayKey)
+
+	rctx, cancel := context.WithCancel(ctx)
+	r.relayCancel = cancel
+
+	go tunnel.NewClient(info.RelayTunnelURL, header, r.targets).Run(rctx)
+
+	log.Infof("relay by %s", info.RelayTunnelURL)
+}
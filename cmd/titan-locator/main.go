@@ -114,6 +114,14 @@ var runCmd = &cli.Command{
 			Usage: "ip location",
 			Value: "./city.mmdb",
 		},
+		&cli.StringFlag{
+			Name:  "asndb-path",
+			Usage: "asn mmdb path for isp lookup, optional",
+		},
+		&cli.StringFlag{
+			Name:  "geo-override-path",
+			Usage: "ip range to area table over the geodb, line format: cidr,country,province,city,isp",
+		},
 		&cli.StringFlag{
 			Name:  "accesspoint-file",
 			Usage: "accesspoint config",
@@ -124,6 +132,10 @@ var runCmd = &cli.Command{
 			Usage: "use mysql to save config",
 			Value: "user01:sql001@tcp(127.0.0.1:3306)/locator",
 		},
+		&cli.StringSliceFlag{
+			Name:  "etcd-endpoints",
+			Usage: "etcd endpoints to share access points with other locators, example: 127.0.0.1:2379",
+		},
 		// &cli.StringFlag{
 		// 	Name:  "scheduler-token",
 		// 	Usage: "connect to scheduler",
@@ -131,8 +143,7 @@ var runCmd = &cli.Command{
 		// },
 		&cli.StringFlag{
 			Name:  "uuid",
-			Usage: "locator uuid",
-			Value: "f936b0dc-9e59-476b-a16c-36e3d2d7a752",
+			Usage: "locator uuid, must be unique for each locator replica, random if not set",
 		},
 	},
 
@@ -161,8 +172,12 @@ var runCmd = &cli.Command{
 			}
 		}
 
-		gPath := cctx.String("geodb-path")
-		err = region.NewRegion(gPath, region.TypeGeoLite())
+		regionCfg := region.Config{
+			GeoDBPath:    cctx.String("geodb-path"),
+			ASNDBPath:    cctx.String("asndb-path"),
+			OverridePath: cctx.String("geo-override-path"),
+		}
+		err = region.NewRegion(regionCfg, region.TypeGeoLite())
 		if err != nil {
 			log.Panic(err.Error())
 		}
@@ -173,7 +188,7 @@ var runCmd = &cli.Command{
 
 		// Register all metric views
 		if err := view.Register(
-			metrics.DefaultViews...,
+			metrics.LocatorNodeViews...,
 		); err != nil {
 			log.Fatalf("Cannot register the view: %v", err)
 		}
@@ -254,7 +269,10 @@ var runCmd = &cli.Command{
 		}
 
 		dbAddr := cctx.String("accesspoint-etcd")
-		uuid := cctx.String("uuid")
+		locatorID := cctx.String("uuid")
+		if locatorID == "" {
+			locatorID = uuid.New().String()
+		}
 
 		address := cctx.String("listen")
 		addrSplit := strings.Split(address, ":")
@@ -268,7 +286,7 @@ var runCmd = &cli.Command{
 		}
 
 		srv := &http.Server{
-			Handler: WorkerHandler(locator.NewLocalLocator(ctx, lr, dbAddr, uuid, port), true),
+			Handler: WorkerHandler(locator.NewLocalLocator(ctx, lr, dbAddr, cctx.StringSlice("etcd-endpoints"), locatorID, port), true),
 			BaseContext: func(listener net.Listener) context.Context {
 				ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.APIInterface, "titan-edge"))
 				return ctx
@@ -17,6 +17,7 @@ import (
 	"github.com/linguohua/titan/lib/titanlog"
 	"github.com/linguohua/titan/lib/ulimit"
 	"github.com/linguohua/titan/metrics"
+	"github.com/linguohua/titan/node/cert"
 	"github.com/linguohua/titan/node/repo"
 	"github.com/linguohua/titan/node/scheduler"
 	"github.com/linguohua/titan/node/scheduler/db/cache"
@@ -164,6 +165,14 @@ var runCmd = &cli.Command{
 			Usage: "geodb path",
 			Value: "../../geoip/geolite2_city/city.mmdb",
 		},
+		&cli.StringFlag{
+			Name:  "asndb-path",
+			Usage: "asn mmdb path for isp lookup, optional",
+		},
+		&cli.StringFlag{
+			Name:  "geo-override-path",
+			Usage: "ip range to area table over the geodb, line format: cidr,country,province,city,isp",
+		},
 		&cli.StringFlag{
 			Name:  "persistentdb-url",
 			Usage: "persistentdb url",
@@ -171,13 +180,47 @@ var runCmd = &cli.Command{
 		},
 		&cli.StringFlag{
 			Name:  "server-name",
-			Usage: "server uniquely identifies",
+			Usage: "server uniquely identifies, schedulers with the same server name are active/standby",
+		},
+		&cli.StringFlag{
+			Name:  "scheduler-id",
+			Usage: "id of the scheduler in the server, must be unique for each scheduler, random if not set",
 		},
 		&cli.StringFlag{
 			Name:  "area",
-			Usage: "area",
+			Usage: "area of the scheduler, the db tables and locator access point are named by it",
 			Value: "CN-GD-Shenzhen",
 		},
+		&cli.StringSliceFlag{
+			Name:  "serve-areas",
+			Usage: "nodes of the areas are accepted, country, country-province or country-province-city, the area is served if not set",
+		},
+		&cli.BoolFlag{
+			Name:  "require-node-tls",
+			Usage: "nodes must connect with tls certificate issued by scheduler",
+		},
+		&cli.StringFlag{
+			Name:  "download-domain",
+			Usage: "download servers of nodes are issued certificates for <device-id>.<domain>, the dns must resolve them to nodes",
+		},
+		&cli.StringFlag{
+			Name:  "download-ca-cert",
+			Usage: "pem certificate of the ca to issue download certificates, the node ca if not set",
+		},
+		&cli.StringFlag{
+			Name:  "download-ca-key",
+			Usage: "pem ecdsa key of the download ca",
+		},
+		&cli.Int64Flag{
+			Name:  "auto-quarantine-fails",
+			Usage: "quarantine node after continuous validate fail times, 0 is disable",
+			Value: 3,
+		},
+		&cli.IntFlag{
+			Name:  "node-capacity",
+			Usage: "max nodes the scheduler can serve, locator balance nodes by it, 0 is unknown",
+			Value: 0,
+		},
 	},
 
 	Before: func(cctx *cli.Context) error {
@@ -220,8 +263,12 @@ var runCmd = &cli.Command{
 			log.Panic(err.Error())
 		}
 
-		gPath := cctx.String("geodb-path")
-		err = region.NewRegion(gPath, region.TypeGeoLite())
+		regionCfg := region.Config{
+			GeoDBPath:    cctx.String("geodb-path"),
+			ASNDBPath:    cctx.String("asndb-path"),
+			OverridePath: cctx.String("geo-override-path"),
+		}
+		err = region.NewRegion(regionCfg, region.TypeGeoLite())
 		if err != nil {
 			log.Panic(err.Error())
 		}
@@ -237,7 +284,20 @@ var runCmd = &cli.Command{
 			log.Panic(err.Error())
 		}
 
-		scheduler.InitServerArea(area)
+		scheduler.InitServerArea(area, cctx.StringSlice("serve-areas"))
+		scheduler.SetAutoQuarantineFails(cctx.Int64("auto-quarantine-fails"))
+		scheduler.SetNodeCapacity(cctx.Int("node-capacity"))
+		scheduler.SetSchedulerID(cctx.String("scheduler-id"))
+
+		tlsConfig, err := scheduler.InitNodeTLS(lr, cctx.Bool("require-node-tls"))
+		if err != nil {
+			log.Panic(err.Error())
+		}
+
+		err = scheduler.InitDownloadTLS(cctx.String("download-domain"), cctx.String("download-ca-cert"), cctx.String("download-ca-key"))
+		if err != nil {
+			log.Panic(err.Error())
+		}
 
 		address := cctx.String("listen")
 
@@ -250,7 +310,7 @@ var runCmd = &cli.Command{
 		schedulerAPI := scheduler.NewLocalScheduleNode(lr, port)
 
 		srv := &http.Server{
-			Handler: schedulerHandler(schedulerAPI, true),
+			Handler: schedulerHandler(schedulerAPI, schedulerAPI.(*scheduler.Scheduler).AuthVerifyRequest, schedulerAPI.(*scheduler.Scheduler).TunnelHandler(), true),
 			BaseContext: func(listener net.Listener) context.Context {
 				ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.APIInterface, "titan-edge"))
 				return ctx
@@ -273,7 +333,8 @@ var runCmd = &cli.Command{
 
 		log.Info("titan scheduler listen with:", address)
 
-		return srv.Serve(nl)
+		// plain connections of cli and users are served, node without tls certificate is refused by require-node-tls
+		return srv.Serve(cert.NewListener(nl, tlsConfig, true))
 	},
 }
 
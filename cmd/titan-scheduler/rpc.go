@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/linguohua/titan/lib/rpcenc"
 	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/tunnel"
 
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/metrics/proxy"
@@ -14,7 +16,8 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func schedulerHandler(a api.Scheduler, permissioned bool) http.Handler {
+// verify of the requests set the tenant of the request, it is not the AuthVerify called by nodes
+func schedulerHandler(a api.Scheduler, verify func(ctx context.Context, token string) ([]auth.Permission, error), tunnelHandler http.Handler, permissioned bool) http.Handler {
 	mux := mux.NewRouter()
 	readerHandler, readerServerOpt := rpcenc.ReaderParamDecoder()
 	rpcServer := jsonrpc.NewServer(readerServerOpt)
@@ -28,6 +31,8 @@ func schedulerHandler(a api.Scheduler, permissioned bool) http.Handler {
 
 	mux.Handle("/rpc/v0", rpcServer)
 	mux.Handle("/rpc/streams/v0/push/{uuid}", readerHandler)
+	// edges in reverse connection mode
+	mux.Handle(tunnel.Path, tunnelHandler)
 	mux.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
 
 	if !permissioned {
@@ -35,7 +40,7 @@ func schedulerHandler(a api.Scheduler, permissioned bool) http.Handler {
 	}
 
 	ah := &auth.Handler{
-		Verify: a.AuthVerify,
+		Verify: verify,
 		Next:   mux.ServeHTTP,
 	}
 
@@ -0,0 +1,186 @@
+// Package car read and write blocks in CARv1 format,
+// a dag-cbor header of the roots followed by length prefixed cid and block sections
+package car
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"golang.org/x/xerrors"
+)
+
+// ContentType of the car http response
+const ContentType = "application/vnd.ipld.car"
+
+// max length of header and block sections
+const maxSectionSize = 32 << 20
+
+// Writer write the header at creation and then the blocks
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter write the header of the roots
+func NewWriter(w io.Writer, roots []cid.Cid) (*Writer, error) {
+	header, err := qp.BuildMap(basicnode.Prototype.Map, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "roots", qp.List(int64(len(roots)), func(la datamodel.ListAssembler) {
+			for _, root := range roots {
+				qp.ListEntry(la, qp.Link(cidlink.Link{Cid: root}))
+			}
+		}))
+		qp.MapEntry(ma, "version", qp.Int(1))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := dagcbor.Encode(header, buf); err != nil {
+		return nil, err
+	}
+
+	if err := writeUvarint(w, uint64(buf.Len())); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w}, nil
+}
+
+// WriteBlock write a block section
+func (cw *Writer) WriteBlock(c cid.Cid, data []byte) error {
+	if err := cw.WriteBlockHeader(c, int64(len(data))); err != nil {
+		return err
+	}
+
+	_, err := cw.w.Write(data)
+	return err
+}
+
+// WriteBlockHeader write the length and cid of a block section, the caller must write size bytes of block data then
+func (cw *Writer) WriteBlockHeader(c cid.Cid, size int64) error {
+	cidBytes := c.Bytes()
+	if err := writeUvarint(cw.w, uint64(len(cidBytes))+uint64(size)); err != nil {
+		return err
+	}
+
+	_, err := cw.w.Write(cidBytes)
+	return err
+}
+
+// Reader read the header at creation and then the blocks
+type Reader struct {
+	r     *bufio.Reader
+	Roots []cid.Cid
+}
+
+// NewReader read the header
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	data, err := readSection(br)
+	if err != nil {
+		if xerrors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, bytes.NewReader(data)); err != nil {
+		return nil, xerrors.Errorf("decode car header: %w", err)
+	}
+
+	header := nb.Build()
+
+	version, err := header.LookupByString("version")
+	if err != nil {
+		return nil, xerrors.Errorf("car header version: %w", err)
+	}
+
+	if v, err := version.AsInt(); err != nil || v != 1 {
+		return nil, xerrors.Errorf("unsupported car version")
+	}
+
+	rootsNode, err := header.LookupByString("roots")
+	if err != nil {
+		return nil, xerrors.Errorf("car header roots: %w", err)
+	}
+
+	roots := make([]cid.Cid, 0, rootsNode.Length())
+	it := rootsNode.ListIterator()
+	for it != nil && !it.Done() {
+		_, n, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		link, err := n.AsLink()
+		if err != nil {
+			return nil, err
+		}
+
+		cl, ok := link.(cidlink.Link)
+		if !ok {
+			return nil, xerrors.New("car root is not cid")
+		}
+
+		roots = append(roots, cl.Cid)
+	}
+
+	return &Reader{r: br, Roots: roots}, nil
+}
+
+// Next read the next block, io.EOF at the end
+func (cr *Reader) Next() (cid.Cid, []byte, error) {
+	data, err := readSection(cr.r)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	n, c, err := cid.CidFromBytes(data)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	return c, data[n:], nil
+}
+
+func readSection(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if size == 0 || size > maxSectionSize {
+		return nil, xerrors.Errorf("invalid car section size %d", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if xerrors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func writeUvarint(w io.Writer, v uint64) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+	_, err := w.Write(buf[:n])
+	return err
+}
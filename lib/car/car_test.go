@@ -0,0 +1,53 @@
+package car
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+func TestRoundTrip(t *testing.T) {
+	blks := []blocks.Block{
+		blocks.NewBlock([]byte("block one")),
+		blocks.NewBlock([]byte("block two")),
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, []cid.Cid{blks[0].Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blk := range blks {
+		if err := w.WriteBlock(blk.Cid(), blk.RawData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Roots) != 1 || !r.Roots[0].Equals(blks[0].Cid()) {
+		t.Fatalf("unexpected roots %v", r.Roots)
+	}
+
+	for _, blk := range blks {
+		c, data, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !c.Equals(blk.Cid()) || !bytes.Equal(data, blk.RawData()) {
+			t.Fatalf("unexpected block %s", c)
+		}
+	}
+
+	if _, _, err := r.Next(); err != io.EOF {
+		t.Fatalf("want EOF, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package denylist
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// entries are double hashes of bad bits format, the cids are not exposed by the list
+const hashPrefix = "//"
+
+// Hash double hash of the cid, sha256 of "<cid v1 base32>/" in hex, v0 and v1 of a cid are the same
+func Hash(c cid.Cid) string {
+	// string of cid v1 is base32
+	v1 := cid.NewCidV1(c.Type(), c.Hash())
+
+	sum := sha256.Sum256([]byte(v1.String() + "/"))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseEntry hash of the entry, the entry is //<hash>, /ipfs/<cid> or <cid>,
+// empty hash for blank and comment lines
+func ParseEntry(entry string) (string, error) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || strings.HasPrefix(entry, "#") {
+		return "", nil
+	}
+
+	if strings.HasPrefix(entry, hashPrefix) {
+		hash := strings.ToLower(strings.TrimPrefix(entry, hashPrefix))
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return "", xerrors.Errorf("invalid hash entry %s", entry)
+		}
+		return hash, nil
+	}
+
+	entry = strings.TrimPrefix(entry, "/ipfs/")
+	// path under the cid is not supported, the whole cid is denied
+	if i := strings.Index(entry, "/"); i >= 0 {
+		entry = entry[:i]
+	}
+
+	c, err := cid.Decode(entry)
+	if err != nil {
+		return "", xerrors.Errorf("invalid cid entry %s:%w", entry, err)
+	}
+
+	return Hash(c), nil
+}
+
+// Parse hashes of the denylist file of bad bits format
+func Parse(r io.Reader) ([]string, error) {
+	var hashes []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		hash, err := ParseEntry(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+
+		if hash != "" {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	return hashes, scanner.Err()
+}
+
+// digest of the version and the sorted hashes
+func digest(version int64, hashes []string) []byte {
+	sorted := make([]string, len(hashes))
+	copy(sorted, hashes)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, version)
+	for _, hash := range sorted {
+		h.Write([]byte(hash))
+		h.Write([]byte{'\n'})
+	}
+
+	return h.Sum(nil)
+}
+
+// Sign the version and hashes of the denylist
+func Sign(key *ecdsa.PrivateKey, version int64, hashes []string) ([]byte, error) {
+	return ecdsa.SignASN1(rand.Reader, key, digest(version, hashes))
+}
+
+// Verify the signature of the denylist
+func Verify(pub *ecdsa.PublicKey, version int64, hashes []string, sig []byte) error {
+	if !ecdsa.VerifyASN1(pub, digest(version, hashes), sig) {
+		return xerrors.Errorf("denylist %d signature invalid", version)
+	}
+
+	return nil
+}
+
+// Filter check the cids with the hashes of the denylist
+type Filter struct {
+	lock     sync.RWMutex
+	version  int64
+	hashes   map[string]struct{}
+	notifies []func()
+}
+
+func NewFilter() *Filter {
+	return &Filter{hashes: make(map[string]struct{})}
+}
+
+// Set replace the hashes, the notifies are called after set
+func (f *Filter) Set(version int64, hashes []string) {
+	m := make(map[string]struct{}, len(hashes))
+	for _, hash := range hashes {
+		m[hash] = struct{}{}
+	}
+
+	f.lock.Lock()
+	f.version = version
+	f.hashes = m
+	notifies := f.notifies
+	f.lock.Unlock()
+
+	for _, notify := range notifies {
+		go notify()
+	}
+}
+
+// Notify call f when the hashes changed
+func (f *Filter) Notify(notify func()) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.notifies = append(f.notifies, notify)
+}
+
+func (f *Filter) Version() int64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.version
+}
+
+func (f *Filter) Len() int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return len(f.hashes)
+}
+
+// Denied check the cid string, invalid and empty cids are not denied
+func (f *Filter) Denied(cidStr string) bool {
+	if f == nil || cidStr == "" {
+		return false
+	}
+
+	c, err := cid.Decode(cidStr)
+	if err != nil {
+		return false
+	}
+
+	return f.DeniedCid(c)
+}
+
+func (f *Filter) DeniedCid(c cid.Cid) bool {
+	if f == nil {
+		return false
+	}
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if len(f.hashes) == 0 {
+		return false
+	}
+
+	_, ok := f.hashes[Hash(c)]
+	return ok
+}
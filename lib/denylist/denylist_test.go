@@ -0,0 +1,58 @@
+package denylist
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+func TestFilter(t *testing.T) {
+	v0 := blocks.NewBlock([]byte("denied")).Cid()
+	v1 := cid.NewCidV1(cid.DagProtobuf, v0.Hash())
+
+	hashes, err := Parse(strings.NewReader("# comment\n\n/ipfs/" + v0.String() + "\n//" + Hash(v1) + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hashes) != 2 || hashes[0] != hashes[1] {
+		t.Fatalf("hashes of cid v0 and v1 mismatch %v", hashes)
+	}
+
+	f := NewFilter()
+	f.Set(1, hashes)
+
+	if !f.Denied(v0.String()) || !f.Denied(v1.String()) {
+		t.Fatal("cid not denied")
+	}
+
+	if f.Denied(blocks.NewBlock([]byte("allowed")).Cid().String()) {
+		t.Fatal("cid denied")
+	}
+}
+
+func TestSign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := []string{Hash(blocks.NewBlock([]byte("a")).Cid()), Hash(blocks.NewBlock([]byte("b")).Cid())}
+	sig, err := Sign(key, 2, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(&key.PublicKey, 2, []string{hashes[1], hashes[0]}, sig); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(&key.PublicKey, 3, hashes, sig); err == nil {
+		t.Fatal("signature of other version verified")
+	}
+}
@@ -0,0 +1,41 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+// ReceiptDigest digest of the download receipt signed by the client
+func ReceiptDigest(cid string, size int64, deviceID string, time int64, ticket string) []byte {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%s\n%d\n%s", cid, size, deviceID, time, ticket)))
+	return h[:]
+}
+
+// SignReceipt sign the receipt digest with the client key
+func SignReceipt(key *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	return ecdsa.SignASN1(rand.Reader, key, digest)
+}
+
+// VerifyReceipt verify the receipt signature with the client public key in the ticket
+func VerifyReceipt(clientKey, digest, sign []byte) error {
+	pub, err := x509.ParsePKIXPublicKey(clientKey)
+	if err != nil {
+		return err
+	}
+
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return xerrors.New("client key is not ecdsa")
+	}
+
+	if !ecdsa.VerifyASN1(key, digest, sign) {
+		return xerrors.New("receipt signature invalid")
+	}
+
+	return nil
+}
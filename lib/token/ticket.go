@@ -0,0 +1,77 @@
+package token
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/xerrors"
+)
+
+// Ticket download ticket signed by scheduler,
+// Audience is the device serving the download, Id is unique per ticket
+type Ticket struct {
+	jwt.StandardClaims
+
+	// ip of the client, empty is any client
+	ClientIP string `json:"cip,omitempty"`
+	// blocks allowed to download
+	Cids []string `json:"cids,omitempty"`
+	// all blocks of the carfile allowed to download
+	RootCid string `json:"root,omitempty"`
+	// total bytes allowed to download, 0 is unlimited
+	MaxBytes int64 `json:"max,omitempty"`
+	// public key of the client to sign download receipts
+	ClientKey []byte `json:"ckey,omitempty"`
+}
+
+// GenerateTicket sign the ticket with scheduler key
+func GenerateTicket(key *ecdsa.PrivateKey, ticket *Ticket) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, ticket)
+	return token.SignedString(key)
+}
+
+// ParseTicket verify the ticket with scheduler public key
+func ParseTicket(signedTicket string, pub *ecdsa.PublicKey) (*Ticket, error) {
+	return parseTicket(signedTicket, pub, &jwt.Parser{})
+}
+
+// ParseIssuedTicket verify the ticket signature but not the expire time,
+// receipts of the ticket can submit after it expired
+func ParseIssuedTicket(signedTicket string, pub *ecdsa.PublicKey) (*Ticket, error) {
+	return parseTicket(signedTicket, pub, &jwt.Parser{SkipClaimsValidation: true})
+}
+
+func parseTicket(signedTicket string, pub *ecdsa.PublicKey, parser *jwt.Parser) (*Ticket, error) {
+	ticket := &Ticket{}
+
+	token, err := parser.ParseWithClaims(signedTicket, ticket, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, xerrors.Errorf("unexpected signing method:%v", token.Header["alg"])
+		}
+		return pub, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, xerrors.New("ticket invalid")
+	}
+
+	if ticket.Id == "" || ticket.ExpiresAt == 0 {
+		return nil, xerrors.New("ticket id or expire time not set")
+	}
+
+	return ticket, nil
+}
+
+// HasCid check the cid is in the ticket cids
+func (t *Ticket) HasCid(cid string) bool {
+	for _, c := range t.Cids {
+		if c == cid {
+			return true
+		}
+	}
+
+	return false
+}
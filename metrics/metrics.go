@@ -51,6 +51,9 @@ var (
 	ProtocolID, _ = tag.NewKey("proto")
 	Direction, _  = tag.NewKey("direction")
 	UseFD, _      = tag.NewKey("use_fd")
+
+	// locator
+	SchedulerURL, _ = tag.NewKey("scheduler_url")
 )
 
 // Measures
@@ -165,6 +168,12 @@ var (
 	RcmgrBlockSvcPeer   = stats.Int64("rcmgr/block_svc", "Number of blocked blocked streams attached to a service for a specific peer", stats.UnitDimensionless)
 	RcmgrAllowMem       = stats.Int64("rcmgr/allow_mem", "Number of allowed memory reservations", stats.UnitDimensionless)
 	RcmgrBlockMem       = stats.Int64("rcmgr/block_mem", "Number of blocked memory reservations", stats.UnitDimensionless)
+
+	// locator
+	SchedulerProbeDuration = stats.Float64("locator/scheduler_probe_ms", "Duration of scheduler health probe", stats.UnitMilliseconds)
+	SchedulerProbeFailure  = stats.Int64("locator/scheduler_probe_failure", "Counter of failed scheduler health probes", stats.UnitDimensionless)
+	SchedulerCircuitOpen   = stats.Int64("locator/scheduler_circuit_open", "Circuit of scheduler is open (1) or closed (0)", stats.UnitDimensionless)
+	SchedulerOnlineNodes   = stats.Int64("locator/scheduler_online_nodes", "Online nodes reported by scheduler", stats.UnitDimensionless)
 )
 
 var (
@@ -597,6 +606,28 @@ var (
 		Measure:     RcmgrBlockMem,
 		Aggregation: view.Count(),
 	}
+
+	// locator
+	SchedulerProbeDurationView = &view.View{
+		Measure:     SchedulerProbeDuration,
+		Aggregation: defaultMillisecondsDistribution,
+		TagKeys:     []tag.Key{SchedulerURL},
+	}
+	SchedulerProbeFailureView = &view.View{
+		Measure:     SchedulerProbeFailure,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{SchedulerURL},
+	}
+	SchedulerCircuitOpenView = &view.View{
+		Measure:     SchedulerCircuitOpen,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{SchedulerURL},
+	}
+	SchedulerOnlineNodesView = &view.View{
+		Measure:     SchedulerOnlineNodes,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{SchedulerURL},
+	}
 )
 
 // DefaultViews is an array of OpenCensus views for metric gathering purposes
@@ -708,6 +739,13 @@ var MinerNodeViews = append([]*view.View{
 	DagStorePRSeekForwardBytesView,
 }, DefaultViews...)
 
+var LocatorNodeViews = append([]*view.View{
+	SchedulerProbeDurationView,
+	SchedulerProbeFailureView,
+	SchedulerCircuitOpenView,
+	SchedulerOnlineNodesView,
+}, DefaultViews...)
+
 // SinceInMilliseconds returns the duration of time since the provide time as a float64.
 func SinceInMilliseconds(startTime time.Time) float64 {
 	return float64(time.Since(startTime).Nanoseconds()) / 1e6
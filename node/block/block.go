@@ -19,6 +19,7 @@ import (
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/lib/denylist"
 	"github.com/linguohua/titan/node/helper"
 
 	format "github.com/ipfs/go-ipld-format"
@@ -35,12 +36,16 @@ type delayReq struct {
 	candidateURL string
 	carFileCid   string
 	CacheID      string
+	// ticket to download block from candidate
+	downloadTicket string
 }
 
 type blockStat struct {
 	cid        string
 	fid        string
 	links      []string
+	linkNames  []string
+	linkSizes  []uint64
 	blockSize  int
 	linksSize  uint64
 	carFileCid string
@@ -60,6 +65,8 @@ type Block struct {
 	exchange      exchange.Interface
 	blockLoaderCh chan bool
 	ipfsGateway   string
+	// denied blocks and carfiles are not loaded, and deleted when the denylist changed
+	denied *denylist.Filter
 }
 
 // TODO need to rename
@@ -67,7 +74,7 @@ type BlockInterface interface {
 	loadBlocks(block *Block, req []*delayReq)
 }
 
-func NewBlock(ds datastore.Batching, blockStore blockstore.BlockStore, scheduler api.Scheduler, blockInterface BlockInterface, ipfsGateway, deviceID string) *Block {
+func NewBlock(ds datastore.Batching, blockStore blockstore.BlockStore, scheduler api.Scheduler, blockInterface BlockInterface, ipfsGateway, deviceID string, denied *denylist.Filter) *Block {
 	block := &Block{
 		ds:         ds,
 		blockStore: blockStore,
@@ -80,6 +87,12 @@ func NewBlock(ds datastore.Batching, blockStore blockstore.BlockStore, scheduler
 		reqListLock:   &sync.Mutex{},
 		blockLoaderCh: make(chan bool),
 		ipfsGateway:   ipfsGateway,
+		denied:        denied,
+	}
+
+	if denied != nil {
+		denied.Notify(block.purgeDenied)
+		go block.purgeDenied()
 	}
 
 	go block.startBlockLoader()
@@ -97,7 +110,7 @@ func apiReq2DelayReq(req *api.ReqCacheData) []*delayReq {
 			continue
 		}
 
-		req := &delayReq{blockInfo: blockInfo, count: 0, candidateURL: req.CandidateURL, carFileCid: req.CardFileCid, CacheID: req.CacheID}
+		req := &delayReq{blockInfo: blockInfo, count: 0, candidateURL: req.CandidateURL, carFileCid: req.CardFileCid, CacheID: req.CacheID, downloadTicket: req.DownloadTicket}
 		results = append(results, req)
 	}
 
@@ -145,7 +158,10 @@ func (block *Block) doLoadBlock() {
 			doLen = helper.Batch
 		}
 
-		doReqs := block.dequeue(doLen)
+		doReqs := block.filterDeniedReq(block.dequeue(doLen))
+		if len(doReqs) == 0 {
+			continue
+		}
 		block.cachingList = doReqs
 
 		block.block.loadBlocks(block, doReqs)
@@ -153,6 +169,91 @@ func (block *Block) doLoadBlock() {
 	}
 }
 
+// filterDeniedReq the reqs of denied blocks and carfiles are failed
+func (block *Block) filterDeniedReq(reqs []*delayReq) []*delayReq {
+	results := make([]*delayReq, 0, len(reqs))
+	for _, req := range reqs {
+		if !block.denied.Denied(req.blockInfo.Cid) && !block.denied.Denied(req.carFileCid) {
+			results = append(results, req)
+			continue
+		}
+
+		bStat := blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}
+		block.cacheResultWithError(context.Background(), bStat, fmt.Errorf("cid %s is denied", req.blockInfo.Cid))
+	}
+
+	return results
+}
+
+// purgeDenied delete the denied blocks and the blocks of denied carfiles
+func (block *Block) purgeDenied() {
+	if block.denied.Len() == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	cids := make(map[string]struct{})
+
+	results, err := block.ds.Query(ctx, query.Query{Prefix: helper.KeyCarfilePrefix, KeysOnly: true})
+	if err != nil {
+		log.Errorf("purgeDenied query carfile blocks error:%v", err)
+		return
+	}
+
+	carfileKeys := make([]datastore.Key, 0)
+	for r := range results.Next() {
+		if r.Error != nil {
+			continue
+		}
+
+		// /carfile/<carfile cid>/<block cid>
+		parts := datastore.NewKey(r.Key).Namespaces()
+		if len(parts) != 3 {
+			continue
+		}
+
+		if block.denied.Denied(parts[1]) || block.denied.Denied(parts[2]) {
+			cids[parts[2]] = struct{}{}
+			carfileKeys = append(carfileKeys, datastore.NewKey(r.Key))
+		}
+	}
+	results.Close()
+
+	keys, err := block.blockStore.GetAllKeys()
+	if err != nil {
+		log.Errorf("purgeDenied get blockstore keys error:%v", err)
+	}
+
+	for _, key := range keys {
+		if block.denied.Denied(key) {
+			cids[key] = struct{}{}
+		}
+	}
+
+	if len(cids) == 0 {
+		return
+	}
+
+	list := make([]string, 0, len(cids))
+	for c := range cids {
+		list = append(list, c)
+	}
+
+	log.Infof("purgeDenied delete %d denied blocks", len(list))
+
+	_, err = block.AnnounceBlocksWasDelete(ctx, list)
+	if err != nil {
+		log.Errorf("purgeDenied delete blocks error:%v", err)
+		return
+	}
+
+	for _, key := range carfileKeys {
+		if err := block.ds.Delete(ctx, key); err != nil {
+			log.Errorf("purgeDenied delete key %s error:%v", key, err)
+		}
+	}
+}
+
 func (block *Block) addReq2WaitList(delayReqs []*delayReq) {
 	block.enqueue(delayReqs)
 	block.notifyBlockLoader()
@@ -177,6 +278,8 @@ func (block *Block) cacheResult(ctx context.Context, from string, err error, bSt
 		Msg:        errMsg,
 		From:       from,
 		Links:      bStat.links,
+		LinkNames:  bStat.linkNames,
+		LinkSizes:  bStat.linkSizes,
 		BlockSize:  bStat.blockSize,
 		LinksSize:  bStat.linksSize,
 		CarFileCid: bStat.carFileCid,
@@ -184,6 +287,14 @@ func (block *Block) cacheResult(ctx context.Context, from string, err error, bSt
 		Fid:        bStat.fid,
 	}
 
+	if success && bStat.carFileCid != "" {
+		// download ticket of carfile check the block with this key
+		err = block.ds.Put(ctx, helper.NewKeyCarfileBlock(bStat.carFileCid, bStat.cid), []byte{})
+		if err != nil {
+			log.Errorf("cacheResult save carfile block error:%v", err)
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
@@ -260,12 +371,16 @@ func (block *Block) filterAvailableReq(reqs []*delayReq) []*delayReq {
 
 			linksSize := uint64(0)
 			cids := make([]string, 0, len(links))
+			names := make([]string, 0, len(links))
+			sizes := make([]uint64, 0, len(links))
 			for _, link := range links {
 				cids = append(cids, link.Cid.String())
+				names = append(names, link.Name)
+				sizes = append(sizes, link.Size)
 				linksSize += link.Size
 			}
 
-			bStat := blockStat{cid: cidStr, fid: reqData.blockInfo.Fid, links: cids, blockSize: len(buf), linksSize: linksSize, carFileCid: reqData.carFileCid, CacheID: reqData.CacheID}
+			bStat := blockStat{cid: cidStr, fid: reqData.blockInfo.Fid, links: cids, linkNames: names, linkSizes: sizes, blockSize: len(buf), linksSize: linksSize, carFileCid: reqData.carFileCid, CacheID: reqData.CacheID}
 			block.cacheResult(ctx, from, nil, bStat)
 			continue
 		}
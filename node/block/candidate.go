@@ -3,24 +3,47 @@ package block
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 
+	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/api/client"
+	"github.com/linguohua/titan/lib/car"
+	"github.com/linguohua/titan/node/cert"
+	"github.com/linguohua/titan/node/helper"
 )
 
 type Candidate struct {
 	deviceID   string
 	downSrvURL string
-	token      string
 }
 
 func (candidate *Candidate) loadBlocks(block *Block, req []*delayReq) {
 	loadBlocksFromCandidate(block, req)
 }
 
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+// download server of candidate may serve https with certificate issued by scheduler,
+// the tls config is set before blocks downloaded
+func candidateHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = client.TLSConfig()
+		httpClient = &http.Client{Transport: transport}
+	})
+
+	return httpClient
+}
+
 func getBlockFromCandidate(url string, tk string) ([]byte, error) {
-	client := &http.Client{}
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -29,7 +52,7 @@ func getBlockFromCandidate(url string, tk string) ([]byte, error) {
 	req.Header.Set("Token", tk)
 	req.Header.Set("App-Name", "edge")
 
-	resp, err := client.Do(req)
+	resp, err := candidateHTTPClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -43,6 +66,7 @@ func getCandidate(candidateURL string) (*Candidate, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	cert.SetPeerTLS(candidateURL, string(api.TypeNameCandidate))
 	api, close, err := client.NewCandicate(ctx, candidateURL, nil)
 	if err != nil {
 		log.Errorf("getCandidateAPI, NewCandicate err:%v", err)
@@ -62,7 +86,7 @@ func getCandidate(candidateURL string) (*Candidate, error) {
 		return nil, err
 	}
 
-	candidate := &Candidate{deviceID: info.DeviceId, downSrvURL: download.URL, token: download.Token}
+	candidate := &Candidate{deviceID: info.DeviceId, downSrvURL: download.URL}
 	return candidate, nil
 }
 
@@ -85,47 +109,140 @@ func loadBlocksFromCandidate(block *Block, reqs []*delayReq) {
 	defer cancel()
 
 	candidateMap := make(map[string]*Candidate)
-	for _, req := range reqs {
-		candidate, err := getCandidateWithMap(candidateMap, req.candidateURL)
+	for _, group := range groupReqsByCandidate(reqs) {
+		candidate, err := getCandidateWithMap(candidateMap, group[0].candidateURL)
 		if err != nil {
 			log.Errorf("getCandidateWithMap error:%v", err)
-			block.cacheResultWithError(ctx, blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}, err)
+			for _, req := range group {
+				block.cacheResultWithError(ctx, blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}, err)
+			}
 			continue
 		}
 
-		url := fmt.Sprintf("%s?cid=%s", candidate.downSrvURL, req.blockInfo.Cid)
-
-		data, err := getBlockFromCandidate(url, candidate.token)
+		blks, err := getBlocksFromCandidate(candidate.downSrvURL, group)
 		if err != nil {
-			log.Errorf("loadBlocksFromCandidate get block from candidate error:%s", err.Error())
-			block.cacheResultWithError(ctx, blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}, err)
-			continue
+			// candidate without batch download, download by block
+			log.Warnf("loadBlocksFromCandidate get blocks from candidate %s error:%s", candidate.deviceID, err.Error())
 		}
 
-		err = block.saveBlock(ctx, data, req.blockInfo.Cid, req.blockInfo.Fid)
-		if err != nil {
-			log.Errorf("loadBlocksFromCandidate save block error:%s", err.Error())
-			block.cacheResultWithError(ctx, blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}, err)
-			continue
+		for _, req := range group {
+			data, ok := blks[req.blockInfo.Cid]
+			if !ok {
+				url := fmt.Sprintf("%s?cid=%s", candidate.downSrvURL, req.blockInfo.Cid)
+
+				data, err = getBlockFromCandidate(url, req.downloadTicket)
+				if err != nil {
+					log.Errorf("loadBlocksFromCandidate get block from candidate error:%s", err.Error())
+					block.cacheResultWithError(ctx, blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}, err)
+					continue
+				}
+			}
+
+			saveBlockFromCandidate(ctx, block, candidate, req, data)
 		}
+	}
+}
+
+// groupReqsByCandidate blocks of the same candidate and ticket are downloaded by one batch request
+func groupReqsByCandidate(reqs []*delayReq) [][]*delayReq {
+	groups := make([][]*delayReq, 0)
+	index := make(map[string]int)
+	for _, req := range reqs {
+		key := req.candidateURL + "/" + req.downloadTicket
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], req)
+	}
+
+	return groups
+}
+
+// getBlocksFromCandidate download the blocks in car format, blocks not returned by candidate are not in the result
+func getBlocksFromCandidate(downSrvURL string, reqs []*delayReq) (map[string][]byte, error) {
+	form := url.Values{}
+	for _, req := range reqs {
+		form.Add("cid", req.blockInfo.Cid)
+	}
+
+	batchURL := strings.TrimSuffix(downSrvURL, helper.DownloadSrvPath) + helper.DownloadBatchPath
+	req, err := http.NewRequest("POST", batchURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
 
-		links, err := getLinks(block, data, req.blockInfo.Cid)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Token", reqs[0].downloadTicket)
+	req.Header.Set("App-Name", "edge")
+
+	resp, err := candidateHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("batch download status %d", resp.StatusCode)
+	}
+
+	cr, err := car.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	blks := make(map[string][]byte, len(reqs))
+	for {
+		c, data, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			log.Errorf("loadBlocksFromCandidate resolveLinks error:%s", err.Error())
-			block.cacheResultWithError(ctx, blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}, err)
-			continue
+			// blocks received before are still saved
+			return blks, err
 		}
 
-		linksSize := uint64(0)
-		cids := make([]string, 0, len(links))
-		for _, link := range links {
-			cids = append(cids, link.Cid.String())
-			linksSize += link.Size
+		sum, err := c.Prefix().Sum(data)
+		if err != nil || !sum.Equals(c) {
+			return blks, fmt.Errorf("block %s mismatch its cid", c)
 		}
 
-		bInfo := blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, links: cids, blockSize: len(data), linksSize: linksSize, carFileCid: req.carFileCid, CacheID: req.CacheID}
-		block.cacheResult(ctx, candidate.deviceID, nil, bInfo)
+		blks[c.String()] = data
+	}
 
-		log.Infof("loadBlocksFromCandidate, cid:%s,err:%v", req.blockInfo.Cid, err)
+	return blks, nil
+}
+
+func saveBlockFromCandidate(ctx context.Context, block *Block, candidate *Candidate, req *delayReq, data []byte) {
+	err := block.saveBlock(ctx, data, req.blockInfo.Cid, req.blockInfo.Fid)
+	if err != nil {
+		log.Errorf("loadBlocksFromCandidate save block error:%s", err.Error())
+		block.cacheResultWithError(ctx, blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}, err)
+		return
 	}
+
+	links, err := getLinks(block, data, req.blockInfo.Cid)
+	if err != nil {
+		log.Errorf("loadBlocksFromCandidate resolveLinks error:%s", err.Error())
+		block.cacheResultWithError(ctx, blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, carFileCid: req.carFileCid, CacheID: req.CacheID}, err)
+		return
+	}
+
+	linksSize := uint64(0)
+	cids := make([]string, 0, len(links))
+	names := make([]string, 0, len(links))
+	sizes := make([]uint64, 0, len(links))
+	for _, link := range links {
+		cids = append(cids, link.Cid.String())
+		names = append(names, link.Name)
+		sizes = append(sizes, link.Size)
+		linksSize += link.Size
+	}
+
+	bInfo := blockStat{cid: req.blockInfo.Cid, fid: req.blockInfo.Fid, links: cids, linkNames: names, linkSizes: sizes, blockSize: len(data), linksSize: linksSize, carFileCid: req.carFileCid, CacheID: req.CacheID}
+	block.cacheResult(ctx, candidate.deviceID, nil, bInfo)
+
+	log.Infof("loadBlocksFromCandidate, cid:%s", req.blockInfo.Cid)
 }
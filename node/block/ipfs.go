@@ -175,12 +175,16 @@ func loadBlocksFromIPFS(block *Block, req []*delayReq) {
 
 		linksSize := uint64(0)
 		cids := make([]string, 0, len(links))
+		names := make([]string, 0, len(links))
+		sizes := make([]uint64, 0, len(links))
 		for _, link := range links {
 			cids = append(cids, link.Cid.String())
+			names = append(names, link.Name)
+			sizes = append(sizes, link.Size)
 			linksSize += link.Size
 		}
 
-		bStat := blockStat{cid: cidStr, fid: req.blockInfo.Fid, links: cids, blockSize: len(b.RawData()), linksSize: linksSize, carFileCid: req.carFileCid, CacheID: req.CacheID}
+		bStat := blockStat{cid: cidStr, fid: req.blockInfo.Fid, links: cids, linkNames: names, linkSizes: sizes, blockSize: len(b.RawData()), linksSize: linksSize, carFileCid: req.carFileCid, CacheID: req.CacheID}
 		block.cacheResult(ctx, from, nil, bStat)
 
 		log.Infof("cache data,cid:%s,err:%v", cidStr, err)
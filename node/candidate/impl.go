@@ -16,6 +16,7 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/linguohua/titan/node/block"
+	"github.com/linguohua/titan/node/cert"
 	"github.com/linguohua/titan/node/common"
 	"github.com/linguohua/titan/node/device"
 	"github.com/linguohua/titan/node/download"
@@ -43,7 +44,7 @@ func NewLocalCandidateNode(ctx context.Context, tcpSrvAddr string, device *devic
 	rateLimiter := rate.NewLimiter(rate.Limit(device.GetBandwidthUp()), int(device.GetBandwidthUp()))
 	blockDownload := download.NewBlockDownload(rateLimiter, params, device)
 
-	block := block.NewBlock(params.DS, params.BlockStore, params.Scheduler, &block.IPFS{}, params.IPFSGateway, device.GetDeviceID())
+	block := block.NewBlock(params.DS, params.BlockStore, params.Scheduler, &block.IPFS{}, params.IPFSGateway, device.GetDeviceID(), params.Denylist)
 	validate := vd.NewValidate(blockDownload, block, device.GetDeviceID())
 
 	candidate := &Candidate{
@@ -53,6 +54,7 @@ func NewLocalCandidateNode(ctx context.Context, tcpSrvAddr string, device *devic
 		Validate:      validate,
 		scheduler:     params.Scheduler,
 		tcpSrvAddr:    tcpSrvAddr,
+		relay:         newRelay(),
 	}
 
 	go candidate.startTcpServer()
@@ -94,6 +96,7 @@ type Candidate struct {
 	scheduler      api.Scheduler
 	tcpSrvAddr     string
 	blockWaiterMap sync.Map
+	relay          *relay
 }
 
 func (candidate *Candidate) WaitQuiet(ctx context.Context) error {
@@ -112,6 +115,33 @@ func (candidate *Candidate) ValidateBlocks(ctx context.Context, req []api.ReqVal
 	return nil
 }
 
+// timeout of dialing the address of reachability checking
+const reachabilityDialTimeout = 3 * time.Second
+
+func (candidate *Candidate) CheckReachability(ctx context.Context, addrs []string) ([]bool, error) {
+	results := make([]bool, len(addrs))
+
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+
+			dialer := net.Dialer{Timeout: reachabilityDialTimeout}
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				log.Debugf("check reachability %s err:%s", addr, err.Error())
+				return
+			}
+			conn.Close()
+			results[i] = true
+		}(i, addr)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
 func (candidate *Candidate) loadBlockWaiterFromMap(key string) (*blockWaiter, bool) {
 	vb, ok := candidate.blockWaiterMap.Load(key)
 	if ok {
@@ -247,8 +277,10 @@ func getNodeApi(nodeType int, nodeURL string) (nodeAPI, jsonrpc.ClientCloser, er
 	defer cancel()
 
 	if nodeType == int(api.NodeEdge) {
+		cert.SetPeerTLS(nodeURL, string(api.TypeNameEdge))
 		return client.NewEdge(ctx, nodeURL, nil)
 	} else if nodeType == int(api.NodeCandidate) {
+		cert.SetPeerTLS(nodeURL, string(api.TypeNameCandidate))
 		return client.NewCandicate(ctx, nodeURL, nil)
 	}
 
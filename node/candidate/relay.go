@@ -0,0 +1,83 @@
+package candidate
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/linguohua/titan/node/tunnel"
+)
+
+// relay edges in reverse connection mode, users download from the edge through the candidate
+type relay struct {
+	hub *tunnel.Hub
+
+	lk sync.Mutex
+	// deviceID:key issued by scheduler
+	keys map[string]string
+}
+
+func newRelay() *relay {
+	return &relay{hub: tunnel.NewHub(nil), keys: make(map[string]string)}
+}
+
+func (candidate *Candidate) AllowRelay(ctx context.Context, deviceID, key string) error {
+	candidate.relay.lk.Lock()
+	candidate.relay.keys[deviceID] = key
+	candidate.relay.lk.Unlock()
+
+	return nil
+}
+
+// RelayHandler accept the tunnels of edges and relay the requests to them
+func (candidate *Candidate) RelayHandler() http.Handler {
+	return candidate.relay
+}
+
+func (r *relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == tunnel.Path {
+		r.acceptTunnel(w, req)
+		return
+	}
+
+	// /relay/{deviceID}/rpc/v0 to rpc server, others to download server of the edge
+	rest := strings.TrimPrefix(req.URL.Path, tunnel.RelayPath)
+	deviceID := rest
+	if i := strings.Index(rest, "/"); i >= 0 {
+		deviceID = rest[:i]
+	}
+
+	if deviceID == "" || !r.hub.IsConnected(deviceID) {
+		http.NotFound(w, req)
+		return
+	}
+
+	prefix := tunnel.RelayPath + deviceID
+	target := tunnel.TargetDownload
+	if strings.HasPrefix(strings.TrimPrefix(req.URL.Path, prefix), "/rpc/") {
+		target = tunnel.TargetRPC
+	}
+
+	r.hub.ReverseProxy(deviceID, target, prefix).ServeHTTP(w, req)
+}
+
+func (r *relay) acceptTunnel(w http.ResponseWriter, req *http.Request) {
+	deviceID := req.Header.Get(tunnel.HeaderDeviceID)
+	key := req.Header.Get(tunnel.HeaderRelayKey)
+
+	r.lk.Lock()
+	allowed, ok := r.keys[deviceID]
+	r.lk.Unlock()
+
+	if !ok || key == "" || subtle.ConstantTimeCompare([]byte(allowed), []byte(key)) != 1 {
+		log.Warnf("relay tunnel of %s is not allowed, remote:%s", deviceID, req.RemoteAddr)
+		http.Error(w, "relay is not allowed", http.StatusForbidden)
+		return
+	}
+
+	if err := r.hub.Accept(deviceID, w, req); err != nil {
+		log.Errorf("accept relay tunnel of %s err:%s", deviceID, err.Error())
+	}
+}
@@ -0,0 +1,64 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+
+	"github.com/linguohua/titan/node/repo"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/xerrors"
+)
+
+// acmeTLSConfig certificate of the hostname obtained from the acme server by tls-alpn challenge,
+// the download server must be reachable on port 443 of the hostname
+func acmeTLSConfig(lr repo.LockedRepo, opts DownloadTLSOptions) (*tls.Config, error) {
+	if opts.Hostname == "" {
+		return nil, xerrors.New("acme need the hostname of the download server")
+	}
+
+	client := &acme.Client{DirectoryURL: opts.ACMEDirectory}
+	if opts.ACMECA != "" {
+		pool, err := loadCertPool(opts.ACMECA)
+		if err != nil {
+			return nil, err
+		}
+
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(filepath.Join(lr.Path(), "acme")),
+		HostPolicy: autocert.HostWhitelist(opts.Hostname),
+		Email:      opts.ACMEEmail,
+		Client:     client,
+	}
+
+	cfg := m.TLSConfig()
+	cfg.MinVersion = tls.VersionTLS12
+
+	return cfg, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, xerrors.Errorf("no certificate in %s", path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,348 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/linguohua/titan/node/repo"
+	"github.com/linguohua/titan/node/types"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("cert")
+
+const (
+	// KeyName node or scheduler tls key
+	KeyName = "tls-private"
+	// CAKeyName scheduler ca key
+	CAKeyName = "tls-ca-private"
+	// CACertName scheduler ca certificate
+	CACertName = "tls-ca-cert"
+	// TrustedCAName ca certificate node trusted
+	TrustedCAName = "tls-trusted-ca"
+
+	// UnitScheduler organizational unit of the scheduler certificate
+	UnitScheduler = "scheduler"
+
+	KTECDSAPrivate types.KeyType = "ecdsa-p256-private"
+	KTX509Cert     types.KeyType = "x509-cert"
+
+	caCommonName = "titan-scheduler-ca"
+	certValidity = 365 * 24 * time.Hour
+)
+
+// LoadOrCreateKey load the ecdsa key from repo keystore, create it if not exist
+func LoadOrCreateKey(lr repo.LockedRepo, name string) (*ecdsa.PrivateKey, error) {
+	keystore, err := lr.KeyStore()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := keystore.Get(name)
+	if errors.Is(err, types.ErrKeyInfoNotFound) {
+		log.Warnf("Generating new tls key %s", name)
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := keystore.Put(name, types.KeyInfo{Type: KTECDSAPrivate, PrivateKey: der}); err != nil {
+			return nil, xerrors.Errorf("writing tls key: %w", err)
+		}
+
+		return key, nil
+	} else if err != nil {
+		return nil, xerrors.Errorf("could not get tls key: %w", err)
+	}
+
+	return x509.ParseECPrivateKey(info.PrivateKey)
+}
+
+// LoadCert load the certificate DER from repo keystore
+func LoadCert(lr repo.LockedRepo, name string) ([]byte, error) {
+	keystore, err := lr.KeyStore()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := keystore.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return info.PrivateKey, nil
+}
+
+// SaveCert save the certificate DER to repo keystore
+func SaveCert(lr repo.LockedRepo, name string, der []byte) error {
+	keystore, err := lr.KeyStore()
+	if err != nil {
+		return err
+	}
+
+	err = keystore.Delete(name)
+	if err != nil && !errors.Is(err, types.ErrKeyInfoNotFound) {
+		return err
+	}
+
+	return keystore.Put(name, types.KeyInfo{Type: KTX509Cert, PrivateKey: der})
+}
+
+// Fingerprint sha256 hex of the certificate DER
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchFingerprint fingerprint may be in upper case or separated by colons
+func MatchFingerprint(der []byte, fingerprint string) bool {
+	fingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+	return Fingerprint(der) == fingerprint
+}
+
+// TrustCA save the scheduler ca verified by the fingerprint, later ca must be the same
+func TrustCA(lr repo.LockedRepo, caDER []byte) error {
+	old, err := LoadCert(lr, TrustedCAName)
+	if err == nil {
+		if !bytes.Equal(old, caDER) {
+			return xerrors.New("scheduler ca mismatch with the trusted ca")
+		}
+		return nil
+	}
+
+	if !errors.Is(err, types.ErrKeyInfoNotFound) {
+		return err
+	}
+
+	return SaveCert(lr, TrustedCAName, caDER)
+}
+
+// NewCSR create a certificate request for the device
+func NewCSR(key *ecdsa.PrivateKey, deviceID string) ([]byte, error) {
+	tmpl := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: deviceID},
+	}
+
+	return x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+}
+
+// NewTLSConfig tls config for both server and client side.
+// Peer certificates must be issued by the ca, host names are not checked,
+// peer identity is the certificate common name.
+func NewTLSConfig(key *ecdsa.PrivateKey, certDER, caDER []byte) (*tls.Config, error) {
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	// ca is sent in the chain, node can check it by the fingerprint before trusted
+	certificate := tls.Certificate{
+		Certificate: [][]byte{certDER, caDER},
+		PrivateKey:  key,
+	}
+
+	verify := func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return xerrors.New("peer certificate not found")
+		}
+
+		c, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+
+		_, err = c.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		return err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+		// host name is not used as identity, VerifyPeerCertificate check the chain
+		InsecureSkipVerify:    true, //nolint:gosec
+		VerifyPeerCertificate: verify,
+	}, nil
+}
+
+// PeerCheck check the peer certificate after the chain verified
+type PeerCheck func(c *x509.Certificate) error
+
+// WithPeerCheck copy of the tls config which also check the peer certificate
+func WithPeerCheck(cfg *tls.Config, check PeerCheck) *tls.Config {
+	out := cfg.Clone()
+	verify := cfg.VerifyPeerCertificate
+
+	out.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+		if verify != nil {
+			if err := verify(rawCerts, chains); err != nil {
+				return err
+			}
+		}
+
+		if len(rawCerts) == 0 {
+			return xerrors.New("peer certificate not found")
+		}
+
+		c, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+
+		return check(c)
+	}
+
+	return out
+}
+
+// ExpectUnit peer certificate must be of the organizational unit, such as scheduler, edge or candidate
+func ExpectUnit(unit string) PeerCheck {
+	return func(c *x509.Certificate) error {
+		for _, u := range c.Subject.OrganizationalUnit {
+			if u == unit {
+				return nil
+			}
+		}
+
+		return xerrors.Errorf("peer %s is not %s", c.Subject.CommonName, unit)
+	}
+}
+
+// ExpectCommonName peer certificate must be of the device
+func ExpectCommonName(name string) PeerCheck {
+	return func(c *x509.Certificate) error {
+		if c.Subject.CommonName != name {
+			return xerrors.Errorf("peer %s mismatch %s", c.Subject.CommonName, name)
+		}
+
+		return nil
+	}
+}
+
+// PeerID common name of the verified peer certificate
+func PeerID(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	return state.PeerCertificates[0].Subject.CommonName
+}
+
+// CA scheduler certificate authority
+type CA struct {
+	key     *ecdsa.PrivateKey
+	cert    *x509.Certificate
+	certDER []byte
+}
+
+// NewCA load or create the ca in scheduler repo keystore
+func NewCA(lr repo.LockedRepo) (*CA, error) {
+	key, err := LoadOrCreateKey(lr, CAKeyName)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := LoadCert(lr, CACertName)
+	if errors.Is(err, types.ErrKeyInfoNotFound) {
+		tmpl := &x509.Certificate{
+			SerialNumber:          newSerialNumber(),
+			Subject:               pkix.Name{CommonName: caCommonName},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(10 * certValidity),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+
+		der, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			return nil, err
+		}
+
+		err = SaveCert(lr, CACertName, der)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{key: key, cert: c, certDER: der}, nil
+}
+
+// CertDER ca certificate
+func (ca *CA) CertDER() []byte {
+	return ca.certDER
+}
+
+// IssueCert sign a certificate for the public key
+func (ca *CA) IssueCert(pub *ecdsa.PublicKey, commonName, unit string) ([]byte, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: []string{unit}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+
+	return x509.CreateCertificate(rand.Reader, tmpl, ca.cert, pub, ca.key)
+}
+
+// IssueNodeCert check the certificate request and sign it
+func (ca *CA) IssueNodeCert(csrDER []byte, deviceID, unit string) ([]byte, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+
+	if csr.Subject.CommonName != deviceID {
+		return nil, xerrors.Errorf("csr common name %s mismatch device %s", csr.Subject.CommonName, deviceID)
+	}
+
+	pub, ok := csr.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, xerrors.New("csr public key is not ecdsa")
+	}
+
+	return ca.IssueCert(pub, deviceID, unit)
+}
+
+func newSerialNumber() *big.Int {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return n
+}
@@ -0,0 +1,174 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/linguohua/titan/node/repo"
+)
+
+func newTestRepo(t *testing.T) repo.LockedRepo {
+	r, err := repo.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Init(repo.Worker); err != nil {
+		t.Fatal(err)
+	}
+
+	lr, err := r.Lock(repo.Worker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lr.Close() })
+
+	return lr
+}
+
+type testPeer struct {
+	key  *ecdsa.PrivateKey
+	cert []byte
+	cfg  *tls.Config
+}
+
+func newTestPeer(t *testing.T, lr repo.LockedRepo, ca *CA, name, unit string) *testPeer {
+	key, err := LoadOrCreateKey(lr, "key-"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certDER, err := ca.IssueCert(&key.PublicKey, name, unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewTLSConfig(key, certDER, ca.CertDER())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testPeer{key: key, cert: certDER, cfg: cfg}
+}
+
+// handshake client dial the server by the config
+func handshake(clientCfg, serverCfg *tls.Config) error {
+	_, err := handshakeState(clientCfg, serverCfg)
+	return err
+}
+
+// handshakeState connection state of the client after handshake
+func handshakeState(clientCfg, serverCfg *tls.Config) (tls.ConnectionState, error) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		server := tls.Server(s, serverCfg)
+		done <- server.Handshake()
+		server.Close()
+	}()
+
+	client := tls.Client(c, clientCfg)
+	err := client.Handshake()
+	s.Close()
+	<-done
+
+	return client.ConnectionState(), err
+}
+
+func TestPeerCheck(t *testing.T) {
+	lr := newTestRepo(t)
+
+	ca, err := NewCA(lr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := newTestPeer(t, lr, ca, "scheduler_test", UnitScheduler)
+	edge := newTestPeer(t, lr, ca, "edge1", "edge")
+
+	if err := handshake(WithPeerCheck(edge.cfg, ExpectUnit(UnitScheduler)), scheduler.cfg); err != nil {
+		t.Errorf("node dial scheduler: %v", err)
+	}
+
+	other := newTestPeer(t, lr, ca, "edge2", "edge")
+	if err := handshake(WithPeerCheck(edge.cfg, ExpectUnit(UnitScheduler)), other.cfg); err == nil {
+		t.Error("node accept edge as scheduler")
+	}
+
+	if err := handshake(WithPeerCheck(scheduler.cfg, ExpectCommonName("edge1")), edge.cfg); err != nil {
+		t.Errorf("scheduler dial node: %v", err)
+	}
+
+	if err := handshake(WithPeerCheck(scheduler.cfg, ExpectCommonName("edge1")), other.cfg); err == nil {
+		t.Error("scheduler accept edge2 as edge1")
+	}
+
+	otherCA, err := NewCA(newTestRepo(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newTestPeer(t, lr, otherCA, "scheduler_fake", UnitScheduler)
+	if err := handshake(WithPeerCheck(edge.cfg, ExpectUnit(UnitScheduler)), fake.cfg); err == nil {
+		t.Error("node accept scheduler of other ca")
+	}
+}
+
+func TestVerifyScheduler(t *testing.T) {
+	lr := newTestRepo(t)
+
+	ca, err := NewCA(lr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := newTestPeer(t, lr, ca, "scheduler_test", UnitScheduler)
+	edge := newTestPeer(t, lr, ca, "edge1", "edge")
+
+	fingerprint := Fingerprint(ca.CertDER())
+	chain := [][]byte{scheduler.cert, ca.CertDER()}
+
+	if err := verifyScheduler(nil, fingerprint)(chain, nil); err != nil {
+		t.Errorf("verify by fingerprint: %v", err)
+	}
+
+	if err := verifyScheduler(ca.CertDER(), "")(chain[:1], nil); err != nil {
+		t.Errorf("verify by trusted ca: %v", err)
+	}
+
+	if err := verifyScheduler(nil, fingerprint)(chain[:1], nil); err == nil {
+		t.Error("verify without ca in chain")
+	}
+
+	if err := verifyScheduler(nil, strings.Repeat("0", 64))(chain, nil); err == nil {
+		t.Error("verify by wrong fingerprint")
+	}
+
+	if err := verifyScheduler(nil, fingerprint)([][]byte{edge.cert, ca.CertDER()}, nil); err == nil {
+		t.Error("verify edge as scheduler")
+	}
+}
+
+func TestMatchFingerprint(t *testing.T) {
+	der := []byte("certificate")
+	fingerprint := Fingerprint(der)
+
+	var parts []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		parts = append(parts, strings.ToUpper(fingerprint[i:i+2]))
+	}
+
+	if !MatchFingerprint(der, strings.Join(parts, ":")) {
+		t.Error("fingerprint in upper case with colons not match")
+	}
+
+	if MatchFingerprint(der, fingerprint[1:]) {
+		t.Error("short fingerprint match")
+	}
+}
@@ -0,0 +1,267 @@
+package cert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/repo"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// DownloadKeyName key of the download server certificate
+	DownloadKeyName = "tls-download-private"
+
+	// download certificate is renewed before expired
+	downloadRenewBefore = 30 * 24 * time.Hour
+	downloadRetryDelay  = time.Minute
+)
+
+// download server tls mode
+const (
+	DownloadTLSScheduler = "scheduler"
+	DownloadTLSACME      = "acme"
+)
+
+// DownloadHostname per-node hostname of the download server under the domain, empty if no domain
+func DownloadHostname(deviceID, domain string) string {
+	if domain == "" {
+		return ""
+	}
+
+	// underscore is not allowed in hostname
+	label := strings.ToLower(strings.ReplaceAll(deviceID, "_", "-"))
+	return label + "." + strings.TrimPrefix(domain, ".")
+}
+
+// LoadCA load the ca from pem files, for the ca trusted by browsers
+func LoadCA(certPath, keyPath string) (*CA, error) {
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, xerrors.Errorf("no certificate in %s", certPath)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, xerrors.Errorf("no key in %s", keyPath)
+	}
+
+	c, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parseECKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{key: key, cert: c, certDER: certBlock.Bytes}, nil
+}
+
+func parseECKey(der []byte) (*ecdsa.PrivateKey, error) {
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, xerrors.New("ca key is not ecdsa")
+	}
+
+	return ecKey, nil
+}
+
+// IssueDownloadCert sign the server certificate of the download server for the hostname and ip
+func (ca *CA) IssueDownloadCert(csrDER []byte, deviceID, hostname, ip string) ([]byte, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+
+	if csr.Subject.CommonName != deviceID {
+		return nil, xerrors.Errorf("csr common name %s mismatch device %s", csr.Subject.CommonName, deviceID)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: deviceID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if hostname != "" {
+		tmpl.DNSNames = []string{hostname}
+	}
+
+	if addr := net.ParseIP(ip); addr != nil {
+		tmpl.IPAddresses = []net.IP{addr}
+	}
+
+	if len(tmpl.DNSNames) == 0 && len(tmpl.IPAddresses) == 0 {
+		return nil, xerrors.Errorf("no hostname or ip for device %s", deviceID)
+	}
+
+	return x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+}
+
+// downloadCert certificate of the download server issued by scheduler, renewed before expired
+type downloadCert struct {
+	scheduler api.Scheduler
+	deviceID  string
+	secret    string
+	key       *ecdsa.PrivateKey
+
+	lk       sync.RWMutex
+	cert     *tls.Certificate
+	expire   time.Time
+	hostname string
+	renewing bool
+}
+
+func newDownloadCert(ctx context.Context, lr repo.LockedRepo, scheduler api.Scheduler, deviceID, secret string) (*downloadCert, error) {
+	key, err := LoadOrCreateKey(lr, DownloadKeyName)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &downloadCert{scheduler: scheduler, deviceID: deviceID, secret: secret, key: key}
+	if err := d.renew(ctx); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *downloadCert) renew(ctx context.Context) error {
+	csr, err := NewCSR(d.key, d.deviceID)
+	if err != nil {
+		return err
+	}
+
+	info, err := d.scheduler.GetDownloadCert(ctx, d.deviceID, d.secret, csr)
+	if err != nil {
+		return xerrors.Errorf("get download cert: %w", err)
+	}
+
+	if len(info.Certs) == 0 {
+		return xerrors.New("download cert is empty")
+	}
+
+	leaf, err := x509.ParseCertificate(info.Certs[0])
+	if err != nil {
+		return err
+	}
+
+	d.lk.Lock()
+	d.cert = &tls.Certificate{Certificate: info.Certs, PrivateKey: d.key, Leaf: leaf}
+	d.expire = leaf.NotAfter
+	d.hostname = info.Hostname
+	d.lk.Unlock()
+
+	log.Infof("download cert issued, hostname:%s, expire:%s", info.Hostname, leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+func (d *downloadCert) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	d.lk.Lock()
+	c := d.cert
+	if time.Until(d.expire) < downloadRenewBefore && !d.renewing {
+		d.renewing = true
+		go d.renewAsync()
+	}
+	d.lk.Unlock()
+
+	return c, nil
+}
+
+func (d *downloadCert) renewAsync() {
+	if err := d.renew(context.Background()); err != nil {
+		log.Errorf("renew download cert err:%s", err.Error())
+		// retry on later handshake
+		time.Sleep(downloadRetryDelay)
+	}
+
+	d.lk.Lock()
+	d.renewing = false
+	d.lk.Unlock()
+}
+
+// DownloadTLSOptions tls of the download server
+type DownloadTLSOptions struct {
+	// DownloadTLSScheduler or DownloadTLSACME, empty is disabled
+	Mode string
+	// hostname in download url, for acme it is the hostname of the certificate
+	Hostname string
+	// acme directory url
+	ACMEDirectory string
+	ACMEEmail     string
+	// pem file of the root ca of the acme server, for test ca
+	ACMECA string
+}
+
+// DownloadTLSConfig tls config of the download server and the hostname in download url,
+// hostname empty is the external ip, http/2 is negotiated by alpn
+func DownloadTLSConfig(ctx context.Context, lr repo.LockedRepo, scheduler api.Scheduler, deviceID, secret string, opts DownloadTLSOptions) (*tls.Config, string, error) {
+	switch opts.Mode {
+	case "":
+		return nil, "", nil
+	case DownloadTLSScheduler:
+		d, err := newDownloadCert(ctx, lr, scheduler, deviceID, secret)
+		if err != nil {
+			return nil, "", err
+		}
+
+		hostname := opts.Hostname
+		if hostname == "" {
+			hostname = d.hostname
+		}
+
+		return &tls.Config{
+			GetCertificate: d.getCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+			MinVersion:     tls.VersionTLS12,
+		}, hostname, nil
+	case DownloadTLSACME:
+		cfg, err := acmeTLSConfig(lr, opts)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return cfg, opts.Hostname, nil
+	}
+
+	return nil, "", xerrors.Errorf("unknown download tls mode %s", opts.Mode)
+}
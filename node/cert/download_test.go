@@ -0,0 +1,254 @@
+package cert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linguohua/titan/api"
+)
+
+// fakeScheduler issue download certificates by the ca
+type fakeScheduler struct {
+	api.Scheduler
+
+	ca       *CA
+	hostname string
+	calls    int32
+}
+
+func (s *fakeScheduler) GetDownloadCert(ctx context.Context, deviceID, secret string, csr []byte) (api.DownloadCertInfo, error) {
+	atomic.AddInt32(&s.calls, 1)
+
+	certDER, err := s.ca.IssueDownloadCert(csr, deviceID, s.hostname, "10.0.0.1")
+	if err != nil {
+		return api.DownloadCertInfo{}, err
+	}
+
+	return api.DownloadCertInfo{Certs: [][]byte{certDER, s.ca.CertDER()}, Hostname: s.hostname}, nil
+}
+
+func TestDownloadHostname(t *testing.T) {
+	if h := DownloadHostname("e_ABC", ".titan.io"); h != "e-abc.titan.io" {
+		t.Errorf("hostname %s", h)
+	}
+
+	if h := DownloadHostname("e_1", ""); h != "" {
+		t.Errorf("hostname without domain %s", h)
+	}
+}
+
+func TestIssueDownloadCert(t *testing.T) {
+	lr := newTestRepo(t)
+
+	ca, err := NewCA(lr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := NewCSR(key, "e_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ca.IssueDownloadCert(csr, "e_2", "e-2.titan.io", ""); err == nil {
+		t.Error("issue cert for csr of other device")
+	}
+
+	if _, err := ca.IssueDownloadCert(csr, "e_1", "", "not ip"); err == nil {
+		t.Error("issue cert without hostname and ip")
+	}
+
+	certDER, err := ca.IssueDownloadCert(csr, "e_1", "e-1.titan.io", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	for _, name := range []string{"e-1.titan.io", "10.0.0.1"} {
+		if _, err := c.Verify(x509.VerifyOptions{Roots: pool, DNSName: name}); err != nil {
+			t.Errorf("verify %s: %v", name, err)
+		}
+	}
+
+	if _, err := c.Verify(x509.VerifyOptions{Roots: pool, DNSName: "e-2.titan.io"}); err == nil {
+		t.Error("cert is valid for other hostname")
+	}
+}
+
+func TestLoadCA(t *testing.T) {
+	ca, err := NewCA(newTestRepo(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "ca.crt")
+	keyPath := filepath.Join(dir, "ca.key")
+
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.CertDER()}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// keys of pkcs8 and sec1 are accepted
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sec1, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, der := range [][]byte{pkcs8, sec1} {
+		if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := LoadCA(certPath, keyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !loaded.key.Equal(ca.key) || string(loaded.CertDER()) != string(ca.CertDER()) {
+			t.Error("loaded ca mismatch")
+		}
+	}
+
+	if _, err := LoadCA(keyPath, keyPath); err == nil {
+		t.Error("load key as certificate")
+	}
+}
+
+func TestDownloadTLSScheduler(t *testing.T) {
+	lr := newTestRepo(t)
+
+	ca, err := NewCA(lr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := &fakeScheduler{ca: ca, hostname: "e-1.titan.io"}
+	cfg, hostname, err := DownloadTLSConfig(context.Background(), lr, scheduler, "e_1", "secret", DownloadTLSOptions{Mode: DownloadTLSScheduler})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hostname != "e-1.titan.io" {
+		t.Errorf("hostname %s", hostname)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	clientCfg := &tls.Config{RootCAs: pool, ServerName: hostname, NextProtos: []string{"h2"}, MinVersion: tls.VersionTLS12}
+	state, err := handshakeState(clientCfg, cfg)
+	if err != nil {
+		t.Fatalf("download handshake: %v", err)
+	}
+
+	// http2 is negotiated
+	if state.NegotiatedProtocol != "h2" {
+		t.Errorf("negotiated protocol %s", state.NegotiatedProtocol)
+	}
+
+	// renewed in background before expired
+	d := &downloadCert{scheduler: scheduler, deviceID: "e_1", secret: "secret"}
+	d.key, _ = LoadOrCreateKey(lr, DownloadKeyName)
+	if err := d.renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := atomic.LoadInt32(&scheduler.calls)
+	d.lk.Lock()
+	d.expire = time.Now().Add(downloadRenewBefore / 2)
+	d.lk.Unlock()
+
+	if c, err := d.getCertificate(nil); err != nil || c == nil {
+		t.Fatalf("certificate while renewing: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&scheduler.calls) == calls {
+		if time.Now().After(deadline) {
+			t.Fatal("download cert is not renewed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDownloadTLSOptions(t *testing.T) {
+	lr := newTestRepo(t)
+
+	cfg, hostname, err := DownloadTLSConfig(context.Background(), lr, nil, "e_1", "", DownloadTLSOptions{})
+	if err != nil || cfg != nil || hostname != "" {
+		t.Error("tls is enabled without mode")
+	}
+
+	if _, _, err := DownloadTLSConfig(context.Background(), lr, nil, "e_1", "", DownloadTLSOptions{Mode: "unknown"}); err == nil {
+		t.Error("unknown mode is accepted")
+	}
+
+	if _, _, err := DownloadTLSConfig(context.Background(), lr, nil, "e_1", "", DownloadTLSOptions{Mode: DownloadTLSACME}); err == nil {
+		t.Error("acme without hostname")
+	}
+
+	if _, _, err := DownloadTLSConfig(context.Background(), lr, nil, "e_1", "", DownloadTLSOptions{Mode: DownloadTLSACME, Hostname: "e-1.titan.io", ACMECA: filepath.Join(t.TempDir(), "none.pem")}); err == nil {
+		t.Error("acme with root ca not found")
+	}
+}
+
+func TestACMEHostPolicy(t *testing.T) {
+	lr := newTestRepo(t)
+
+	cfg, hostname, err := DownloadTLSConfig(context.Background(), lr, nil, "e_1", "", DownloadTLSOptions{
+		Mode:          DownloadTLSACME,
+		Hostname:      "e-1.titan.io",
+		ACMEDirectory: "https://127.0.0.1:1/directory",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hostname != "e-1.titan.io" || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("hostname %s, min version %x", hostname, cfg.MinVersion)
+	}
+
+	hasALPN := false
+	for _, proto := range cfg.NextProtos {
+		if proto == "acme-tls/1" {
+			hasALPN = true
+		}
+	}
+
+	if !hasALPN {
+		t.Errorf("tls-alpn challenge not enabled: %v", cfg.NextProtos)
+	}
+
+	// certificate of other hostname is not requested from the acme server
+	if _, err := cfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.titan.io"}); err == nil {
+		t.Error("certificate of other hostname")
+	}
+}
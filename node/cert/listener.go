@@ -0,0 +1,117 @@
+package cert
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// first byte of a tls handshake record
+const recordTypeHandshake = 0x16
+
+const detectTimeout = 10 * time.Second
+
+// NewListener serve tls connections on the listener, tls connections are detected by the first byte,
+// plain connections are served on the same listener if plain is set, or closed.
+// the peer of plain connection is not authenticated, the rpc methods rely on the token only
+func NewListener(l net.Listener, cfg *tls.Config, plain bool) net.Listener {
+	m := &muxListener{
+		Listener: l,
+		cfg:      cfg,
+		plain:    plain,
+		connCh:   make(chan net.Conn),
+		errCh:    make(chan error, 1),
+		closeCh:  make(chan struct{}),
+	}
+
+	go m.acceptLoop()
+
+	return m
+}
+
+type muxListener struct {
+	net.Listener
+	cfg   *tls.Config
+	plain bool
+
+	connCh  chan net.Conn
+	errCh   chan error
+	closeCh chan struct{}
+}
+
+type peekConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (m *muxListener) acceptLoop() {
+	for {
+		c, err := m.Listener.Accept()
+		if err != nil {
+			m.errCh <- err
+			return
+		}
+
+		go m.detect(c)
+	}
+}
+
+func (m *muxListener) detect(c net.Conn) {
+	err := c.SetReadDeadline(time.Now().Add(detectTimeout))
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	r := bufio.NewReader(c)
+	b, err := r.Peek(1)
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	err = c.SetReadDeadline(time.Time{})
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	var conn net.Conn = &peekConn{Conn: c, r: r}
+	if b[0] == recordTypeHandshake {
+		conn = tls.Server(conn, m.cfg)
+	} else if !m.plain {
+		c.Close()
+		return
+	}
+
+	select {
+	case m.connCh <- conn:
+	case <-m.closeCh:
+		c.Close()
+	}
+}
+
+func (m *muxListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-m.connCh:
+		return c, nil
+	case err := <-m.errCh:
+		// keep the error for later Accept calls
+		m.errCh <- err
+		return nil, err
+	}
+}
+
+func (m *muxListener) Close() error {
+	select {
+	case <-m.closeCh:
+	default:
+		close(m.closeCh)
+	}
+	return m.Listener.Close()
+}
@@ -0,0 +1,76 @@
+package cert
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+)
+
+// serveListener write ok to the connections accepted by the listener
+func serveListener(t *testing.T, cfg *tls.Config, plain bool) string {
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewListener(nl, cfg, plain)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			c.Write([]byte("ok"))
+			c.Close()
+		}
+	}()
+
+	return nl.Addr().String()
+}
+
+// readConn write the first byte and read the response of the listener
+func readConn(c net.Conn) string {
+	defer c.Close()
+
+	if _, err := c.Write([]byte("G")); err != nil {
+		return ""
+	}
+
+	b, _ := io.ReadAll(c)
+	return string(b)
+}
+
+func TestListener(t *testing.T) {
+	lr := newTestRepo(t)
+	ca, err := NewCA(lr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestPeer(t, lr, ca, "scheduler", "scheduler")
+	client := newTestPeer(t, lr, ca, "e_1", "edge")
+
+	for _, plain := range []bool{true, false} {
+		addr := serveListener(t, server.cfg, plain)
+
+		tc, err := tls.Dial("tcp", addr, client.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readConn(tc); got != "ok" {
+			t.Errorf("plain %v: tls connection read %q", plain, got)
+		}
+
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readConn(c); (got == "ok") != plain {
+			t.Errorf("plain %v: plain connection read %q", plain, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/linguohua/titan/api/client"
+	"github.com/linguohua/titan/node/repo"
+	"github.com/linguohua/titan/node/types"
+	"golang.org/x/xerrors"
+)
+
+// NodeTLSConfig get the node certificate from scheduler by tls and return the node tls config,
+// scheduler is verified by the trusted ca, or by the ca fingerprint distributed out of band before the ca trusted.
+// The scheduler url is set to be connected with the node certificate and checked as scheduler.
+func NodeTLSConfig(ctx context.Context, lr repo.LockedRepo, schedulerURL string, header http.Header, deviceID, secret, caFingerprint string) (*tls.Config, error) {
+	trusted, err := LoadCert(lr, TrustedCAName)
+	if err != nil && !errors.Is(err, types.ErrKeyInfoNotFound) {
+		return nil, err
+	}
+
+	if trusted != nil && caFingerprint != "" && !MatchFingerprint(trusted, caFingerprint) {
+		return nil, xerrors.New("trusted ca mismatch with the scheduler ca fingerprint")
+	}
+
+	if trusted == nil && caFingerprint == "" {
+		return nil, xerrors.New("scheduler ca fingerprint is required before the scheduler ca trusted")
+	}
+
+	key, err := LoadOrCreateKey(lr, KeyName)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := NewCSR(key, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedulerURL = client.TLSURL(schedulerURL)
+
+	// secret is only sent to the verified scheduler
+	client.SetAddrTLSConfig(schedulerURL, &tls.Config{
+		MinVersion:            tls.VersionTLS12,
+		InsecureSkipVerify:    true, //nolint:gosec
+		VerifyPeerCertificate: verifyScheduler(trusted, caFingerprint),
+	})
+
+	scheduler, closer, err := client.NewScheduler(ctx, schedulerURL, header)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	info, err := scheduler.GetNodeCert(ctx, deviceID, secret, csr)
+	if err != nil {
+		return nil, xerrors.Errorf("get node cert: %w", err)
+	}
+
+	if trusted == nil && !MatchFingerprint(info.CACert, caFingerprint) {
+		return nil, xerrors.New("scheduler ca mismatch with the fingerprint")
+	}
+
+	if err := TrustCA(lr, info.CACert); err != nil {
+		return nil, err
+	}
+
+	cfg, err := NewTLSConfig(key, info.Cert, info.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetAddrTLSConfig(schedulerURL, WithPeerCheck(cfg, ExpectUnit(UnitScheduler)))
+
+	return cfg, nil
+}
+
+// SetPeerTLS the node at the url is connected with the node certificate, the peer must be of the unit
+func SetPeerTLS(url, unit string) {
+	cfg := client.TLSConfig()
+	if cfg == nil {
+		return
+	}
+
+	client.SetAddrTLSConfig(url, WithPeerCheck(cfg, ExpectUnit(unit)))
+}
+
+// verifyScheduler verify the scheduler certificate by the trusted ca,
+// or by the ca in the chain which match the fingerprint
+func verifyScheduler(trusted []byte, caFingerprint string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return xerrors.New("peer certificate not found")
+		}
+
+		caDER := trusted
+		if caDER == nil {
+			for _, raw := range rawCerts[1:] {
+				if MatchFingerprint(raw, caFingerprint) {
+					caDER = raw
+					break
+				}
+			}
+		}
+
+		if caDER == nil {
+			return xerrors.New("scheduler ca not match the fingerprint")
+		}
+
+		ca, err := x509.ParseCertificate(caDER)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		pool.AddCert(ca)
+
+		c, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+
+		_, err = c.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		if err != nil {
+			return err
+		}
+
+		return ExpectUnit(UnitScheduler)(c)
+	}
+}
@@ -23,6 +23,8 @@ type Device struct {
 	internalIP    string
 	bandwidthUp   int64
 	bandwidthDown int64
+	// port mapping type of the gateway, UPnP or NAT-PMP, empty if not mapped
+	upnp string
 }
 
 func NewDevice(deviceID, publicIP, internalIP string, bandwidthUp, bandwidthDown int64) *Device {
@@ -61,6 +63,7 @@ func (device *Device) DeviceInfo(ctx context.Context) (api.DevicesInfo, error) {
 	info.InternalIp = device.internalIP
 	info.BandwidthDown = float64(device.bandwidthDown)
 	info.BandwidthUp = float64(device.bandwidthUp)
+	info.Upnp = device.upnp
 
 	mac, err := getMacAddr(info.InternalIp)
 	if err != nil {
@@ -162,6 +165,11 @@ func (device *Device) GetInternalIP() string {
 	return device.internalIP
 }
 
+// SetUpnp set the port mapping type of the gateway
+func (device *Device) SetUpnp(upnp string) {
+	device.upnp = upnp
+}
+
 // only for test
 func fillUpDeviceInfo(deviceInfo *api.DevicesInfo) {
 	if deviceInfo.Latency <= 0 {
@@ -171,8 +179,4 @@ func fillUpDeviceInfo(deviceInfo *api.DevicesInfo) {
 	if deviceInfo.PkgLossRatio <= 0 {
 		deviceInfo.PkgLossRatio = rand.Float64()
 	}
-
-	if deviceInfo.NatRatio <= 0 {
-		deviceInfo.NatRatio = 100
-	}
 }
@@ -0,0 +1,226 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	accessLogMaxSize    = 100 << 20
+	accessLogMaxBackups = 5
+	// entries buffered, entries are dropped when the buffer is full
+	accessLogBuffer = 4096
+)
+
+// accessEntry a line of the access log
+type accessEntry struct {
+	Time     string `json:"time"`
+	ClientIP string `json:"client_ip"`
+	AppName  string `json:"app_name,omitempty"`
+	TicketID string `json:"ticket_id,omitempty"`
+	Path     string `json:"path"`
+	Cid      string `json:"cid"`
+	Blocks   int    `json:"blocks"`
+	Bytes    int64  `json:"bytes"`
+	Status   int    `json:"status"`
+	CostMs   int64  `json:"cost_ms"`
+	Speed    int64  `json:"speed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// accessLog write the access entries as json lines in background, the file is rotated by size
+type accessLog struct {
+	entries chan *accessEntry
+	w       *rotateWriter
+
+	lock    sync.Mutex
+	dropped int64
+}
+
+// newAccessLog path empty is disabled
+func newAccessLog(path string) (*accessLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	w, err := newRotateWriter(path, accessLogMaxSize, accessLogMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	al := &accessLog{entries: make(chan *accessEntry, accessLogBuffer), w: w}
+	go al.run()
+
+	return al, nil
+}
+
+func (al *accessLog) add(entry *accessEntry) {
+	if al == nil {
+		return
+	}
+
+	entry.Time = time.Now().Format(time.RFC3339Nano)
+
+	select {
+	case al.entries <- entry:
+	default:
+		al.lock.Lock()
+		al.dropped++
+		al.lock.Unlock()
+	}
+}
+
+func (al *accessLog) run() {
+	for entry := range al.entries {
+		al.lock.Lock()
+		dropped := al.dropped
+		al.dropped = 0
+		al.lock.Unlock()
+
+		if dropped > 0 {
+			log.Warnf("access log dropped %d entries", dropped)
+		}
+
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+
+		if _, err := al.w.Write(append(buf, '\n')); err != nil {
+			log.Errorf("write access log error:%v", err)
+		}
+	}
+}
+
+type accessKey struct{}
+
+// statusWriter record the status and bytes of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// withAccessLog log the requests of the handler, the handler fill the entry got by accessEntryOf
+func (bd *BlockDownload) withAccessLog(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if bd.accessLog == nil {
+			h(w, r)
+			return
+		}
+
+		start := time.Now()
+		entry := &accessEntry{
+			ClientIP: bd.clientIP(r),
+			AppName:  r.Header.Get("App-Name"),
+			Path:     r.URL.Path,
+			Cid:      r.URL.Query().Get("cid"),
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		h(sw, r.WithContext(context.WithValue(r.Context(), accessKey{}, entry)))
+
+		entry.Status = sw.status
+		entry.Bytes = sw.bytes
+		entry.CostMs = time.Since(start).Milliseconds()
+		if entry.CostMs > 0 {
+			entry.Speed = entry.Bytes * 1000 / entry.CostMs
+		}
+
+		bd.accessLog.add(entry)
+	}
+}
+
+// accessEntryOf the entry of the request, a discarded entry if access log is disabled
+func accessEntryOf(r *http.Request) *accessEntry {
+	if entry, ok := r.Context().Value(accessKey{}).(*accessEntry); ok {
+		return entry
+	}
+
+	return &accessEntry{}
+}
+
+// rotateWriter rename the file to path.1 when it exceed max size, path.1 to path.2 and so on
+type rotateWriter struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+func newRotateWriter(path string, maxSize int64, maxBackups int) (*rotateWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	w := &rotateWriter{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	if w.size+int64(len(p)) > w.maxSize && w.size > 0 {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	for i := w.maxBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		return err
+	}
+
+	return w.open()
+}
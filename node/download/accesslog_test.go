@@ -0,0 +1,123 @@
+package download
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+
+	w, err := newRotateWriter(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 lines of 40 bytes, 2 lines a file
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf("%039d\n", i)
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "8,9",
+		path + ".1": "6,7",
+		path + ".2": "4,5",
+	}
+
+	for file, lines := range want {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]string, 0)
+		for _, line := range strings.Fields(string(data)) {
+			got = append(got, strings.TrimLeft(line, "0"))
+		}
+
+		if strings.Join(got, ",") != lines {
+			t.Errorf("lines of %s: got %v, want %s", file, got, lines)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("backups exceed max backups")
+	}
+
+	// size of the exist file is counted after reopen
+	w2, err := newRotateWriter(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w2.size != 80 {
+		t.Errorf("size of reopened file %d", w2.size)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	al, err := newAccessLog("")
+	if err != nil || al != nil {
+		t.Fatal("access log enabled without path")
+	}
+	// disabled access log ignore entries
+	al.add(&accessEntry{})
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	al, err = newAccessLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bd := &BlockDownload{accessLog: al}
+	h := bd.withAccessLog(func(w http.ResponseWriter, r *http.Request) {
+		accessEntryOf(r).TicketID = "t1"
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("block"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/block/get?cid=bafy", nil)
+	r.RemoteAddr = "1.1.1.1:1234"
+	r.Header.Set("App-Name", "app")
+	h(httptest.NewRecorder(), r)
+
+	var entry accessEntry
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := ioutil.ReadFile(path)
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		if scanner.Scan() {
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("access entry not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if entry.ClientIP != "1.1.1.1" || entry.AppName != "app" || entry.Cid != "bafy" || entry.TicketID != "t1" ||
+		entry.Status != http.StatusPartialContent || entry.Bytes != 5 || entry.Time == "" {
+		t.Errorf("access entry %+v", entry)
+	}
+
+	// handler fill a discarded entry if the request is not logged
+	if accessEntryOf(httptest.NewRequest(http.MethodGet, "/", nil)) == nil {
+		t.Error("entry of the request not logged is nil")
+	}
+}
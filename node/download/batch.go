@@ -0,0 +1,269 @@
+package download
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-merkledag"
+	"github.com/linguohua/titan/lib/car"
+	"golang.org/x/xerrors"
+)
+
+// max cids of a batch request
+const maxBatchCids = 10000
+
+// selector of the dag under the root
+const (
+	selectorAll   = "all"
+	selectorDepth = "depth:"
+)
+
+// getBlocks stream the blocks in car format, blocks are the cid list of form value cid,
+// or the dag of form value root walked by form value selector.
+// blocks not found or not in the ticket are skipped, the client check the missing blocks
+func (bd *BlockDownload) getBlocks(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tk := r.Header.Get("Token")
+	clientIP := bd.clientIP(r)
+
+	cids, root, maxDepth, err := parseBatchRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Infof("GetBlocks, App-Name:%s, cids:%d, root:%s", r.Header.Get("App-Name"), len(cids), root)
+
+	entry := accessEntryOf(r)
+	if root.Defined() {
+		entry.Cid = root.String()
+	}
+
+	ticket, err := bd.tickets.parse(tk, clientIP)
+	if err != nil {
+		entry.Error = err.Error()
+		log.Errorf("Valid ticket %s error:%v", tk, err)
+		http.Error(w, fmt.Sprintf("Valid ticket error:%v", err), http.StatusForbidden)
+		return
+	}
+
+	entry.TicketID = ticket.Id
+
+	if (root.Defined() && bd.denied.DeniedCid(root)) || bd.denied.Denied(ticket.RootCid) {
+		entry.Error = "denied"
+		http.Error(w, "cid is denied", http.StatusUnavailableForLegalReasons)
+		return
+	}
+
+	lease, err := bd.limits.acquire(clientIP, r.Header.Get("App-Name"), ticket.Id, 0)
+	if err != nil {
+		entry.Error = err.Error()
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	roots := cids
+	if root.Defined() {
+		roots = []cid.Cid{root}
+	}
+
+	w.Header().Set("Content-Type", car.ContentType)
+
+	now := time.Now()
+	size := int64(0)
+	count := 0
+
+	defer func() {
+		lease.release(size, count)
+		entry.Blocks = count
+	}()
+
+	cw, err := car.NewWriter(w, roots)
+	if err != nil {
+		log.Errorf("GetBlocks, write car header error:%v", err)
+		return
+	}
+
+	send := func(c cid.Cid) ([]byte, error) {
+		cidStr := c.String()
+		// descendants of the denied block are not walked
+		if bd.denied.DeniedCid(c) || bd.deniedBlocks.denied(cidStr) {
+			return nil, xerrors.Errorf("cid %s is denied", cidStr)
+		}
+
+		if err := bd.tickets.allow(ticket, cidStr); err != nil {
+			return nil, err
+		}
+
+		reader, err := bd.blockStore.GetReader(cidStr)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		if err := bd.tickets.use(ticket, cidStr, reader.Size()); err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(lease.reader(r.Context(), NewReader(reader, bd.limiter)))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := cw.WriteBlock(c, data); err != nil {
+			return nil, err
+		}
+
+		size += int64(len(data))
+		count++
+		return data, nil
+	}
+
+	if root.Defined() {
+		err = walkDag(root, maxDepth, send)
+	} else {
+		for _, c := range cids {
+			if _, err := send(c); err != nil {
+				log.Warnf("GetBlocks, skip block %s:%v", c, err)
+			}
+		}
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+		log.Errorf("GetBlocks, walk dag %s error:%v", root, err)
+	}
+
+	if count == 0 {
+		return
+	}
+
+	costTime := time.Since(now)
+
+	var speedRate = int64(0)
+	if costTime != 0 {
+		speedRate = int64(float64(size) / float64(costTime) * float64(time.Second))
+	}
+
+	bd.stats.add(roots[0].String(), clientIP, count, size, speedRate)
+
+	log.Debugf("Download blocks %d of %s costTime %d, size %d, speed %d", count, roots[0], costTime, size, speedRate)
+}
+
+// parseBatchRequest cids or root with max depth of the walk, -1 is unlimited
+func parseBatchRequest(r *http.Request) ([]cid.Cid, cid.Cid, int, error) {
+	if rootStr := r.Form.Get("root"); rootStr != "" {
+		root, err := cid.Decode(rootStr)
+		if err != nil {
+			return nil, cid.Undef, 0, err
+		}
+
+		maxDepth, err := parseSelector(r.Form.Get("selector"))
+		if err != nil {
+			return nil, cid.Undef, 0, err
+		}
+
+		return nil, root, maxDepth, nil
+	}
+
+	values := r.Form["cid"]
+	if len(values) == 0 {
+		return nil, cid.Undef, 0, xerrors.New("no cid or root")
+	}
+
+	if len(values) > maxBatchCids {
+		return nil, cid.Undef, 0, xerrors.Errorf("cids exceed %d", maxBatchCids)
+	}
+
+	cids := make([]cid.Cid, 0, len(values))
+	for _, v := range values {
+		c, err := cid.Decode(v)
+		if err != nil {
+			return nil, cid.Undef, 0, err
+		}
+		cids = append(cids, c)
+	}
+
+	return cids, cid.Undef, 0, nil
+}
+
+// parseSelector all is the whole dag, depth:N is the blocks within N links of the root
+func parseSelector(selector string) (int, error) {
+	if selector == "" || selector == selectorAll {
+		return -1, nil
+	}
+
+	if strings.HasPrefix(selector, selectorDepth) {
+		depth, err := strconv.Atoi(strings.TrimPrefix(selector, selectorDepth))
+		if err == nil && depth >= 0 {
+			return depth, nil
+		}
+	}
+
+	return 0, xerrors.Errorf("invalid selector %s", selector)
+}
+
+// walkDag visit the blocks of the dag in depth first order, links of the block returned by visit are followed
+func walkDag(root cid.Cid, maxDepth int, visit func(c cid.Cid) ([]byte, error)) error {
+	visited := make(map[cid.Cid]struct{})
+
+	var walk func(c cid.Cid, depth int) error
+	walk = func(c cid.Cid, depth int) error {
+		if _, ok := visited[c]; ok {
+			return nil
+		}
+		visited[c] = struct{}{}
+
+		data, err := visit(c)
+		if err != nil {
+			return xerrors.Errorf("block %s: %w", c, err)
+		}
+
+		if maxDepth >= 0 && depth >= maxDepth {
+			return nil
+		}
+
+		links, err := blockLinks(c, data)
+		if err != nil {
+			return err
+		}
+
+		for _, link := range links {
+			if err := walk(link, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return walk(root, 0)
+}
+
+// blockLinks links of dag-pb block, raw block has no link
+func blockLinks(c cid.Cid, data []byte) ([]cid.Cid, error) {
+	if c.Prefix().Codec != cid.DagProtobuf {
+		return nil, nil
+	}
+
+	node, err := merkledag.DecodeProtobuf(data)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]cid.Cid, 0, len(node.Links()))
+	for _, link := range node.Links() {
+		links = append(links, link.Cid)
+	}
+
+	return links, nil
+}
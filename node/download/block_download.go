@@ -2,6 +2,7 @@ package download
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -13,7 +14,8 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/blockstore"
-	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/lib/denylist"
+	"github.com/linguohua/titan/node/cert"
 	"github.com/linguohua/titan/node/device"
 	"github.com/linguohua/titan/node/helper"
 	"golang.org/x/time/rate"
@@ -28,6 +30,25 @@ type BlockDownload struct {
 	scheduler      api.Scheduler
 	device         *device.Device
 	srvAddr        string
+	// port mapped by gateway, 0 is the port of srvAddr
+	externalPort int
+	// serve https if set, plain http is still accepted on the same port
+	tlsConfig *tls.Config
+	hostname  string
+	tickets   *ticketChecker
+	// limits of client ips, apps and tickets
+	limits   *downloadLimiter
+	receipts *receiptCollector
+	// served blocks aggregated by cid and client
+	stats     *statsCollector
+	accessLog *accessLog
+	// cids refused by the download server
+	denied   *denylist.Filter
+	denylist *denylistSyncer
+	// blocks of the denied carfiles
+	deniedBlocks *deniedBlocks
+	// X-Real-IP is only trusted from them
+	trustedProxies []*net.IPNet
 }
 
 func NewBlockDownload(limiter *rate.Limiter, params *helper.NodeParams, device *device.Device) *BlockDownload {
@@ -37,7 +58,25 @@ func NewBlockDownload(limiter *rate.Limiter, params *helper.NodeParams, device *
 		downloadSrvKey: params.DownloadSrvKey,
 		scheduler:      params.Scheduler,
 		srvAddr:        params.DownloadSrvAddr,
-		device:         device}
+		tlsConfig:      params.DownloadTLS,
+		hostname:       params.DownloadHostname,
+		device:         device,
+		tickets:        newTicketChecker(params.Scheduler, params.DS, device.GetDeviceID()),
+		limits:         newDownloadLimiter(params.Scheduler, params.NodeToken),
+		receipts:       newReceiptCollector(params.Scheduler, params.NodeToken),
+		stats:          newStatsCollector(params.Scheduler, device.GetDeviceID(), params.NodeToken),
+		denied:         params.Denylist}
+
+	blockDownload.trustedProxies = parseTrustedProxies(params.DownloadTrustedProxies)
+	blockDownload.deniedBlocks = newDeniedBlocks(params.DS, params.Denylist)
+	blockDownload.denylist = newDenylistSyncer(params.Scheduler, params.DS, params.Denylist, blockDownload.tickets)
+
+	accessLog, err := newAccessLog(params.AccessLogPath)
+	if err != nil {
+		log.Errorf("open access log %s error:%v, access log disabled", params.AccessLogPath, err)
+	} else {
+		blockDownload.accessLog = accessLog
+	}
 
 	go blockDownload.startDownloadServer()
 
@@ -49,33 +88,66 @@ func (bd *BlockDownload) getBlock(w http.ResponseWriter, r *http.Request) {
 	tk := r.Header.Get("Token")
 	cidStr := r.URL.Query().Get("cid")
 
-	log.Infof("GetBlock, App-Name:%s, Token:%s,  cid:%s", appName, tk, cidStr)
+	log.Debugf("GetBlock, App-Name:%s, Token:%s,  cid:%s", appName, tk, cidStr)
+
+	clientIP := bd.clientIP(r)
+	entry := accessEntryOf(r)
+
+	ticket, err := bd.tickets.verify(tk, cidStr, clientIP)
+	if err != nil {
+		entry.Error = err.Error()
+		log.Errorf("Valid ticket %s error:%v", tk, err)
+		http.Error(w, fmt.Sprintf("Valid ticket error:%v", err), http.StatusForbidden)
+		return
+	}
+
+	entry.TicketID = ticket.Id
 
-	if !token.ValidToken(tk, bd.downloadSrvKey) {
-		log.Errorf("Valid token %s error", tk)
-		http.Error(w, fmt.Sprintf("Valid token %s error", tk), http.StatusBadRequest)
+	if bd.denied.Denied(cidStr) || bd.denied.Denied(ticket.RootCid) || bd.deniedBlocks.denied(cidStr) {
+		entry.Error = "denied"
+		http.Error(w, fmt.Sprintf("cid %s is denied", cidStr), http.StatusUnavailableForLegalReasons)
 		return
 	}
 
 	reader, err := bd.blockStore.GetReader(cidStr)
 	if err != nil {
+		entry.Error = err.Error()
 		log.Errorf("GetBlock, GetReader:%v", err)
 		http.NotFound(w, r)
 		return
 	}
 	defer reader.Close()
 
+	lease, err := bd.limits.acquire(clientIP, appName, ticket.Id, reader.Size())
+	if err != nil {
+		entry.Error = err.Error()
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	err = bd.tickets.use(ticket, cidStr, reader.Size())
+	if err != nil {
+		lease.release(0, 0)
+		entry.Error = err.Error()
+		log.Errorf("Use ticket %s error:%v", ticket.Id, err)
+		http.Error(w, fmt.Sprintf("Use ticket error:%v", err), http.StatusForbidden)
+		return
+	}
+
 	contentDisposition := fmt.Sprintf("attachment; filename=%s", cidStr)
 	w.Header().Set("Content-Disposition", contentDisposition)
 	w.Header().Set("Content-Length", strconv.FormatInt(reader.Size(), 10))
 
 	now := time.Now()
 
-	n, err := io.Copy(w, NewReader(reader, bd.limiter))
+	n, err := io.Copy(w, lease.reader(r.Context(), NewReader(reader, bd.limiter)))
+	lease.release(n, 1)
 	if err != nil {
+		entry.Error = err.Error()
 		log.Errorf("GetBlock, io.Copy error:%v", err)
 		return
 	}
+	entry.Blocks = 1
 
 	costTime := time.Now().Sub(now)
 
@@ -84,34 +156,75 @@ func (bd *BlockDownload) getBlock(w http.ResponseWriter, r *http.Request) {
 		speedRate = int64(float64(n) / float64(costTime) * float64(time.Second))
 	}
 
-	go bd.statistics(bd.device.GetDeviceID(), cidStr, int(n), speedRate, getClientIP(r))
+	bd.stats.add(cidStr, clientIP, 1, n, speedRate)
 
-	log.Infof("Download block %s costTime %d, size %d, speed %d", cidStr, costTime, n, speedRate)
+	log.Debugf("Download block %s costTime %d, size %d, speed %d", cidStr, costTime, n, speedRate)
 
 	return
 }
 
-func getClientIP(r *http.Request) string {
-	reqIP := r.Header.Get("X-Real-IP")
-	if reqIP == "" {
-		h, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			log.Errorf("could not get ip from: %s, err: %s", r.RemoteAddr, err)
+// clientIP ip of the remote address, X-Real-IP set by the client is not trusted for it is bound to the ticket and limits,
+// it is only trusted from loopback which the relay requests are forwarded from by the tunnel, and from the trusted proxies
+func (bd *BlockDownload) clientIP(r *http.Request) string {
+	h, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		log.Errorf("could not get ip from: %s, err: %s", r.RemoteAddr, err)
+		return ""
+	}
+
+	realIP := r.Header.Get("X-Real-IP")
+	if realIP == "" || net.ParseIP(realIP) == nil {
+		return h
+	}
+
+	ip := net.ParseIP(h)
+	if ip == nil {
+		return h
+	}
+
+	if ip.IsLoopback() {
+		return realIP
+	}
+
+	for _, proxy := range bd.trustedProxies {
+		if proxy.Contains(ip) {
+			return realIP
 		}
-		reqIP = h
 	}
 
-	return reqIP
+	return h
 }
 
-func (bd *BlockDownload) statistics(deviceID, cid string, size int, downloadSpeed int64, clientIP string) {
-	stat := api.DownloadStat{Cid: cid, DeviceID: deviceID, BlockSize: size, DownloadSpeed: downloadSpeed, ClientIP: clientIP}
-	bd.scheduler.DownloadBlockResult(context.Background(), stat)
+// parseTrustedProxies ips or cidrs of the proxies, invalid ones are ignored
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	out := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			log.Errorf("trusted proxy %s error:%v", proxy, err)
+			continue
+		}
+
+		out = append(out, ipNet)
+	}
+
+	return out
 }
 
 func (bd *BlockDownload) startDownloadServer() {
 	mux := http.NewServeMux()
-	mux.HandleFunc(helper.DownloadSrvPath, bd.getBlock)
+	mux.HandleFunc(helper.DownloadSrvPath, bd.withAccessLog(bd.getBlock))
+	mux.HandleFunc(helper.DownloadReceiptPath, bd.receipt)
+	mux.HandleFunc(helper.DownloadBatchPath, bd.withAccessLog(bd.getBlocks))
 
 	srv := &http.Server{
 		Handler: mux,
@@ -123,6 +236,11 @@ func (bd *BlockDownload) startDownloadServer() {
 		log.Fatal(err)
 	}
 
+	if bd.tlsConfig != nil {
+		// http/2 is negotiated by alpn of tls config, the download by http is still served
+		nl = cert.NewListener(nl, bd.tlsConfig, true)
+	}
+
 	log.Infof("download server listen on %s", bd.srvAddr)
 
 	err = srv.Serve(nl)
@@ -155,16 +273,56 @@ func (bd *BlockDownload) UnlimitDownloadSpeed() error {
 	return nil
 }
 
-func (bd *BlockDownload) GetDownloadInfo(ctx context.Context) (api.DownloadInfo, error) {
-	tk, err := token.GenerateToken(bd.downloadSrvKey, time.Now().Add(helper.DownloadTokenExpireAfter).Unix())
-	if err != nil {
-		return api.DownloadInfo{}, err
+// SetDownloadLimits set limits of client ip, app and ticket
+func (bd *BlockDownload) SetDownloadLimits(ctx context.Context, limits api.DownloadLimits) error {
+	log.Infof("set download limits %+v", limits)
+	bd.limits.setLimits(limits)
+	return nil
+}
+
+// GetDownloadStats top cids and clients served in the last 24 hours
+func (bd *BlockDownload) GetDownloadStats(ctx context.Context, top int) (api.DownloadStatsInfo, error) {
+	return bd.stats.top(top), nil
+}
+
+// SetDenylist set the denylist pushed by scheduler
+func (bd *BlockDownload) SetDenylist(ctx context.Context, list api.Denylist) error {
+	return bd.denylist.set(list)
+}
+
+// SetExternalPort set the download server port mapped by gateway
+func (bd *BlockDownload) SetExternalPort(port int) {
+	bd.externalPort = port
+}
+
+// port of the download server for users
+func (bd *BlockDownload) publicPort() string {
+	if bd.externalPort > 0 {
+		return strconv.Itoa(bd.externalPort)
 	}
 
 	addrSplit := strings.Split(bd.srvAddr, ":")
+	return addrSplit[1]
+}
+
+// download url for users, https with hostname if tls enabled
+func (bd *BlockDownload) downloadURL(externalIP string) string {
+	if bd.tlsConfig == nil {
+		return fmt.Sprintf("http://%s:%s%s", externalIP, bd.publicPort(), helper.DownloadSrvPath)
+	}
+
+	host := bd.hostname
+	if host == "" {
+		host = externalIP
+	}
+
+	return fmt.Sprintf("https://%s%s", net.JoinHostPort(host, bd.publicPort()), helper.DownloadSrvPath)
+}
+
+// GetDownloadInfo download server url, the download ticket is issued by scheduler
+func (bd *BlockDownload) GetDownloadInfo(ctx context.Context) (api.DownloadInfo, error) {
 	info := api.DownloadInfo{
-		URL:   fmt.Sprintf("http://%s:%s%s", bd.device.GetExternaIP(), addrSplit[1], helper.DownloadSrvPath),
-		Token: tk,
+		URL: bd.downloadURL(bd.device.GetExternaIP()),
 	}
 
 	return info, nil
@@ -176,8 +334,7 @@ func (bd *BlockDownload) GetRateLimit() int64 {
 }
 
 func (bd *BlockDownload) UpdateDownloadServerAccessAuth(exteranlIP string) {
-	addrSplit := strings.Split(bd.srvAddr, ":")
-	url := fmt.Sprintf("http://%s:%s%s", exteranlIP, addrSplit[1], helper.DownloadSrvPath)
+	url := bd.downloadURL(exteranlIP)
 	accessAuth := api.DownloadServerAccessAuth{DeviceID: bd.device.GetDeviceID(), URL: url, SecurityKey: bd.downloadSrvKey}
 	bd.scheduler.UpdateDownloadServerAccessAuth(context.Background(), accessAuth)
 }
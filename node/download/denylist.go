@@ -0,0 +1,190 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/denylist"
+	"github.com/linguohua/titan/node/helper"
+)
+
+const (
+	denylistSyncInterval = 10 * time.Minute
+	denylistKey          = "denylist"
+)
+
+// denylistSyncer get the denylist from scheduler at start and periodically,
+// the denylist is saved to datastore for the start when scheduler is unreachable
+type denylistSyncer struct {
+	lock      sync.Mutex
+	scheduler api.Scheduler
+	ds        datastore.Batching
+	filter    *denylist.Filter
+	// the denylist is signed by the ticket key of scheduler
+	tickets *ticketChecker
+}
+
+func newDenylistSyncer(scheduler api.Scheduler, ds datastore.Batching, filter *denylist.Filter, tickets *ticketChecker) *denylistSyncer {
+	s := &denylistSyncer{
+		scheduler: scheduler,
+		ds:        ds,
+		filter:    filter,
+		tickets:   tickets,
+	}
+
+	s.load()
+	go s.run()
+
+	return s
+}
+
+// load the denylist saved, it is verified before save
+func (s *denylistSyncer) load() {
+	buf, err := s.ds.Get(context.Background(), datastore.NewKey(denylistKey))
+	if err != nil {
+		if err != datastore.ErrNotFound {
+			log.Errorf("load denylist error:%v", err)
+		}
+		return
+	}
+
+	list := api.Denylist{}
+	if err := json.Unmarshal(buf, &list); err != nil {
+		log.Errorf("unmarshal denylist error:%v", err)
+		return
+	}
+
+	s.filter.Set(list.Version, list.Entries)
+}
+
+func (s *denylistSyncer) run() {
+	ticker := time.NewTicker(denylistSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sync()
+		<-ticker.C
+	}
+}
+
+func (s *denylistSyncer) sync() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	list, err := s.scheduler.GetDenylist(ctx, s.filter.Version())
+	if err != nil {
+		log.Warnf("GetDenylist error:%v", err)
+		return
+	}
+
+	if err := s.set(list); err != nil {
+		log.Errorf("set denylist error:%v", err)
+	}
+}
+
+// set verify and save the denylist, the denylist of the current version is ignored
+func (s *denylistSyncer) set(list api.Denylist) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if list.Version == s.filter.Version() {
+		return nil
+	}
+
+	pub, err := s.tickets.publicKey()
+	if err != nil {
+		return err
+	}
+
+	if err := denylist.Verify(pub, list.Version, list.Entries, list.Signature); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ds.Put(context.Background(), datastore.NewKey(denylistKey), buf); err != nil {
+		log.Errorf("save denylist error:%v", err)
+	}
+
+	s.filter.Set(list.Version, list.Entries)
+	log.Infof("denylist version %d, entries %d", list.Version, len(list.Entries))
+
+	return nil
+}
+
+// deniedBlocks blocks of the denied carfiles by the carfile membership in datastore,
+// rebuilt when the denylist changed, the blocks are refused before they are purged
+type deniedBlocks struct {
+	ds     datastore.Batching
+	filter *denylist.Filter
+
+	// only one rebuild at a time
+	rebuildLock sync.Mutex
+
+	lock sync.RWMutex
+	cids map[string]struct{}
+}
+
+func newDeniedBlocks(ds datastore.Batching, filter *denylist.Filter) *deniedBlocks {
+	d := &deniedBlocks{ds: ds, filter: filter, cids: make(map[string]struct{})}
+	if filter == nil {
+		return d
+	}
+
+	filter.Notify(d.rebuild)
+	d.rebuild()
+
+	return d
+}
+
+func (d *deniedBlocks) rebuild() {
+	d.rebuildLock.Lock()
+	defer d.rebuildLock.Unlock()
+
+	cids := make(map[string]struct{})
+	if d.filter.Len() > 0 {
+		results, err := d.ds.Query(context.Background(), query.Query{Prefix: helper.KeyCarfilePrefix, KeysOnly: true})
+		if err != nil {
+			log.Errorf("query carfile blocks error:%v", err)
+			return
+		}
+
+		for r := range results.Next() {
+			if r.Error != nil {
+				continue
+			}
+
+			// /carfile/<carfile cid>/<block cid>
+			parts := datastore.NewKey(r.Key).Namespaces()
+			if len(parts) == 3 && d.filter.Denied(parts[1]) {
+				cids[parts[2]] = struct{}{}
+			}
+		}
+		results.Close()
+	}
+
+	d.lock.Lock()
+	d.cids = cids
+	d.lock.Unlock()
+}
+
+// denied the block is of a denied carfile
+func (d *deniedBlocks) denied(cid string) bool {
+	if d == nil {
+		return false
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	_, ok := d.cids[cid]
+	return ok
+}
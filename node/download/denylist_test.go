@@ -0,0 +1,62 @@
+package download
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/linguohua/titan/lib/denylist"
+	"github.com/linguohua/titan/node/helper"
+)
+
+func TestDeniedBlocks(t *testing.T) {
+	root := blocks.NewBlock([]byte("root")).Cid().String()
+	child := blocks.NewBlock([]byte("child")).Cid().String()
+	other := blocks.NewBlock([]byte("other")).Cid().String()
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	for _, c := range []string{root, child} {
+		if err := ds.Put(context.Background(), helper.NewKeyCarfileBlock(root, c), []byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := denylist.NewFilter()
+	d := newDeniedBlocks(ds, filter)
+
+	if d.denied(child) {
+		t.Fatal("block denied before the carfile denied")
+	}
+
+	rootCid := blocks.NewBlock([]byte("root")).Cid()
+	filter.Set(1, []string{denylist.Hash(rootCid)})
+
+	// rebuild is notified in goroutine
+	deadline := time.Now().Add(time.Second)
+	for !d.denied(child) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !d.denied(child) {
+		t.Error("block of the denied carfile is not denied")
+	}
+
+	if d.denied(other) {
+		t.Error("block not in the denied carfile is denied")
+	}
+
+	filter.Set(2, nil)
+	d.rebuild()
+
+	if d.denied(child) {
+		t.Error("block denied after the carfile removed from denylist")
+	}
+
+	var nilBlocks *deniedBlocks
+	if nilBlocks.denied(child) {
+		t.Error("nil denied blocks deny the block")
+	}
+}
@@ -0,0 +1,340 @@
+package download
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+const (
+	usageReportInterval = 5 * time.Minute
+	// violations keep when report failed
+	violationMaxPending = 1000
+	// max bytes of a read, burst of the rate limiters is not less than it
+	limitReadChunk = 32 * 1024
+	dateLayout     = "2006-01-02"
+)
+
+// limitState usage of a client ip, app or ticket
+type limitState struct {
+	conns int
+	rate  *rate.Limiter
+	// bytes downloaded on the day
+	day   string
+	bytes int64
+}
+
+// downloadLimiter limit the concurrent connections, bytes per second and daily bytes of
+// client ips, apps and tickets, the usage of apps and violations are reported to scheduler
+type downloadLimiter struct {
+	lock      sync.Mutex
+	scheduler api.Scheduler
+	token     *helper.NodeToken
+	limits    api.DownloadLimits
+	// scope:target:state
+	states map[string]map[string]*limitState
+
+	// app name:usage of today, the date of usage is kept for the reports across days
+	usages map[string]*api.AppDownloadUsage
+	// scope/target/limit:violation
+	violations map[string]*api.DownloadViolation
+}
+
+// limitLease a download accepted by the limiter
+type limitLease struct {
+	dl      *downloadLimiter
+	app     string
+	targets map[string]string
+	rates   []*rate.Limiter
+}
+
+func newDownloadLimiter(scheduler api.Scheduler, token *helper.NodeToken) *downloadLimiter {
+	dl := &downloadLimiter{
+		scheduler: scheduler,
+		token:     token,
+		states: map[string]map[string]*limitState{
+			api.DownloadScopeIP:     make(map[string]*limitState),
+			api.DownloadScopeApp:    make(map[string]*limitState),
+			api.DownloadScopeTicket: make(map[string]*limitState),
+		},
+		usages:     make(map[string]*api.AppDownloadUsage),
+		violations: make(map[string]*api.DownloadViolation),
+	}
+
+	go dl.run()
+
+	return dl
+}
+
+// setLimits the rate limiters are created again with the new limits
+func (dl *downloadLimiter) setLimits(limits api.DownloadLimits) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.limits = limits
+	for _, states := range dl.states {
+		for _, state := range states {
+			state.rate = nil
+		}
+	}
+}
+
+func (dl *downloadLimiter) limitOf(scope, target string) api.DownloadLimit {
+	switch scope {
+	case api.DownloadScopeIP:
+		return dl.limits.PerIP
+	case api.DownloadScopeApp:
+		if limit, ok := dl.limits.Apps[target]; ok {
+			return limit
+		}
+		return dl.limits.PerApp
+	case api.DownloadScopeTicket:
+		return dl.limits.PerTicket
+	}
+
+	return api.DownloadLimit{}
+}
+
+// acquire check the limits before download size bytes, the lease must be released after download
+func (dl *downloadLimiter) acquire(clientIP, app, ticketID string, size int64) (*limitLease, error) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	today := time.Now().Format(dateLayout)
+	targets := map[string]string{api.DownloadScopeIP: clientIP, api.DownloadScopeApp: app, api.DownloadScopeTicket: ticketID}
+
+	for scope, target := range targets {
+		if target == "" {
+			continue
+		}
+
+		limit := dl.limitOf(scope, target)
+		state := dl.state(scope, target, today)
+
+		if limit.MaxConns > 0 && state.conns >= limit.MaxConns {
+			dl.violate(scope, target, api.DownloadLimitConns, clientIP, app, today)
+			return nil, xerrors.Errorf("%s %s exceed max connections %d", scope, target, limit.MaxConns)
+		}
+
+		if limit.DailyBytes > 0 && state.bytes+size > limit.DailyBytes {
+			dl.violate(scope, target, api.DownloadLimitDaily, clientIP, app, today)
+			return nil, xerrors.Errorf("%s %s exceed daily bytes %d", scope, target, limit.DailyBytes)
+		}
+	}
+
+	lease := &limitLease{dl: dl, app: app, targets: targets}
+	for scope, target := range targets {
+		if target == "" {
+			continue
+		}
+
+		state := dl.states[scope][target]
+		state.conns++
+
+		limit := dl.limitOf(scope, target)
+		if limit.BytesPerSec <= 0 {
+			continue
+		}
+
+		if state.rate == nil {
+			burst := int(limit.BytesPerSec)
+			if burst < limitReadChunk {
+				burst = limitReadChunk
+			}
+			state.rate = rate.NewLimiter(rate.Limit(limit.BytesPerSec), burst)
+		}
+		lease.rates = append(lease.rates, state.rate)
+	}
+
+	return lease, nil
+}
+
+// state of the target, the daily bytes are reset on a new day
+func (dl *downloadLimiter) state(scope, target, today string) *limitState {
+	state, ok := dl.states[scope][target]
+	if !ok {
+		state = &limitState{day: today}
+		dl.states[scope][target] = state
+	}
+
+	if state.day != today {
+		state.day = today
+		state.bytes = 0
+	}
+
+	return state
+}
+
+func (dl *downloadLimiter) violate(scope, target, limit, clientIP, app, today string) {
+	log.Warnf("download rejected by %s limit of %s %s, client:%s, app:%s", limit, scope, target, clientIP, app)
+
+	if app != "" {
+		dl.usage(app, today).Rejected++
+	}
+
+	key := scope + "/" + target + "/" + limit
+	v, ok := dl.violations[key]
+	if !ok {
+		if len(dl.violations) >= violationMaxPending {
+			return
+		}
+
+		v = &api.DownloadViolation{Scope: scope, Target: target, Limit: limit, ClientIP: clientIP, AppName: app, CreatedTime: time.Now().Unix()}
+		dl.violations[key] = v
+	}
+	v.Count++
+}
+
+func (dl *downloadLimiter) usage(app, date string) *api.AppDownloadUsage {
+	key := app + "/" + date
+	usage, ok := dl.usages[key]
+	if !ok {
+		usage = &api.AppDownloadUsage{AppName: app, Date: date}
+		dl.usages[key] = usage
+	}
+
+	return usage
+}
+
+// reader throttle the reader by the rate limits of the lease
+func (l *limitLease) reader(ctx context.Context, r io.Reader) io.Reader {
+	if len(l.rates) == 0 {
+		return r
+	}
+
+	return &limitReader{ctx: ctx, r: r, rates: l.rates}
+}
+
+// release record the bytes downloaded
+func (l *limitLease) release(bytes int64, blocks int) {
+	dl := l.dl
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	today := time.Now().Format(dateLayout)
+	for scope, target := range l.targets {
+		if target == "" {
+			continue
+		}
+
+		state := dl.state(scope, target, today)
+		state.bytes += bytes
+		if state.conns > 0 {
+			state.conns--
+		}
+	}
+
+	if l.app != "" {
+		usage := dl.usage(l.app, today)
+		usage.Bytes += bytes
+		usage.Blocks += int64(blocks)
+	}
+}
+
+type limitReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rates []*rate.Limiter
+}
+
+func (r *limitReader) Read(buf []byte) (int, error) {
+	if len(buf) > limitReadChunk {
+		buf = buf[:limitReadChunk]
+	}
+
+	n, err := r.r.Read(buf)
+	if n <= 0 {
+		return n, err
+	}
+
+	for _, l := range r.rates {
+		if werr := l.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+func (dl *downloadLimiter) run() {
+	ticker := time.NewTicker(usageReportInterval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+
+		dl.clean()
+		dl.report()
+	}
+}
+
+// clean remove the idle states, the states of today are kept for daily limit
+func (dl *downloadLimiter) clean() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	today := time.Now().Format(dateLayout)
+	for scope, states := range dl.states {
+		for target, state := range states {
+			if state.conns == 0 && (state.day != today || dl.limitOf(scope, target).DailyBytes <= 0) {
+				delete(states, target)
+			}
+		}
+	}
+}
+
+func (dl *downloadLimiter) report() {
+	dl.lock.Lock()
+	report := api.DownloadUsageReport{}
+	for _, usage := range dl.usages {
+		report.Apps = append(report.Apps, *usage)
+	}
+	for _, v := range dl.violations {
+		report.Violations = append(report.Violations, *v)
+	}
+	usages := dl.usages
+	violations := dl.violations
+	dl.usages = make(map[string]*api.AppDownloadUsage)
+	dl.violations = make(map[string]*api.DownloadViolation)
+	dl.lock.Unlock()
+
+	if len(report.Apps) == 0 && len(report.Violations) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := dl.scheduler.SubmitDownloadUsage(ctx, dl.token.Get(ctx), report)
+	if err == nil {
+		return
+	}
+
+	log.Errorf("SubmitDownloadUsage error:%v", err)
+
+	// report again next time
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	for _, usage := range usages {
+		current := dl.usage(usage.AppName, usage.Date)
+		current.Bytes += usage.Bytes
+		current.Blocks += usage.Blocks
+		current.Rejected += usage.Rejected
+	}
+
+	for key, v := range violations {
+		if current, ok := dl.violations[key]; ok {
+			current.Count += v.Count
+		} else if len(dl.violations) < violationMaxPending {
+			dl.violations[key] = v
+		}
+	}
+}
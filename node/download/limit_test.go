@@ -0,0 +1,63 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linguohua/titan/api"
+)
+
+func TestDownloadLimiter(t *testing.T) {
+	dl := newDownloadLimiter(nil, nil)
+	dl.setLimits(api.DownloadLimits{
+		PerIP: api.DownloadLimit{MaxConns: 1},
+		Apps:  map[string]api.DownloadLimit{"app": {DailyBytes: 100}},
+	})
+
+	lease, err := dl.acquire("1.1.1.1", "app", "t1", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dl.acquire("1.1.1.1", "app", "t2", 10); err == nil {
+		t.Fatal("max connections of ip not limited")
+	}
+
+	lease.release(60, 1)
+
+	if _, err := dl.acquire("2.2.2.2", "app", "t3", 60); err == nil {
+		t.Fatal("daily bytes of app not limited")
+	}
+
+	usage := dl.usage("app", time.Now().Format(dateLayout))
+	if usage.Bytes != 60 || usage.Blocks != 1 || usage.Rejected != 2 {
+		t.Fatalf("unexpected usage %+v", *usage)
+	}
+
+	if len(dl.violations) != 2 {
+		t.Fatalf("want 2 violations, got %d", len(dl.violations))
+	}
+}
+
+func TestDownloadLimiterSpoofedIP(t *testing.T) {
+	bd := &BlockDownload{limits: newDownloadLimiter(nil, nil)}
+	bd.limits.setLimits(api.DownloadLimits{PerIP: api.DownloadLimit{MaxConns: 1}})
+
+	request := func(realIP string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/block/get", nil)
+		r.RemoteAddr = "1.1.1.1:1234"
+		r.Header.Set("X-Real-IP", realIP)
+		return r
+	}
+
+	if _, err := bd.limits.acquire(bd.clientIP(request("2.2.2.2")), "", "t1", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// random X-Real-IP of the client does not bypass the limit of its ip
+	if _, err := bd.limits.acquire(bd.clientIP(request("3.3.3.3")), "", "t2", 10); err == nil {
+		t.Error("max connections of ip bypassed by X-Real-IP")
+	}
+}
@@ -0,0 +1,138 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+)
+
+const (
+	receiptSubmitInterval = time.Minute
+	receiptBatchSize      = 100
+	// receipts keep when submit failed
+	receiptMaxPending = 10000
+)
+
+// receiptCollector collect download receipts from users and submit to scheduler in batches
+type receiptCollector struct {
+	lock      sync.Mutex
+	scheduler api.Scheduler
+	token     *helper.NodeToken
+	receipts  []api.DownloadReceipt
+	notify    chan struct{}
+}
+
+func newReceiptCollector(scheduler api.Scheduler, token *helper.NodeToken) *receiptCollector {
+	rc := &receiptCollector{
+		scheduler: scheduler,
+		token:     token,
+		notify:    make(chan struct{}, 1),
+	}
+
+	go rc.run()
+
+	return rc
+}
+
+func (rc *receiptCollector) add(receipt api.DownloadReceipt) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	rc.receipts = append(rc.receipts, receipt)
+	if len(rc.receipts) > receiptMaxPending {
+		rc.receipts = rc.receipts[len(rc.receipts)-receiptMaxPending:]
+	}
+
+	if len(rc.receipts) >= receiptBatchSize {
+		select {
+		case rc.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (rc *receiptCollector) run() {
+	ticker := time.NewTicker(receiptSubmitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-rc.notify:
+		}
+
+		rc.submit()
+	}
+}
+
+func (rc *receiptCollector) submit() {
+	for {
+		rc.lock.Lock()
+		n := len(rc.receipts)
+		if n > receiptBatchSize {
+			n = receiptBatchSize
+		}
+		batch := make([]api.DownloadReceipt, n)
+		copy(batch, rc.receipts)
+		rc.receipts = rc.receipts[n:]
+		rc.lock.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		result, err := rc.scheduler.SubmitDownloadReceipts(ctx, rc.token.Get(ctx), batch)
+		cancel()
+		if err != nil {
+			log.Errorf("SubmitDownloadReceipts error:%v", err)
+
+			// submit again next time
+			rc.lock.Lock()
+			rc.receipts = append(batch, rc.receipts...)
+			if len(rc.receipts) > receiptMaxPending {
+				rc.receipts = rc.receipts[len(rc.receipts)-receiptMaxPending:]
+			}
+			rc.lock.Unlock()
+			return
+		}
+
+		if result.Rejected > 0 {
+			log.Warnf("SubmitDownloadReceipts accepted:%d, rejected:%d", result.Accepted, result.Rejected)
+		}
+	}
+}
+
+// receipt handle the download receipt signed by user
+func (bd *BlockDownload) receipt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var receipt api.DownloadReceipt
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&receipt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if receipt.DeviceID != bd.device.GetDeviceID() {
+		http.Error(w, "receipt device id mismatch", http.StatusBadRequest)
+		return
+	}
+
+	err = bd.tickets.served(receipt.Ticket, receipt.Cid)
+	if err != nil {
+		log.Errorf("receipt ticket error:%v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bd.receipts.add(receipt)
+}
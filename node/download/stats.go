@@ -0,0 +1,222 @@
+package download
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/helper"
+)
+
+const (
+	statsSubmitInterval = time.Minute
+	statsBatchSize      = 500
+	// stats keep when submit failed
+	statsMaxPending = 100000
+	// hours of stats kept for top cids and clients
+	statsKeepHours = 24
+	hourLayout     = "2006-01-02 15"
+)
+
+type statKey struct {
+	cid      string
+	clientIP string
+	hour     string
+}
+
+type aggStat struct {
+	stat     api.DownloadStat
+	speedSum int64
+	count    int64
+}
+
+// statsCollector aggregate the downloads by cid, client and hour, submit to scheduler in batches
+type statsCollector struct {
+	lock      sync.Mutex
+	scheduler api.Scheduler
+	deviceID  string
+	token     *helper.NodeToken
+	since     time.Time
+
+	current map[statKey]*aggStat
+	pending []api.DownloadStat
+
+	// hour:cid or client ip:rank
+	cids    map[string]map[string]*api.DownloadRank
+	clients map[string]map[string]*api.DownloadRank
+}
+
+func newStatsCollector(scheduler api.Scheduler, deviceID string, token *helper.NodeToken) *statsCollector {
+	sc := &statsCollector{
+		scheduler: scheduler,
+		deviceID:  deviceID,
+		token:     token,
+		since:     time.Now(),
+		current:   make(map[statKey]*aggStat),
+		cids:      make(map[string]map[string]*api.DownloadRank),
+		clients:   make(map[string]map[string]*api.DownloadRank),
+	}
+
+	go sc.run()
+
+	return sc
+}
+
+func (sc *statsCollector) add(cid, clientIP string, blocks int, bytes, speed int64) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	hour := time.Now().Format(hourLayout)
+	key := statKey{cid: cid, clientIP: clientIP, hour: hour}
+
+	agg, ok := sc.current[key]
+	if !ok {
+		agg = &aggStat{stat: api.DownloadStat{Cid: cid, DeviceID: sc.deviceID, ClientIP: clientIP, Hour: hour}}
+		sc.current[key] = agg
+	}
+
+	agg.stat.Blocks += blocks
+	agg.stat.BlockSize += int(bytes)
+	agg.speedSum += speed
+	agg.count++
+
+	addRank(sc.cids, hour, cid, blocks, bytes)
+	addRank(sc.clients, hour, clientIP, blocks, bytes)
+}
+
+func addRank(ranks map[string]map[string]*api.DownloadRank, hour, key string, blocks int, bytes int64) {
+	hourRanks, ok := ranks[hour]
+	if !ok {
+		hourRanks = make(map[string]*api.DownloadRank)
+		ranks[hour] = hourRanks
+	}
+
+	rank, ok := hourRanks[key]
+	if !ok {
+		rank = &api.DownloadRank{Key: key}
+		hourRanks[key] = rank
+	}
+
+	rank.Blocks += int64(blocks)
+	rank.Bytes += bytes
+}
+
+// top cids and clients of the kept hours by bytes
+func (sc *statsCollector) top(n int) api.DownloadStatsInfo {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	since := time.Now().Add(-statsKeepHours * time.Hour)
+	if since.Before(sc.since) {
+		since = sc.since
+	}
+
+	return api.DownloadStatsInfo{
+		Since:      since.Unix(),
+		TopCids:    topRanks(sc.cids, n),
+		TopClients: topRanks(sc.clients, n),
+	}
+}
+
+func topRanks(ranks map[string]map[string]*api.DownloadRank, n int) []api.DownloadRank {
+	sum := make(map[string]*api.DownloadRank)
+	for _, hourRanks := range ranks {
+		for key, rank := range hourRanks {
+			s, ok := sum[key]
+			if !ok {
+				s = &api.DownloadRank{Key: key}
+				sum[key] = s
+			}
+			s.Blocks += rank.Blocks
+			s.Bytes += rank.Bytes
+		}
+	}
+
+	out := make([]api.DownloadRank, 0, len(sum))
+	for _, rank := range sum {
+		out = append(out, *rank)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Bytes > out[j].Bytes
+	})
+
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+
+	return out
+}
+
+func (sc *statsCollector) run() {
+	ticker := time.NewTicker(statsSubmitInterval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+
+		sc.flush()
+		sc.submit()
+	}
+}
+
+// flush move the aggregated stats to pending, remove the ranks of the expired hours
+func (sc *statsCollector) flush() {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	for _, agg := range sc.current {
+		if agg.count > 0 {
+			agg.stat.DownloadSpeed = agg.speedSum / agg.count
+		}
+		sc.pending = append(sc.pending, agg.stat)
+	}
+	sc.current = make(map[statKey]*aggStat)
+
+	if len(sc.pending) > statsMaxPending {
+		log.Warnf("download stats pending exceed %d, drop %d", statsMaxPending, len(sc.pending)-statsMaxPending)
+		sc.pending = sc.pending[len(sc.pending)-statsMaxPending:]
+	}
+
+	expired := time.Now().Add(-statsKeepHours * time.Hour).Format(hourLayout)
+	for _, ranks := range []map[string]map[string]*api.DownloadRank{sc.cids, sc.clients} {
+		for hour := range ranks {
+			if hour <= expired {
+				delete(ranks, hour)
+			}
+		}
+	}
+}
+
+func (sc *statsCollector) submit() {
+	for {
+		sc.lock.Lock()
+		n := len(sc.pending)
+		if n > statsBatchSize {
+			n = statsBatchSize
+		}
+		batch := make([]api.DownloadStat, n)
+		copy(batch, sc.pending)
+		sc.pending = sc.pending[n:]
+		sc.lock.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := sc.scheduler.SubmitDownloadStats(ctx, sc.token.Get(ctx), batch)
+		cancel()
+		if err != nil {
+			log.Errorf("SubmitDownloadStats error:%v", err)
+
+			// submit again next time
+			sc.lock.Lock()
+			sc.pending = append(batch, sc.pending...)
+			sc.lock.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package download
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"golang.org/x/xerrors"
+)
+
+func (s *fakeScheduler) SubmitDownloadStats(ctx context.Context, token string, stats []api.DownloadStat) error {
+	if atomic.LoadInt32(&s.fail) != 0 {
+		return xerrors.New("scheduler offline")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.statsBatches = append(s.statsBatches, stats)
+	return nil
+}
+
+func newTestStatsCollector(scheduler api.Scheduler) *statsCollector {
+	return &statsCollector{
+		scheduler: scheduler,
+		deviceID:  "e_1",
+		since:     time.Now(),
+		current:   make(map[statKey]*aggStat),
+		cids:      make(map[string]map[string]*api.DownloadRank),
+		clients:   make(map[string]map[string]*api.DownloadRank),
+	}
+}
+
+func TestStatsAggregate(t *testing.T) {
+	sc := newTestStatsCollector(nil)
+
+	sc.add("a", "1.1.1.1", 1, 100, 10)
+	sc.add("a", "1.1.1.1", 2, 200, 30)
+	sc.add("a", "2.2.2.2", 1, 50, 10)
+	sc.add("b", "2.2.2.2", 1, 1000, 10)
+
+	sc.flush()
+	if len(sc.pending) != 3 || len(sc.current) != 0 {
+		t.Fatalf("pending %d, current %d", len(sc.pending), len(sc.current))
+	}
+
+	for _, stat := range sc.pending {
+		if stat.Cid == "a" && stat.ClientIP == "1.1.1.1" {
+			if stat.Blocks != 3 || stat.BlockSize != 300 || stat.DownloadSpeed != 20 || stat.DeviceID != "e_1" {
+				t.Errorf("aggregated stat %+v", stat)
+			}
+		}
+	}
+
+	top := sc.top(1)
+	if len(top.TopCids) != 1 || top.TopCids[0].Key != "b" || top.TopCids[0].Bytes != 1000 {
+		t.Errorf("top cids %v", top.TopCids)
+	}
+
+	if len(top.TopClients) != 1 || top.TopClients[0].Key != "2.2.2.2" || top.TopClients[0].Blocks != 2 {
+		t.Errorf("top clients %v", top.TopClients)
+	}
+
+	// ranks of the expired hours are removed
+	expired := time.Now().Add(-(statsKeepHours + 1) * time.Hour).Format(hourLayout)
+	addRank(sc.cids, expired, "c", 1, 10000)
+	sc.flush()
+	if len(sc.top(0).TopCids) != 2 {
+		t.Error("rank of expired hour is kept")
+	}
+}
+
+func TestStatsSubmit(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	sc := newTestStatsCollector(scheduler)
+
+	for i := 0; i < statsBatchSize+1; i++ {
+		sc.pending = append(sc.pending, api.DownloadStat{Cid: "a", Blocks: i})
+	}
+
+	// kept for next submit after failed
+	atomic.StoreInt32(&scheduler.fail, 1)
+	sc.submit()
+	if len(sc.pending) != statsBatchSize+1 || sc.pending[0].Blocks != 0 {
+		t.Fatalf("pending %d after submit failed", len(sc.pending))
+	}
+
+	atomic.StoreInt32(&scheduler.fail, 0)
+	sc.submit()
+	if len(sc.pending) != 0 {
+		t.Fatalf("pending %d after submit", len(sc.pending))
+	}
+
+	if len(scheduler.statsBatches) != 2 || len(scheduler.statsBatches[0]) != statsBatchSize || len(scheduler.statsBatches[1]) != 1 {
+		t.Errorf("batches %d", len(scheduler.statsBatches))
+	}
+
+	// pending stats are limited
+	sc.pending = make([]api.DownloadStat, statsMaxPending)
+	sc.add("a", "1.1.1.1", 1, 100, 10)
+	sc.flush()
+	if len(sc.pending) != statsMaxPending || sc.pending[statsMaxPending-1].Cid != "a" {
+		t.Error("pending stats exceed max pending or the latest is dropped")
+	}
+}
@@ -0,0 +1,225 @@
+package download
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/helper"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// interval to remove expired ticket usages
+	ticketCleanInterval = time.Minute
+	// interval to refresh the ticket public key, the cached key is used while refreshing
+	ticketKeyRefreshInterval = 10 * time.Minute
+)
+
+// ticketUsage download usage of a ticket, keep until ticket expire
+type ticketUsage struct {
+	expireAt int64
+	bytes    int64
+	cids     map[string]struct{}
+}
+
+// ticketChecker verify download tickets offline with scheduler public key,
+// every block of a ticket can download only once
+type ticketChecker struct {
+	lock      sync.Mutex
+	scheduler api.Scheduler
+	ds        datastore.Batching
+	deviceID  string
+	usages    map[string]*ticketUsage
+	lastClean time.Time
+
+	keyLock  sync.Mutex
+	pubKey   *ecdsa.PublicKey
+	keyTime  time.Time
+	keyGroup singleflight.Group
+}
+
+func newTicketChecker(scheduler api.Scheduler, ds datastore.Batching, deviceID string) *ticketChecker {
+	return &ticketChecker{
+		scheduler: scheduler,
+		ds:        ds,
+		deviceID:  deviceID,
+		usages:    make(map[string]*ticketUsage),
+		lastClean: time.Now(),
+	}
+}
+
+// publicKey get the ticket public key from scheduler at first use,
+// the cached key is refreshed in background, concurrent fetches share one rpc
+func (tc *ticketChecker) publicKey() (*ecdsa.PublicKey, error) {
+	tc.keyLock.Lock()
+	key, keyTime := tc.pubKey, tc.keyTime
+	tc.keyLock.Unlock()
+
+	if key != nil {
+		if time.Since(keyTime) > ticketKeyRefreshInterval {
+			tc.keyGroup.DoChan("", tc.fetchPublicKey)
+		}
+		return key, nil
+	}
+
+	v, err, _ := tc.keyGroup.Do("", tc.fetchPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*ecdsa.PublicKey), nil
+}
+
+func (tc *ticketChecker) fetchPublicKey() (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	der, err := tc.scheduler.GetTicketPublicKey(ctx)
+	if err != nil {
+		log.Warnf("GetTicketPublicKey err:%s", err.Error())
+		return nil, err
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, xerrors.New("ticket public key is not ecdsa")
+	}
+
+	tc.keyLock.Lock()
+	tc.pubKey = key
+	tc.keyTime = time.Now()
+	tc.keyLock.Unlock()
+
+	return key, nil
+}
+
+// verify check the ticket allow the client to download the cid
+func (tc *ticketChecker) verify(signedTicket, cid, clientIP string) (*token.Ticket, error) {
+	ticket, err := tc.parse(signedTicket, clientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tc.allow(ticket, cid); err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+}
+
+// parse check the signature, audience and client of the ticket
+func (tc *ticketChecker) parse(signedTicket, clientIP string) (*token.Ticket, error) {
+	pub, err := tc.publicKey()
+	if err != nil {
+		return nil, xerrors.Errorf("get ticket public key: %w", err)
+	}
+
+	ticket, err := token.ParseTicket(signedTicket, pub)
+	if err != nil {
+		return nil, err
+	}
+
+	if ticket.Audience != tc.deviceID {
+		return nil, xerrors.Errorf("ticket is not for device %s", tc.deviceID)
+	}
+
+	if ticket.ClientIP != "" && ticket.ClientIP != clientIP {
+		return nil, xerrors.Errorf("ticket is not for client %s", clientIP)
+	}
+
+	return ticket, nil
+}
+
+// allow check the parsed ticket contain the cid
+func (tc *ticketChecker) allow(ticket *token.Ticket, cid string) error {
+	if ticket.HasCid(cid) {
+		return nil
+	}
+
+	if ticket.RootCid != "" {
+		if ticket.RootCid == cid {
+			return nil
+		}
+
+		ok, err := tc.ds.Has(context.Background(), helper.NewKeyCarfileBlock(ticket.RootCid, cid))
+		if err == nil && ok {
+			return nil
+		}
+	}
+
+	return xerrors.Errorf("ticket does not contain cid %s", cid)
+}
+
+// served check the block of the ticket is downloaded from this node
+func (tc *ticketChecker) served(signedTicket, cid string) error {
+	pub, err := tc.publicKey()
+	if err != nil {
+		return xerrors.Errorf("get ticket public key: %w", err)
+	}
+
+	ticket, err := token.ParseIssuedTicket(signedTicket, pub)
+	if err != nil {
+		return err
+	}
+
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	usage, ok := tc.usages[ticket.Id]
+	if !ok {
+		return xerrors.Errorf("ticket %s not used", ticket.Id)
+	}
+
+	if _, ok := usage.cids[cid]; !ok {
+		return xerrors.Errorf("cid %s of ticket %s not downloaded", cid, ticket.Id)
+	}
+
+	return nil
+}
+
+// use record the download of the block, reject replay and download over the byte budget
+func (tc *ticketChecker) use(ticket *token.Ticket, cid string, size int64) error {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(tc.lastClean) > ticketCleanInterval {
+		for id, usage := range tc.usages {
+			if usage.expireAt < now.Unix() {
+				delete(tc.usages, id)
+			}
+		}
+		tc.lastClean = now
+	}
+
+	usage, ok := tc.usages[ticket.Id]
+	if !ok {
+		usage = &ticketUsage{expireAt: ticket.ExpiresAt, cids: make(map[string]struct{})}
+		tc.usages[ticket.Id] = usage
+	}
+
+	if _, ok := usage.cids[cid]; ok {
+		return xerrors.Errorf("ticket %s already used for cid %s", ticket.Id, cid)
+	}
+
+	if ticket.MaxBytes > 0 && usage.bytes+size > ticket.MaxBytes {
+		return xerrors.Errorf("ticket %s exceed max bytes %d", ticket.Id, ticket.MaxBytes)
+	}
+
+	usage.cids[cid] = struct{}{}
+	usage.bytes += size
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package download
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/helper"
+	"golang.org/x/xerrors"
+)
+
+// fakeScheduler serve the ticket public key and receive the download stats
+type fakeScheduler struct {
+	api.Scheduler
+
+	der   []byte
+	fail  int32
+	calls int32
+
+	lock sync.Mutex
+	// batches of the submitted stats
+	statsBatches [][]api.DownloadStat
+}
+
+func (s *fakeScheduler) GetTicketPublicKey(ctx context.Context) ([]byte, error) {
+	atomic.AddInt32(&s.calls, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	if atomic.LoadInt32(&s.fail) != 0 {
+		return nil, xerrors.New("scheduler offline")
+	}
+	return s.der, nil
+}
+
+func newTestChecker(t *testing.T, deviceID string) (*ticketChecker, *fakeScheduler, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := &fakeScheduler{der: der}
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	return newTicketChecker(scheduler, ds, deviceID), scheduler, key
+}
+
+func signTicket(t *testing.T, key *ecdsa.PrivateKey, id, deviceID string, ticket token.Ticket) string {
+	now := time.Now()
+	ticket.StandardClaims = jwt.StandardClaims{
+		Id:        id,
+		Audience:  deviceID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+
+	signed, err := token.GenerateTicket(key, &ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestTicketVerify(t *testing.T) {
+	tc, _, key := newTestChecker(t, "e_1")
+
+	err := tc.ds.Put(context.Background(), helper.NewKeyCarfileBlock("root", "child"), []byte("child"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := signTicket(t, key, "t1", "e_1", token.Ticket{ClientIP: "1.1.1.1", Cids: []string{"a", "b"}})
+	if _, err := tc.verify(signed, "b", "1.1.1.1"); err != nil {
+		t.Errorf("verify cid of ticket: %v", err)
+	}
+
+	if _, err := tc.verify(signed, "c", "1.1.1.1"); err == nil {
+		t.Error("cid not in ticket is allowed")
+	}
+
+	if _, err := tc.verify(signed, "a", "2.2.2.2"); err == nil {
+		t.Error("ticket of other client is allowed")
+	}
+
+	other := signTicket(t, key, "t2", "e_2", token.Ticket{Cids: []string{"a"}})
+	if _, err := tc.verify(other, "a", "1.1.1.1"); err == nil {
+		t.Error("ticket of other device is allowed")
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged := signTicket(t, otherKey, "t3", "e_1", token.Ticket{Cids: []string{"a"}})
+	if _, err := tc.verify(forged, "a", "1.1.1.1"); err == nil {
+		t.Error("ticket not signed by scheduler is allowed")
+	}
+
+	root := signTicket(t, key, "t4", "e_1", token.Ticket{RootCid: "root"})
+	for _, cid := range []string{"root", "child"} {
+		if _, err := tc.verify(root, cid, "1.1.1.1"); err != nil {
+			t.Errorf("verify %s of root ticket: %v", cid, err)
+		}
+	}
+
+	if _, err := tc.verify(root, "other", "1.1.1.1"); err == nil {
+		t.Error("block not in the carfile of root ticket is allowed")
+	}
+}
+
+func TestTicketReplay(t *testing.T) {
+	tc, _, key := newTestChecker(t, "e_1")
+
+	signed := signTicket(t, key, "t1", "e_1", token.Ticket{Cids: []string{"a", "b", "c"}, MaxBytes: 100})
+	ticket, err := tc.verify(signed, "a", "1.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tc.use(ticket, "a", 60); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tc.use(ticket, "a", 60); err == nil {
+		t.Error("replay of the block is allowed")
+	}
+
+	if err := tc.use(ticket, "b", 60); err == nil {
+		t.Error("download over max bytes is allowed")
+	}
+
+	if err := tc.use(ticket, "c", 40); err != nil {
+		t.Errorf("download in max bytes: %v", err)
+	}
+
+	if err := tc.served(signed, "a"); err != nil {
+		t.Errorf("served block: %v", err)
+	}
+
+	if err := tc.served(signed, "b"); err == nil {
+		t.Error("block not downloaded is served")
+	}
+}
+
+func TestTicketPublicKey(t *testing.T) {
+	tc, scheduler, key := newTestChecker(t, "e_1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tc.publicKey(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&scheduler.calls); calls != 1 {
+		t.Errorf("public key fetched %d times", calls)
+	}
+
+	// cached key is used when refresh failed
+	atomic.StoreInt32(&scheduler.fail, 1)
+	tc.keyLock.Lock()
+	tc.keyTime = time.Now().Add(-2 * ticketKeyRefreshInterval)
+	tc.keyLock.Unlock()
+
+	pub, err := tc.publicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !pub.Equal(&key.PublicKey) {
+		t.Error("cached key mismatch")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	bd := &BlockDownload{trustedProxies: parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "bad"})}
+	if len(bd.trustedProxies) != 2 {
+		t.Fatalf("trusted proxies %v", bd.trustedProxies)
+	}
+
+	cases := []struct {
+		remote, realIP, expect string
+	}{
+		{"1.1.1.1:1234", "", "1.1.1.1"},
+		// spoofed by client
+		{"1.1.1.1:1234", "2.2.2.2", "1.1.1.1"},
+		// relay tunnel
+		{"127.0.0.1:1234", "2.2.2.2", "2.2.2.2"},
+		{"10.1.2.3:1234", "2.2.2.2", "2.2.2.2"},
+		{"192.168.1.1:1234", "2.2.2.2", "2.2.2.2"},
+		{"192.168.1.2:1234", "2.2.2.2", "192.168.1.2"},
+		{"10.1.2.3:1234", "invalid", "10.1.2.3"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/block/get", nil)
+		r.RemoteAddr = c.remote
+		if c.realIP != "" {
+			r.Header.Set("X-Real-IP", c.realIP)
+		}
+
+		if ip := bd.clientIP(r); ip != c.expect {
+			t.Errorf("client ip of %s %s is %s, expect %s", c.remote, c.realIP, ip, c.expect)
+		}
+	}
+}
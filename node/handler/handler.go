@@ -13,6 +13,17 @@ var log = logging.Logger("handler")
 
 type RequestIP struct{}
 
+// PeerID device id from the verified tls client certificate
+type PeerID struct{}
+
+// Tenant tenant of the verified token, it is set by the verify of auth handler
+type Tenant struct{}
+
+// tenantHolder the context of auth verify is not passed to the rpc method, the holder is shared by them
+type tenantHolder struct {
+	id string
+}
+
 type Handler struct {
 	handler *auth.Handler
 }
@@ -25,6 +36,31 @@ func GetRequestIP(ctx context.Context) string {
 	return v
 }
 
+// GetPeerID device id of the tls peer, empty if request is not from a tls client with certificate
+func GetPeerID(ctx context.Context) string {
+	v, ok := ctx.Value(PeerID{}).(string)
+	if !ok {
+		return ""
+	}
+	return v
+}
+
+// SetTenant set the tenant of the request, called by the verify of auth handler
+func SetTenant(ctx context.Context, tenantID string) {
+	if holder, ok := ctx.Value(Tenant{}).(*tenantHolder); ok {
+		holder.id = tenantID
+	}
+}
+
+// GetTenant tenant of the token, empty if the token is not of a tenant
+func GetTenant(ctx context.Context) string {
+	holder, ok := ctx.Value(Tenant{}).(*tenantHolder)
+	if !ok {
+		return ""
+	}
+	return holder.id
+}
+
 func New(ah *auth.Handler) http.Handler {
 	return &Handler{ah}
 }
@@ -43,6 +79,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, RequestIP{}, reqIP)
+	ctx = context.WithValue(ctx, Tenant{}, &tenantHolder{})
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		ctx = context.WithValue(ctx, PeerID{}, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}
 
 	h.handler.ServeHTTP(w, r.WithContext(ctx))
 }
@@ -0,0 +1,35 @@
+package helper
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/linguohua/titan/api"
+	"golang.org/x/xerrors"
+)
+
+// NodeAuthVerify verify the token of the rpc request of node by scheduler,
+// the token scheduler issued for calling other node is refused
+func NodeAuthVerify(deviceID string, verify func(ctx context.Context, token string) ([]auth.Permission, error)) func(ctx context.Context, token string) ([]auth.Permission, error) {
+	return func(ctx context.Context, token string) ([]auth.Permission, error) {
+		perms, err := verify(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]auth.Permission, 0, len(perms))
+		for _, perm := range perms {
+			id := api.NodeOfPermission(perm)
+			if id == "" {
+				out = append(out, perm)
+				continue
+			}
+
+			if id != deviceID {
+				return nil, xerrors.Errorf("token of node %s can not call node %s", id, deviceID)
+			}
+		}
+
+		return out, nil
+	}
+}
@@ -1,12 +1,13 @@
 package helper
 
 import (
+	"crypto/tls"
 	"fmt"
-	"time"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/blockstore"
+	"github.com/linguohua/titan/lib/denylist"
 )
 
 const (
@@ -17,11 +18,14 @@ const (
 	// validate timeout
 	ValidateTimeout = 5
 
-	DownloadSrvPath          = "/block/get"
-	DownloadTokenExpireAfter = 24 * time.Hour
+	DownloadSrvPath     = "/block/get"
+	DownloadReceiptPath = "/block/receipt"
+	// blocks of cids or a dag in car format
+	DownloadBatchPath = "/block/batch"
 
 	KeyFidPrefix     = "fid/"
 	KeyCidPrefix     = "cid/"
+	KeyCarfilePrefix = "carfile/"
 	TcpPackMaxLength = 52428800
 )
 
@@ -33,6 +37,18 @@ type NodeParams struct {
 	DownloadSrvKey  string
 	DownloadSrvAddr string
 	IPFSGateway     string
+	// download server serve https and http/2 if set
+	DownloadTLS *tls.Config
+	// hostname in the download url, external ip if empty
+	DownloadHostname string
+	// json lines access log of the download server, disabled if empty
+	AccessLogPath string
+	// ips or cidrs of the proxies in front of the download server, X-Real-IP is only trusted from them
+	DownloadTrustedProxies []string
+	// cids refused by the node, shared by download server and block loader
+	Denylist *denylist.Filter
+	// token of the node to submit downloads to scheduler
+	NodeToken *NodeToken
 }
 
 func NewKeyFID(fid string) datastore.Key {
@@ -44,3 +60,9 @@ func NewKeyCID(cid string) datastore.Key {
 	key := fmt.Sprintf("%s%s", KeyCidPrefix, cid)
 	return datastore.NewKey(key)
 }
+
+// NewKeyCarfileBlock key of the block cached by carfile
+func NewKeyCarfileBlock(carfileCid, cid string) datastore.Key {
+	key := fmt.Sprintf("%s%s/%s", KeyCarfilePrefix, carfileCid, cid)
+	return datastore.NewKey(key)
+}
@@ -0,0 +1,73 @@
+package helper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/linguohua/titan/api"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("helper")
+
+// node token is got again before this time of expire
+const nodeTokenRenewBefore = 10 * time.Minute
+
+// NodeToken token of the node got from scheduler by the secret, it expires and is got again before expired
+type NodeToken struct {
+	scheduler api.Scheduler
+	deviceID  string
+	secret    string
+
+	lock   sync.Mutex
+	token  string
+	expire time.Time
+}
+
+// NewNodeToken get the token of the device from scheduler
+func NewNodeToken(ctx context.Context, scheduler api.Scheduler, deviceID, secret string) (*NodeToken, error) {
+	t := &NodeToken{scheduler: scheduler, deviceID: deviceID, secret: secret}
+	if err := t.renew(ctx); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Get the token, it is renewed if about to expire, the old token is returned if renew failed
+func (t *NodeToken) Get(ctx context.Context) string {
+	if t == nil {
+		return ""
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if time.Until(t.expire) < nodeTokenRenewBefore {
+		if err := t.renew(ctx); err != nil {
+			log.Errorf("renew node token err:%s", err.Error())
+		}
+	}
+
+	return t.token
+}
+
+func (t *NodeToken) renew(ctx context.Context) error {
+	token, err := t.scheduler.GetToken(ctx, t.deviceID, t.secret)
+	if err != nil {
+		return err
+	}
+
+	// the token is verified by scheduler, only the expire is read here
+	claims := jwt.StandardClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, &claims); err != nil {
+		return xerrors.Errorf("parse node token: %w", err)
+	}
+
+	t.token = token
+	t.expire = time.Unix(claims.ExpiresAt, 0)
+	return nil
+}
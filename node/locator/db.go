@@ -109,6 +109,14 @@ func (db *db) getDeviceInfo(deviceID string) (*deviceInfo, error) {
 	return db.db.getDeviceInfo(deviceID)
 }
 
+func (db *db) setDeviceOnline(deviceID, schedulerURL, areaID string) error {
+	return db.db.setDeviceInfo(deviceID, schedulerURL, areaID, true)
+}
+
+func (db *db) setDeviceOffline(deviceID, schedulerURL string) error {
+	return db.db.setDeviceOffline(deviceID, schedulerURL)
+}
+
 func (db *db) close() error {
 	return db.db.cli.Close()
 }
@@ -225,6 +233,12 @@ func (db *sqlDB) setDeviceInfo(deviceID string, schedulerURL string, areaID stri
 	return err
 }
 
+func (db *sqlDB) setDeviceOffline(deviceID string, schedulerURL string) error {
+	devInfo := &deviceInfo{DeviceID: deviceID, SchedulerURL: schedulerURL}
+	_, err := db.cli.NamedExec(`UPDATE device SET online=0 WHERE device_id=:device_id AND scheduler_url=:scheduler_url`, devInfo)
+	return err
+}
+
 func (db *sqlDB) deleteDeviceInfo(deviceID string) error {
 	devInfo := &deviceInfo{DeviceID: deviceID}
 	_, err := db.cli.NamedExec(`DELETE FROM device WHERE device_id=:device_id`, devInfo)
@@ -0,0 +1,394 @@
+package locator
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/region"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// area hint of the cid found in the area
+	cidAreaFoundTTL = 10 * time.Minute
+	// area hint of the cid not found in the area
+	cidAreaMissTTL = time.Minute
+	// max cids of hints, expired hints are purged when reach it
+	maxCidAreaHints = 100000
+	// areas are queried at the same time
+	areaFanoutBatch = 3
+	// default count of download infos return to user
+	defaultDownloadInfos = 5
+)
+
+type areaHint struct {
+	found  bool
+	expire time.Time
+}
+
+// cidAreaHints the areas which the cid found or not found recently
+type cidAreaHints struct {
+	lk sync.Mutex
+	// cid:areaID:*areaHint
+	hints map[string]map[string]*areaHint
+}
+
+func newCidAreaHints() *cidAreaHints {
+	return &cidAreaHints{hints: make(map[string]map[string]*areaHint)}
+}
+
+// get the valid hints of the cid, areaID:found
+func (h *cidAreaHints) get(cid string) map[string]bool {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	out := make(map[string]bool)
+	now := time.Now()
+	for areaID, hint := range h.hints[cid] {
+		if hint.expire.After(now) {
+			out[areaID] = hint.found
+		}
+	}
+
+	return out
+}
+
+func (h *cidAreaHints) set(cid, areaID string, found bool) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	areas, ok := h.hints[cid]
+	if !ok {
+		if len(h.hints) >= maxCidAreaHints {
+			h.purge()
+		}
+
+		areas = make(map[string]*areaHint)
+		h.hints[cid] = areas
+	}
+
+	ttl := cidAreaMissTTL
+	if found {
+		ttl = cidAreaFoundTTL
+	}
+	areas[areaID] = &areaHint{found: found, expire: time.Now().Add(ttl)}
+}
+
+// purge expired hints, clear all if it is still full
+func (h *cidAreaHints) purge() {
+	now := time.Now()
+	for cid, areas := range h.hints {
+		for areaID, hint := range areas {
+			if !hint.expire.After(now) {
+				delete(areas, areaID)
+			}
+		}
+
+		if len(areas) == 0 {
+			delete(h.hints, cid)
+		}
+	}
+
+	if len(h.hints) >= maxCidAreaHints {
+		h.hints = make(map[string]map[string]*areaHint)
+	}
+}
+
+// areaGeo location of the area, learned from the ip of its schedulers
+func (locator *Locator) areaGeo(areaID string) *region.GeoInfo {
+	if v, ok := locator.areaGeos.Load(areaID); ok {
+		return v.(*region.GeoInfo)
+	}
+
+	accessPoint, err := locator.cfg.getAccessPoint(areaID)
+	if err != nil {
+		return nil
+	}
+
+	for _, info := range accessPoint.SchedulerInfos {
+		u, err := url.Parse(info.URL)
+		if err != nil {
+			continue
+		}
+
+		ip := u.Hostname()
+		if net.ParseIP(ip) == nil {
+			addrs, err := net.LookupHost(ip)
+			if err != nil || len(addrs) == 0 {
+				continue
+			}
+			ip = addrs[0]
+		}
+
+		geoInfo, err := region.GetRegion().GetGeoInfo(ip)
+		if err != nil || geoInfo == nil {
+			continue
+		}
+
+		locator.areaGeos.Store(areaID, geoInfo)
+		return geoInfo
+	}
+
+	return nil
+}
+
+// sortAreas areas to find the cid, ordered by hints and geographic proximity to the user
+func (locator *Locator) sortAreas(clientGeo *region.GeoInfo, clientArea string, hints map[string]bool) []string {
+	areaIDs, err := locator.cfg.listAccessPoints()
+	if err != nil {
+		log.Errorf("sortAreas listAccessPoints err:%s", err.Error())
+		return nil
+	}
+
+	type areaOrder struct {
+		areaID   string
+		found    bool
+		level    int
+		distance float64
+	}
+
+	orders := make([]*areaOrder, 0, len(areaIDs))
+	for _, areaID := range areaIDs {
+		found, ok := hints[areaID]
+		if ok && !found {
+			// cid not in the area recently
+			continue
+		}
+
+		o := &areaOrder{areaID: areaID, found: found, level: region.AreaMatchLevel(clientArea, areaID), distance: -1}
+		if km, ok := region.DistanceKm(clientGeo, locator.areaGeo(areaID)); ok {
+			o.distance = km
+		}
+		orders = append(orders, o)
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		a, b := orders[i], orders[j]
+		if a.found != b.found {
+			return a.found
+		}
+		if a.level != b.level {
+			return a.level > b.level
+		}
+		// unknown distance is the last
+		if (a.distance < 0) != (b.distance < 0) {
+			return a.distance >= 0
+		}
+		return a.distance < b.distance
+	})
+
+	out := make([]string, 0, len(orders))
+	for _, o := range orders {
+		out = append(out, o.areaID)
+	}
+	return out
+}
+
+// areaSchedulerAPI a connected scheduler of the area, connect it if need
+func (locator *Locator) areaSchedulerAPI(areaID string) (*schedulerAPI, bool) {
+	if schedulerAPI, ok := locator.apMgr.randSchedulerAPI(areaID); ok {
+		return schedulerAPI, true
+	}
+
+	accessPoint, err := locator.cfg.getAccessPoint(areaID)
+	if err != nil {
+		return nil, false
+	}
+
+	for _, info := range accessPoint.SchedulerInfos {
+		if locator.apMgr.isStandby(info.URL) {
+			continue
+		}
+
+		if schedulerAPI, ok := locator.apMgr.getSchedulerAPI(info.URL, areaID, info.AccessToken); ok {
+			return schedulerAPI, true
+		}
+	}
+
+	return nil, false
+}
+
+// clientAreas areas to find the cid for the user, the nearest is the first
+func (locator *Locator) clientAreas(ip, cid string) []string {
+	clientArea := ""
+	clientGeo, err := region.GetRegion().GetGeoInfo(ip)
+	if err != nil {
+		log.Errorf("clientAreas get geo from ip error %s", err.Error())
+	} else {
+		clientArea = clientGeo.Geo
+	}
+
+	if clientArea == "" || clientArea == "unknown-unknown-unknown" {
+		log.Errorf("user %s can not get areaID", ip)
+		clientArea = defaultAreaID
+	}
+
+	areaIDs := locator.sortAreas(clientGeo, clientArea, locator.hints.get(cid))
+	log.Infof("user %s area %s find cid %s in areas %v", ip, clientArea, cid, areaIDs)
+
+	return areaIDs
+}
+
+// findDownloadInfos find the cid from the nearest areas, merge and rank the download infos of schedulers
+func (locator *Locator) findDownloadInfos(ctx context.Context, ip string, req api.DownloadTicketReq, max int) ([]api.DownloadInfo, error) {
+	if max <= 0 {
+		max = defaultDownloadInfos
+	}
+	// nodes are ranked for the user ip, not the locator
+	req.ClientIP = ip
+
+	cid := req.RootCid
+	if cid == "" && len(req.Cids) > 0 {
+		cid = req.Cids[0]
+	}
+
+	areaIDs := locator.clientAreas(ip, cid)
+
+	infos := make([]api.DownloadInfo, 0)
+	var lastErr error
+	for start := 0; start < len(areaIDs) && len(infos) == 0; start += areaFanoutBatch {
+		end := start + areaFanoutBatch
+		if end > len(areaIDs) {
+			end = len(areaIDs)
+		}
+
+		var lk sync.Mutex
+		var wg sync.WaitGroup
+		for _, areaID := range areaIDs[start:end] {
+			sAPI, ok := locator.areaSchedulerAPI(areaID)
+			if !ok {
+				continue
+			}
+
+			wg.Add(1)
+			go func(areaID string, sAPI *schedulerAPI) {
+				defer wg.Done()
+
+				cctx, cancel := context.WithTimeout(ctx, connectTimeout*time.Second)
+				defer cancel()
+
+				list, err := sAPI.GetDownloadTickets(cctx, req, max)
+				locator.hints.set(cid, areaID, err == nil && len(list) > 0)
+
+				lk.Lock()
+				defer lk.Unlock()
+
+				if err != nil {
+					lastErr = err
+					return
+				}
+				infos = append(infos, list...)
+			}(areaID, sAPI)
+		}
+		wg.Wait()
+	}
+
+	if len(infos) == 0 {
+		return nil, lastErr
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Score > infos[j].Score
+	})
+
+	if len(infos) > max {
+		infos = infos[:max]
+	}
+
+	return infos, nil
+}
+
+// findDownloadInfosWithBlocks find the cids from the nearest areas, the cids not found yet are sent to each area in one call,
+// the download infos of all areas in the batch are merged and ranked, error is returned only if no cid is found
+func (locator *Locator) findDownloadInfosWithBlocks(ctx context.Context, ip string, cids []string, max int) (map[string][]api.DownloadInfo, error) {
+	if len(cids) == 0 {
+		return nil, xerrors.New("cids is nil")
+	}
+
+	if max <= 0 {
+		max = defaultDownloadInfos
+	}
+
+	areaIDs := locator.clientAreas(ip, cids[0])
+
+	infoMap := make(map[string][]api.DownloadInfo)
+	var lastErr error
+	for start := 0; start < len(areaIDs); start += areaFanoutBatch {
+		missing := make([]string, 0, len(cids))
+		for _, cid := range cids {
+			if _, ok := infoMap[cid]; !ok {
+				missing = append(missing, cid)
+			}
+		}
+
+		if len(missing) == 0 {
+			break
+		}
+
+		end := start + areaFanoutBatch
+		if end > len(areaIDs) {
+			end = len(areaIDs)
+		}
+
+		var lk sync.Mutex
+		var wg sync.WaitGroup
+		for _, areaID := range areaIDs[start:end] {
+			sAPI, ok := locator.areaSchedulerAPI(areaID)
+			if !ok {
+				continue
+			}
+
+			wg.Add(1)
+			go func(areaID string, sAPI *schedulerAPI) {
+				defer wg.Done()
+
+				cctx, cancel := context.WithTimeout(ctx, connectTimeout*time.Second)
+				defer cancel()
+
+				found, err := sAPI.GetDownloadTicketsWithBlocks(cctx, api.DownloadTicketReq{Cids: missing, ClientIP: ip}, max)
+				for _, cid := range missing {
+					locator.hints.set(cid, areaID, err == nil && len(found[cid]) > 0)
+				}
+
+				lk.Lock()
+				defer lk.Unlock()
+
+				if err != nil {
+					lastErr = err
+					return
+				}
+
+				for cid, infos := range found {
+					if len(infos) > 0 {
+						infoMap[cid] = append(infoMap[cid], infos...)
+					}
+				}
+			}(areaID, sAPI)
+		}
+		wg.Wait()
+	}
+
+	if len(infoMap) == 0 {
+		if lastErr == nil {
+			lastErr = xerrors.Errorf("cids %v not found", cids)
+		}
+		return nil, lastErr
+	}
+
+	for cid, infos := range infoMap {
+		sort.SliceStable(infos, func(i, j int) bool {
+			return infos[i].Score > infos[j].Score
+		})
+
+		if len(infos) > max {
+			infoMap[cid] = infos[:max]
+		}
+	}
+
+	return infoMap, nil
+}
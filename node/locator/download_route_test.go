@@ -0,0 +1,240 @@
+package locator
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/region"
+	"golang.org/x/xerrors"
+)
+
+// fakeRegion geo of the ips in table
+type fakeRegion map[string]*region.GeoInfo
+
+func (r fakeRegion) GetGeoInfo(ip string) (*region.GeoInfo, error) {
+	if geo, ok := r[ip]; ok {
+		return geo, nil
+	}
+	return r.DefaultGeoInfo(ip), nil
+}
+
+func (r fakeRegion) DefaultGeoInfo(ip string) *region.GeoInfo {
+	return &region.GeoInfo{IP: ip, Geo: "unknown-unknown-unknown"}
+}
+
+// fakeCfg access points in memory
+type fakeCfg map[string]api.AccessPoint
+
+func (c fakeCfg) addAccessPoints(areaID string, schedulerURL string, weight int, accessToken string) error {
+	ap := c[areaID]
+	ap.AreaID = areaID
+	ap.SchedulerInfos = append(ap.SchedulerInfos, api.SchedulerInfo{URL: schedulerURL, Weight: weight, AccessToken: accessToken})
+	c[areaID] = ap
+	return nil
+}
+
+func (c fakeCfg) removeAccessPoints(areaID string) error {
+	delete(c, areaID)
+	return nil
+}
+
+func (c fakeCfg) listAccessPoints() ([]string, error) {
+	areaIDs := make([]string, 0, len(c))
+	for areaID := range c {
+		areaIDs = append(areaIDs, areaID)
+	}
+	sort.Strings(areaIDs)
+	return areaIDs, nil
+}
+
+func (c fakeCfg) getAccessPoint(areaID string) (api.AccessPoint, error) {
+	ap, ok := c[areaID]
+	if !ok {
+		return api.AccessPoint{}, xerrors.Errorf("area %s not found", areaID)
+	}
+	return ap, nil
+}
+
+func (c fakeCfg) isAccessPointExist(areaID, schedulerURL string) (bool, error) {
+	for _, info := range c[areaID].SchedulerInfos {
+		if info.URL == schedulerURL {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fakeScheduler serve the download infos of its cids
+type fakeScheduler struct {
+	api.Scheduler
+
+	lk    sync.Mutex
+	infos map[string][]api.DownloadInfo
+	err   error
+	// requests of the scheduler
+	reqs []api.DownloadTicketReq
+	// probe fails if loadErr is set
+	loadErr error
+	load    api.SchedulerLoad
+	probes  int
+}
+
+func (s *fakeScheduler) GetDownloadTicketsWithBlocks(ctx context.Context, req api.DownloadTicketReq, max int) (map[string][]api.DownloadInfo, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.reqs = append(s.reqs, req)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	out := make(map[string][]api.DownloadInfo)
+	for _, cid := range req.Cids {
+		if infos, ok := s.infos[cid]; ok {
+			out[cid] = infos
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, xerrors.New("not found")
+	}
+	return out, nil
+}
+
+func (s *fakeScheduler) GetSchedulerLoad(ctx context.Context) (api.SchedulerLoad, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.probes++
+	return s.load, s.loadErr
+}
+
+func (s *fakeScheduler) LocatorConnect(ctx context.Context, port int, areaID, locatorID, locatorToken string) error {
+	return nil
+}
+
+// newTestLocator locator with the schedulers of the areas, the url of the scheduler is its area
+func newTestLocator(schedulers map[string]*fakeScheduler) *Locator {
+	region.SetRegion(fakeRegion{
+		"1.1.1.1": {IP: "1.1.1.1", Geo: "CN-GD-Shenzhen", Latitude: 22.5, Longitude: 114},
+		"2.2.2.2": {IP: "2.2.2.2", Geo: "CN-GD-Guangzhou", Latitude: 23.1, Longitude: 113.3},
+		"3.3.3.3": {IP: "3.3.3.3", Geo: "US-CA-Oakland", Latitude: 37.8, Longitude: -122.3},
+		"4.4.4.4": {IP: "4.4.4.4", Geo: "US-NY-NewYork", Latitude: 40.7, Longitude: -74},
+	})
+
+	ips := map[string]string{"CN-GD-Shenzhen": "1.1.1.1", "CN-GD-Guangzhou": "2.2.2.2", "US-CA-Oakland": "3.3.3.3", "US-NY-NewYork": "4.4.4.4"}
+
+	cfg := fakeCfg{}
+	locator := &Locator{cfg: cfg, apMgr: newAccessPointMgr(5000, "", "locator"), hints: newCidAreaHints()}
+	for areaID, s := range schedulers {
+		url := "http://" + ips[areaID] + ":3456/rpc/v0"
+		cfg.addAccessPoints(areaID, url, 1, "")
+		locator.apMgr.addAccessPointToMap(areaID, &accessPoint{apis: []*schedulerAPI{{Scheduler: s, close: func() {}, url: url}}})
+	}
+
+	return locator
+}
+
+func TestFindDownloadInfosWithBlocks(t *testing.T) {
+	near := &fakeScheduler{infos: map[string][]api.DownloadInfo{
+		"a": {{URL: "near-a1", Score: 1}, {URL: "near-a2", Score: 3}},
+	}}
+	middle := &fakeScheduler{infos: map[string][]api.DownloadInfo{
+		"a": {{URL: "middle-a"}},
+		"b": {{URL: "middle-b"}},
+	}}
+	far := &fakeScheduler{err: xerrors.New("scheduler offline")}
+
+	locator := newTestLocator(map[string]*fakeScheduler{"CN-GD-Shenzhen": near, "CN-GD-Guangzhou": middle, "US-CA-Oakland": far})
+
+	infoMap, err := locator.findDownloadInfosWithBlocks(context.Background(), "1.1.1.1", []string{"a", "b", "c"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infoMap) != 2 {
+		t.Fatalf("cids found %v", infoMap)
+	}
+
+	if infoMap["a"][0].URL != "near-a2" || infoMap["a"][1].URL != "near-a1" || len(infoMap["a"]) != 3 {
+		t.Errorf("infos of a are not merged from the areas ranked by score: %v", infoMap["a"])
+	}
+
+	if infoMap["b"][0].URL != "middle-b" {
+		t.Errorf("infos of b %v", infoMap["b"])
+	}
+
+	// the areas of the batch are called once with the cids and the user ip
+	want := []api.DownloadTicketReq{{Cids: []string{"a", "b", "c"}, ClientIP: "1.1.1.1"}}
+	for i, s := range []*fakeScheduler{near, middle, far} {
+		if !reflect.DeepEqual(s.reqs, want) {
+			t.Errorf("requests of scheduler %d: got %v, want %v", i, s.reqs, want)
+		}
+	}
+
+	// error is returned if no cid found
+	_, err = locator.findDownloadInfosWithBlocks(context.Background(), "1.1.1.1", []string{"d"}, 0)
+	if err == nil {
+		t.Error("no error when no cid found")
+	}
+
+	if _, err := locator.findDownloadInfosWithBlocks(context.Background(), "1.1.1.1", nil, 0); err == nil {
+		t.Error("no error with nil cids")
+	}
+}
+
+func TestFindDownloadInfosWithBlocksMerge(t *testing.T) {
+	near := &fakeScheduler{infos: map[string][]api.DownloadInfo{
+		"a": {{URL: "near-a", Score: 1}},
+	}}
+	middle := &fakeScheduler{infos: map[string][]api.DownloadInfo{
+		"a": {{URL: "middle-a", Score: 5}},
+	}}
+	far := &fakeScheduler{infos: map[string][]api.DownloadInfo{
+		"a": {{URL: "far-a", Score: 3}},
+	}}
+	farthest := &fakeScheduler{infos: map[string][]api.DownloadInfo{
+		"a": {{URL: "farthest-a", Score: 10}},
+		"b": {{URL: "farthest-b"}},
+	}}
+
+	locator := newTestLocator(map[string]*fakeScheduler{
+		"CN-GD-Shenzhen": near, "CN-GD-Guangzhou": middle, "US-CA-Oakland": far, "US-NY-NewYork": farthest,
+	})
+
+	infoMap, err := locator.findDownloadInfosWithBlocks(context.Background(), "1.1.1.1", []string{"a", "b"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the best infos of the nearest batch, not the first area found
+	urls := []string{}
+	for _, info := range infoMap["a"] {
+		urls = append(urls, info.URL)
+	}
+	if !reflect.DeepEqual(urls, []string{"middle-a", "far-a"}) {
+		t.Errorf("infos of a: %v", urls)
+	}
+
+	if len(infoMap["b"]) != 1 || infoMap["b"][0].URL != "farthest-b" {
+		t.Errorf("infos of b: %v", infoMap["b"])
+	}
+
+	// the next batch is called only with the cids not found
+	if want := []api.DownloadTicketReq{{Cids: []string{"b"}, ClientIP: "1.1.1.1"}}; !reflect.DeepEqual(farthest.reqs, want) {
+		t.Errorf("requests of the next batch: got %v, want %v", farthest.reqs, want)
+	}
+
+	// the next batch is not called if all cids are found
+	farthest.reqs = nil
+	if _, err := locator.findDownloadInfosWithBlocks(context.Background(), "1.1.1.1", []string{"a"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(farthest.reqs) != 0 {
+		t.Errorf("next batch is called after all cids found: %v", farthest.reqs)
+	}
+}
@@ -0,0 +1,277 @@
+package locator
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// key is prefix/areaID/escaped scheduler url, value is json of etcdSchedulerCfg
+	etcdAccessPointPrefix = "/titan/locator/accesspoints/"
+	etcdDialTimeout       = 5 * time.Second
+	etcdRequestTimeout    = 5 * time.Second
+	// wait before watch again after the watch is broken
+	etcdRewatchInterval = time.Second
+)
+
+type etcdSchedulerCfg struct {
+	URL         string
+	Weight      int
+	AccessToken string
+}
+
+// etcdCfg access points saved in etcd, shared by all locators,
+// the local copy is updated by watch
+type etcdCfg struct {
+	cli *clientv3.Client
+
+	lk sync.RWMutex
+	// areaID:url:*etcdSchedulerCfg
+	accessPoints map[string]map[string]*etcdSchedulerCfg
+
+	// call when scheduler is removed from access point
+	onRemove func(areaID, schedulerURL string)
+}
+
+func newEtcdCfg(endpoints []string) (*etcdCfg, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &etcdCfg{cli: cli, accessPoints: make(map[string]map[string]*etcdSchedulerCfg)}
+
+	rev, err := cfg.load()
+	if err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	go cfg.watch(rev)
+
+	return cfg, nil
+}
+
+func etcdAccessPointKey(areaID, schedulerURL string) string {
+	return etcdAccessPointPrefix + areaID + "/" + url.PathEscape(schedulerURL)
+}
+
+func parseEtcdAccessPointKey(key string) (areaID, schedulerURL string, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(key, etcdAccessPointPrefix), "/", 2)
+	if len(parts) != 2 {
+		return "", "", xerrors.Errorf("invalid access point key:%s", key)
+	}
+
+	schedulerURL, err = url.PathUnescape(parts[1])
+	if err != nil {
+		return "", "", err
+	}
+
+	return parts[0], schedulerURL, nil
+}
+
+// load all access points, return the revision to watch from
+func (cfg *etcdCfg) load() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := cfg.cli.Get(ctx, etcdAccessPointPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	accessPoints := make(map[string]map[string]*etcdSchedulerCfg)
+	for _, kv := range resp.Kvs {
+		areaID, _, err := parseEtcdAccessPointKey(string(kv.Key))
+		if err != nil {
+			log.Errorf("etcd load access point err:%s", err.Error())
+			continue
+		}
+
+		scfg := &etcdSchedulerCfg{}
+		if err := json.Unmarshal(kv.Value, scfg); err != nil {
+			log.Errorf("etcd load access point %s err:%s", string(kv.Key), err.Error())
+			continue
+		}
+
+		if accessPoints[areaID] == nil {
+			accessPoints[areaID] = make(map[string]*etcdSchedulerCfg)
+		}
+		accessPoints[areaID][scfg.URL] = scfg
+	}
+
+	cfg.lk.Lock()
+	old := cfg.accessPoints
+	cfg.accessPoints = accessPoints
+	cfg.lk.Unlock()
+
+	// schedulers removed while the watch is broken
+	for areaID, schedulers := range old {
+		for schedulerURL := range schedulers {
+			if _, ok := accessPoints[areaID][schedulerURL]; !ok {
+				cfg.removed(areaID, schedulerURL)
+			}
+		}
+	}
+
+	return resp.Header.Revision, nil
+}
+
+func (cfg *etcdCfg) watch(rev int64) {
+	for {
+		// the watcher is released by cancel before watch again
+		ctx, cancel := context.WithCancel(cfg.cli.Ctx())
+		wch := cfg.cli.Watch(ctx, etcdAccessPointPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+		for resp := range wch {
+			if err := resp.Err(); err != nil {
+				log.Errorf("etcd watch access points err:%s", err.Error())
+				break
+			}
+
+			for _, ev := range resp.Events {
+				cfg.apply(ev)
+			}
+			rev = resp.Header.Revision
+		}
+		cancel()
+
+		if cfg.cli.Ctx().Err() != nil {
+			// client closed
+			return
+		}
+
+		time.Sleep(etcdRewatchInterval)
+
+		// the revision may be compacted, reload all
+		newRev, err := cfg.load()
+		if err != nil {
+			log.Errorf("etcd reload access points err:%s", err.Error())
+			continue
+		}
+		rev = newRev
+	}
+}
+
+func (cfg *etcdCfg) apply(ev *clientv3.Event) {
+	areaID, schedulerURL, err := parseEtcdAccessPointKey(string(ev.Kv.Key))
+	if err != nil {
+		log.Errorf("etcd watch access point err:%s", err.Error())
+		return
+	}
+
+	if ev.Type == clientv3.EventTypeDelete {
+		cfg.lk.Lock()
+		if schedulers, ok := cfg.accessPoints[areaID]; ok {
+			delete(schedulers, schedulerURL)
+			if len(schedulers) == 0 {
+				delete(cfg.accessPoints, areaID)
+			}
+		}
+		cfg.lk.Unlock()
+
+		log.Infof("etcd access point %s scheduler %s removed", areaID, schedulerURL)
+		cfg.removed(areaID, schedulerURL)
+		return
+	}
+
+	scfg := &etcdSchedulerCfg{}
+	if err := json.Unmarshal(ev.Kv.Value, scfg); err != nil {
+		log.Errorf("etcd watch access point %s err:%s", string(ev.Kv.Key), err.Error())
+		return
+	}
+
+	cfg.lk.Lock()
+	if cfg.accessPoints[areaID] == nil {
+		cfg.accessPoints[areaID] = make(map[string]*etcdSchedulerCfg)
+	}
+	cfg.accessPoints[areaID][scfg.URL] = scfg
+	cfg.lk.Unlock()
+
+	log.Infof("etcd access point %s scheduler %s updated", areaID, scfg.URL)
+}
+
+func (cfg *etcdCfg) removed(areaID, schedulerURL string) {
+	if cfg.onRemove != nil {
+		cfg.onRemove(areaID, schedulerURL)
+	}
+}
+
+func (cfg *etcdCfg) addAccessPoints(areaID string, schedulerURL string, weight int, accessToken string) error {
+	value, err := json.Marshal(&etcdSchedulerCfg{URL: schedulerURL, Weight: weight, AccessToken: accessToken})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	key := etcdAccessPointKey(areaID, schedulerURL)
+	// other locator may add it meanwhile
+	resp, err := cfg.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(value))).
+		Commit()
+	if err != nil {
+		return err
+	}
+
+	if !resp.Succeeded {
+		return xerrors.Errorf("access point %s scheduler %s aready exist", areaID, schedulerURL)
+	}
+	return nil
+}
+
+func (cfg *etcdCfg) removeAccessPoints(areaID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	_, err := cfg.cli.Delete(ctx, etcdAccessPointPrefix+areaID+"/", clientv3.WithPrefix())
+	return err
+}
+
+func (cfg *etcdCfg) listAccessPoints() (areaIDs []string, err error) {
+	cfg.lk.RLock()
+	defer cfg.lk.RUnlock()
+
+	areaIDs = make([]string, 0, len(cfg.accessPoints))
+	for areaID := range cfg.accessPoints {
+		areaIDs = append(areaIDs, areaID)
+	}
+	return areaIDs, nil
+}
+
+func (cfg *etcdCfg) getAccessPoint(areaID string) (api.AccessPoint, error) {
+	cfg.lk.RLock()
+	defer cfg.lk.RUnlock()
+
+	schedulers := cfg.accessPoints[areaID]
+	ap := api.AccessPoint{AreaID: areaID, SchedulerInfos: make([]api.SchedulerInfo, 0, len(schedulers))}
+	for _, scfg := range schedulers {
+		ap.SchedulerInfos = append(ap.SchedulerInfos, api.SchedulerInfo{URL: scfg.URL, Weight: scfg.Weight, AccessToken: scfg.AccessToken})
+	}
+
+	return ap, nil
+}
+
+func (cfg *etcdCfg) isAccessPointExist(areaID, schedulerURL string) (bool, error) {
+	cfg.lk.RLock()
+	defer cfg.lk.RUnlock()
+
+	_, ok := cfg.accessPoints[areaID][schedulerURL]
+	return ok, nil
+}
+
+func (cfg *etcdCfg) close() error {
+	return cfg.cli.Close()
+}
@@ -0,0 +1,166 @@
+package locator
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// newTestEtcdCfg new etcd cfg connected to the etcd server of the test
+func newTestEtcdCfg(t *testing.T, endpoints []string) *etcdCfg {
+	cfg, err := newEtcdCfg(endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cfg.close() })
+
+	return cfg
+}
+
+// removedRecorder record the schedulers removed from access points
+type removedRecorder struct {
+	lk      sync.Mutex
+	removed map[string]bool
+}
+
+func (r *removedRecorder) onRemove(areaID, schedulerURL string) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	r.removed[areaID+schedulerURL] = true
+}
+
+func (r *removedRecorder) isRemoved(areaID, schedulerURL string) bool {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	return r.removed[areaID+schedulerURL]
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("wait for %s timeout", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func isExist(cfg *etcdCfg, areaID, schedulerURL string) bool {
+	ok, _ := cfg.isAccessPointExist(areaID, schedulerURL)
+	return ok
+}
+
+func TestEtcdCfgWatch(t *testing.T) {
+	endpoints := newTestEtcd(t)
+	a := newTestEtcdCfg(t, endpoints)
+
+	areaID := "test-" + uuid.NewString()
+	urlA := "http://192.168.0.26:3456/rpc/v0"
+	urlB := "http://192.168.0.29:3456/rpc/v0"
+	defer a.removeAccessPoints(areaID)
+
+	if err := a.addAccessPoints(areaID, urlA, 1, "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.addAccessPoints(areaID, urlA, 1, "token"); err == nil {
+		t.Error("add the scheduler twice")
+	}
+
+	// loaded by the new locator
+	b := newTestEtcdCfg(t, endpoints)
+	if !isExist(b, areaID, urlA) {
+		t.Fatal("access point is not loaded")
+	}
+
+	ap, err := b.getAccessPoint(areaID)
+	if err != nil || len(ap.SchedulerInfos) != 1 || ap.SchedulerInfos[0].AccessToken != "token" {
+		t.Fatalf("access point %v, err:%v", ap, err)
+	}
+
+	recorder := &removedRecorder{removed: make(map[string]bool)}
+	b.onRemove = recorder.onRemove
+
+	// add and remove by other locator are seen by watch
+	if err := a.addAccessPoints(areaID, urlB, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "watch add", func() bool { return isExist(b, areaID, urlB) })
+
+	if err := a.removeAccessPoints(areaID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "watch remove", func() bool { return recorder.isRemoved(areaID, urlA) && recorder.isRemoved(areaID, urlB) })
+
+	areaIDs, _ := b.listAccessPoints()
+	for _, id := range areaIDs {
+		if id == areaID {
+			t.Error("removed area is still listed")
+		}
+	}
+}
+
+func TestEtcdCfgRewatchCompacted(t *testing.T) {
+	a := newTestEtcdCfg(t, newTestEtcd(t))
+
+	areaID := "test-" + uuid.NewString()
+	urlA := "http://192.168.0.26:3456/rpc/v0"
+	urlB := "http://192.168.0.29:3456/rpc/v0"
+	defer a.removeAccessPoints(areaID)
+
+	if err := a.addAccessPoints(areaID, urlA, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the watch of c start from the revision compacted
+	c := &etcdCfg{cli: a.cli, accessPoints: make(map[string]map[string]*etcdSchedulerCfg)}
+	recorder := &removedRecorder{removed: make(map[string]bool)}
+	c.onRemove = recorder.onRemove
+
+	rev, err := c.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isExist(c, areaID, urlA) {
+		t.Fatal("access point is not loaded")
+	}
+
+	if err := a.removeAccessPoints(areaID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.addAccessPoints(areaID, urlB, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := a.cli.Get(ctx, etcdAccessPointPrefix, clientv3.WithPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.cli.Compact(ctx, resp.Header.Revision); err != nil {
+		t.Fatal(err)
+	}
+
+	go c.watch(rev)
+
+	// reload after the watch is broken by compaction, the scheduler removed meanwhile is removed
+	waitFor(t, "reload", func() bool { return isExist(c, areaID, urlB) && recorder.isRemoved(areaID, urlA) })
+
+	// watch again from the reloaded revision
+	urlC := "http://192.168.0.30:3456/rpc/v0"
+	if err := a.addAccessPoints(areaID, urlC, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "watch again", func() bool { return isExist(c, areaID, urlC) })
+}
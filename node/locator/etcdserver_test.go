@@ -0,0 +1,330 @@
+package locator
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc"
+)
+
+// testEtcd etcd server in memory for the test, it serves the kv and watch api used by etcdCfg,
+// the etcd server package can not be embedded as its otel dependence conflict with the one of libp2p
+type testEtcd struct {
+	pb.UnimplementedKVServer
+	pb.UnimplementedWatchServer
+
+	lk        sync.Mutex
+	rev       int64
+	compacted int64
+	kvs       map[string]*mvccpb.KeyValue
+	// events after the compacted revision
+	history  []*mvccpb.Event
+	watchers map[*testWatcher]struct{}
+}
+
+type testWatcher struct {
+	stream *testWatchStream
+	id     int64
+	key    []byte
+	end    []byte
+}
+
+// testWatchStream the watch stream of a client, the responses are sent one by one
+type testWatchStream struct {
+	lk     sync.Mutex
+	stream pb.Watch_WatchServer
+}
+
+func (s *testWatchStream) send(resp *pb.WatchResponse) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if err := s.stream.Send(resp); err != nil {
+		log.Debugf("test etcd send watch response err:%s", err.Error())
+	}
+}
+
+// newTestEtcd start the etcd server, return the endpoints
+func newTestEtcd(t *testing.T) []string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &testEtcd{rev: 1, kvs: make(map[string]*mvccpb.KeyValue), watchers: make(map[*testWatcher]struct{})}
+
+	srv := grpc.NewServer()
+	pb.RegisterKVServer(srv, e)
+	pb.RegisterWatchServer(srv, e)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return []string{lis.Addr().String()}
+}
+
+func (e *testEtcd) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: e.rev}
+}
+
+// inRange key in [key, end), only the key if end is empty, all keys after key if end is \x00
+func inRange(k, key, end []byte) bool {
+	if len(end) == 0 {
+		return bytes.Equal(k, key)
+	}
+
+	if bytes.Compare(k, key) < 0 {
+		return false
+	}
+	return bytes.Equal(end, []byte{0}) || bytes.Compare(k, end) < 0
+}
+
+func (e *testEtcd) rangeKvs(key, end []byte) []*mvccpb.KeyValue {
+	kvs := make([]*mvccpb.KeyValue, 0)
+	for _, kv := range e.kvs {
+		if inRange(kv.Key, key, end) {
+			kvs = append(kvs, kv)
+		}
+	}
+
+	sort.Slice(kvs, func(i, j int) bool { return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0 })
+	return kvs
+}
+
+func (e *testEtcd) doRange(r *pb.RangeRequest) *pb.RangeResponse {
+	kvs := e.rangeKvs(r.Key, r.RangeEnd)
+	return &pb.RangeResponse{Header: e.header(), Kvs: kvs, Count: int64(len(kvs))}
+}
+
+func (e *testEtcd) doPut(r *pb.PutRequest, rev int64) *pb.PutResponse {
+	kv := &mvccpb.KeyValue{Key: r.Key, Value: r.Value, CreateRevision: rev, ModRevision: rev, Version: 1}
+	if old, ok := e.kvs[string(r.Key)]; ok {
+		kv.CreateRevision = old.CreateRevision
+		kv.Version = old.Version + 1
+	}
+	e.kvs[string(r.Key)] = kv
+
+	e.notify(&mvccpb.Event{Type: mvccpb.PUT, Kv: kv})
+	return &pb.PutResponse{Header: e.header()}
+}
+
+func (e *testEtcd) doDelete(r *pb.DeleteRangeRequest, rev int64) *pb.DeleteRangeResponse {
+	kvs := e.rangeKvs(r.Key, r.RangeEnd)
+	for _, kv := range kvs {
+		delete(e.kvs, string(kv.Key))
+		e.notify(&mvccpb.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: kv.Key, ModRevision: rev}})
+	}
+
+	return &pb.DeleteRangeResponse{Header: e.header(), Deleted: int64(len(kvs))}
+}
+
+func (e *testEtcd) compare(c *pb.Compare) bool {
+	kv, ok := e.kvs[string(c.Key)]
+	if !ok {
+		kv = &mvccpb.KeyValue{}
+	}
+
+	var result int
+	switch c.Target {
+	case pb.Compare_VERSION:
+		result = compareInt(kv.Version, c.GetVersion())
+	case pb.Compare_CREATE:
+		result = compareInt(kv.CreateRevision, c.GetCreateRevision())
+	case pb.Compare_MOD:
+		result = compareInt(kv.ModRevision, c.GetModRevision())
+	case pb.Compare_VALUE:
+		result = bytes.Compare(kv.Value, c.GetValue())
+	}
+
+	switch c.Result {
+	case pb.Compare_EQUAL:
+		return result == 0
+	case pb.Compare_NOT_EQUAL:
+		return result != 0
+	case pb.Compare_GREATER:
+		return result > 0
+	default:
+		return result < 0
+	}
+}
+
+func compareInt(a, b int64) int {
+	if a > b {
+		return 1
+	}
+	if a < b {
+		return -1
+	}
+	return 0
+}
+
+// notify the event to watchers and keep it for the watchers start from old revision
+func (e *testEtcd) notify(ev *mvccpb.Event) {
+	e.history = append(e.history, ev)
+
+	for w := range e.watchers {
+		if inRange(ev.Kv.Key, w.key, w.end) {
+			w.stream.send(&pb.WatchResponse{Header: e.header(), WatchId: w.id, Events: []*mvccpb.Event{ev}})
+		}
+	}
+}
+
+func (e *testEtcd) Range(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	return e.doRange(r), nil
+}
+
+func (e *testEtcd) Put(ctx context.Context, r *pb.PutRequest) (*pb.PutResponse, error) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	e.rev++
+	return e.doPut(r, e.rev), nil
+}
+
+func (e *testEtcd) DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, error) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	if len(e.rangeKvs(r.Key, r.RangeEnd)) == 0 {
+		return &pb.DeleteRangeResponse{Header: e.header()}, nil
+	}
+
+	e.rev++
+	return e.doDelete(r, e.rev), nil
+}
+
+func (e *testEtcd) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	succeeded := true
+	for _, c := range r.Compare {
+		if !e.compare(c) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := r.Failure
+	if succeeded {
+		ops = r.Success
+	}
+
+	// all changes of the txn are in the same revision
+	rev := e.rev + 1
+	changed := false
+
+	resp := &pb.TxnResponse{Succeeded: succeeded}
+	for _, op := range ops {
+		switch {
+		case op.GetRequestRange() != nil:
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseRange{ResponseRange: e.doRange(op.GetRequestRange())}})
+		case op.GetRequestPut() != nil:
+			e.rev, changed = rev, true
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{ResponsePut: e.doPut(op.GetRequestPut(), rev)}})
+		case op.GetRequestDeleteRange() != nil:
+			e.rev, changed = rev, true
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: e.doDelete(op.GetRequestDeleteRange(), rev)}})
+		default:
+			return nil, rpctypes.ErrGRPCNotCapable
+		}
+	}
+
+	if !changed {
+		e.rev = rev - 1
+	}
+
+	resp.Header = e.header()
+	return resp, nil
+}
+
+func (e *testEtcd) Compact(ctx context.Context, r *pb.CompactionRequest) (*pb.CompactionResponse, error) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	if r.Revision <= e.compacted {
+		return nil, rpctypes.ErrGRPCCompacted
+	}
+	if r.Revision > e.rev {
+		return nil, rpctypes.ErrGRPCFutureRev
+	}
+
+	e.compacted = r.Revision
+	history := make([]*mvccpb.Event, 0, len(e.history))
+	for _, ev := range e.history {
+		if ev.Kv.ModRevision > e.compacted {
+			history = append(history, ev)
+		}
+	}
+	e.history = history
+
+	return &pb.CompactionResponse{Header: e.header()}, nil
+}
+
+func (e *testEtcd) Watch(stream pb.Watch_WatchServer) error {
+	ws := &testWatchStream{stream: stream}
+	watchers := make(map[int64]*testWatcher)
+	var nextID int64
+
+	defer func() {
+		e.lk.Lock()
+		for _, w := range watchers {
+			delete(e.watchers, w)
+		}
+		e.lk.Unlock()
+	}()
+
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+
+		switch {
+		case req.GetCreateRequest() != nil:
+			cr := req.GetCreateRequest()
+			w := &testWatcher{stream: ws, id: nextID, key: cr.Key, end: cr.RangeEnd}
+			nextID++
+
+			e.lk.Lock()
+			ws.send(&pb.WatchResponse{Header: e.header(), WatchId: w.id, Created: true})
+
+			if cr.StartRevision != 0 && cr.StartRevision <= e.compacted {
+				// the watch is canceled as the revision is compacted
+				ws.send(&pb.WatchResponse{Header: e.header(), WatchId: w.id, CompactRevision: e.compacted, Canceled: true})
+				e.lk.Unlock()
+				continue
+			}
+
+			for _, ev := range e.history {
+				if cr.StartRevision != 0 && ev.Kv.ModRevision >= cr.StartRevision && inRange(ev.Kv.Key, w.key, w.end) {
+					ws.send(&pb.WatchResponse{Header: e.header(), WatchId: w.id, Events: []*mvccpb.Event{ev}})
+				}
+			}
+
+			e.watchers[w] = struct{}{}
+			watchers[w.id] = w
+			e.lk.Unlock()
+
+		case req.GetCancelRequest() != nil:
+			id := req.GetCancelRequest().WatchId
+
+			e.lk.Lock()
+			if w, ok := watchers[id]; ok {
+				delete(e.watchers, w)
+				delete(watchers, id)
+			}
+			ws.send(&pb.WatchResponse{Header: e.header(), WatchId: id, Canceled: true})
+			e.lk.Unlock()
+		}
+	}
+}
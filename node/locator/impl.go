@@ -3,6 +3,8 @@ package locator
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/filecoin-project/go-jsonrpc/auth"
@@ -26,13 +28,26 @@ const (
 	defaultAreaID  = "CN-GD-Shenzhen"
 )
 
-func NewLocalLocator(ctx context.Context, lr repo.LockedRepo, dbAddr, uuid string, locatorPort int) api.Locator {
-	locator := &Locator{}
+func NewLocalLocator(ctx context.Context, lr repo.LockedRepo, dbAddr string, etcdEndpoints []string, uuid string, locatorPort int) api.Locator {
+	locator := &Locator{hints: newCidAreaHints()}
 	if len(dbAddr) > 0 {
 		locator.db = newDB(dbAddr)
 		locator.cfg = locator.db
+		locator.registry = locator.db
 	} else {
 		locator.cfg = newLocalCfg(lr)
+		locator.registry = newMemRegistry()
+	}
+
+	// access points shared by all locators
+	var etcd *etcdCfg
+	if len(etcdEndpoints) > 0 {
+		cfg, err := newEtcdCfg(etcdEndpoints)
+		if err != nil {
+			log.Panicf("NewLocalLocator, new etcd cfg failed:%s", err.Error())
+		}
+		etcd = cfg
+		locator.cfg = cfg
 	}
 
 	sec, err := secret.APISecret(lr)
@@ -48,6 +63,13 @@ func NewLocalLocator(ctx context.Context, lr repo.LockedRepo, dbAddr, uuid strin
 	}
 
 	locator.apMgr = newAccessPointMgr(locatorPort, string(token), uuid)
+	if etcd != nil {
+		// scheduler removed by other locator
+		etcd.onRemove = func(areaID, schedulerURL string) {
+			locator.apMgr.removeSchedulerAPI(schedulerURL, areaID)
+		}
+	}
+	locator.apMgr.startHealthCheck(locator.cfg)
 	return locator
 
 }
@@ -62,9 +84,14 @@ type lconfig interface {
 
 type Locator struct {
 	common.CommonAPI
-	cfg   lconfig
-	apMgr *accessPointMgr
-	db    *db
+	cfg      lconfig
+	apMgr    *accessPointMgr
+	db       *db
+	registry deviceRegistry
+
+	hints *cidAreaHints
+	// areaID:*region.GeoInfo
+	areaGeos sync.Map
 }
 
 func (locator *Locator) GetAccessPoints(ctx context.Context, deviceID string, securityKey string) ([]api.SchedulerAuth, error) {
@@ -85,7 +112,7 @@ func (locator *Locator) GetAccessPoints(ctx context.Context, deviceID string, se
 		areaID = defaultAreaID
 	}
 
-	device, err := locator.db.getDeviceInfo(deviceID)
+	device, err := locator.registry.getDeviceInfo(deviceID)
 	if err != nil {
 		log.Errorf("GetAccessPoints, getDeviceInfo:%s", err.Error())
 		return []api.SchedulerAuth{}, err
@@ -97,7 +124,7 @@ func (locator *Locator) GetAccessPoints(ctx context.Context, deviceID string, se
 	}
 
 	cfg := locator.getCfg(areaID, device.SchedulerURL)
-	if cfg == nil {
+	if cfg == nil || locator.apMgr.isStandby(device.SchedulerURL) {
 		return locator.getAccessPointWithWeightCount(areaID)
 	}
 
@@ -157,6 +184,7 @@ func (locator *Locator) ShowAccessPoint(ctx context.Context, areaID string) (api
 		if locator.apMgr.isSchedulerOnline(cfg.URL, areaID, cfg.AccessToken) {
 			cfg.Online = true
 		}
+		locator.apMgr.fillHealth(&cfg)
 
 		infos = append(infos, cfg)
 	}
@@ -169,25 +197,15 @@ func (locator *Locator) DeviceOnline(ctx context.Context, deviceID string, areaI
 	log.Infof("areaID:%s device %s online", areaID, deviceID)
 	ip := handler.GetRequestIP(ctx)
 	schedulerURL := fmt.Sprintf("http://%s:%d/rpc/v0", ip, port)
-	locator.db.db.setDeviceInfo(deviceID, schedulerURL, areaID, true)
-	return nil
+	return locator.registry.setDeviceOnline(deviceID, schedulerURL, areaID)
 }
 
-func (locator *Locator) DeviceOffline(ctx context.Context, deviceID string) error {
+// DeviceOffline device offline from the scheduler, ignored if the device has moved to other scheduler
+func (locator *Locator) DeviceOffline(ctx context.Context, deviceID string, port int) error {
 	log.Infof("device %s offline", deviceID)
-	info, err := locator.db.getDeviceInfo(deviceID)
-	if err != nil {
-		log.Errorf("DeviceOffline, get device %s error:%s", deviceID, err.Error())
-		return err
-	}
-
-	if info == nil {
-		log.Errorf("DeviceOffline, device %s not in locator", deviceID)
-		return fmt.Errorf("device %s not exist", deviceID)
-	}
-
-	locator.db.db.setDeviceInfo(deviceID, info.SchedulerURL, info.AreaID, false)
-	return nil
+	ip := handler.GetRequestIP(ctx)
+	schedulerURL := fmt.Sprintf("http://%s:%d/rpc/v0", ip, port)
+	return locator.registry.setDeviceOffline(deviceID, schedulerURL)
 }
 
 func (locator *Locator) getAccessPointWithWeightCount(areaID string) ([]api.SchedulerAuth, error) {
@@ -211,17 +229,22 @@ func (locator *Locator) getAccessPointWithWeightCount(areaID string) ([]api.Sche
 		}
 	}
 
-	cfgWeights := countSchedulerWeightWithInfo(onlineSchedulers)
+	cfgWeights := locator.countSchedulerWeightWithInfo(onlineSchedulers)
 	currentWeights := locator.countSchedulerWeightByDevice(onlineSchedulers)
 
 	urls := make([]string, 0)
 	for url, weight := range cfgWeights {
 		currentWeight := currentWeights[url]
-		if currentWeight <= weight {
+		if weight > 0 && currentWeight <= weight {
 			urls = append(urls, url)
 		}
 	}
 
+	// the most underloaded scheduler is the first
+	sort.Slice(urls, func(i, j int) bool {
+		return cfgWeights[urls[i]]-currentWeights[urls[i]] > cfgWeights[urls[j]]-currentWeights[urls[j]]
+	})
+
 	auths := make([]api.SchedulerAuth, 0, len(urls))
 	for _, url := range urls {
 		accessToken := onlineSchedulers[url].AccessToken
@@ -233,15 +256,22 @@ func (locator *Locator) getAccessPointWithWeightCount(areaID string) ([]api.Sche
 	return auths, nil
 }
 
-func countSchedulerWeightWithInfo(schedulerCfgs map[string]*api.SchedulerInfo) map[string]float32 {
-	totalWeight := 0
+// countSchedulerWeightWithInfo share of the schedulers, weight is adjusted by live health and load
+func (locator *Locator) countSchedulerWeightWithInfo(schedulerCfgs map[string]*api.SchedulerInfo) map[string]float32 {
+	totalWeight := 0.0
+	weightMap := make(map[string]float64)
 	for _, cfg := range schedulerCfgs {
-		totalWeight += cfg.Weight
+		weightMap[cfg.URL] = locator.apMgr.effectiveWeight(cfg)
+		totalWeight += weightMap[cfg.URL]
 	}
 
 	result := make(map[string]float32)
-	for _, cfg := range schedulerCfgs {
-		result[cfg.URL] = float32(cfg.Weight) / float32(totalWeight)
+	for url, weight := range weightMap {
+		if totalWeight == 0 {
+			result[url] = 0
+		} else {
+			result[url] = float32(weight / totalWeight)
+		}
 	}
 
 	return result
@@ -252,7 +282,7 @@ func (locator *Locator) countSchedulerWeightByDevice(schedulerCfgs map[string]*a
 
 	weightMap := make(map[string]int)
 	for _, cfg := range schedulerCfgs {
-		count, err := locator.db.countDeviceOnScheduler(cfg.URL)
+		count, err := locator.registry.countDeviceOnScheduler(cfg.URL)
 		if err != nil {
 			log.Errorf("countSchedulerWeightByDevice, error:%s", err.Error())
 			continue
@@ -274,78 +304,66 @@ func (locator *Locator) countSchedulerWeightByDevice(schedulerCfgs map[string]*a
 }
 
 func (locator *Locator) GetDownloadInfosWithBlocks(ctx context.Context, cids []string) (map[string][]api.DownloadInfo, error) {
-	ip := handler.GetRequestIP(ctx)
-	areaID := ""
-	geoInfo, err := region.GetRegion().GetGeoInfo(ip)
-	if err != nil {
-		log.Errorf("GetAccessPoints get geo from ip error %s", err.Error())
-	} else {
-		areaID = geoInfo.Geo
-	}
-
-	log.Infof("user %s get Area areaID %s", ip, areaID)
+	return locator.findDownloadInfosWithBlocks(ctx, handler.GetRequestIP(ctx), cids, 0)
+}
 
-	if areaID == "" || areaID == "unknown-unknown-unknown" {
-		log.Errorf("user %s can not get areaID", ip)
-		areaID = defaultAreaID
+func (locator *Locator) GetDownloadInfoWithBlocks(ctx context.Context, cids []string) (map[string]api.DownloadInfo, error) {
+	infosMap, err := locator.findDownloadInfosWithBlocks(ctx, handler.GetRequestIP(ctx), cids, 1)
+	if err != nil {
+		return nil, err
 	}
 
-	schedulerAPI, ok := locator.apMgr.randSchedulerAPI(areaID)
-	if ok {
-		return schedulerAPI.GetDownloadInfosWithBlocks(ctx, cids)
+	infoMap := make(map[string]api.DownloadInfo, len(infosMap))
+	for cid, infos := range infosMap {
+		infoMap[cid] = infos[0]
 	}
-
-	// TODO: new scheduler
-	return make(map[string][]api.DownloadInfo), nil
-
+	return infoMap, nil
 }
-func (locator *Locator) GetDownloadInfoWithBlocks(ctx context.Context, cids []string) (map[string]api.DownloadInfo, error) {
-	ip := handler.GetRequestIP(ctx)
-	areaID := ""
-	geoInfo, err := region.GetRegion().GetGeoInfo(ip)
-	if err != nil {
-		log.Errorf("GetAccessPoints get geo from ip error %s", err.Error())
-	} else {
-		areaID = geoInfo.Geo
-	}
 
-	log.Infof("user %s get Area areaID %s", ip, areaID)
+func (locator *Locator) GetDownloadInfoWithBlock(ctx context.Context, cid string) (api.DownloadInfo, error) {
+	return locator.GetDownloadTicket(ctx, api.DownloadTicketReq{Cids: []string{cid}})
+}
 
-	if areaID == "" || areaID == "unknown-unknown-unknown" {
-		log.Errorf("user %s can not get areaID", ip)
-		areaID = defaultAreaID
+func (locator *Locator) GetDownloadTicket(ctx context.Context, req api.DownloadTicketReq) (api.DownloadInfo, error) {
+	infos, err := locator.findDownloadInfos(ctx, handler.GetRequestIP(ctx), req, 1)
+	if err != nil {
+		return api.DownloadInfo{}, err
 	}
 
-	schedulerAPI, ok := locator.apMgr.randSchedulerAPI(areaID)
-	if ok {
-		return schedulerAPI.GetDownloadInfoWithBlocks(ctx, cids)
+	if len(infos) == 0 {
+		// TODO: new scheduler
+		return api.DownloadInfo{}, nil
 	}
-	// TODO: new scheduler
-	return make(map[string]api.DownloadInfo), nil
+	return infos[0], nil
 }
-func (locator *Locator) GetDownloadInfoWithBlock(ctx context.Context, cid string) (api.DownloadInfo, error) {
-	ip := handler.GetRequestIP(ctx)
-	areaID := ""
-	geoInfo, err := region.GetRegion().GetGeoInfo(ip)
-	if err != nil {
-		log.Errorf("GetAccessPoints get geo from ip error %s", err.Error())
-	} else {
-		areaID = geoInfo.Geo
-	}
 
-	log.Infof("user %s get Area areaID %s", ip, areaID)
+func (locator *Locator) GetDownloadTickets(ctx context.Context, req api.DownloadTicketReq, max int) ([]api.DownloadInfo, error) {
+	return locator.findDownloadInfos(ctx, handler.GetRequestIP(ctx), req, max)
+}
 
-	if areaID == "" || areaID == "unknown-unknown-unknown" {
-		log.Errorf("user %s can not get areaID", ip)
-		areaID = defaultAreaID
+// LookupIPGeo location and isp of the ip, to check the geo db and override table
+func (locator *Locator) LookupIPGeo(ctx context.Context, ip string) (api.IPGeoInfo, error) {
+	if ip == "" {
+		ip = handler.GetRequestIP(ctx)
 	}
 
-	schedulerAPI, ok := locator.apMgr.randSchedulerAPI(areaID)
-	if ok {
-		return schedulerAPI.GetDownloadInfoWithBlock(ctx, cid)
-	}
-	// TODO: new scheduler
-	return api.DownloadInfo{}, nil
+	geoInfo, err := region.GetRegion().GetGeoInfo(ip)
+	if err != nil {
+		return api.IPGeoInfo{}, err
+	}
+
+	return api.IPGeoInfo{
+		IP:         geoInfo.IP,
+		Geo:        geoInfo.Geo,
+		Country:    geoInfo.Country,
+		Province:   geoInfo.Province,
+		City:       geoInfo.City,
+		ISP:        geoInfo.ISP,
+		ASN:        geoInfo.ASN,
+		Latitude:   geoInfo.Latitude,
+		Longitude:  geoInfo.Longitude,
+		Overridden: geoInfo.Overridden,
+	}, nil
 }
 
 func (locator *Locator) authNewTokenFromScheduler(schedulerAPI *schedulerAPI) (string, error) {
@@ -0,0 +1,71 @@
+package locator
+
+import (
+	"sync"
+)
+
+// deviceRegistry device to scheduler assignments, shared by all locator replicas
+type deviceRegistry interface {
+	getDeviceInfo(deviceID string) (*deviceInfo, error)
+	// setDeviceOnline bind the device to the scheduler
+	setDeviceOnline(deviceID, schedulerURL, areaID string) error
+	// setDeviceOffline only if the device is still on the scheduler,
+	// the offline event of old scheduler is ignored after the device moved
+	setDeviceOffline(deviceID, schedulerURL string) error
+	countDeviceOnScheduler(schedulerURL string) (int, error)
+}
+
+// memRegistry device registry in memory, for single locator and tests
+type memRegistry struct {
+	lk      sync.RWMutex
+	devices map[string]*deviceInfo
+}
+
+func newMemRegistry() *memRegistry {
+	return &memRegistry{devices: make(map[string]*deviceInfo)}
+}
+
+func (r *memRegistry) getDeviceInfo(deviceID string) (*deviceInfo, error) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+
+	info, ok := r.devices[deviceID]
+	if !ok {
+		return nil, nil
+	}
+
+	out := *info
+	return &out, nil
+}
+
+func (r *memRegistry) setDeviceOnline(deviceID, schedulerURL, areaID string) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	r.devices[deviceID] = &deviceInfo{DeviceID: deviceID, SchedulerURL: schedulerURL, AreaID: areaID, Online: true}
+	return nil
+}
+
+func (r *memRegistry) setDeviceOffline(deviceID, schedulerURL string) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	info, ok := r.devices[deviceID]
+	if ok && info.SchedulerURL == schedulerURL {
+		info.Online = false
+	}
+	return nil
+}
+
+func (r *memRegistry) countDeviceOnScheduler(schedulerURL string) (int, error) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+
+	count := 0
+	for _, info := range r.devices {
+		if info.SchedulerURL == schedulerURL {
+			count++
+		}
+	}
+	return count, nil
+}
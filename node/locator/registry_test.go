@@ -0,0 +1,45 @@
+package locator
+
+import (
+	"testing"
+)
+
+func TestMemRegistry(t *testing.T) {
+	r := newMemRegistry()
+	deviceID := "525e7729506711ed8c2c902e1671f843"
+	urlA := "http://192.168.0.26:3456/rpc/v0"
+	urlB := "http://192.168.0.29:3456/rpc/v0"
+
+	// offline of unknown device is ignored
+	if err := r.setDeviceOffline(deviceID, urlA); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := r.setDeviceOnline(deviceID, urlA, defaultAreaID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, _ := r.countDeviceOnScheduler(urlA)
+	if count != 1 {
+		t.Fatalf("count:%d, expect 1", count)
+	}
+
+	// device moved to scheduler B, offline of A is stale
+	r.setDeviceOnline(deviceID, urlB, defaultAreaID)
+	r.setDeviceOffline(deviceID, urlA)
+
+	info, _ := r.getDeviceInfo(deviceID)
+	if info == nil || !info.Online || info.SchedulerURL != urlB {
+		t.Fatalf("device info:%v, expect online on %s", info, urlB)
+	}
+
+	r.setDeviceOffline(deviceID, urlB)
+	r.setDeviceOffline(deviceID, urlB)
+
+	info, _ = r.getDeviceInfo(deviceID)
+	if info.Online {
+		t.Fatal("device should be offline")
+	}
+}
@@ -0,0 +1,239 @@
+package locator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/metrics"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// interval of scheduler health probe
+	healthCheckInterval = 30 * time.Second
+	// circuit open after continuous probe fail times
+	circuitFailures = 3
+	// scheduler is not used in this time after the circuit open, then probe again
+	circuitOpenTime = time.Minute
+	// weight of the new probe in the moving average
+	healthAlpha = 0.3
+	// latency (ms) of this value halve the weight
+	healthLatencyRef = 200.0
+)
+
+type schedulerHealth struct {
+	lk sync.Mutex
+	// moving average of probe latency (ms)
+	latency float64
+	// moving average of probe error rate
+	errorRate float64
+	// continuous probe fail times
+	failures  int
+	openUntil time.Time
+	lastCheck time.Time
+	online    bool
+	load      api.SchedulerLoad
+}
+
+func (h *schedulerHealth) isCircuitOpen() bool {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	return time.Now().Before(h.openUntil)
+}
+
+func (h *schedulerHealth) success(latency float64, load api.SchedulerLoad) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	if h.latency == 0 {
+		h.latency = latency
+	} else {
+		h.latency = healthAlpha*latency + (1-healthAlpha)*h.latency
+	}
+	h.errorRate = (1 - healthAlpha) * h.errorRate
+	h.failures = 0
+	h.openUntil = time.Time{}
+	h.lastCheck = time.Now()
+	h.online = true
+	h.load = load
+}
+
+// fail return true if the circuit is open
+func (h *schedulerHealth) fail() bool {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	h.errorRate = healthAlpha + (1-healthAlpha)*h.errorRate
+	h.failures++
+	h.lastCheck = time.Now()
+	h.online = false
+
+	if h.failures >= circuitFailures {
+		h.openUntil = time.Now().Add(circuitOpenTime)
+		return true
+	}
+	return false
+}
+
+func (mgr *accessPointMgr) getHealth(url string) *schedulerHealth {
+	v, _ := mgr.healths.LoadOrStore(url, &schedulerHealth{})
+	return v.(*schedulerHealth)
+}
+
+func (mgr *accessPointMgr) isCircuitOpen(url string) bool {
+	return mgr.getHealth(url).isCircuitOpen()
+}
+
+// isStandby the scheduler is not the leader of its server, it does not serve nodes
+func (mgr *accessPointMgr) isStandby(url string) bool {
+	health := mgr.getHealth(url)
+
+	health.lk.Lock()
+	defer health.lk.Unlock()
+
+	return health.load.Standby
+}
+
+// isUsable the scheduler can serve nodes and users
+func (mgr *accessPointMgr) isUsable(url string) bool {
+	return !mgr.isCircuitOpen(url) && !mgr.isStandby(url)
+}
+
+func (mgr *accessPointMgr) getSchedulerLoad(url, areaID, accessToken string) (api.SchedulerLoad, error) {
+	// reconnect if the scheduler was disconnected
+	schedulerAPI, ok := mgr.getSchedulerAPI(url, areaID, accessToken)
+	if !ok {
+		return api.SchedulerLoad{}, xerrors.Errorf("connect scheduler %s failed", url)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), connectTimeout*time.Second)
+	defer cancel()
+
+	load, err := schedulerAPI.GetSchedulerLoad(ctx)
+	if err != nil {
+		return load, err
+	}
+
+	// scheduler remove the locator after notify fails, connect again, it is ignored if connected
+	err = schedulerAPI.LocatorConnect(ctx, mgr.locatorPort, areaID, mgr.uuid, mgr.locatorToken)
+	return load, err
+}
+
+// probeScheduler check the health of scheduler, the broken client is removed and reconnect in next probe
+func (mgr *accessPointMgr) probeScheduler(url, areaID, accessToken string) bool {
+	health := mgr.getHealth(url)
+	if health.isCircuitOpen() {
+		return false
+	}
+
+	ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.SchedulerURL, url))
+
+	start := time.Now()
+	load, err := mgr.getSchedulerLoad(url, areaID, accessToken)
+	latency := metrics.SinceInMilliseconds(start)
+	stats.Record(ctx, metrics.SchedulerProbeDuration.M(latency))
+
+	if err != nil {
+		log.Warnf("probeScheduler %s err:%s", url, err.Error())
+
+		var circuitOpen int64
+		if health.fail() {
+			log.Errorf("scheduler %s circuit open", url)
+			circuitOpen = 1
+		}
+		stats.Record(ctx, metrics.SchedulerProbeFailure.M(1), metrics.SchedulerCircuitOpen.M(circuitOpen))
+
+		mgr.removeSchedulerAPI(url, areaID)
+		return false
+	}
+
+	health.success(latency, load)
+	stats.Record(ctx, metrics.SchedulerCircuitOpen.M(0), metrics.SchedulerOnlineNodes.M(int64(load.OnlineEdges+load.OnlineCandidates)))
+	return true
+}
+
+// startHealthCheck probe all schedulers of access points periodically
+func (mgr *accessPointMgr) startHealthCheck(cfg lconfig) {
+	go func() {
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			mgr.checkSchedulers(cfg)
+			<-ticker.C
+		}
+	}()
+}
+
+func (mgr *accessPointMgr) checkSchedulers(cfg lconfig) {
+	areaIDs, err := cfg.listAccessPoints()
+	if err != nil {
+		log.Errorf("checkSchedulers listAccessPoints err:%s", err.Error())
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, areaID := range areaIDs {
+		ap, err := cfg.getAccessPoint(areaID)
+		if err != nil {
+			log.Errorf("checkSchedulers getAccessPoint err:%s", err.Error())
+			continue
+		}
+
+		for _, info := range ap.SchedulerInfos {
+			wg.Add(1)
+			go func(areaID string, info api.SchedulerInfo) {
+				defer wg.Done()
+				mgr.probeScheduler(info.URL, areaID, info.AccessToken)
+			}(areaID, info)
+		}
+	}
+	wg.Wait()
+}
+
+// fillHealth set the health state of the scheduler to info
+func (mgr *accessPointMgr) fillHealth(info *api.SchedulerInfo) {
+	health := mgr.getHealth(info.URL)
+
+	health.lk.Lock()
+	defer health.lk.Unlock()
+
+	info.Latency = health.latency
+	info.ErrorRate = health.errorRate
+	info.CircuitOpen = time.Now().Before(health.openUntil)
+	info.OnlineNodes = health.load.OnlineEdges + health.load.OnlineCandidates
+	info.Capacity = health.load.Capacity
+	info.Standby = health.load.Standby
+}
+
+// effectiveWeight configured weight of the scheduler, reduced by error rate, latency and load
+func (mgr *accessPointMgr) effectiveWeight(info *api.SchedulerInfo) float64 {
+	health := mgr.getHealth(info.URL)
+
+	health.lk.Lock()
+	defer health.lk.Unlock()
+
+	if health.load.Standby {
+		return 0
+	}
+
+	weight := float64(info.Weight) * (1 - health.errorRate)
+	if health.latency > 0 {
+		weight *= healthLatencyRef / (healthLatencyRef + health.latency)
+	}
+
+	if capacity := health.load.Capacity; capacity > 0 {
+		used := float64(health.load.OnlineEdges+health.load.OnlineCandidates) / float64(capacity)
+		if used >= 1 {
+			return 0
+		}
+		weight *= 1 - used
+	}
+
+	return weight
+}
@@ -0,0 +1,115 @@
+package locator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"golang.org/x/xerrors"
+)
+
+func TestSchedulerCircuit(t *testing.T) {
+	h := &schedulerHealth{}
+
+	for i := 1; i < circuitFailures; i++ {
+		if h.fail() {
+			t.Fatalf("circuit open after %d fails", i)
+		}
+	}
+
+	if !h.fail() || !h.isCircuitOpen() {
+		t.Fatalf("circuit not open after %d fails", circuitFailures)
+	}
+
+	// probe again after the open time
+	h.openUntil = time.Now().Add(-time.Second)
+	if h.isCircuitOpen() {
+		t.Fatal("circuit still open after the open time")
+	}
+
+	errorRate := h.errorRate
+	h.success(100, api.SchedulerLoad{OnlineEdges: 1})
+	if h.failures != 0 || !h.online || h.errorRate >= errorRate || h.latency != 100 {
+		t.Errorf("health after success: %+v", h)
+	}
+
+	h.success(200, api.SchedulerLoad{})
+	if h.latency <= 100 || h.latency >= 200 {
+		t.Errorf("latency %f is not moving average", h.latency)
+	}
+}
+
+func TestProbeScheduler(t *testing.T) {
+	// nothing listen on the port, reconnect fails at once
+	url := "http://127.0.0.1:1/rpc/v0"
+	s := &fakeScheduler{load: api.SchedulerLoad{OnlineEdges: 10, Capacity: 100}}
+
+	mgr := newAccessPointMgr(5000, "", "locator")
+	mgr.addAccessPointToMap(defaultAreaID, &accessPoint{apis: []*schedulerAPI{{Scheduler: s, close: func() {}, url: url}}})
+
+	if !mgr.probeScheduler(url, defaultAreaID, "") {
+		t.Fatal("probe healthy scheduler fail")
+	}
+
+	info := api.SchedulerInfo{URL: url, Weight: 10}
+	mgr.fillHealth(&info)
+	if info.OnlineNodes != 10 || info.Capacity != 100 || info.CircuitOpen {
+		t.Errorf("health of scheduler %+v", info)
+	}
+
+	if w := mgr.effectiveWeight(&info); w <= 0 || w >= 10 {
+		t.Errorf("effective weight %f", w)
+	}
+
+	// the broken client is removed
+	s.loadErr = xerrors.New("scheduler offline")
+	if mgr.probeScheduler(url, defaultAreaID, "") {
+		t.Fatal("probe broken scheduler success")
+	}
+
+	if _, ok := mgr.randSchedulerAPI(defaultAreaID); ok {
+		t.Fatal("broken scheduler is still used")
+	}
+
+	for i := 1; i < circuitFailures; i++ {
+		mgr.probeScheduler(url, defaultAreaID, "")
+	}
+
+	if !mgr.isCircuitOpen(url) || mgr.isSchedulerOnline(url, defaultAreaID, "") {
+		t.Fatal("circuit not open")
+	}
+
+	// scheduler is not probed while the circuit is open
+	probes := s.probes
+	if mgr.probeScheduler(url, defaultAreaID, "") || s.probes != probes {
+		t.Error("scheduler probed while the circuit is open")
+	}
+}
+
+func TestStandbyScheduler(t *testing.T) {
+	leader := &fakeScheduler{}
+	standby := &fakeScheduler{load: api.SchedulerLoad{Standby: true}}
+
+	mgr := newAccessPointMgr(5000, "", "locator")
+	mgr.addAccessPointToMap(defaultAreaID, &accessPoint{apis: []*schedulerAPI{
+		{Scheduler: leader, close: func() {}, url: "leader"},
+		{Scheduler: standby, close: func() {}, url: "standby"},
+	}})
+
+	for _, url := range []string{"leader", "standby"} {
+		if !mgr.probeScheduler(url, defaultAreaID, "") {
+			t.Fatalf("probe %s fail", url)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		s, ok := mgr.randSchedulerAPI(defaultAreaID)
+		if !ok || s.url != "leader" {
+			t.Fatal("standby scheduler is used")
+		}
+	}
+
+	if w := mgr.effectiveWeight(&api.SchedulerInfo{URL: "standby", Weight: 10}); w != 0 {
+		t.Errorf("weight of standby %f", w)
+	}
+}
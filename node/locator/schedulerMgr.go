@@ -31,6 +31,8 @@ type accessPointMgr struct {
 	random       *rand.Rand
 	uuid         string
 	locatorToken string
+	// key is scheduler url, value is *schedulerHealth
+	healths sync.Map
 }
 
 func newAccessPointMgr(locatorPort int, locatorToken, uuid string) *accessPointMgr {
@@ -101,7 +103,7 @@ func (mgr *accessPointMgr) removeSchedulerAPI(url, areaID string) {
 		return
 	}
 
-	var index = 0
+	var index = -1
 	for i, api := range ap.apis {
 		if api.url == url {
 			index = i
@@ -109,6 +111,10 @@ func (mgr *accessPointMgr) removeSchedulerAPI(url, areaID string) {
 		}
 	}
 
+	if index < 0 {
+		return
+	}
+
 	api := ap.apis[index]
 	ap.apis = append(ap.apis[0:index], ap.apis[index+1:]...)
 	api.close()
@@ -150,22 +156,22 @@ func (mgr *accessPointMgr) getSchedulerAPI(url, areaID, accessToken string) (*sc
 
 }
 
+// isSchedulerOnline health state of last probe, probe again if it is out of date
 func (mgr *accessPointMgr) isSchedulerOnline(url, areaID, accessToken string) bool {
-	ctx, cancel := context.WithTimeout(context.TODO(), connectTimeout*time.Second)
-	defer cancel()
+	health := mgr.getHealth(url)
+	if health.isCircuitOpen() {
+		return false
+	}
 
-	api, ok := mgr.getSchedulerAPI(url, areaID, accessToken)
-	if ok {
-		_, err := api.Version(ctx)
-		if err != nil {
-			mgr.removeSchedulerAPI(url, areaID)
-			return false
-		}
+	health.lk.Lock()
+	online, lastCheck := health.online, health.lastCheck
+	health.lk.Unlock()
 
-		return true
+	if time.Since(lastCheck) < healthCheckInterval {
+		return online
 	}
 
-	return false
+	return mgr.probeScheduler(url, areaID, accessToken)
 }
 
 func (mgr *accessPointMgr) randSchedulerAPI(areaID string) (*schedulerAPI, bool) {
@@ -174,9 +180,16 @@ func (mgr *accessPointMgr) randSchedulerAPI(areaID string) (*schedulerAPI, bool)
 		return nil, false
 	}
 
-	if len(ap.apis) > 0 {
-		index := mgr.random.Intn(len(ap.apis))
-		return ap.apis[index], true
+	apis := make([]*schedulerAPI, 0, len(ap.apis))
+	for _, api := range ap.apis {
+		if mgr.isUsable(api.url) {
+			apis = append(apis, api)
+		}
+	}
+
+	if len(apis) > 0 {
+		index := mgr.random.Intn(len(apis))
+		return apis[index], true
 	}
 
 	return nil, false
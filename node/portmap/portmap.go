@@ -0,0 +1,107 @@
+package portmap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	nat "github.com/libp2p/go-nat"
+)
+
+var log = logging.Logger("portmap")
+
+const (
+	// timeout of gateway discovery
+	discoverTimeout = 10 * time.Second
+	// lease of the mapping, it is renewed before expired
+	mappingLease     = 20 * time.Minute
+	mappingRenewTime = 15 * time.Minute
+	mappingDesc      = "titan"
+)
+
+// Mapper tcp port mapping by UPnP or NAT-PMP of the gateway
+type Mapper struct {
+	gateway nat.NAT
+
+	lk sync.Mutex
+	// internal port:external port
+	ports map[int]int
+}
+
+// NewMapper discover the gateway, return error if the gateway support neither UPnP nor NAT-PMP
+func NewMapper(ctx context.Context) (*Mapper, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoverTimeout)
+	defer cancel()
+
+	gateway, err := nat.DiscoverGateway(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("discover gateway %s", gateway.Type())
+
+	return &Mapper{gateway: gateway, ports: make(map[int]int)}, nil
+}
+
+// Type UPnP or NAT-PMP
+func (m *Mapper) Type() string {
+	return m.gateway.Type()
+}
+
+// Map the internal port to gateway, return the external port
+func (m *Mapper) Map(internalPort int) (int, error) {
+	externalPort, err := m.gateway.AddPortMapping("tcp", internalPort, mappingDesc, mappingLease)
+	if err != nil {
+		return 0, err
+	}
+
+	m.lk.Lock()
+	m.ports[internalPort] = externalPort
+	m.lk.Unlock()
+
+	log.Infof("map port %d to %d by %s", internalPort, externalPort, m.gateway.Type())
+	return externalPort, nil
+}
+
+// ExternalPort the mapped port, 0 if the port is not mapped
+func (m *Mapper) ExternalPort(internalPort int) int {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	return m.ports[internalPort]
+}
+
+// Renew the mappings periodically until ctx done, the mappings are deleted then
+func (m *Mapper) Renew(ctx context.Context) {
+	ticker := time.NewTicker(mappingRenewTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.lk.Lock()
+			ports := make([]int, 0, len(m.ports))
+			for port := range m.ports {
+				ports = append(ports, port)
+			}
+			m.lk.Unlock()
+
+			for _, port := range ports {
+				if _, err := m.Map(port); err != nil {
+					log.Errorf("renew port %d mapping err:%s", port, err.Error())
+				}
+			}
+		case <-ctx.Done():
+			m.lk.Lock()
+			for port := range m.ports {
+				if err := m.gateway.DeletePortMapping("tcp", port); err != nil {
+					log.Warnf("delete port %d mapping err:%s", port, err.Error())
+				}
+			}
+			m.ports = make(map[int]int)
+			m.lk.Unlock()
+			return
+		}
+	}
+}
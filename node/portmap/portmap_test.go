@@ -0,0 +1,97 @@
+package portmap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// fakeGateway map the internal port to the port plus offset
+type fakeGateway struct {
+	lk      sync.Mutex
+	offset  int
+	err     error
+	mapped  map[int]int
+	deleted []int
+}
+
+func (g *fakeGateway) Type() string { return "UPnP (IGDv2-IP1)" }
+
+func (g *fakeGateway) GetDeviceAddress() (net.IP, error) { return net.IPv4(192, 168, 1, 1), nil }
+
+func (g *fakeGateway) GetExternalAddress() (net.IP, error) { return net.IPv4(8, 8, 8, 8), nil }
+
+func (g *fakeGateway) GetInternalAddress() (net.IP, error) { return net.IPv4(192, 168, 1, 2), nil }
+
+func (g *fakeGateway) AddPortMapping(protocol string, internalPort int, description string, timeout time.Duration) (int, error) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	if g.err != nil {
+		return 0, g.err
+	}
+
+	g.mapped[internalPort] = internalPort + g.offset
+	return internalPort + g.offset, nil
+}
+
+func (g *fakeGateway) DeletePortMapping(protocol string, internalPort int) error {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	delete(g.mapped, internalPort)
+	g.deleted = append(g.deleted, internalPort)
+	return nil
+}
+
+func TestMapper(t *testing.T) {
+	gateway := &fakeGateway{offset: 10000, mapped: make(map[int]int)}
+	m := &Mapper{gateway: gateway, ports: make(map[int]int)}
+
+	if m.ExternalPort(3456) != 0 {
+		t.Error("external port of the port not mapped")
+	}
+
+	port, err := m.Map(3456)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if port != 13456 || m.ExternalPort(3456) != 13456 {
+		t.Errorf("external port %d, mapped %d", port, m.ExternalPort(3456))
+	}
+
+	gateway.err = xerrors.New("mapping refused")
+	if _, err := m.Map(3000); err == nil {
+		t.Error("mapping refused by gateway")
+	}
+	if m.ExternalPort(3000) != 0 {
+		t.Error("external port of the refused mapping")
+	}
+	gateway.err = nil
+
+	// the mappings are deleted when renew is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Renew(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	gateway.lk.Lock()
+	defer gateway.lk.Unlock()
+
+	if len(gateway.mapped) != 0 || len(gateway.deleted) != 1 || gateway.deleted[0] != 3456 {
+		t.Errorf("mappings %v after renew stopped, deleted %v", gateway.mapped, gateway.deleted)
+	}
+
+	if m.ExternalPort(3456) != 0 {
+		t.Error("external port after the mapping deleted")
+	}
+}
@@ -1,43 +1,408 @@
 package scheduler
 
 import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
 	"github.com/linguohua/titan/region"
+	"github.com/ouqiang/timewheel"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// operator of the area policies from config
+	configOperator = "config"
+	// max parts of area, country-province-city
+	maxAreaLevel = 3
 )
 
 var (
-	serverArea = "CN-GD-Shenzhen"
-	whitelist  = []string{"192.168.0.26"}
+	// area of the scheduler, the db tables and locator access point
+	serverArea = ""
+	// areas served by config, the policy in db is prior to it
+	serveAreas []string
+
+	// max nodes the scheduler can serve, report to locator, 0 is unknown
+	nodeCapacity = 0
 )
 
-// InitServerArea set area
-func InitServerArea(area string) {
-	log.Infof("server area :%s", area)
+// InitServerArea set area and the areas served, the server area is served if areas is empty
+func InitServerArea(area string, areas []string) {
+	log.Infof("server area :%s, serve areas:%v", area, areas)
 	serverArea = area
+	serveAreas = areas
 }
 
-func initAreaTable() {
+// SetNodeCapacity set the max nodes the scheduler can serve
+func SetNodeCapacity(capacity int) {
+	nodeCapacity = capacity
 }
 
-func areaExist(area string) bool {
-	if area == "" {
-		return false
+func areaLevel(area string) int {
+	return len(strings.Split(area, "-"))
+}
+
+func checkAreaPolicy(info *api.AreaPolicy) error {
+	if info.Area == "" {
+		return xerrors.New("area is nil")
+	}
+
+	if areaLevel(info.Area) > maxAreaLevel {
+		return xerrors.Errorf("area %s is not country-province-city", info.Area)
 	}
 
-	return area == serverArea
+	if info.MaxNodes < 0 {
+		return xerrors.Errorf("max nodes %d is negative", info.MaxNodes)
+	}
+
+	return nil
 }
 
-func ipLegality(ip string) (bool, *region.GeoInfo) {
-	geoInfo, _ := region.GetRegion().GetGeoInfo(ip)
-	if areaExist(geoInfo.Geo) {
-		return true, geoInfo
+func checkIPAllowlist(info *api.IPAllowlist) error {
+	if ip := net.ParseIP(info.Target); ip == nil {
+		_, ipNet, err := net.ParseCIDR(info.Target)
+		if err != nil {
+			return xerrors.Errorf("allowlist target %s is not ip or cidr", info.Target)
+		}
+		// normalize the cidr, the target is the primary key
+		info.Target = ipNet.String()
+	}
+
+	if info.Area != "" && region.StringGeoToGeoInfo(info.Area) == nil {
+		return xerrors.Errorf("allowlist area %s is not country-province-city", info.Area)
+	}
+
+	return nil
+}
+
+type cidrAllowlist struct {
+	ipNet *net.IPNet
+	info  *api.IPAllowlist
+}
+
+// AreaManager areas served by the scheduler and the ip allowlist
+type AreaManager struct {
+	lk sync.RWMutex
+	// lower case area:policy
+	policies map[string]*api.AreaPolicy
+	ips      map[string]*api.IPAllowlist
+	cidrs    []*cidrAllowlist
+
+	nodeManager *NodeManager
+
+	reloadTimewheel *timewheel.TimeWheel
+	reloadTime      int // reload time interval (minute)
+}
+
+func newAreaManager(nodeManager *NodeManager) *AreaManager {
+	m := &AreaManager{
+		nodeManager: nodeManager,
+		policies:    make(map[string]*api.AreaPolicy),
+		ips:         make(map[string]*api.IPAllowlist),
+		reloadTime:  1,
+	}
+
+	err := m.reload()
+	if err != nil {
+		log.Errorf("newAreaManager reload err:%s", err.Error())
 	}
 
-	for _, p := range whitelist {
-		if p == ip {
+	m.initReloadTimewheel()
+
+	return m
+}
+
+func (m *AreaManager) initReloadTimewheel() {
+	// policies may be changed by other scheduler of the area
+	m.reloadTimewheel = timewheel.New(1*time.Second, 3600, func(_ interface{}) {
+		m.reloadTimewheel.AddTimer(time.Duration(m.reloadTime*60-1)*time.Second, "Area", nil)
+		err := m.reload()
+		if err != nil {
+			log.Errorf("area reload err:%s", err.Error())
+		}
+	})
+	m.reloadTimewheel.Start()
+	m.reloadTimewheel.AddTimer(time.Duration(m.reloadTime*60-1)*time.Second, "Area", nil)
+}
+
+func (m *AreaManager) reload() error {
+	policies := make(map[string]*api.AreaPolicy)
+
+	areas := serveAreas
+	if len(areas) == 0 && serverArea != "" {
+		areas = []string{serverArea}
+	}
+	for _, area := range areas {
+		policies[strings.ToLower(area)] = &api.AreaPolicy{Area: area, AcceptEdge: true, AcceptCandidate: true, Operator: configOperator}
+	}
+
+	list, err := persistent.GetDB().GetAreaPolicies()
+	if err != nil {
+		// keep the config areas served
+		m.lk.Lock()
+		m.policies = policies
+		m.lk.Unlock()
+		return err
+	}
+
+	for _, info := range list {
+		policies[strings.ToLower(info.Area)] = info
+	}
+
+	allowlists, err := persistent.GetDB().GetIPAllowlists()
+	if err != nil {
+		return err
+	}
+
+	ips := make(map[string]*api.IPAllowlist)
+	cidrs := make([]*cidrAllowlist, 0)
+	for _, info := range allowlists {
+		if net.ParseIP(info.Target) != nil {
+			ips[info.Target] = info
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(info.Target)
+		if err != nil {
+			log.Errorf("allowlist reload cidr %s err:%s", info.Target, err.Error())
+			continue
+		}
+		cidrs = append(cidrs, &cidrAllowlist{ipNet: ipNet, info: info})
+	}
+
+	m.lk.Lock()
+	m.policies = policies
+	m.ips = ips
+	m.cidrs = cidrs
+	m.lk.Unlock()
+
+	m.disconnectUnservedNodes()
+
+	return nil
+}
+
+// matchPolicy the most specific policy of the geo
+func (m *AreaManager) matchPolicy(geo string) *api.AreaPolicy {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	var out *api.AreaPolicy
+	outLevel := 0
+	for _, policy := range m.policies {
+		level := areaLevel(policy.Area)
+		if level <= outLevel || region.AreaMatchLevel(policy.Area, geo) < level {
+			continue
+		}
+
+		out = policy
+		outLevel = level
+	}
+
+	return out
+}
+
+func (m *AreaManager) findAllowlist(ip string) *api.IPAllowlist {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	if info, ok := m.ips[ip]; ok {
+		return info
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+
+	for _, c := range m.cidrs {
+		if c.ipNet.Contains(addr) {
+			return c.info
+		}
+	}
+
+	return nil
+}
+
+func isNodeTypeAccepted(policy *api.AreaPolicy, nodeType api.NodeTypeName) bool {
+	switch nodeType {
+	case api.TypeNameEdge:
+		return policy.AcceptEdge
+	case api.TypeNameCandidate:
+		return policy.AcceptCandidate
+	}
+
+	return false
+}
+
+// nodeArea geo of the node, return error if the area of node is not served
+func (m *AreaManager) nodeArea(deviceID, ip string, nodeType api.NodeTypeName) (*region.GeoInfo, error) {
+	geoInfo, _ := region.GetRegion().GetGeoInfo(ip)
+
+	if entry := m.findAllowlist(ip); entry != nil {
+		if geo := region.StringGeoToGeoInfo(entry.Area); geo != nil {
+			geoInfo.Country, geoInfo.Province, geoInfo.City = geo.Country, geo.Province, geo.City
+			geoInfo.Geo = entry.Area
+		} else if m.matchPolicy(geoInfo.Geo) == nil {
 			geoInfo.Geo = serverArea
-			return true, geoInfo
 		}
+		return geoInfo, nil
+	}
+
+	policy := m.matchPolicy(geoInfo.Geo)
+	if policy == nil {
+		return geoInfo, xerrors.Errorf(ErrAreaNotExist, geoInfo.Geo, ip)
+	}
+
+	if !isNodeTypeAccepted(policy, nodeType) {
+		return geoInfo, xerrors.Errorf("%s, %s node not accepted! ip:%s", geoInfo.Geo, nodeType, ip)
+	}
+
+	if policy.MaxNodes > 0 && m.countAreaNodes(policy, deviceID) >= policy.MaxNodes {
+		return geoInfo, xerrors.Errorf("%s, Area is full! ip:%s", geoInfo.Geo, ip)
+	}
+
+	return geoInfo, nil
+}
+
+// countAreaNodes online nodes applied the policy, except the device
+func (m *AreaManager) countAreaNodes(policy *api.AreaPolicy, exceptID string) int {
+	count := 0
+	check := func(deviceID string, node *Node) {
+		if deviceID == exceptID || node.geoInfo == nil || m.findAllowlist(node.deviceInfo.ExternalIp) != nil {
+			return
+		}
+
+		if m.matchPolicy(node.geoInfo.Geo) == policy {
+			count++
+		}
+	}
+
+	m.nodeManager.edgeNodeMap.Range(func(key, value interface{}) bool {
+		if node := value.(*EdgeNode); node != nil {
+			check(key.(string), &node.Node)
+		}
+		return true
+	})
+
+	m.nodeManager.candidateNodeMap.Range(func(key, value interface{}) bool {
+		if node := value.(*CandidateNode); node != nil {
+			check(key.(string), &node.Node)
+		}
+		return true
+	})
+
+	return count
+}
+
+func (m *AreaManager) isNodeServed(node *Node, nodeType api.NodeTypeName) bool {
+	if node.geoInfo == nil || m.findAllowlist(node.deviceInfo.ExternalIp) != nil {
+		return true
+	}
+
+	policy := m.matchPolicy(node.geoInfo.Geo)
+	return policy != nil && isNodeTypeAccepted(policy, nodeType)
+}
+
+// disconnectUnservedNodes nodes of the area no longer served are disconnected
+func (m *AreaManager) disconnectUnservedNodes() {
+	unserved := make([]string, 0)
+
+	m.nodeManager.edgeNodeMap.Range(func(key, value interface{}) bool {
+		node := value.(*EdgeNode)
+		if node != nil && !m.isNodeServed(&node.Node, api.TypeNameEdge) {
+			unserved = append(unserved, node.deviceInfo.DeviceId)
+		}
+		return true
+	})
+
+	m.nodeManager.candidateNodeMap.Range(func(key, value interface{}) bool {
+		node := value.(*CandidateNode)
+		if node != nil && !m.isNodeServed(&node.Node, api.TypeNameCandidate) {
+			unserved = append(unserved, node.deviceInfo.DeviceId)
+		}
+		return true
+	})
+
+	for _, deviceID := range unserved {
+		log.Warnf("disconnect node of unserved area:%s", deviceID)
+		m.nodeManager.nodeOffline(deviceID)
 	}
+}
+
+// listPolicies policies from config and db, sorted by area
+func (m *AreaManager) listPolicies() []api.AreaPolicy {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	out := make([]api.AreaPolicy, 0, len(m.policies))
+	for _, policy := range m.policies {
+		out = append(out, *policy)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Area < out[j].Area
+	})
+
+	return out
+}
+
+func (m *AreaManager) setPolicy(info *api.AreaPolicy) error {
+	err := checkAreaPolicy(info)
+	if err != nil {
+		return err
+	}
+
+	info.CreatedTime = time.Now().Unix()
+	err = persistent.GetDB().SetAreaPolicy(info)
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("area policy %s edge:%v candidate:%v max nodes:%d by %s", info.Area, info.AcceptEdge, info.AcceptCandidate, info.MaxNodes, info.Operator)
+
+	return m.reload()
+}
+
+func (m *AreaManager) removePolicy(area, operator string) error {
+	err := persistent.GetDB().RemoveAreaPolicy(area)
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("area policy %s removed by %s", area, operator)
+
+	return m.reload()
+}
+
+func (m *AreaManager) addAllowlist(info *api.IPAllowlist) error {
+	err := checkIPAllowlist(info)
+	if err != nil {
+		return err
+	}
+
+	info.CreatedTime = time.Now().Unix()
+	err = persistent.GetDB().SetIPAllowlist(info)
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("ip allowlist %s area:%s by %s, reason:%s", info.Target, info.Area, info.Operator, info.Reason)
+
+	return m.reload()
+}
+
+func (m *AreaManager) removeAllowlist(target, operator string) error {
+	err := persistent.GetDB().RemoveIPAllowlist(target)
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("ip allowlist %s removed by %s", target, operator)
 
-	return false, geoInfo
+	return m.reload()
 }
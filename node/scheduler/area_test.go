@@ -0,0 +1,190 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/region"
+)
+
+// fakeRegion geo of the ips in table
+type fakeRegion map[string]string
+
+func (r fakeRegion) GetGeoInfo(ip string) (*region.GeoInfo, error) {
+	geo, ok := r[ip]
+	if !ok {
+		return r.DefaultGeoInfo(ip), nil
+	}
+
+	info := region.StringGeoToGeoInfo(geo)
+	info.IP, info.Geo = ip, geo
+	return info, nil
+}
+
+func (r fakeRegion) DefaultGeoInfo(ip string) *region.GeoInfo {
+	return &region.GeoInfo{IP: ip, Geo: "unknown-unknown-unknown"}
+}
+
+// newTestAreaManager areas served by config and the policies in db
+func newTestAreaManager(t *testing.T, configAreas []string, policies ...*api.AreaPolicy) (*AreaManager, *fakeDB) {
+	d := newFakeDB()
+	for _, policy := range policies {
+		d.areaPolicies[policy.Area] = policy
+	}
+
+	oldArea, oldAreas := serverArea, serveAreas
+	InitServerArea("CN-GD-Shenzhen", configAreas)
+	t.Cleanup(func() { serverArea, serveAreas = oldArea, oldAreas })
+
+	region.SetRegion(fakeRegion{
+		"1.1.1.1": "CN-GD-Shenzhen",
+		"2.2.2.2": "CN-GD-Guangzhou",
+		"3.3.3.3": "CN-BJ-Beijing",
+		"4.4.4.4": "US-CA-Oakland",
+	})
+
+	m := &AreaManager{nodeManager: &NodeManager{}}
+	if err := m.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	return m, d
+}
+
+func TestMatchPolicy(t *testing.T) {
+	m, _ := newTestAreaManager(t, []string{"CN"},
+		&api.AreaPolicy{Area: "CN-GD", AcceptCandidate: true},
+		&api.AreaPolicy{Area: "cn-gd-shenzhen", AcceptEdge: true, AcceptCandidate: true, MaxNodes: 1},
+	)
+
+	cases := map[string]string{
+		"CN-GD-Shenzhen":  "cn-gd-shenzhen",
+		"CN-GD-Guangzhou": "CN-GD",
+		"CN-BJ-Beijing":   "CN",
+		"US-CA-Oakland":   "",
+	}
+
+	for geo, area := range cases {
+		policy := m.matchPolicy(geo)
+		if policy == nil {
+			if area != "" {
+				t.Errorf("policy of %s not found", geo)
+			}
+			continue
+		}
+
+		if policy.Area != area {
+			t.Errorf("policy of %s: got %s, want %s", geo, policy.Area, area)
+		}
+	}
+
+	if list := m.listPolicies(); len(list) != 3 || list[0].Area != "CN" || list[0].Operator != configOperator {
+		t.Errorf("policies %v", list)
+	}
+}
+
+func TestNodeArea(t *testing.T) {
+	m, _ := newTestAreaManager(t, []string{"CN"},
+		&api.AreaPolicy{Area: "CN-GD", AcceptCandidate: true},
+		&api.AreaPolicy{Area: "CN-GD-Shenzhen", AcceptEdge: true, AcceptCandidate: true, MaxNodes: 1},
+	)
+
+	if _, err := m.nodeArea("e_1", "2.2.2.2", api.TypeNameEdge); err == nil {
+		t.Error("edge accepted by the area only accept candidate")
+	}
+
+	if _, err := m.nodeArea("c_1", "2.2.2.2", api.TypeNameCandidate); err != nil {
+		t.Errorf("candidate of the province: %v", err)
+	}
+
+	if _, err := m.nodeArea("e_1", "3.3.3.3", api.TypeNameEdge); err != nil {
+		t.Errorf("edge of the country: %v", err)
+	}
+
+	if _, err := m.nodeArea("e_1", "4.4.4.4", api.TypeNameEdge); err == nil {
+		t.Error("node of the area not served is accepted")
+	}
+
+	geoInfo, err := m.nodeArea("e_1", "1.1.1.1", api.TypeNameEdge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.nodeManager.edgeNodeMap.Store("e_1", &EdgeNode{Node: Node{geoInfo: geoInfo, deviceInfo: api.DevicesInfo{DeviceId: "e_1", ExternalIp: "1.1.1.1"}}})
+
+	if _, err := m.nodeArea("e_2", "1.1.1.1", api.TypeNameEdge); err == nil {
+		t.Error("node accepted after the area is full")
+	}
+
+	// reconnect of the node in the area
+	if _, err := m.nodeArea("e_1", "1.1.1.1", api.TypeNameEdge); err != nil {
+		t.Errorf("node reconnect: %v", err)
+	}
+}
+
+func TestIPAllowlist(t *testing.T) {
+	m, d := newTestAreaManager(t, []string{"CN-GD"})
+
+	for _, info := range []*api.IPAllowlist{
+		{Target: "4.4.4.4", Area: "CN-GD-Guangzhou"},
+		{Target: "3.3.3.0/24"},
+	} {
+		if err := checkIPAllowlist(info); err != nil {
+			t.Fatal(err)
+		}
+		d.allowlists[info.Target] = info
+	}
+
+	if err := m.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	geoInfo, err := m.nodeArea("e_1", "4.4.4.4", api.TypeNameEdge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if geoInfo.Geo != "CN-GD-Guangzhou" || geoInfo.City != "Guangzhou" {
+		t.Errorf("area of the node is not overridden: %v", geoInfo)
+	}
+
+	// the node of the area not served is put in the server area
+	geoInfo, err = m.nodeArea("e_2", "3.3.3.3", api.TypeNameEdge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if geoInfo.Geo != serverArea {
+		t.Errorf("area of the node %s, want %s", geoInfo.Geo, serverArea)
+	}
+
+	if !m.isNodeServed(&Node{geoInfo: geoInfo, deviceInfo: api.DevicesInfo{ExternalIp: "3.3.3.3"}}, api.TypeNameEdge) {
+		t.Error("node in allowlist is not served")
+	}
+}
+
+func TestCheckAreaPolicy(t *testing.T) {
+	for _, info := range []*api.AreaPolicy{
+		{},
+		{Area: "CN-GD-Shenzhen-Nanshan"},
+		{Area: "CN", MaxNodes: -1},
+	} {
+		if err := checkAreaPolicy(info); err == nil {
+			t.Errorf("invalid policy %v is accepted", info)
+		}
+	}
+
+	info := &api.IPAllowlist{Target: "10.1.2.3/16"}
+	if err := checkIPAllowlist(info); err != nil || info.Target != "10.1.0.0/16" {
+		t.Errorf("cidr is not normalized: %s, err:%v", info.Target, err)
+	}
+
+	for _, info := range []*api.IPAllowlist{
+		{Target: "host"},
+		{Target: "1.1.1.1", Area: "CN-GD"},
+	} {
+		if err := checkIPAllowlist(info); err == nil {
+			t.Errorf("invalid allowlist %v is accepted", info)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/node/scheduler/db/cache"
@@ -36,6 +39,19 @@ type Cache struct {
 	// lastUpdateTime time.Time
 }
 
+// cache id:data key of the running caches, nodes only know the root cid of the carfile,
+// the data of a selector is found by the cache id, the cache is deleted when ended or removed
+var cacheCarfiles sync.Map
+
+// carfileOfCache data key of the cache, the ended cache is read from db
+func carfileOfCache(cacheID string) (string, error) {
+	if v, ok := cacheCarfiles.Load(cacheID); ok {
+		return v.(string), nil
+	}
+
+	return persistent.GetDB().GetCacheCarfileID(cacheID)
+}
+
 func newCacheID(cid string) (string, error) {
 	fid, err := cache.GetDB().IncrCacheID(serverArea)
 	if err != nil {
@@ -61,6 +77,7 @@ func newCache(nodeManager *NodeManager, data *Data, cid string) (*Cache, error)
 		cacheID:     id,
 		carfileCid:  cid,
 	}
+	cacheCarfiles.Store(id, cid)
 
 	return cache, err
 }
@@ -75,6 +92,7 @@ func loadCache(cacheID, carfileCid string, nodeManager *NodeManager, data *Data)
 		nodeManager: nodeManager,
 		data:        data,
 	}
+	cacheCarfiles.Store(cacheID, carfileCid)
 
 	info, err := persistent.GetDB().GetCacheInfo(cacheID, carfileCid)
 	// list, err := persistent.GetDB().GetCacheInfos(area, cacheID)
@@ -95,7 +113,7 @@ func loadCache(cacheID, carfileCid string, nodeManager *NodeManager, data *Data)
 func (c *Cache) cacheBlocksToNode(deviceID string, cids []string) error {
 	cNode := c.nodeManager.getCandidateNode(deviceID)
 	if cNode != nil {
-		reqDatas := cNode.getReqCacheDatas(c.nodeManager, cids, c.carfileCid, c.cacheID)
+		reqDatas := cNode.getReqCacheDatas(c.nodeManager, cids, c.data.rootCid, c.cacheID)
 
 		for _, reqData := range reqDatas {
 			err := cNode.nodeAPI.CacheBlocks(context.Background(), reqData)
@@ -108,7 +126,7 @@ func (c *Cache) cacheBlocksToNode(deviceID string, cids []string) error {
 
 	eNode := c.nodeManager.getEdgeNode(deviceID)
 	if eNode != nil {
-		reqDatas := eNode.getReqCacheDatas(c.nodeManager, cids, c.carfileCid, c.cacheID)
+		reqDatas := eNode.getReqCacheDatas(c.nodeManager, cids, c.data.rootCid, c.cacheID)
 
 		for _, reqData := range reqDatas {
 			err := eNode.nodeAPI.CacheBlocks(context.Background(), reqData)
@@ -122,20 +140,25 @@ func (c *Cache) cacheBlocksToNode(deviceID string, cids []string) error {
 	return xerrors.Errorf("%s:%s", ErrNodeNotFind, deviceID)
 }
 
-func (c *Cache) findNode(isHaveCache bool, filterDeviceIDs map[string]string, i int) (deviceID string) {
+// findNode node to cache the block, nodes with higher reputation are more likely to be chosen
+func (c *Cache) findNode(r *rand.Rand, isHaveCache bool, filterDeviceIDs map[string]string) (deviceID string) {
 	deviceID = ""
 
 	if isHaveCache {
 		cs := c.nodeManager.findEdgeNodes(nil, filterDeviceIDs)
+		cs = c.nodeManager.reachableEdges(cs)
 		if cs == nil || len(cs) <= 0 {
 			return
 		}
-		// rand node
-		// node := cs[randomNum(0, len(cs))]
-		node := cs[i%len(cs)]
+		// every isp has the copy for its users
+		cs = c.nodeManager.preferLeastHeldISP(cs, filterDeviceIDs)
 
-		deviceID = node.deviceInfo.DeviceId
-		// deviceAddr = node.addr
+		deviceIDs := make([]string, 0, len(cs))
+		for _, node := range cs {
+			deviceIDs = append(deviceIDs, node.deviceInfo.DeviceId)
+		}
+
+		deviceID = pickByReputation(r, deviceIDs)
 		return
 	}
 
@@ -143,11 +166,13 @@ func (c *Cache) findNode(isHaveCache bool, filterDeviceIDs map[string]string, i
 	if cs == nil || len(cs) <= 0 {
 		return
 	}
-	// rand node
-	node := cs[i%len(cs)]
 
-	deviceID = node.deviceInfo.DeviceId
-	// deviceAddr = node.addr
+	deviceIDs := make([]string, 0, len(cs))
+	for _, node := range cs {
+		deviceIDs = append(deviceIDs, node.deviceInfo.DeviceId)
+	}
+
+	deviceID = pickByReputation(r, deviceIDs)
 	return
 }
 
@@ -159,6 +184,7 @@ func (c *Cache) matchingNodeAndBlock(cids map[string]int, isHaveCache bool) ([]*
 
 	nodeCacheMap := make(map[string][]string)
 	blockList := make([]*persistent.BlockInfo, 0)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	for cid, dbID := range cids {
 		status := cacheStatusFail
@@ -175,7 +201,7 @@ func (c *Cache) matchingNodeAndBlock(cids map[string]int, isHaveCache bool) ([]*
 				}
 			}
 
-			deviceID = c.findNode(isHaveCache, filterDeviceIDs, dbID)
+			deviceID = c.findNode(r, isHaveCache, filterDeviceIDs)
 			if deviceID != "" {
 				status = cacheStatusCreate
 
@@ -242,6 +268,12 @@ func (c *Cache) blockCacheResult(info *api.CacheResultInfo) error {
 		fid = info.Fid
 	}
 
+	if status == cacheStatusSuccess {
+		incrReputation(info.DeviceID, cache.ReputationFieldCacheSuccess, 1)
+	} else {
+		incrReputation(info.DeviceID, cache.ReputationFieldCacheFail, 1)
+	}
+
 	bInfo := &persistent.BlockInfo{
 		ID:          cacheInfo.ID,
 		CacheID:     c.cacheID,
@@ -254,7 +286,7 @@ func (c *Cache) blockCacheResult(info *api.CacheResultInfo) error {
 
 	linkMap := make(map[string]int)
 	if len(info.Links) > 0 {
-		for _, link := range info.Links {
+		for _, link := range c.selectLinks(info) {
 			linkMap[link] = 0
 		}
 	}
@@ -310,6 +342,7 @@ func (c *Cache) startCache(cids map[string]int, haveRootCache bool) error {
 
 func (c *Cache) endCache(unDoneBlocks int) (err error) {
 	log.Infof("end cache %s,%s ----------", c.carfileCid, c.cacheID)
+	cacheCarfiles.Delete(c.cacheID)
 
 	defer func() {
 		err = c.data.endData(c)
@@ -336,9 +369,53 @@ func (c *Cache) endCache(unDoneBlocks int) (err error) {
 		c.status = cacheStatusSuccess
 	}
 
+	if c.status == cacheStatusSuccess && c.data.selector != nil {
+		rErr := cache.GetDB().RemoveCacheBlockPos(c.cacheID)
+		if rErr != nil {
+			log.Errorf("endCache %s,%s RemoveCacheBlockPos err:%s", c.carfileCid, c.cacheID, rErr.Error())
+		}
+	}
+
 	return
 }
 
+// selectLinks links of the block that need to cache
+func (c *Cache) selectLinks(info *api.CacheResultInfo) []string {
+	selector := c.data.selector
+	if selector == nil {
+		return info.Links
+	}
+
+	posStr, err := cache.GetDB().GetCacheBlockPos(c.cacheID, info.Cid)
+	if err != nil {
+		log.Errorf("selectLinks %s,%s GetCacheBlockPos err:%s", c.cacheID, info.Cid, err.Error())
+		return nil
+	}
+
+	pos, err := parseDagPos(posStr)
+	if err != nil {
+		log.Errorf("selectLinks %s,%s parseDagPos err:%s", c.cacheID, info.Cid, err.Error())
+		return nil
+	}
+
+	selected := selector.selectLinks(pos, info.Links, info.LinkNames, info.LinkSizes)
+
+	links := make([]string, 0, len(selected))
+	posMap := make(map[string]string)
+	for link, p := range selected {
+		links = append(links, link)
+		posMap[link] = p.String()
+	}
+
+	err = cache.GetDB().SetCacheBlockPos(c.cacheID, posMap)
+	if err != nil {
+		log.Errorf("selectLinks %s,%s SetCacheBlockPos err:%s", c.cacheID, info.Cid, err.Error())
+		return nil
+	}
+
+	return links
+}
+
 func (c *Cache) removeCache() error {
 	reliability := c.data.reliability
 
@@ -387,6 +464,11 @@ func (c *Cache) removeCache() error {
 			c.data.reliability = reliability
 			c.data.cacheIDs = cacheIDs
 			c.data.rootCacheID = rootCacheID
+			cacheCarfiles.Delete(c.cacheID)
+
+			if c.data.selector != nil {
+				err = cache.GetDB().RemoveCacheBlockPos(c.cacheID)
+			}
 		}
 	}
 
@@ -447,7 +529,8 @@ func (c *Cache) removeBlocks(deviceID string, cids []string) (map[string]string,
 		delRecordList = append(delRecordList, cid)
 	}
 
-	err := persistent.GetDB().DeleteBlockInfos(c.carfileCid, c.cacheID, deviceID, delRecordList)
+	// block records of nodes are saved with the root cid
+	err := persistent.GetDB().DeleteBlockInfos(c.data.rootCid, c.cacheID, deviceID, delRecordList)
 	if err != nil {
 		return errorMap, err
 	}
@@ -16,6 +16,8 @@ type Data struct {
 	nodeManager     *NodeManager
 	dataManager     *DataManager
 	cid             string
+	rootCid         string
+	selector        *carfileSelector
 	cacheMap        sync.Map
 	cacheIDs        string
 	reliability     int
@@ -24,13 +26,17 @@ type Data struct {
 	cacheCount      int
 	rootCacheID     string
 	totalBlocks     int
+	// tenant of the data, empty is owned by admin
+	owner string
 }
 
-func newData(nodeManager *NodeManager, dataManager *DataManager, cid string, reliability int) *Data {
+func newData(nodeManager *NodeManager, dataManager *DataManager, cid, rootCid string, selector *carfileSelector, reliability int) *Data {
 	return &Data{
 		nodeManager:     nodeManager,
 		dataManager:     dataManager,
 		cid:             cid,
+		rootCid:         rootCid,
+		selector:        selector,
 		reliability:     0,
 		needReliability: reliability,
 		cacheCount:      0,
@@ -46,7 +52,18 @@ func loadData(cid string, nodeManager *NodeManager, dataManager *DataManager) *D
 		return nil
 	}
 	if dInfo != nil {
-		data := newData(nodeManager, dataManager, cid, 0)
+		rootCid := dInfo.RootCID
+		if rootCid == "" {
+			rootCid = cid
+		}
+
+		selector, err := parseCarfileSelector(dInfo.Selector)
+		if err != nil {
+			log.Errorf("loadData %s parseCarfileSelector err :%s", cid, err.Error())
+			return nil
+		}
+
+		data := newData(nodeManager, dataManager, cid, rootCid, selector, 0)
 		data.cacheIDs = dInfo.CacheIDs
 		data.totalSize = dInfo.TotalSize
 		data.needReliability = dInfo.NeedReliability
@@ -54,6 +71,7 @@ func loadData(cid string, nodeManager *NodeManager, dataManager *DataManager) *D
 		data.cacheCount = dInfo.CacheCount
 		data.rootCacheID = dInfo.RootCacheID
 		data.totalBlocks = dInfo.TotalBlocks
+		data.owner = dInfo.Owner
 
 		idList := strings.Split(dInfo.CacheIDs, ",")
 		for _, cacheID := range idList {
@@ -126,10 +144,18 @@ func (d *Data) createCache() (*Cache, error) {
 
 func (d *Data) updateDataInfo(blockInfo *persistent.BlockInfo, fid string, info *api.CacheResultInfo, c *Cache, createBlocks []*persistent.BlockInfo) error {
 	if !d.haveRootCache() {
-		if info.Cid == d.cid {
-			d.totalSize = int(info.LinksSize) + info.BlockSize
+		if d.selector == nil {
+			if info.Cid == d.rootCid {
+				d.totalSize = int(info.LinksSize) + info.BlockSize
+			}
+			d.totalBlocks += len(info.Links)
+		} else {
+			// only part of the dag is cached, count the selected blocks
+			if info.IsOK {
+				d.totalSize += info.BlockSize
+			}
+			d.totalBlocks += len(createBlocks)
 		}
-		d.totalBlocks += len(info.Links)
 		// isUpdate = true
 	}
 
@@ -139,6 +165,7 @@ func (d *Data) updateDataInfo(blockInfo *persistent.BlockInfo, fid string, info
 func (d *Data) saveCacheingResults(cache *Cache, bInfo *persistent.BlockInfo, fid string, createBlocks []*persistent.BlockInfo) error {
 	dInfo := &persistent.DataInfo{
 		CID:         d.cid,
+		RootCID:     d.rootCid,
 		TotalSize:   d.totalSize,
 		TotalBlocks: d.totalBlocks,
 		Reliability: d.reliability,
@@ -208,7 +235,22 @@ func (d *Data) startData() error {
 	}
 	// c.dbID = id
 
-	return c.startCache(map[string]int{c.carfileCid: 0}, d.haveRootCache())
+	if d.selector != nil {
+		err = cache.GetDB().SetCacheBlockPos(c.cacheID, map[string]string{d.rootCid: dagPos{}.String()})
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.startCache(map[string]int{d.rootCid: 0}, d.haveRootCache())
+}
+
+func (d *Data) selectorStr() string {
+	if d.selector == nil {
+		return ""
+	}
+
+	return d.selector.str
 }
 
 func (d *Data) endData(c *Cache) (err error) {
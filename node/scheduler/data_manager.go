@@ -48,6 +48,9 @@ func newDataManager(nodeManager *NodeManager) *DataManager {
 func (m *DataManager) initTimewheel() {
 	m.timeoutTimeWheel = timewheel.New(1*time.Second, 3600, func(_ interface{}) {
 		m.timeoutTimeWheel.AddTimer((time.Duration(m.timeoutTime)*60-1)*time.Second, "TaskTimeout", nil)
+		if !isLeader() {
+			return
+		}
 		m.checkTaskTimeouts()
 	})
 	m.timeoutTimeWheel.Start()
@@ -55,6 +58,9 @@ func (m *DataManager) initTimewheel() {
 
 	m.taskTimeWheel = timewheel.New(1*time.Second, 3600, func(_ interface{}) {
 		m.taskTimeWheel.AddTimer(time.Duration(m.doTaskTime-1)*time.Second, "DataTask", nil)
+		if !isLeader() {
+			return
+		}
 		err := m.doDataTask()
 		if err != nil {
 			log.Errorf("doTask err :%s", err.Error())
@@ -98,9 +104,9 @@ func (m *DataManager) doDataTask() error {
 			return xerrors.Errorf("cid:%s,cacheID:%s ; startCacheContinue err:%s", info.Cid, cacheID, err.Error())
 		}
 	} else {
-		err = m.startCacheData(info.Cid, info.NeedReliability)
+		err = m.startCacheData(info.Cid, info.NeedReliability, info.Selector, info.Owner)
 		if err != nil {
-			return xerrors.Errorf("cid:%s,reliability:%d ; startCacheData err:%s", info.Cid, info.NeedReliability, err.Error())
+			return xerrors.Errorf("cid:%s,reliability:%d,selector:%s ; startCacheData err:%s", info.Cid, info.NeedReliability, info.Selector, err.Error())
 		}
 	}
 
@@ -165,6 +171,34 @@ func (m *DataManager) checkTaskTimeout(cid, cacheID string) {
 	}
 }
 
+// recoverRunningTasks load the running tasks of the failed leader
+func (m *DataManager) recoverRunningTasks() {
+	list, err := cache.GetDB().GetTasksWithRunningList()
+	if err != nil {
+		log.Errorf("recoverRunningTasks GetTasksWithRunningList err:%s", err.Error())
+		return
+	}
+
+	for _, cKey := range list {
+		cidList := strings.Split(cKey, ":")
+		if len(cidList) != 2 {
+			continue
+		}
+
+		if data := m.findData(cidList[0], true); data == nil {
+			log.Warnf("recoverRunningTasks data %s not found", cidList[0])
+		}
+	}
+}
+
+// clearRunningTasks the tasks are continued by the new leader
+func (m *DataManager) clearRunningTasks() {
+	m.runningTaskMap.Range(func(key, value interface{}) bool {
+		m.runningTaskMap.Delete(key)
+		return true
+	})
+}
+
 func (m *DataManager) checkTaskTimeouts() {
 	list, err := cache.GetDB().GetTasksWithRunningList()
 	if err != nil {
@@ -188,15 +222,22 @@ func (m *DataManager) checkTaskTimeouts() {
 	}
 }
 
-func (m *DataManager) startCacheData(cid string, reliability int) error {
-	var err error
+func (m *DataManager) startCacheData(cid string, reliability int, selectorStr, owner string) error {
+	selector, err := parseCarfileSelector(selectorStr)
+	if err != nil {
+		return err
+	}
+
+	key := dataKey(cid, selectorStr)
+
 	isSave := false
-	data := m.findData(cid, true)
+	data := m.findData(key, true)
 	if data == nil {
 		isSave = true
-		data = newData(m.nodeManager, m, cid, reliability)
+		data = newData(m.nodeManager, m, key, cid, selector, reliability)
+		data.owner = owner
 
-		m.runningTaskMap.Store(cid, data)
+		m.runningTaskMap.Store(key, data)
 	}
 
 	if data.needReliability != reliability {
@@ -213,6 +254,8 @@ func (m *DataManager) startCacheData(cid string, reliability int) error {
 	if isSave {
 		err = persistent.GetDB().SetDataInfo(&persistent.DataInfo{
 			CID:             data.cid,
+			RootCID:         data.rootCid,
+			Selector:        data.selectorStr(),
 			CacheIDs:        data.cacheIDs,
 			TotalSize:       data.totalSize,
 			NeedReliability: data.needReliability,
@@ -220,6 +263,7 @@ func (m *DataManager) startCacheData(cid string, reliability int) error {
 			CacheCount:      data.cacheCount,
 			TotalBlocks:     data.totalBlocks,
 			RootCacheID:     data.rootCacheID,
+			Owner:           data.owner,
 		})
 		if err != nil {
 			return xerrors.Errorf("cid:%s,SetDataInfo err:%s", data.cid, err.Error())
@@ -253,8 +297,8 @@ func (m *DataManager) startCacheContinue(cid, cacheID string) error {
 	return nil
 }
 
-func (m *DataManager) cacheData(cid string, reliability int) error {
-	return cache.GetDB().SetWaitingCacheTask(api.CacheDataInfo{Cid: cid, NeedReliability: reliability})
+func (m *DataManager) cacheData(cid string, reliability int, selector, owner string) error {
+	return cache.GetDB().SetWaitingCacheTask(api.CacheDataInfo{Cid: cid, NeedReliability: reliability, Selector: selector, Owner: owner})
 	// return m.startCacheData(cid, reliability)
 }
 
@@ -305,10 +349,14 @@ func (m *DataManager) removeCache(carfileCid, cacheID string) error {
 
 func (m *DataManager) cacheCarfileResult(deviceID string, info *api.CacheResultInfo) error {
 	// area := m.nodeManager.getNodeArea(deviceID)
-	data := m.findData(info.CarFileCid, true)
+	carfileID, err := carfileOfCache(info.CacheID)
+	if err != nil {
+		return xerrors.Errorf("cacheID:%s,carfileOfCache err:%s", info.CacheID, err.Error())
+	}
 
+	data := m.findData(carfileID, true)
 	if data == nil {
-		return xerrors.Errorf("%s : %s", ErrNotFoundTask, info.CarFileCid)
+		return xerrors.Errorf("%s : %s", ErrNotFoundTask, carfileID)
 	}
 
 	cacheI, ok := data.cacheMap.Load(info.CacheID)
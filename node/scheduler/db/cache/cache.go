@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"time"
+
 	"github.com/linguohua/titan/api"
 	"golang.org/x/xerrors"
 )
@@ -21,6 +23,10 @@ type DB interface {
 	GetRunningTask(cid string) (string, error)
 	RemoveRunningTask(cid, cacheID string) error
 
+	SetCacheBlockPos(cacheID string, posMap map[string]string) error
+	GetCacheBlockPos(cacheID, cid string) (string, error)
+	RemoveCacheBlockPos(cacheID string) error
+
 	SetWaitingCacheTask(info api.CacheDataInfo) error
 	GetWaitingCacheTask() (api.CacheDataInfo, error)
 	RemoveWaitingCacheTask() error
@@ -60,8 +66,39 @@ type DB interface {
 	GetDeviceStat() (api.StateNetwork, error)
 	SetDeviceInfo(deviceID string, info api.DevicesInfo) (bool, error)
 	GetDeviceInfo(deviceID string) (api.DevicesInfo, error)
-	IncrDeviceReward(deviceID string, reward int64) error
+	IncrDeviceReward(deviceID string, reward float64) error
+	SetDeviceTodayReward(deviceID string, reward float64) error
 	SetDeviceLatency(deviceID string, latency float64) error
+	IncrNodeSuspicious(deviceID string, count int64) error
+	IncrNodeValidateFail(deviceID string) (int64, error)
+	ResetNodeValidateFail(deviceID string) error
+
+	SetDownloadReceipt(ticketID, cid string, expiration time.Duration) (bool, error)
+	IncrTicketBytes(ticketID string, size int64, expiration time.Duration) (int64, error)
+	// IncrClientTickets tickets of the client in the window, the window starts from the first ticket
+	IncrClientTickets(client string, window time.Duration) (int64, error)
+
+	IncrRewardStat(deviceID, field string, value float64) error
+	GetRewardStats(beforeHour string) ([]*RewardStat, error)
+	RemoveRewardStat(deviceID, hour string) error
+	SetRewardFormula(formula api.RewardFormula) error
+	GetRewardFormula() (api.RewardFormula, error)
+	SetDownloadLimits(limits api.DownloadLimits) error
+	GetDownloadLimits() (api.DownloadLimits, error)
+	IncrDenylistVersion() (int64, error)
+	GetDenylistVersion() (int64, error)
+
+	IncrReputationStats(deviceID string, values map[string]float64) error
+	GetReputationStats() ([]*ReputationStat, error)
+	SetDeviceReputation(deviceID string, score float64) error
+	SetDeviceNat(deviceID, natType string, natRatio float64) error
+
+	AcquireLeader(schedulerID string, lease time.Duration) (bool, error)
+	ReleaseLeader(schedulerID string) error
+	GetLeader() (string, error)
+	SetNodeOwner(deviceID, schedulerID string, lease time.Duration) error
+	GetNodeOwner(deviceID string) (string, error)
+	RemoveNodeOwner(deviceID, schedulerID string) error
 
 	IsNilErr(err error) bool
 }
@@ -98,6 +135,11 @@ func GetDB() DB {
 	return db
 }
 
+// SetDB replace the db, tests use it to set a fake db
+func SetDB(d DB) {
+	db = d
+}
+
 // NodeInfo base info
 type NodeInfo struct {
 	OnLineTime int64
@@ -106,3 +148,51 @@ type NodeInfo struct {
 	IsOnline   bool
 	NodeType   api.NodeTypeName
 }
+
+// RewardStat field
+const (
+	RewardFieldDownloadBytes   = "DownloadBytes"
+	RewardFieldDownloadCount   = "DownloadCount"
+	RewardFieldOnlineMinutes   = "OnlineMinutes"
+	RewardFieldValidateSuccess = "ValidateSuccess"
+	RewardFieldValidateFail    = "ValidateFail"
+)
+
+// RewardHourLayout hour format of reward stat
+const RewardHourLayout = "2006010215"
+
+// RewardStat reward statistics of device in an hour
+type RewardStat struct {
+	DeviceID        string
+	Hour            string
+	DownloadBytes   float64 `redis:"DownloadBytes"`
+	DownloadCount   float64 `redis:"DownloadCount"`
+	OnlineMinutes   float64 `redis:"OnlineMinutes"`
+	ValidateSuccess float64 `redis:"ValidateSuccess"`
+	ValidateFail    float64 `redis:"ValidateFail"`
+}
+
+// ReputationStat field
+const (
+	ReputationFieldOnlineMinutes   = "OnlineMinutes"
+	ReputationFieldExpectedMinutes = "ExpectedMinutes"
+	ReputationFieldValidateSuccess = "ValidateSuccess"
+	ReputationFieldValidateFail    = "ValidateFail"
+	ReputationFieldDownloadSuccess = "DownloadSuccess"
+	ReputationFieldDownloadFail    = "DownloadFail"
+	ReputationFieldCacheSuccess    = "CacheSuccess"
+	ReputationFieldCacheFail       = "CacheFail"
+)
+
+// ReputationStat decayed event counters of device
+type ReputationStat struct {
+	DeviceID        string
+	OnlineMinutes   float64 `redis:"OnlineMinutes"`
+	ExpectedMinutes float64 `redis:"ExpectedMinutes"`
+	ValidateSuccess float64 `redis:"ValidateSuccess"`
+	ValidateFail    float64 `redis:"ValidateFail"`
+	DownloadSuccess float64 `redis:"DownloadSuccess"`
+	DownloadFail    float64 `redis:"DownloadFail"`
+	CacheSuccess    float64 `redis:"CacheSuccess"`
+	CacheFail       float64 `redis:"CacheFail"`
+}
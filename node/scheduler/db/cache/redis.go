@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/linguohua/titan/api"
@@ -20,6 +21,8 @@ const (
 	redisKeyWaitingTask = "Titan:WaitingTask:%s"
 	// redisKeyRunningList  server name
 	redisKeyRunningList = "Titan:RunningList:%s"
+	// redisKeyCacheBlockPos  server name:cacheID
+	redisKeyCacheBlockPos = "Titan:CacheBlockPos:%s:%s"
 	// redisKeyRunningTask  server name:cid
 	redisKeyRunningTask = "Titan:RunningTask:%s:%s"
 	// redisKeyCacheResult  server name
@@ -52,6 +55,26 @@ const (
 	redisKeyNodeDeviceID = "Titan:NodeDeviceID"
 	// RedisKeyNodeReward
 	redisKeyNodeDayReward = "Titan:NodeDayReward:%s"
+	// ticketID:cid
+	redisKeyDownloadReceipt = "Titan:DownloadReceipt:%s:%s"
+	// ticketID
+	redisKeyTicketBytes = "Titan:TicketBytes:%s"
+	// client ip or key
+	redisKeyClientTickets = "Titan:ClientTickets:%s"
+	// deviceID:hour
+	redisKeyRewardStat = "Titan:RewardStat:%s:%s"
+	// server name
+	redisKeyRewardFormula = "Titan:RewardFormula:%s"
+	// server name
+	redisKeyDownloadLimits = "Titan:DownloadLimits:%s"
+	// deviceID
+	redisKeyReputation = "Titan:Reputation:%s"
+	// server name
+	redisKeyLeader = "Titan:Leader:%s"
+	// deviceID
+	redisKeyNodeOwner = "Titan:NodeOwner:%s"
+	// server name
+	redisKeyDenylistVersion = "Titan:DenylistVersion:%s"
 
 	// NodeInfo field
 	onlineTimeField         = "OnlineTime"
@@ -59,14 +82,41 @@ const (
 	nodeTodayRewardField    = "TodayProfit"
 	nodeRewardDateTimeField = "RewardDateTime"
 	nodeLatencyField        = "Latency"
+	nodeSuspiciousField     = "SuspiciousCount"
+	nodeReputationField     = "Reputation"
+	nodeNatTypeField        = "NatType"
+	nodeNatRatioField       = "NatRatio"
+	// continuous validate fail count
+	nodeValidateFailField = "ValidateFailCount"
 	// CacheTask field
 	// carFileIDField = "CarFileID"
 	// cacheIDField = "cacheID"
 )
 
+// acquire the key if it is free, renew it if it is held by the value
+var acquireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0`)
+
+// delete the key only if it is held by the value
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
 const (
 	dayFormatLayout = "20060102"
-	tebibyte        = 1024 * 1024 * 1024 * 1024
+	// reward stat not settled in time will be dropped
+	rewardStatExpiration = 7 * 24 * time.Hour
+	tebibyte             = 1024 * 1024 * 1024 * 1024
+	// keys returned by one SCAN call
+	scanCount = 1000
 )
 
 // TypeRedis redis
@@ -323,7 +373,7 @@ func (rd redisDB) IsNodeInValidatorList(deviceID string) (bool, error) {
 // 	return cid, cacheID
 // }
 
-func (rd redisDB) IncrDeviceReward(deviceID string, reward int64) error {
+func (rd redisDB) IncrDeviceReward(deviceID string, reward float64) error {
 	key := fmt.Sprintf(redisKeyNodeInfo, deviceID)
 
 	results, err := rd.cli.HMGet(context.Background(), key, nodeTodayRewardField, nodeRewardDateTimeField).Result()
@@ -333,11 +383,11 @@ func (rd redisDB) IncrDeviceReward(deviceID string, reward int64) error {
 
 	var (
 		datetime     time.Time
-		beforeReward int64
+		beforeReward float64
 	)
 
 	if resReward, ok := results[0].(string); ok {
-		beforeReward, err = strconv.ParseInt(resReward, 10, 64)
+		beforeReward, err = strconv.ParseFloat(resReward, 64)
 		if err != nil {
 			return err
 		}
@@ -365,6 +415,37 @@ func (rd redisDB) IncrDeviceReward(deviceID string, reward int64) error {
 	return nil
 }
 
+// SetDeviceTodayReward set the reward of today, it is the sum of the settled incomes of today
+func (rd redisDB) SetDeviceTodayReward(deviceID string, reward float64) error {
+	key := fmt.Sprintf(redisKeyNodeInfo, deviceID)
+
+	_, err := rd.cli.HMSet(context.Background(), key,
+		nodeTodayRewardField, reward,
+		nodeRewardDateTimeField, getStartOfDay(time.Now()).Format(dayFormatLayout),
+	).Result()
+	return err
+}
+
+// scanKeys keys match the pattern, SCAN does not block redis as KEYS with many keys
+func (rd redisDB) scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	seen := make(map[string]struct{})
+	keys := make([]string, 0)
+
+	iter := rd.cli.Scan(ctx, 0, pattern, scanCount).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		// a key may be returned more than once by SCAN
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	return keys, iter.Err()
+}
+
 func getStartOfDay(t time.Time) time.Time {
 	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
 }
@@ -375,7 +456,7 @@ func (rd redisDB) SetDeviceInfo(deviceID string, info api.DevicesInfo) (bool, er
 	ctx := context.Background()
 	_, err := rd.cli.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
 		for field, value := range toMap(info) {
-			if field == nodeTodayRewardField || field == onlineTimeField {
+			if field == nodeTodayRewardField || field == onlineTimeField || field == nodeSuspiciousField || field == nodeReputationField {
 				continue
 			}
 			pipeliner.HMSet(ctx, key, field, value)
@@ -490,6 +571,35 @@ func (rd redisDB) RemoveRunningTask(cid, cacheID string) error {
 	return rd.RemoveTaskWithRunningList(cid, cacheID)
 }
 
+func (rd redisDB) SetCacheBlockPos(cacheID string, posMap map[string]string) error {
+	if len(posMap) <= 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf(redisKeyCacheBlockPos, serverName, cacheID)
+
+	values := make([]interface{}, 0, len(posMap)*2)
+	for cid, pos := range posMap {
+		values = append(values, cid, pos)
+	}
+
+	_, err := rd.cli.HMSet(context.Background(), key, values...).Result()
+	return err
+}
+
+func (rd redisDB) GetCacheBlockPos(cacheID, cid string) (string, error) {
+	key := fmt.Sprintf(redisKeyCacheBlockPos, serverName, cacheID)
+
+	return rd.cli.HGet(context.Background(), key, cid).Result()
+}
+
+func (rd redisDB) RemoveCacheBlockPos(cacheID string) error {
+	key := fmt.Sprintf(redisKeyCacheBlockPos, serverName, cacheID)
+
+	_, err := rd.cli.Del(context.Background(), key).Result()
+	return err
+}
+
 func (rd redisDB) SetWaitingCacheTask(info api.CacheDataInfo) error {
 	key := fmt.Sprintf(redisKeyWaitingTask, serverName)
 
@@ -572,9 +682,228 @@ func (rd redisDB) SetDeviceLatency(deviceID string, latency float64) error {
 	return nil
 }
 
+func (rd redisDB) IncrNodeSuspicious(deviceID string, count int64) error {
+	key := fmt.Sprintf(redisKeyNodeInfo, deviceID)
+	_, err := rd.cli.HIncrBy(context.Background(), key, nodeSuspiciousField, count).Result()
+	return err
+}
+
+func (rd redisDB) IncrNodeValidateFail(deviceID string) (int64, error) {
+	key := fmt.Sprintf(redisKeyNodeInfo, deviceID)
+	return rd.cli.HIncrBy(context.Background(), key, nodeValidateFailField, 1).Result()
+}
+
+func (rd redisDB) ResetNodeValidateFail(deviceID string) error {
+	key := fmt.Sprintf(redisKeyNodeInfo, deviceID)
+	_, err := rd.cli.HSet(context.Background(), key, nodeValidateFailField, 0).Result()
+	return err
+}
+
+// SetDownloadReceipt return false if the receipt already set
+func (rd redisDB) SetDownloadReceipt(ticketID, cid string, expiration time.Duration) (bool, error) {
+	key := fmt.Sprintf(redisKeyDownloadReceipt, ticketID, cid)
+	return rd.cli.SetNX(context.Background(), key, time.Now().Unix(), expiration).Result()
+}
+
+func (rd redisDB) IncrTicketBytes(ticketID string, size int64, expiration time.Duration) (int64, error) {
+	key := fmt.Sprintf(redisKeyTicketBytes, ticketID)
+
+	ctx := context.Background()
+	var incr *redis.IntCmd
+	_, err := rd.cli.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		incr = pipeliner.IncrBy(ctx, key, size)
+		pipeliner.Expire(ctx, key, expiration)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+func (rd redisDB) IncrClientTickets(client string, window time.Duration) (int64, error) {
+	key := fmt.Sprintf(redisKeyClientTickets, client)
+
+	ctx := context.Background()
+	var incr *redis.IntCmd
+	_, err := rd.cli.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		// the expiration is only set by the first ticket
+		pipeliner.SetNX(ctx, key, 0, window)
+		incr = pipeliner.Incr(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+func (rd redisDB) IncrRewardStat(deviceID, field string, value float64) error {
+	key := fmt.Sprintf(redisKeyRewardStat, deviceID, time.Now().Format(RewardHourLayout))
+
+	ctx := context.Background()
+	_, err := rd.cli.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		pipeliner.HIncrByFloat(ctx, key, field, value)
+		pipeliner.Expire(ctx, key, rewardStatExpiration)
+		return nil
+	})
+	return err
+}
+
+// GetRewardStats reward stats of the hours before beforeHour
+func (rd redisDB) GetRewardStats(beforeHour string) ([]*RewardStat, error) {
+	ctx := context.Background()
+	keys, err := rd.scanKeys(ctx, fmt.Sprintf(redisKeyRewardStat, "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf(redisKeyRewardStat, "", "")
+	prefix = prefix[:len(prefix)-1]
+
+	out := make([]*RewardStat, 0)
+	for _, key := range keys {
+		// key format prefix:deviceID:hour
+		rest := strings.TrimPrefix(key, prefix)
+		index := strings.LastIndex(rest, ":")
+		if index <= 0 {
+			continue
+		}
+
+		stat := &RewardStat{DeviceID: rest[:index], Hour: rest[index+1:]}
+		if stat.Hour >= beforeHour {
+			continue
+		}
+
+		if err := rd.cli.HGetAll(ctx, key).Scan(stat); err != nil {
+			continue
+		}
+
+		out = append(out, stat)
+	}
+
+	return out, nil
+}
+
+func (rd redisDB) RemoveRewardStat(deviceID, hour string) error {
+	key := fmt.Sprintf(redisKeyRewardStat, deviceID, hour)
+	_, err := rd.cli.Del(context.Background(), key).Result()
+	return err
+}
+
+func (rd redisDB) SetRewardFormula(formula api.RewardFormula) error {
+	key := fmt.Sprintf(redisKeyRewardFormula, serverName)
+
+	buf, err := json.Marshal(formula)
+	if err != nil {
+		return err
+	}
+
+	_, err = rd.cli.Set(context.Background(), key, buf, 0).Result()
+	return err
+}
+
+func (rd redisDB) SetDownloadLimits(limits api.DownloadLimits) error {
+	key := fmt.Sprintf(redisKeyDownloadLimits, serverName)
+
+	buf, err := json.Marshal(limits)
+	if err != nil {
+		return err
+	}
+
+	_, err = rd.cli.Set(context.Background(), key, buf, 0).Result()
+	return err
+}
+
+func (rd redisDB) GetDownloadLimits() (api.DownloadLimits, error) {
+	key := fmt.Sprintf(redisKeyDownloadLimits, serverName)
+
+	limits := api.DownloadLimits{}
+	buf, err := rd.cli.Get(context.Background(), key).Bytes()
+	if err != nil {
+		return limits, err
+	}
+
+	err = json.Unmarshal(buf, &limits)
+	return limits, err
+}
+
+func (rd redisDB) IncrDenylistVersion() (int64, error) {
+	key := fmt.Sprintf(redisKeyDenylistVersion, serverName)
+
+	return rd.cli.IncrBy(context.Background(), key, 1).Result()
+}
+
+func (rd redisDB) GetDenylistVersion() (int64, error) {
+	key := fmt.Sprintf(redisKeyDenylistVersion, serverName)
+
+	return rd.cli.Get(context.Background(), key).Int64()
+}
+
+func (rd redisDB) GetRewardFormula() (api.RewardFormula, error) {
+	key := fmt.Sprintf(redisKeyRewardFormula, serverName)
+
+	formula := api.RewardFormula{}
+	buf, err := rd.cli.Get(context.Background(), key).Bytes()
+	if err != nil {
+		return formula, err
+	}
+
+	err = json.Unmarshal(buf, &formula)
+	return formula, err
+}
+
+func (rd redisDB) IncrReputationStats(deviceID string, values map[string]float64) error {
+	key := fmt.Sprintf(redisKeyReputation, deviceID)
+
+	ctx := context.Background()
+	_, err := rd.cli.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		for field, value := range values {
+			pipeliner.HIncrByFloat(ctx, key, field, value)
+		}
+		return nil
+	})
+	return err
+}
+
+func (rd redisDB) GetReputationStats() ([]*ReputationStat, error) {
+	ctx := context.Background()
+	keys, err := rd.scanKeys(ctx, fmt.Sprintf(redisKeyReputation, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf(redisKeyReputation, "")
+	out := make([]*ReputationStat, 0, len(keys))
+	for _, key := range keys {
+		stat := &ReputationStat{DeviceID: strings.TrimPrefix(key, prefix)}
+		if err := rd.cli.HGetAll(ctx, key).Scan(stat); err != nil {
+			continue
+		}
+
+		out = append(out, stat)
+	}
+
+	return out, nil
+}
+
+func (rd redisDB) SetDeviceReputation(deviceID string, score float64) error {
+	key := fmt.Sprintf(redisKeyNodeInfo, deviceID)
+	_, err := rd.cli.HSet(context.Background(), key, nodeReputationField, score).Result()
+	return err
+}
+
+func (rd redisDB) SetDeviceNat(deviceID, natType string, natRatio float64) error {
+	key := fmt.Sprintf(redisKeyNodeInfo, deviceID)
+	_, err := rd.cli.HMSet(context.Background(), key, nodeNatTypeField, natType, nodeNatRatioField, natRatio).Result()
+	return err
+}
+
 func (rd redisDB) GetDeviceStat() (out api.StateNetwork, err error) {
 	ctx := context.Background()
-	keys, err := rd.cli.Keys(ctx, fmt.Sprintf(redisKeyNodeInfo, "*")).Result()
+	keys, err := rd.scanKeys(ctx, fmt.Sprintf(redisKeyNodeInfo, "*"))
 	if err != nil {
 		return
 	}
@@ -601,3 +930,35 @@ func (rd redisDB) GetDeviceStat() (out api.StateNetwork, err error) {
 
 	return
 }
+
+// AcquireLeader return true if the scheduler is the leader of the server until lease expired
+func (rd redisDB) AcquireLeader(schedulerID string, lease time.Duration) (bool, error) {
+	key := fmt.Sprintf(redisKeyLeader, serverName)
+	return acquireScript.Run(context.Background(), rd.cli, []string{key}, schedulerID, lease.Milliseconds()).Bool()
+}
+
+func (rd redisDB) ReleaseLeader(schedulerID string) error {
+	key := fmt.Sprintf(redisKeyLeader, serverName)
+	return releaseScript.Run(context.Background(), rd.cli, []string{key}, schedulerID).Err()
+}
+
+func (rd redisDB) GetLeader() (string, error) {
+	key := fmt.Sprintf(redisKeyLeader, serverName)
+	return rd.cli.Get(context.Background(), key).Result()
+}
+
+// SetNodeOwner the scheduler the node connected, renewed by keepalive
+func (rd redisDB) SetNodeOwner(deviceID, schedulerID string, lease time.Duration) error {
+	key := fmt.Sprintf(redisKeyNodeOwner, deviceID)
+	return rd.cli.Set(context.Background(), key, schedulerID, lease).Err()
+}
+
+func (rd redisDB) GetNodeOwner(deviceID string) (string, error) {
+	key := fmt.Sprintf(redisKeyNodeOwner, deviceID)
+	return rd.cli.Get(context.Background(), key).Result()
+}
+
+func (rd redisDB) RemoveNodeOwner(deviceID, schedulerID string) error {
+	key := fmt.Sprintf(redisKeyNodeOwner, deviceID)
+	return releaseScript.Run(context.Background(), rd.cli, []string{key}, schedulerID).Err()
+}
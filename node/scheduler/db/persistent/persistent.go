@@ -30,11 +30,14 @@ type DB interface {
 	SetDataInfo(info *DataInfo) error
 	GetDataInfo(cid string) (*DataInfo, error)
 	GetDataInfos() ([]*DataInfo, error)
-	GetDataCidWithPage(page int) (count int, totalPage int, list []string, err error)
+	// owner empty is all datas
+	GetDataCidWithPage(page int, owner string) (count int, totalPage int, list []string, err error)
 
 	// cache info
 	// SetCacheInfo(info *CacheInfo) error
 	GetCacheInfo(cacheID, carfileID string) (*CacheInfo, error)
+	// GetCacheCarfileID data key of the cache
+	GetCacheCarfileID(cacheID string) (string, error)
 	RemoveAndUpdateCacheInfo(cacheID, carfileID, cachesID, rootCacheID string, caches []string, reliability int) error
 
 	// block info
@@ -55,13 +58,63 @@ type DB interface {
 	GetBlocksFID(deviceID string) (map[string]string, error)
 	GetDeviceBlockNum(deviceID string) (int64, error)
 	GetNodesWithCacheList(cid string) ([]string, error)
+	GetNodeBlocks(deviceID, cid string) ([]*NodeBlocks, error)
 
 	// temporary node register
 	BindRegisterInfo(secret, deviceID string, nodeType api.NodeType) error
 	GetRegisterInfo(deviceID string) (*api.NodeRegisterInfo, error)
+	UpdateRegisterSecret(deviceID, secret string) error
+	SetDeviceUser(deviceID, userID string) error
+	GetUserDevices(userID string) ([]string, error)
+
+	// device income, income of the device and hour is replaced by save
+	SaveDeviceIncome(info *DeviceIncome) error
+	GetDeviceIncomes(deviceIDs []string, fromHour, toHour string) ([]*DeviceIncome, error)
+	GetDeviceIncomeSum(deviceIDs []string) (float64, error)
+
+	// reputation
+	SaveReputationHistory(infos []*ReputationHistory) error
+
+	// quarantine and ban
+	SetNodeRestriction(info *api.NodeRestriction) error
+	RemoveNodeRestriction(target, reason, operator string) error
+	GetNodeRestrictions() ([]*api.NodeRestriction, error)
+	GetNodeRestrictionLogs(target string, limit int) ([]*api.NodeRestrictionLog, error)
+
+	// served areas and ip allowlist
+	SetAreaPolicy(info *api.AreaPolicy) error
+	RemoveAreaPolicy(area string) error
+	GetAreaPolicies() ([]*api.AreaPolicy, error)
+	SetIPAllowlist(info *api.IPAllowlist) error
+	RemoveIPAllowlist(target string) error
+	GetIPAllowlists() ([]*api.IPAllowlist, error)
+
+	// content denylist
+	AddDenylist(entries []*api.DenylistEntry) error
+	RemoveDenylist(hashes []string) error
+	GetDenylist() ([]*api.DenylistEntry, error)
+
+	// tenants owning carfiles
+	SetTenant(info *api.Tenant) error
+	GetTenant(tenantID string) (*api.Tenant, error)
+	GetTenants() ([]*api.Tenant, error)
+	// GetTenantStorage carfiles of the tenant and their size multiplied by need reliability
+	GetTenantStorage(tenantID string) (carfiles int, size int64, err error)
+	// GetRootOwners owners of the carfile and the selector caches of the root cid, empty for the datas without owner
+	GetRootOwners(rootCid string) ([]string, error)
+	AddTenantBandwidths(infos []*TenantBandwidth) error
+	GetTenantBandwidth(tenantID, month string) (int64, error)
+
+	// download usage of apps and limit violations
+	AddAppDownloadUsages(usages []*api.AppDownloadUsage) error
+	GetAppDownloadUsages(date string) ([]*api.AppDownloadUsage, error)
+	AddDownloadViolations(violations []*api.DownloadViolation) error
+	GetDownloadViolations(deviceID string, limit int) ([]*api.DownloadViolation, error)
 
 	// AddDownloadInfo user download block information
 	AddDownloadInfo(deviceID string, info *api.BlockDownloadInfo) error
+	// AddDownloadInfos download information aggregated by node
+	AddDownloadInfos(infos []*api.BlockDownloadInfo) error
 	GetDownloadInfo(deviceID string) ([]*api.BlockDownloadInfo, error)
 
 	// tool
@@ -103,6 +156,11 @@ func GetDB() DB {
 	return db
 }
 
+// SetDB replace the db, tests use it to set a fake db
+func SetDB(d DB) {
+	db = d
+}
+
 // NodeInfo base info
 type NodeInfo struct {
 	ID          int
@@ -131,6 +189,34 @@ type ValidateResult struct {
 	ServerName  string `db:"server_name"`
 }
 
+// ReputationHistory reputation score of device at a time
+type ReputationHistory struct {
+	ID       int
+	DeviceID string  `db:"device_id"`
+	Score    float64 `db:"score"`
+	Uptime   float64 `db:"uptime"`
+	Validate float64 `db:"validate"`
+	Download float64 `db:"download"`
+	Cache    float64 `db:"cache"`
+	Latency  float64 `db:"latency"`
+}
+
+// DeviceIncome income of device in an hour
+type DeviceIncome struct {
+	ID       int
+	DeviceID string `db:"device_id"`
+	UserID   string `db:"user_id"`
+	// format 2006010215
+	Hour            string  `db:"hour"`
+	DownloadBytes   int64   `db:"download_bytes"`
+	DownloadCount   int64   `db:"download_count"`
+	OnlineMinutes   float64 `db:"online_minutes"`
+	StorageBytes    int64   `db:"storage_bytes"`
+	ValidateSuccess int64   `db:"validate_success"`
+	ValidateFail    int64   `db:"validate_fail"`
+	Income          float64 `db:"income"`
+}
+
 // NodeBlocks Node Block
 type NodeBlocks struct {
 	ID        int
@@ -152,6 +238,8 @@ type NodeBlocks struct {
 type DataInfo struct {
 	ID              int
 	CID             string `db:"cid"`
+	RootCID         string `db:"root_cid"`
+	Selector        string `db:"selector"`
 	CacheIDs        string `db:"cache_ids"`
 	Status          int    `db:"status"`
 	TotalSize       int    `db:"total_size"`
@@ -160,6 +248,14 @@ type DataInfo struct {
 	CacheCount      int    `db:"cache_count"`
 	RootCacheID     string `db:"root_cache_id"`
 	TotalBlocks     int    `db:"total_blocks"`
+	Owner           string `db:"owner"`
+}
+
+// TenantBandwidth bytes downloaded from the carfiles of the tenant in the month
+type TenantBandwidth struct {
+	TenantID string `db:"tenant_id"`
+	Month    string `db:"month"`
+	Bytes    int64  `db:"bandwidth_bytes"`
 }
 
 // CacheInfo Data Block info
@@ -1,6 +1,7 @@
 package persistent
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
 	"time"
@@ -30,6 +31,17 @@ var (
 	blockInfoTable    = "block_info_%s"
 	cacheInfoTable    = "cache_info_%s"
 	blockDownloadInfo = "block_download_info_%s"
+	deviceIncomeTable = "device_income_%s"
+	reputationTable   = "reputation_history_%s"
+	restrictionTable  = "node_restriction_%s"
+	restrictionLog    = "node_restriction_log_%s"
+	areaPolicyTable   = "area_policy_%s"
+	ipAllowlistTable  = "ip_allowlist_%s"
+	appUsageTable     = "app_download_usage_%s"
+	violationTable    = "download_violation_%s"
+	denylistTable     = "denylist_%s"
+	tenantTable       = "tenant_%s"
+	tenantUsageTable  = "tenant_usage_%s"
 )
 
 // InitSQL init sql
@@ -258,6 +270,18 @@ func (sd sqlDB) GetBlockFidWithCid(deviceID, cid string) (string, error) {
 	return info.FID, err
 }
 
+func (sd sqlDB) GetNodeBlocks(deviceID, cid string) ([]*NodeBlocks, error) {
+	area := sd.ReplaceArea()
+
+	var out []*NodeBlocks
+	cmd := fmt.Sprintf(`SELECT * FROM %s WHERE cid=? AND device_id=?`, fmt.Sprintf(deviceBlockTable, area))
+	if err := sd.cli.Select(&out, cmd, cid, deviceID); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 func (sd sqlDB) GetBlocksFID(deviceID string) (map[string]string, error) {
 	area := sd.ReplaceArea()
 
@@ -429,8 +453,13 @@ func (sd sqlDB) SaveCacheingResults(dInfo *DataInfo, cInfo *CacheInfo, updateBlo
 	tx.MustExec(bCmd, updateBlock.Status, updateBlock.Size, updateBlock.Reliability, updateBlock.DeviceID, updateBlock.ID)
 
 	if fid != "" {
+		// block records of nodes are saved with the root cid, carfile id of cache is the data key of the selector
+		rootCid := dInfo.RootCID
+		if rootCid == "" {
+			rootCid = cInfo.CarfileID
+		}
 		cmd1 := fmt.Sprintf(`INSERT INTO %s (cid, fid, cache_id, carfile_id, device_id) VALUES (?, ?, ?, ?, ?)`, fmt.Sprintf(deviceBlockTable, area))
-		tx.MustExec(cmd1, updateBlock.CID, fid, updateBlock.CacheID, cInfo.CarfileID, updateBlock.DeviceID)
+		tx.MustExec(cmd1, updateBlock.CID, fid, updateBlock.CacheID, rootCid, updateBlock.DeviceID)
 		// 	cmd1 := fmt.Sprintf(`UPDATE %s SET fid=? WHERE cid=? AND carfile_id=? AND cache_id=? AND device_id=?`, fmt.Sprintf(deviceBlockTable, area))
 		// 	tx.MustExec(cmd1, fid, updateBlock.CID, cInfo.CarfileID, updateBlock.CacheID, updateBlock.DeviceID)
 		// } else {
@@ -469,7 +498,7 @@ func (sd sqlDB) SetDataInfo(info *DataInfo) error {
 	}
 
 	if oldInfo == nil {
-		cmd := fmt.Sprintf("INSERT INTO %s (cid, cache_ids, status, need_reliability, total_blocks) VALUES (:cid, :cache_ids, :status, :need_reliability, :total_blocks)", tableName)
+		cmd := fmt.Sprintf("INSERT INTO %s (cid, root_cid, selector, cache_ids, status, need_reliability, total_blocks, owner) VALUES (:cid, :root_cid, :selector, :cache_ids, :status, :need_reliability, :total_blocks, :owner)", tableName)
 		_, err = sd.cli.NamedExec(cmd, info)
 		return err
 	}
@@ -506,12 +535,17 @@ func (sd sqlDB) GetDataInfo(cid string) (*DataInfo, error) {
 	return info, err
 }
 
-func (sd sqlDB) GetDataCidWithPage(page int) (count int, totalPage int, list []string, err error) {
+func (sd sqlDB) GetDataCidWithPage(page int, owner string) (count int, totalPage int, list []string, err error) {
 	area := sd.ReplaceArea()
 	p := 20
 
 	cmd := fmt.Sprintf("SELECT count(*) FROM %s ;", fmt.Sprintf(dataInfoTable, area))
-	err = sd.cli.Get(&count, cmd)
+	args := []interface{}{}
+	if owner != "" {
+		cmd = fmt.Sprintf("SELECT count(*) FROM %s WHERE owner=?", fmt.Sprintf(dataInfoTable, area))
+		args = append(args, owner)
+	}
+	err = sd.cli.Get(&count, cmd, args...)
 	if err != nil {
 		return
 	}
@@ -527,7 +561,10 @@ func (sd sqlDB) GetDataCidWithPage(page int) (count int, totalPage int, list []s
 	}
 
 	cmd = fmt.Sprintf("SELECT * FROM %s WHERE id>=(SELECT id FROM %s order by id limit %d,1) LIMIT %d", fmt.Sprintf(dataInfoTable, area), fmt.Sprintf(dataInfoTable, area), (p * (page - 1)), p)
-	rows, err := sd.cli.Queryx(cmd)
+	if owner != "" {
+		cmd = fmt.Sprintf("SELECT * FROM %s WHERE owner=? ORDER BY id LIMIT %d,%d", fmt.Sprintf(dataInfoTable, area), (p * (page - 1)), p)
+	}
+	rows, err := sd.cli.Queryx(cmd, args...)
 	if err != nil {
 		return
 	}
@@ -630,6 +667,16 @@ func (sd sqlDB) GetDataInfos() ([]*DataInfo, error) {
 // 	return err
 // }
 
+func (sd sqlDB) GetCacheCarfileID(cacheID string) (string, error) {
+	var carfileID string
+	cmd := fmt.Sprintf(`SELECT carfile_id FROM %s WHERE cache_id=?`, fmt.Sprintf(cacheInfoTable, sd.ReplaceArea()))
+	if err := sd.cli.Get(&carfileID, cmd, cacheID); err != nil {
+		return "", err
+	}
+
+	return carfileID, nil
+}
+
 func (sd sqlDB) GetCacheInfo(cacheID, carFileCid string) (*CacheInfo, error) {
 	area := sd.ReplaceArea()
 
@@ -880,6 +927,425 @@ func (sd sqlDB) GetRegisterInfo(deviceID string) (*api.NodeRegisterInfo, error)
 	return info, err
 }
 
+func (sd sqlDB) UpdateRegisterSecret(deviceID, secret string) error {
+	info := &api.NodeRegisterInfo{
+		DeviceID: deviceID,
+		Secret:   secret,
+	}
+
+	_, err := sd.cli.NamedExec(`UPDATE register SET secret=:secret WHERE device_id=:device_id`, info)
+	return err
+}
+
+func (sd sqlDB) SetDeviceUser(deviceID, userID string) error {
+	info := &api.NodeRegisterInfo{
+		DeviceID: deviceID,
+		UserID:   userID,
+	}
+
+	result, err := sd.cli.NamedExec(`UPDATE register SET user_id=:user_id WHERE device_id=:device_id`, info)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return xerrors.New(errNodeNotFind)
+	}
+
+	return nil
+}
+
+func (sd sqlDB) GetUserDevices(userID string) ([]string, error) {
+	var out []string
+	if err := sd.cli.Select(&out, `SELECT device_id FROM register WHERE user_id=?`, userID); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) SaveDeviceIncome(info *DeviceIncome) error {
+	cmd := fmt.Sprintf(`INSERT INTO %s (device_id, user_id, hour, download_bytes, download_count, online_minutes, storage_bytes, validate_success, validate_fail, income)
+	VALUES (:device_id, :user_id, :hour, :download_bytes, :download_count, :online_minutes, :storage_bytes, :validate_success, :validate_fail, :income)
+	ON DUPLICATE KEY UPDATE user_id=VALUES(user_id), download_bytes=VALUES(download_bytes), download_count=VALUES(download_count),
+	online_minutes=VALUES(online_minutes), storage_bytes=VALUES(storage_bytes), validate_success=VALUES(validate_success),
+	validate_fail=VALUES(validate_fail), income=VALUES(income)`, fmt.Sprintf(deviceIncomeTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, info)
+	return err
+}
+
+func (sd sqlDB) GetDeviceIncomes(deviceIDs []string, fromHour, toHour string) ([]*DeviceIncome, error) {
+	if len(deviceIDs) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`SELECT * FROM %s WHERE device_id IN (?) AND hour >= ? AND hour <= ? ORDER BY hour`,
+		fmt.Sprintf(deviceIncomeTable, sd.ReplaceArea())), deviceIDs, fromHour, toHour)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*DeviceIncome
+	if err := sd.cli.Select(&out, sd.cli.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) GetDeviceIncomeSum(deviceIDs []string) (float64, error) {
+	if len(deviceIDs) == 0 {
+		return 0, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`SELECT IFNULL(SUM(income), 0) FROM %s WHERE device_id IN (?)`,
+		fmt.Sprintf(deviceIncomeTable, sd.ReplaceArea())), deviceIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	if err := sd.cli.Get(&sum, sd.cli.Rebind(query), args...); err != nil {
+		return 0, err
+	}
+
+	return sum, nil
+}
+
+func (sd sqlDB) SaveReputationHistory(infos []*ReputationHistory) error {
+	if len(infos) == 0 {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(`INSERT INTO %s (device_id, score, uptime, validate, download, cache, latency)
+	VALUES (:device_id, :score, :uptime, :validate, :download, :cache, :latency)`, fmt.Sprintf(reputationTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, infos)
+	return err
+}
+
+func (sd sqlDB) SetNodeRestriction(info *api.NodeRestriction) error {
+	area := sd.ReplaceArea()
+
+	tx := sd.cli.MustBegin()
+
+	cmd := fmt.Sprintf(`INSERT INTO %s (target, target_type, action, reason, operator, expire_time, created_time)
+	VALUES (:target, :target_type, :action, :reason, :operator, :expire_time, :created_time)
+	ON DUPLICATE KEY UPDATE target_type=VALUES(target_type), action=VALUES(action), reason=VALUES(reason),
+	operator=VALUES(operator), expire_time=VALUES(expire_time), created_time=VALUES(created_time)`, fmt.Sprintf(restrictionTable, area))
+	if _, err := tx.NamedExec(cmd, info); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+
+	logCmd := fmt.Sprintf(`INSERT INTO %s (target, target_type, action, op, reason, operator, created_time)
+	VALUES (:target, :target_type, :action, 'add', :reason, :operator, :created_time)`, fmt.Sprintf(restrictionLog, area))
+	if _, err := tx.NamedExec(logCmd, info); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (sd sqlDB) RemoveNodeRestriction(target, reason, operator string) error {
+	area := sd.ReplaceArea()
+
+	info := &api.NodeRestriction{}
+	cmd := fmt.Sprintf(`SELECT * FROM %s WHERE target=?`, fmt.Sprintf(restrictionTable, area))
+	if err := sd.cli.Get(info, cmd, target); err != nil {
+		if err == sql.ErrNoRows {
+			return xerrors.New(errNodeNotFind)
+		}
+		return err
+	}
+
+	tx := sd.cli.MustBegin()
+
+	cmd = fmt.Sprintf(`DELETE FROM %s WHERE target=?`, fmt.Sprintf(restrictionTable, area))
+	if _, err := tx.Exec(cmd, target); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+
+	logCmd := fmt.Sprintf(`INSERT INTO %s (target, target_type, action, op, reason, operator, created_time)
+	VALUES (?, ?, ?, 'remove', ?, ?, ?)`, fmt.Sprintf(restrictionLog, area))
+	if _, err := tx.Exec(logCmd, info.Target, info.TargetType, info.Action, reason, operator, time.Now().Unix()); err != nil {
+		tx.Rollback() //nolint:errcheck
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (sd sqlDB) GetNodeRestrictions() ([]*api.NodeRestriction, error) {
+	var out []*api.NodeRestriction
+	cmd := fmt.Sprintf(`SELECT * FROM %s`, fmt.Sprintf(restrictionTable, sd.ReplaceArea()))
+	if err := sd.cli.Select(&out, cmd); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) GetNodeRestrictionLogs(target string, limit int) ([]*api.NodeRestrictionLog, error) {
+	var out []*api.NodeRestrictionLog
+
+	tableName := fmt.Sprintf(restrictionLog, sd.ReplaceArea())
+	var err error
+	if target == "" {
+		err = sd.cli.Select(&out, fmt.Sprintf(`SELECT * FROM %s ORDER BY id DESC LIMIT ?`, tableName), limit)
+	} else {
+		err = sd.cli.Select(&out, fmt.Sprintf(`SELECT * FROM %s WHERE target=? ORDER BY id DESC LIMIT ?`, tableName), target, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) SetAreaPolicy(info *api.AreaPolicy) error {
+	cmd := fmt.Sprintf(`INSERT INTO %s (area, accept_edge, accept_candidate, max_nodes, operator, created_time)
+	VALUES (:area, :accept_edge, :accept_candidate, :max_nodes, :operator, :created_time)
+	ON DUPLICATE KEY UPDATE accept_edge=VALUES(accept_edge), accept_candidate=VALUES(accept_candidate),
+	max_nodes=VALUES(max_nodes), operator=VALUES(operator), created_time=VALUES(created_time)`, fmt.Sprintf(areaPolicyTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, info)
+	return err
+}
+
+func (sd sqlDB) RemoveAreaPolicy(area string) error {
+	cmd := fmt.Sprintf(`DELETE FROM %s WHERE area=?`, fmt.Sprintf(areaPolicyTable, sd.ReplaceArea()))
+	result, err := sd.cli.Exec(cmd, area)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return xerrors.New(errNodeNotFind)
+	}
+	return nil
+}
+
+func (sd sqlDB) GetAreaPolicies() ([]*api.AreaPolicy, error) {
+	var out []*api.AreaPolicy
+	cmd := fmt.Sprintf(`SELECT * FROM %s`, fmt.Sprintf(areaPolicyTable, sd.ReplaceArea()))
+	if err := sd.cli.Select(&out, cmd); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) SetIPAllowlist(info *api.IPAllowlist) error {
+	cmd := fmt.Sprintf(`INSERT INTO %s (target, area, reason, operator, created_time)
+	VALUES (:target, :area, :reason, :operator, :created_time)
+	ON DUPLICATE KEY UPDATE area=VALUES(area), reason=VALUES(reason), operator=VALUES(operator),
+	created_time=VALUES(created_time)`, fmt.Sprintf(ipAllowlistTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, info)
+	return err
+}
+
+func (sd sqlDB) RemoveIPAllowlist(target string) error {
+	cmd := fmt.Sprintf(`DELETE FROM %s WHERE target=?`, fmt.Sprintf(ipAllowlistTable, sd.ReplaceArea()))
+	result, err := sd.cli.Exec(cmd, target)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return xerrors.New(errNodeNotFind)
+	}
+	return nil
+}
+
+func (sd sqlDB) GetIPAllowlists() ([]*api.IPAllowlist, error) {
+	var out []*api.IPAllowlist
+	cmd := fmt.Sprintf(`SELECT * FROM %s`, fmt.Sprintf(ipAllowlistTable, sd.ReplaceArea()))
+	if err := sd.cli.Select(&out, cmd); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) AddDenylist(entries []*api.DenylistEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(`INSERT INTO %s (hash, reason, operator, created_time)
+	VALUES (:hash, :reason, :operator, :created_time)
+	ON DUPLICATE KEY UPDATE reason=VALUES(reason), operator=VALUES(operator)`, fmt.Sprintf(denylistTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, entries)
+	return err
+}
+
+func (sd sqlDB) RemoveDenylist(hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	cmd, args, err := sqlx.In(fmt.Sprintf(`DELETE FROM %s WHERE hash IN (?)`, fmt.Sprintf(denylistTable, sd.ReplaceArea())), hashes)
+	if err != nil {
+		return err
+	}
+
+	_, err = sd.cli.Exec(sd.cli.Rebind(cmd), args...)
+	return err
+}
+
+func (sd sqlDB) GetDenylist() ([]*api.DenylistEntry, error) {
+	var out []*api.DenylistEntry
+	cmd := fmt.Sprintf(`SELECT * FROM %s`, fmt.Sprintf(denylistTable, sd.ReplaceArea()))
+	if err := sd.cli.Select(&out, cmd); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) SetTenant(info *api.Tenant) error {
+	cmd := fmt.Sprintf(`INSERT INTO %s (tenant_id, name, storage_quota, replica_quota, bandwidth_quota, disabled, created_time)
+	VALUES (:tenant_id, :name, :storage_quota, :replica_quota, :bandwidth_quota, :disabled, :created_time)
+	ON DUPLICATE KEY UPDATE name=VALUES(name), storage_quota=VALUES(storage_quota), replica_quota=VALUES(replica_quota),
+	bandwidth_quota=VALUES(bandwidth_quota), disabled=VALUES(disabled)`, fmt.Sprintf(tenantTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, info)
+	return err
+}
+
+func (sd sqlDB) GetTenant(tenantID string) (*api.Tenant, error) {
+	info := &api.Tenant{}
+	cmd := fmt.Sprintf(`SELECT * FROM %s WHERE tenant_id=?`, fmt.Sprintf(tenantTable, sd.ReplaceArea()))
+	if err := sd.cli.Get(info, cmd, tenantID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (sd sqlDB) GetTenants() ([]*api.Tenant, error) {
+	var out []*api.Tenant
+	cmd := fmt.Sprintf(`SELECT * FROM %s`, fmt.Sprintf(tenantTable, sd.ReplaceArea()))
+	if err := sd.cli.Select(&out, cmd); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) GetTenantStorage(tenantID string) (int, int64, error) {
+	var out struct {
+		Carfiles int   `db:"carfiles"`
+		Size     int64 `db:"size"`
+	}
+
+	cmd := fmt.Sprintf(`SELECT count(*) AS carfiles, IFNULL(SUM(total_size*need_reliability), 0) AS size FROM %s WHERE owner=?`,
+		fmt.Sprintf(dataInfoTable, sd.ReplaceArea()))
+	if err := sd.cli.Get(&out, cmd, tenantID); err != nil {
+		return 0, 0, err
+	}
+
+	return out.Carfiles, out.Size, nil
+}
+
+func (sd sqlDB) GetRootOwners(rootCid string) ([]string, error) {
+	var out []string
+	cmd := fmt.Sprintf(`SELECT DISTINCT owner FROM %s WHERE cid=? OR root_cid=?`, fmt.Sprintf(dataInfoTable, sd.ReplaceArea()))
+	if err := sd.cli.Select(&out, cmd, rootCid, rootCid); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) AddTenantBandwidths(infos []*TenantBandwidth) error {
+	if len(infos) == 0 {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(`INSERT INTO %s (tenant_id, month, bandwidth_bytes)
+	VALUES (:tenant_id, :month, :bandwidth_bytes)
+	ON DUPLICATE KEY UPDATE bandwidth_bytes=bandwidth_bytes+VALUES(bandwidth_bytes)`, fmt.Sprintf(tenantUsageTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, infos)
+	return err
+}
+
+func (sd sqlDB) GetTenantBandwidth(tenantID, month string) (int64, error) {
+	var bytes int64
+	cmd := fmt.Sprintf(`SELECT IFNULL(SUM(bandwidth_bytes), 0) FROM %s WHERE tenant_id=? AND month=?`, fmt.Sprintf(tenantUsageTable, sd.ReplaceArea()))
+	if err := sd.cli.Get(&bytes, cmd, tenantID, month); err != nil {
+		return 0, err
+	}
+
+	return bytes, nil
+}
+
+func (sd sqlDB) AddAppDownloadUsages(usages []*api.AppDownloadUsage) error {
+	if len(usages) == 0 {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(`INSERT INTO %s (device_id, app_name, date, bytes, blocks, rejected)
+	VALUES (:device_id, :app_name, :date, :bytes, :blocks, :rejected)
+	ON DUPLICATE KEY UPDATE bytes=bytes+VALUES(bytes), blocks=blocks+VALUES(blocks),
+	rejected=rejected+VALUES(rejected)`, fmt.Sprintf(appUsageTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, usages)
+	return err
+}
+
+// GetAppDownloadUsages usage of the apps on the date, summed over devices
+func (sd sqlDB) GetAppDownloadUsages(date string) ([]*api.AppDownloadUsage, error) {
+	var out []*api.AppDownloadUsage
+	cmd := fmt.Sprintf(`SELECT app_name, date, SUM(bytes) AS bytes, SUM(blocks) AS blocks, SUM(rejected) AS rejected
+	FROM %s WHERE date=? GROUP BY app_name, date`, fmt.Sprintf(appUsageTable, sd.ReplaceArea()))
+	if err := sd.cli.Select(&out, cmd, date); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (sd sqlDB) AddDownloadViolations(violations []*api.DownloadViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(`INSERT INTO %s (device_id, scope, target, limit_kind, client_ip, app_name, count, created_time)
+	VALUES (:device_id, :scope, :target, :limit_kind, :client_ip, :app_name, :count, :created_time)`, fmt.Sprintf(violationTable, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(cmd, violations)
+	return err
+}
+
+func (sd sqlDB) GetDownloadViolations(deviceID string, limit int) ([]*api.DownloadViolation, error) {
+	var out []*api.DownloadViolation
+
+	tableName := fmt.Sprintf(violationTable, sd.ReplaceArea())
+	columns := "device_id, scope, target, limit_kind, client_ip, app_name, count, created_time"
+	var err error
+	if deviceID == "" {
+		err = sd.cli.Select(&out, fmt.Sprintf(`SELECT %s FROM %s ORDER BY id DESC LIMIT ?`, columns, tableName), limit)
+	} else {
+		err = sd.cli.Select(&out, fmt.Sprintf(`SELECT %s FROM %s WHERE device_id=? ORDER BY id DESC LIMIT ?`, columns, tableName), deviceID, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 // func (sd sqlDB) RemoveNodeWithCacheList(deviceID, cid string) error {
 // 	info := BlockNodes{
 // 		DeviceID: deviceID,
@@ -1068,6 +1534,19 @@ func (sd sqlDB) AddDownloadInfo(deviceID string, info *api.BlockDownloadInfo) er
 	return nil
 }
 
+func (sd sqlDB) AddDownloadInfos(infos []*api.BlockDownloadInfo) error {
+	if len(infos) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (block_cid, device_id, block_size, speed, reward) 
+				VALUES (:block_cid, :device_id, :block_size, :speed, :reward)`, fmt.Sprintf(blockDownloadInfo, sd.ReplaceArea()))
+
+	_, err := sd.cli.NamedExec(query, infos)
+	return err
+}
+
 func (sd sqlDB) GetDownloadInfo(deviceID string) ([]*api.BlockDownloadInfo, error) {
 	query := fmt.Sprintf(`SELECT * FROM %s WHERE device_id = ? and created_time >= TO_DAYS(NOW()) ORDER BY created_time DESC`,
 		fmt.Sprintf(blockDownloadInfo, sd.ReplaceArea()))
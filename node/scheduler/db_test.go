@@ -0,0 +1,495 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"golang.org/x/xerrors"
+)
+
+// fakeDB persistent db in memory, methods not implemented panic by the nil embedded interface
+type fakeDB struct {
+	persistent.DB
+
+	lock      sync.Mutex
+	registers map[string]*api.NodeRegisterInfo
+	// cid:devices
+	blocks map[string][]string
+	// device:blocks cached by the device
+	nodeBlocks map[string][]*persistent.BlockInfo
+	// device/hour:income
+	incomes map[string]*persistent.DeviceIncome
+	// target:restriction
+	restrictions map[string]*api.NodeRestriction
+	// area:policy
+	areaPolicies map[string]*api.AreaPolicy
+	// target:allowlist
+	allowlists map[string]*api.IPAllowlist
+	// tenant id:tenant
+	tenants map[string]*api.Tenant
+	// cid:data info
+	dataInfos map[string]*persistent.DataInfo
+	// tenant/month:bytes
+	tenantBandwidths map[string]int64
+	// cache id:data key
+	caches map[string]string
+}
+
+func newFakeDB() *fakeDB {
+	d := &fakeDB{
+		registers: make(map[string]*api.NodeRegisterInfo),
+		blocks:    make(map[string][]string),
+
+		nodeBlocks: make(map[string][]*persistent.BlockInfo),
+		incomes:    make(map[string]*persistent.DeviceIncome),
+
+		restrictions: make(map[string]*api.NodeRestriction),
+		areaPolicies: make(map[string]*api.AreaPolicy),
+		allowlists:   make(map[string]*api.IPAllowlist),
+
+		tenants:   make(map[string]*api.Tenant),
+		dataInfos: make(map[string]*persistent.DataInfo),
+
+		tenantBandwidths: make(map[string]int64),
+		caches:           make(map[string]string),
+	}
+
+	persistent.SetDB(d)
+	return d
+}
+
+func (d *fakeDB) BindRegisterInfo(secret, deviceID string, nodeType api.NodeType) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.registers[deviceID] = &api.NodeRegisterInfo{DeviceID: deviceID, Secret: secret, NodeType: int(nodeType)}
+	return nil
+}
+
+func (d *fakeDB) GetRegisterInfo(deviceID string) (*api.NodeRegisterInfo, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	info, ok := d.registers[deviceID]
+	if !ok {
+		return nil, xerrors.New("not found")
+	}
+
+	out := *info
+	return &out, nil
+}
+
+func (d *fakeDB) GetCacheCarfileID(cacheID string) (string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	carfileID, ok := d.caches[cacheID]
+	if !ok {
+		return "", xerrors.Errorf("cache %s not found", cacheID)
+	}
+	return carfileID, nil
+}
+
+func (d *fakeDB) UpdateRegisterSecret(deviceID, secret string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	info, ok := d.registers[deviceID]
+	if !ok {
+		return xerrors.New("not found")
+	}
+
+	info.Secret = secret
+	return nil
+}
+
+func (d *fakeDB) GetNodesWithCacheList(cid string) ([]string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return append([]string(nil), d.blocks[cid]...), nil
+}
+
+func (d *fakeDB) GetNodeBlocks(deviceID, cid string) ([]*persistent.NodeBlocks, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := make([]*persistent.NodeBlocks, 0)
+	for _, b := range d.nodeBlocks[deviceID] {
+		if b.CID == cid {
+			out = append(out, &persistent.NodeBlocks{DeviceID: deviceID, CID: cid, CacheID: b.CacheID})
+		}
+	}
+
+	return out, nil
+}
+
+func (d *fakeDB) GetBlockInfo(cacheID, cid, deviceID string) (*persistent.BlockInfo, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, b := range d.nodeBlocks[deviceID] {
+		if b.CacheID == cacheID && b.CID == cid {
+			out := *b
+			return &out, nil
+		}
+	}
+
+	return nil, xerrors.New("not found")
+}
+
+// fakeCache cache db in memory, methods not implemented panic by the nil embedded interface
+type fakeCache struct {
+	cache.DB
+
+	lock     sync.Mutex
+	receipts map[string]struct{}
+	// ticket id:bytes
+	ticketBytes map[string]int64
+	// client:tickets
+	clientTickets map[string]int64
+
+	rewardStats     []*cache.RewardStat
+	reputationStats []*cache.ReputationStat
+	// stats are kept if remove failed
+	removeErr   error
+	todayReward map[string]float64
+	// device:continuous validate fail times
+	validateFails map[string]int64
+	// holder of the leader lease, redis err if leaderErr is set
+	leader    string
+	leaderErr error
+	// device:nat type
+	nats map[string]string
+}
+
+func newFakeCache() *fakeCache {
+	c := &fakeCache{
+		receipts:      make(map[string]struct{}),
+		ticketBytes:   make(map[string]int64),
+		clientTickets: make(map[string]int64),
+		todayReward:   make(map[string]float64),
+
+		validateFails: make(map[string]int64),
+		nats:          make(map[string]string),
+	}
+
+	cache.SetDB(c)
+	return c
+}
+
+var errFakeNil = xerrors.New("nil")
+
+func (c *fakeCache) IsNilErr(err error) bool {
+	return err == errFakeNil
+}
+
+func (c *fakeCache) SetDownloadReceipt(ticketID, cid string, expiration time.Duration) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := ticketID + ":" + cid
+	if _, ok := c.receipts[key]; ok {
+		return false, nil
+	}
+
+	c.receipts[key] = struct{}{}
+	return true, nil
+}
+
+func (c *fakeCache) IncrClientTickets(client string, window time.Duration) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.clientTickets[client]++
+	return c.clientTickets[client], nil
+}
+
+func (c *fakeCache) IncrTicketBytes(ticketID string, size int64, expiration time.Duration) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ticketBytes[ticketID] += size
+	return c.ticketBytes[ticketID], nil
+}
+
+func (d *fakeDB) SaveDeviceIncome(info *persistent.DeviceIncome) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := *info
+	d.incomes[info.DeviceID+"/"+info.Hour] = &out
+	return nil
+}
+
+func (d *fakeDB) GetDeviceIncomes(deviceIDs []string, fromHour, toHour string) ([]*persistent.DeviceIncome, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := make([]*persistent.DeviceIncome, 0)
+	for _, deviceID := range deviceIDs {
+		for _, info := range d.incomes {
+			if info.DeviceID == deviceID && info.Hour >= fromHour && info.Hour <= toHour {
+				out = append(out, info)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func (c *fakeCache) GetRewardFormula() (api.RewardFormula, error) {
+	return api.RewardFormula{}, errFakeNil
+}
+
+func (c *fakeCache) GetDeviceInfo(deviceID string) (api.DevicesInfo, error) {
+	return api.DevicesInfo{}, errFakeNil
+}
+
+func (c *fakeCache) GetRewardStats(beforeHour string) ([]*cache.RewardStat, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	out := make([]*cache.RewardStat, 0, len(c.rewardStats))
+	for _, stat := range c.rewardStats {
+		s := *stat
+		out = append(out, &s)
+	}
+
+	return out, nil
+}
+
+func (c *fakeCache) RemoveRewardStat(deviceID, hour string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.removeErr != nil {
+		return c.removeErr
+	}
+
+	for i, stat := range c.rewardStats {
+		if stat.DeviceID == deviceID && stat.Hour == hour {
+			c.rewardStats = append(c.rewardStats[:i], c.rewardStats[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (c *fakeCache) SetDeviceTodayReward(deviceID string, reward float64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.todayReward[deviceID] = reward
+	return nil
+}
+
+func (c *fakeCache) GetReputationStats() ([]*cache.ReputationStat, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.reputationStats, nil
+}
+
+func (d *fakeDB) SetNodeRestriction(info *api.NodeRestriction) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := *info
+	d.restrictions[info.Target] = &out
+	return nil
+}
+
+func (d *fakeDB) GetNodeRestrictions() ([]*api.NodeRestriction, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := make([]*api.NodeRestriction, 0, len(d.restrictions))
+	for _, info := range d.restrictions {
+		out = append(out, info)
+	}
+
+	return out, nil
+}
+
+func (c *fakeCache) IncrNodeValidateFail(deviceID string) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.validateFails[deviceID]++
+	return c.validateFails[deviceID], nil
+}
+
+func (c *fakeCache) ResetNodeValidateFail(deviceID string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.validateFails, deviceID)
+	return nil
+}
+
+func (c *fakeCache) AcquireLeader(schedulerID string, lease time.Duration) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.leaderErr != nil {
+		return false, c.leaderErr
+	}
+
+	if c.leader != "" && c.leader != schedulerID {
+		return false, nil
+	}
+
+	c.leader = schedulerID
+	return true, nil
+}
+
+func (c *fakeCache) ReleaseLeader(schedulerID string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.leader == schedulerID {
+		c.leader = ""
+	}
+	return nil
+}
+
+func (c *fakeCache) SetDeviceNat(deviceID, natType string, natRatio float64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.nats[deviceID] = natType
+	return nil
+}
+
+func (d *fakeDB) SetAreaPolicy(info *api.AreaPolicy) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := *info
+	d.areaPolicies[info.Area] = &out
+	return nil
+}
+
+func (d *fakeDB) GetAreaPolicies() ([]*api.AreaPolicy, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := make([]*api.AreaPolicy, 0, len(d.areaPolicies))
+	for _, info := range d.areaPolicies {
+		out = append(out, info)
+	}
+
+	return out, nil
+}
+
+func (d *fakeDB) SetIPAllowlist(info *api.IPAllowlist) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := *info
+	d.allowlists[info.Target] = &out
+	return nil
+}
+
+func (d *fakeDB) GetIPAllowlists() ([]*api.IPAllowlist, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := make([]*api.IPAllowlist, 0, len(d.allowlists))
+	for _, info := range d.allowlists {
+		out = append(out, info)
+	}
+
+	return out, nil
+}
+
+func (d *fakeDB) SetTenant(tenant *api.Tenant) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := *tenant
+	d.tenants[tenant.ID] = &out
+	return nil
+}
+
+func (d *fakeDB) GetTenant(tenantID string) (*api.Tenant, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	tenant, ok := d.tenants[tenantID]
+	if !ok {
+		return nil, nil
+	}
+
+	out := *tenant
+	return &out, nil
+}
+
+func (d *fakeDB) GetDataInfo(cid string) (*persistent.DataInfo, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	info, ok := d.dataInfos[cid]
+	if !ok {
+		return nil, nil
+	}
+
+	out := *info
+	return &out, nil
+}
+
+func (d *fakeDB) GetTenantStorage(tenantID string) (int, int64, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	carfiles, size := 0, int64(0)
+	for _, info := range d.dataInfos {
+		if info.Owner == tenantID {
+			carfiles++
+			size += int64(info.TotalSize * info.NeedReliability)
+		}
+	}
+
+	return carfiles, size, nil
+}
+
+func (d *fakeDB) GetRootOwners(rootCid string) ([]string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	owners := make(map[string]struct{})
+	for _, info := range d.dataInfos {
+		if info.CID == rootCid || info.RootCID == rootCid {
+			owners[info.Owner] = struct{}{}
+		}
+	}
+
+	out := make([]string, 0, len(owners))
+	for owner := range owners {
+		out = append(out, owner)
+	}
+
+	return out, nil
+}
+
+func (d *fakeDB) AddTenantBandwidths(infos []*persistent.TenantBandwidth) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, info := range infos {
+		d.tenantBandwidths[info.TenantID+"/"+info.Month] += info.Bytes
+	}
+	return nil
+}
+
+func (d *fakeDB) GetTenantBandwidth(tenantID, month string) (int64, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.tenantBandwidths[tenantID+"/"+month], nil
+}
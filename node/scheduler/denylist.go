@@ -0,0 +1,257 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/denylist"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// version of the denylist is checked in this interval, the denylist is changed by other schedulers of the server
+	denylistCheckInterval = 10 * time.Second
+	setDenylistTimeout    = 30 * time.Second
+)
+
+// denylistCache latest signed denylist and its filter
+type denylistCache struct {
+	lock      sync.Mutex
+	list      api.Denylist
+	filter    *denylist.Filter
+	lastCheck time.Time
+}
+
+var denied = &denylistCache{filter: denylist.NewFilter()}
+
+// AddDenylist deny the cids, the carfiles of the cids are removed, return the version of denylist
+func (s *Scheduler) AddDenylist(ctx context.Context, entries []string, reason string) (int64, error) {
+	hashes, cids, err := parseDenylistEntries(entries)
+	if err != nil {
+		return 0, err
+	}
+
+	operator := handler.GetRequestIP(ctx)
+	now := time.Now().Unix()
+
+	infos := make([]*api.DenylistEntry, 0, len(hashes))
+	for _, hash := range hashes {
+		infos = append(infos, &api.DenylistEntry{Hash: hash, Reason: reason, Operator: operator, CreatedTime: now})
+	}
+
+	err = persistent.GetDB().AddDenylist(infos)
+	if err != nil {
+		return 0, err
+	}
+
+	list, err := s.updateDenylist()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range cids {
+		err = s.dataManager.removeCarfile(c)
+		if err != nil {
+			log.Warnf("AddDenylist removeCarfile %s err:%s", c, err.Error())
+		}
+	}
+
+	return list.Version, nil
+}
+
+// RemoveDenylist allow the cids again, return the version of denylist
+func (s *Scheduler) RemoveDenylist(ctx context.Context, entries []string) (int64, error) {
+	hashes, _, err := parseDenylistEntries(entries)
+	if err != nil {
+		return 0, err
+	}
+
+	err = persistent.GetDB().RemoveDenylist(hashes)
+	if err != nil {
+		return 0, err
+	}
+
+	list, err := s.updateDenylist()
+	if err != nil {
+		return 0, err
+	}
+
+	return list.Version, nil
+}
+
+// ListDenylist hashes of the denied cids with reasons
+func (s *Scheduler) ListDenylist(ctx context.Context) ([]api.DenylistEntry, error) {
+	entries, err := persistent.GetDB().GetDenylist()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.DenylistEntry, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, *entry)
+	}
+
+	return out, nil
+}
+
+// GetDenylist the signed denylist, entries are empty if the version is the latest
+func (s *Scheduler) GetDenylist(ctx context.Context, version int64) (api.Denylist, error) {
+	list, err := currentDenylist()
+	if err != nil {
+		return api.Denylist{}, err
+	}
+
+	if list.Version == version {
+		return api.Denylist{Version: version}, nil
+	}
+
+	return list, nil
+}
+
+// parseDenylistEntries hashes of the entries and the cids of the entries not hashed
+func parseDenylistEntries(entries []string) ([]string, []string, error) {
+	hashes := make([]string, 0, len(entries))
+	cids := make([]string, 0)
+	for _, entry := range entries {
+		hash, err := denylist.ParseEntry(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if hash == "" {
+			continue
+		}
+		hashes = append(hashes, hash)
+
+		if c, err := cid.Decode(strings.TrimPrefix(strings.TrimSpace(entry), "/ipfs/")); err == nil {
+			cids = append(cids, c.String())
+		}
+	}
+
+	if len(hashes) == 0 {
+		return nil, nil, xerrors.New("denylist entries is nil")
+	}
+
+	return hashes, cids, nil
+}
+
+// updateDenylist increase the version after the denylist changed, push the new denylist to nodes
+func (s *Scheduler) updateDenylist() (api.Denylist, error) {
+	_, err := cache.GetDB().IncrDenylistVersion()
+	if err != nil {
+		return api.Denylist{}, err
+	}
+
+	denied.lock.Lock()
+	denied.lastCheck = time.Time{}
+	denied.lock.Unlock()
+
+	list, err := currentDenylist()
+	if err != nil {
+		return api.Denylist{}, err
+	}
+
+	go s.nodeManager.pushDenylist(list)
+
+	return list, nil
+}
+
+// currentDenylist reload and sign the denylist if the version changed
+func currentDenylist() (api.Denylist, error) {
+	denied.lock.Lock()
+	defer denied.lock.Unlock()
+
+	if time.Since(denied.lastCheck) < denylistCheckInterval {
+		return denied.list, nil
+	}
+
+	version, err := cache.GetDB().GetDenylistVersion()
+	if err != nil && !cache.GetDB().IsNilErr(err) {
+		return api.Denylist{}, err
+	}
+
+	if version == denied.list.Version && denied.list.Signature != nil {
+		denied.lastCheck = time.Now()
+		return denied.list, nil
+	}
+
+	entries, err := persistent.GetDB().GetDenylist()
+	if err != nil {
+		return api.Denylist{}, err
+	}
+
+	hashes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		hashes = append(hashes, entry.Hash)
+	}
+
+	if ticketKey == nil {
+		return api.Denylist{}, xerrors.New("ticket key not init")
+	}
+
+	sig, err := denylist.Sign(ticketKey, version, hashes)
+	if err != nil {
+		return api.Denylist{}, err
+	}
+
+	denied.list = api.Denylist{Version: version, Entries: hashes, Signature: sig}
+	denied.filter.Set(version, hashes)
+	denied.lastCheck = time.Now()
+
+	return denied.list, nil
+}
+
+// isDenied check the cid with the denylist, the last loaded denylist is used if reload failed
+func isDenied(cid string) bool {
+	_, err := currentDenylist()
+	if err != nil {
+		log.Errorf("currentDenylist err:%s", err.Error())
+	}
+
+	return denied.filter.Denied(cid)
+}
+
+// checkTicketDenied check the cids of the download ticket
+func checkTicketDenied(cid string, ticket *token.Ticket) error {
+	cids := append([]string{cid, ticket.RootCid}, ticket.Cids...)
+	for _, c := range cids {
+		if isDenied(c) {
+			return xerrors.Errorf("cid %s is denied", c)
+		}
+	}
+
+	return nil
+}
+
+// pushDenylist set the denylist to all online nodes
+func (m *NodeManager) pushDenylist(list api.Denylist) {
+	m.edgeNodeMap.Range(func(key, value interface{}) bool {
+		node := value.(*EdgeNode)
+		setNodeDenylist(key.(string), node.nodeAPI, list)
+		return true
+	})
+
+	m.candidateNodeMap.Range(func(key, value interface{}) bool {
+		node := value.(*CandidateNode)
+		setNodeDenylist(key.(string), node.nodeAPI, list)
+		return true
+	})
+}
+
+func setNodeDenylist(deviceID string, nodeAPI api.Download, list api.Denylist) {
+	ctx, cancel := context.WithTimeout(context.Background(), setDenylistTimeout)
+	defer cancel()
+
+	err := nodeAPI.SetDenylist(ctx, list)
+	if err != nil {
+		log.Warnf("SetDenylist err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+}
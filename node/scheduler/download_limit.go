@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+)
+
+const setDownloadLimitsTimeout = 10 * time.Second
+
+// SetDownloadLimits save the download limits and push them to the online nodes
+func (s *Scheduler) SetDownloadLimits(ctx context.Context, limits api.DownloadLimits) error {
+	err := cache.GetDB().SetDownloadLimits(limits)
+	if err != nil {
+		return err
+	}
+
+	go s.nodeManager.pushDownloadLimits(limits)
+
+	return nil
+}
+
+// GetDownloadLimits get the download limits of nodes
+func (s *Scheduler) GetDownloadLimits(ctx context.Context) (api.DownloadLimits, error) {
+	return getDownloadLimits(), nil
+}
+
+// SubmitDownloadUsage save the app usage and limit violations of the node download server
+func (s *Scheduler) SubmitDownloadUsage(ctx context.Context, token string, report api.DownloadUsageReport) error {
+	deviceID, err := nodeOfRequest(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	usages := make([]*api.AppDownloadUsage, 0, len(report.Apps))
+	for i := range report.Apps {
+		usage := &report.Apps[i]
+		usage.DeviceID = deviceID
+		usages = append(usages, usage)
+	}
+
+	violations := make([]*api.DownloadViolation, 0, len(report.Violations))
+	for i := range report.Violations {
+		v := &report.Violations[i]
+		v.DeviceID = deviceID
+		violations = append(violations, v)
+	}
+
+	err = persistent.GetDB().AddAppDownloadUsages(usages)
+	if err != nil {
+		return err
+	}
+
+	return persistent.GetDB().AddDownloadViolations(violations)
+}
+
+// GetAppDownloadUsages usage of the apps on the date, for billing
+func (s *Scheduler) GetAppDownloadUsages(ctx context.Context, date string) ([]api.AppDownloadUsage, error) {
+	if date == "" {
+		date = time.Now().Format(dateLayout)
+	}
+
+	usages, err := persistent.GetDB().GetAppDownloadUsages(date)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.AppDownloadUsage, 0, len(usages))
+	for _, usage := range usages {
+		out = append(out, *usage)
+	}
+
+	return out, nil
+}
+
+// GetDownloadViolations latest limit violations of the device, all devices if deviceID is empty
+func (s *Scheduler) GetDownloadViolations(ctx context.Context, deviceID string, limit int) ([]api.DownloadViolation, error) {
+	violations, err := persistent.GetDB().GetDownloadViolations(deviceID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.DownloadViolation, 0, len(violations))
+	for _, v := range violations {
+		out = append(out, *v)
+	}
+
+	return out, nil
+}
+
+func getDownloadLimits() api.DownloadLimits {
+	limits, err := cache.GetDB().GetDownloadLimits()
+	if err != nil && !cache.GetDB().IsNilErr(err) {
+		log.Errorf("GetDownloadLimits err:%s", err.Error())
+	}
+
+	return limits
+}
+
+// pushDownloadLimits set the limits to all online nodes
+func (m *NodeManager) pushDownloadLimits(limits api.DownloadLimits) {
+	m.edgeNodeMap.Range(func(key, value interface{}) bool {
+		node := value.(*EdgeNode)
+		setNodeDownloadLimits(key.(string), node.nodeAPI, limits)
+		return true
+	})
+
+	m.candidateNodeMap.Range(func(key, value interface{}) bool {
+		node := value.(*CandidateNode)
+		setNodeDownloadLimits(key.(string), node.nodeAPI, limits)
+		return true
+	})
+}
+
+// initDownloadLimits set the limits to the node connected
+func initDownloadLimits(deviceID string, nodeAPI api.Download) {
+	setNodeDownloadLimits(deviceID, nodeAPI, getDownloadLimits())
+}
+
+func setNodeDownloadLimits(deviceID string, nodeAPI api.Download, limits api.DownloadLimits) {
+	ctx, cancel := context.WithTimeout(context.Background(), setDownloadLimitsTimeout)
+	defer cancel()
+
+	err := nodeAPI.SetDownloadLimits(ctx, limits)
+	if err != nil {
+		log.Warnf("SetDownloadLimits err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+}
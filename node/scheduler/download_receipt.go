@@ -0,0 +1,163 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"golang.org/x/xerrors"
+)
+
+// receipts can submit until this time after the ticket expired
+const receiptSubmitGrace = 24 * time.Hour
+
+// verifyReceipt check the receipt is signed by the user of the ticket, the user is not the node itself at nodeIP,
+// and the block is cached by the node with the same size, return the cache of the block
+func verifyReceipt(deviceID, nodeIP string, receipt *api.DownloadReceipt) (string, error) {
+	if ticketKey == nil {
+		return "", xerrors.New("ticket key not init")
+	}
+
+	if receipt.DeviceID != deviceID {
+		return "", xerrors.Errorf("receipt device %s mismatch %s", receipt.DeviceID, deviceID)
+	}
+
+	ticket, err := token.ParseIssuedTicket(receipt.Ticket, &ticketKey.PublicKey)
+	if err != nil {
+		return "", xerrors.Errorf("ticket err:%s", err.Error())
+	}
+
+	if ticket.Audience != deviceID {
+		return "", xerrors.Errorf("ticket device %s mismatch %s", ticket.Audience, deviceID)
+	}
+
+	expireAt := time.Unix(ticket.ExpiresAt, 0)
+	if time.Now().After(expireAt.Add(receiptSubmitGrace)) {
+		return "", xerrors.Errorf("ticket %s expired", ticket.Id)
+	}
+
+	if receipt.Time < ticket.IssuedAt || receipt.Time > ticket.ExpiresAt {
+		return "", xerrors.Errorf("receipt time %d out of ticket %s", receipt.Time, ticket.Id)
+	}
+
+	if len(ticket.ClientKey) == 0 {
+		return "", xerrors.Errorf("ticket %s without client key", ticket.Id)
+	}
+
+	// the node downloads from itself to get receipts
+	if nodeIP != "" && ticket.ClientIP == nodeIP {
+		return "", xerrors.Errorf("client ip %s of ticket %s is the node ip", ticket.ClientIP, ticket.Id)
+	}
+
+	digest := token.ReceiptDigest(receipt.Cid, receipt.Size, receipt.DeviceID, receipt.Time, receipt.Ticket)
+	if err := token.VerifyReceipt(ticket.ClientKey, digest, receipt.Sign); err != nil {
+		return "", err
+	}
+
+	blocks, err := persistent.GetDB().GetNodeBlocks(deviceID, receipt.Cid)
+	if err != nil {
+		return "", err
+	}
+
+	var block *persistent.NodeBlocks
+	for _, b := range blocks {
+		if ticket.HasCid(receipt.Cid) || receipt.Cid == ticket.RootCid || b.CarfileID == ticket.RootCid {
+			block = b
+			break
+		}
+	}
+
+	if block == nil {
+		return "", xerrors.Errorf("cid %s not in ticket %s or not cached by node", receipt.Cid, ticket.Id)
+	}
+
+	info, err := persistent.GetDB().GetBlockInfo(block.CacheID, receipt.Cid, deviceID)
+	if err != nil {
+		return "", err
+	}
+
+	if int64(info.Size) != receipt.Size {
+		return "", xerrors.Errorf("receipt size %d mismatch block size %d", receipt.Size, info.Size)
+	}
+
+	expiration := time.Until(expireAt.Add(receiptSubmitGrace))
+
+	// bytes of the ticket are counted before the receipt marked submitted, and given back if the receipt rejected
+	if ticket.MaxBytes > 0 {
+		total, err := cache.GetDB().IncrTicketBytes(ticket.Id, receipt.Size, expiration)
+		if err != nil {
+			return "", err
+		}
+
+		if total > ticket.MaxBytes {
+			rollbackTicketBytes(ticket.Id, receipt.Size, expiration)
+			return "", xerrors.Errorf("ticket %s exceed max bytes %d", ticket.Id, ticket.MaxBytes)
+		}
+	}
+
+	ok, err := cache.GetDB().SetDownloadReceipt(ticket.Id, receipt.Cid, expiration)
+	if err != nil || !ok {
+		if ticket.MaxBytes > 0 {
+			rollbackTicketBytes(ticket.Id, receipt.Size, expiration)
+		}
+
+		if err != nil {
+			return "", err
+		}
+		return "", xerrors.Errorf("receipt of ticket %s cid %s already submitted", ticket.Id, receipt.Cid)
+	}
+
+	return block.CacheID, nil
+}
+
+func rollbackTicketBytes(ticketID string, size int64, expiration time.Duration) {
+	_, err := cache.GetDB().IncrTicketBytes(ticketID, -size, expiration)
+	if err != nil {
+		log.Errorf("rollbackTicketBytes err:%s,ticket:%s", err.Error(), ticketID)
+	}
+}
+
+// submitReceipts count the verified receipts into reward stats,
+// rejected receipts are counted as suspicious behavior of the node
+func submitReceipts(deviceID, nodeIP string, receipts []api.DownloadReceipt) (api.DownloadReceiptResult, error) {
+	result := api.DownloadReceiptResult{}
+	cacheBytes := make(map[string]int64)
+
+	for i := range receipts {
+		receipt := &receipts[i]
+
+		cacheID, err := verifyReceipt(deviceID, nodeIP, receipt)
+		if err != nil {
+			log.Warnf("submitReceipts deviceID:%s,cid:%s,verifyReceipt err:%s", deviceID, receipt.Cid, err.Error())
+			result.Rejected++
+			continue
+		}
+
+		incrRewardStat(deviceID, cache.RewardFieldDownloadBytes, float64(receipt.Size))
+		incrRewardStat(deviceID, cache.RewardFieldDownloadCount, 1)
+		cacheBytes[cacheID] += receipt.Size
+
+		result.Accepted++
+	}
+
+	if len(cacheBytes) > 0 {
+		addTenantBandwidth(cacheBytes)
+	}
+
+	if result.Accepted > 0 {
+		incrReputation(deviceID, cache.ReputationFieldDownloadSuccess, float64(result.Accepted))
+	}
+
+	if result.Rejected > 0 {
+		incrReputation(deviceID, cache.ReputationFieldDownloadFail, float64(result.Rejected))
+
+		err := cache.GetDB().IncrNodeSuspicious(deviceID, int64(result.Rejected))
+		if err != nil {
+			log.Errorf("submitReceipts IncrNodeSuspicious err:%s,deviceID:%s", err.Error(), deviceID)
+		}
+	}
+
+	return result, nil
+}
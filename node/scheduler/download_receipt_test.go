@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+)
+
+type testClient struct {
+	key    *ecdsa.PrivateKey
+	pubDER []byte
+}
+
+func newTestClient(t *testing.T) *testClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testClient{key: key, pubDER: der}
+}
+
+func (c *testClient) receipt(t *testing.T, signedTicket, deviceID, cid string, size int64) api.DownloadReceipt {
+	receipt := api.DownloadReceipt{Cid: cid, Size: size, DeviceID: deviceID, Time: time.Now().Unix(), Ticket: signedTicket}
+
+	digest := token.ReceiptDigest(receipt.Cid, receipt.Size, receipt.DeviceID, receipt.Time, receipt.Ticket)
+	sign, err := token.SignReceipt(c.key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt.Sign = sign
+	return receipt
+}
+
+func initTestTicketKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticketKey = key
+}
+
+func TestVerifyReceipt(t *testing.T) {
+	initTestTicketKey(t)
+	d := newFakeDB()
+	c := newFakeCache()
+
+	d.nodeBlocks["e_1"] = []*persistent.BlockInfo{
+		{CacheID: "cache1", CID: "a", DeviceID: "e_1", Size: 60},
+		{CacheID: "cache1", CID: "b", DeviceID: "e_1", Size: 60},
+		{CacheID: "cache1", CID: "c", DeviceID: "e_1", Size: 30},
+	}
+
+	client := newTestClient(t)
+	signed, err := issueTicket("e_1", &token.Ticket{Cids: []string{"a", "b", "c"}, MaxBytes: 100, ClientKey: client.pubDER}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt := client.receipt(t, signed, "e_1", "a", 60)
+	cacheID, err := verifyReceipt("e_1", "", &receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cacheID != "cache1" {
+		t.Errorf("cache of the block %s", cacheID)
+	}
+
+	if _, err := verifyReceipt("e_1", "", &receipt); err == nil {
+		t.Error("receipt submitted twice is accepted")
+	}
+
+	// the replayed receipt does not use the bytes of the ticket
+	over := client.receipt(t, signed, "e_1", "b", 60)
+	if _, err := verifyReceipt("e_1", "", &over); err == nil {
+		t.Error("receipt over max bytes is accepted")
+	}
+
+	last := client.receipt(t, signed, "e_1", "c", 30)
+	if _, err := verifyReceipt("e_1", "", &last); err != nil {
+		t.Errorf("receipt in max bytes: %v", err)
+	}
+
+	if c.ticketBytes[ticketID(t, signed)] != 90 {
+		t.Errorf("ticket bytes %d", c.ticketBytes[ticketID(t, signed)])
+	}
+
+	// receipt rejected by max bytes is not marked submitted
+	if _, ok := c.receipts[ticketID(t, signed)+":b"]; ok {
+		t.Error("receipt over max bytes is marked submitted")
+	}
+}
+
+func TestVerifyReceiptInvalid(t *testing.T) {
+	initTestTicketKey(t)
+	d := newFakeDB()
+	newFakeCache()
+
+	d.nodeBlocks["e_1"] = []*persistent.BlockInfo{{CacheID: "cache1", CID: "a", DeviceID: "e_1", Size: 60}}
+
+	client := newTestClient(t)
+	signed, err := issueTicket("e_1", &token.Ticket{Cids: []string{"a"}, ClientKey: client.pubDER}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestClient(t)
+	forged := other.receipt(t, signed, "e_1", "a", 60)
+
+	wrongSize := client.receipt(t, signed, "e_1", "a", 61)
+	notCached := client.receipt(t, signed, "e_1", "b", 60)
+	otherDevice := client.receipt(t, signed, "e_2", "a", 60)
+
+	tampered := client.receipt(t, signed, "e_1", "a", 60)
+	tampered.Time++
+
+	cases := map[string]api.DownloadReceipt{
+		"not signed by the client of the ticket": forged,
+		"size mismatch":                          wrongSize,
+		"block not cached":                       notCached,
+		"receipt of other device":                otherDevice,
+		"receipt changed after signed":           tampered,
+	}
+
+	for name, receipt := range cases {
+		receipt := receipt
+		if _, err := verifyReceipt("e_1", "", &receipt); err == nil {
+			t.Errorf("%s is accepted", name)
+		}
+	}
+
+	valid := client.receipt(t, signed, "e_1", "a", 60)
+	if _, err := verifyReceipt("e_1", "", &valid); err != nil {
+		t.Errorf("valid receipt: %v", err)
+	}
+}
+
+func ticketID(t *testing.T, signed string) string {
+	ticket, err := token.ParseIssuedTicket(signed, &ticketKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ticket.Id
+}
+
+func TestVerifyReceiptSelfServed(t *testing.T) {
+	initTestTicketKey(t)
+	d := newFakeDB()
+	newFakeCache()
+
+	d.nodeBlocks["e_1"] = []*persistent.BlockInfo{{CacheID: "cache1", CID: "a", DeviceID: "e_1", Size: 60}}
+
+	client := newTestClient(t)
+	signed, err := issueTicket("e_1", &token.Ticket{ClientIP: "1.1.1.1", Cids: []string{"a"}, ClientKey: client.pubDER}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt := client.receipt(t, signed, "e_1", "a", 60)
+	if _, err := verifyReceipt("e_1", "1.1.1.1", &receipt); err == nil {
+		t.Error("receipt of the ticket of the node ip is accepted")
+	}
+
+	if _, err := verifyReceipt("e_1", "2.2.2.2", &receipt); err != nil {
+		t.Errorf("receipt of other client: %v", err)
+	}
+}
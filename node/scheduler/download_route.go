@@ -0,0 +1,233 @@
+package scheduler
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"github.com/linguohua/titan/region"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// distance of this value score 0.5
+	routeDistanceRefKm = 500.0
+	// download speed (B/s) of this value score 0.5
+	routeSpeedRef = 1024 * 1024.0
+	// served bytes are counted in window
+	routeLoadWindow = time.Minute
+	// weight of the new download speed in the moving average
+	routeSpeedAlpha = 0.2
+	// random jitter spread the traffic of nodes with similar score
+	routeJitter = 0.05
+	// candidates are fallback of edges, the score is comparable across schedulers
+	candidateRouteFactor = 0.5
+
+	distanceWeight   = 0.35
+	throughputWeight = 0.2
+	reputationWeight = 0.2
+	headroomWeight   = 0.25
+
+	// max fallback nodes return to user
+	maxDownloadFallbacks = 5
+)
+
+// routeStats recent download stats of devices, deviceID:*routeStat
+var routeStats sync.Map
+
+type routeStat struct {
+	lk sync.Mutex
+	// moving average of download speed reported by node
+	speed float64
+	// bytes served in current window
+	windowStart time.Time
+	windowBytes float64
+	// bytes per second of last window
+	lastRate float64
+}
+
+// recordDownloadStat update the throughput and load of the node
+func recordDownloadStat(stat api.DownloadStat) {
+	v, _ := routeStats.LoadOrStore(stat.DeviceID, &routeStat{windowStart: time.Now()})
+	rs := v.(*routeStat)
+
+	rs.lk.Lock()
+	defer rs.lk.Unlock()
+
+	if stat.DownloadSpeed > 0 {
+		if rs.speed == 0 {
+			rs.speed = float64(stat.DownloadSpeed)
+		} else {
+			rs.speed = routeSpeedAlpha*float64(stat.DownloadSpeed) + (1-routeSpeedAlpha)*rs.speed
+		}
+	}
+
+	rs.rotate()
+	rs.windowBytes += float64(stat.BlockSize)
+}
+
+func (rs *routeStat) rotate() {
+	elapsed := time.Since(rs.windowStart)
+	if elapsed < routeLoadWindow {
+		return
+	}
+
+	if elapsed < 2*routeLoadWindow {
+		rs.lastRate = rs.windowBytes / elapsed.Seconds()
+	} else {
+		// no download in last window
+		rs.lastRate = 0
+	}
+	rs.windowStart = time.Now()
+	rs.windowBytes = 0
+}
+
+// throughput and upload rate of the node, 0 is unknown
+func getRouteStat(deviceID string) (speed, rate float64) {
+	v, ok := routeStats.Load(deviceID)
+	if !ok {
+		return 0, 0
+	}
+
+	rs := v.(*routeStat)
+	rs.lk.Lock()
+	defer rs.lk.Unlock()
+
+	rs.rotate()
+	return rs.speed, rs.lastRate
+}
+
+// routeScore score of the node to serve the client, higher is better
+func routeScore(node *Node, clientGeo *region.GeoInfo) float64 {
+	distance := 0.5
+	if km, ok := region.DistanceKm(clientGeo, node.geoInfo); ok {
+		distance = routeDistanceRefKm / (routeDistanceRefKm + km)
+	}
+
+	speed, rate := getRouteStat(node.deviceInfo.DeviceId)
+
+	throughput := 0.5
+	if speed > 0 {
+		throughput = speed / (speed + routeSpeedRef)
+	}
+
+	// upload speed limit set by SetDownloadSpeed
+	headroom := 0.5
+	if limit := node.deviceInfo.BandwidthUp; limit > 0 {
+		headroom = 1 - math.Min(rate/limit, 1)
+	}
+
+	reputation := reputationScore(node.deviceInfo.DeviceId) / 100
+
+	return distanceWeight*distance +
+		throughputWeight*throughput +
+		reputationWeight*reputation +
+		headroomWeight*headroom
+}
+
+type routeNode struct {
+	node        *Node
+	downloadAPI api.Download
+	score       float64
+}
+
+// rankDownloadNodes online holders of the cid, ordered by route score,
+// edges are prior to candidates, the same isp nodes as the client are prior to others
+func (m *NodeManager) rankDownloadNodes(cid, clientIP string) ([]*routeNode, error) {
+	deviceIDs, err := persistent.GetDB().GetNodesWithCacheList(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deviceIDs) <= 0 {
+		return nil, xerrors.Errorf("%s , whit cid:%s", ErrNodeNotFind, cid)
+	}
+
+	var clientGeo *region.GeoInfo
+	if clientIP != "" {
+		clientGeo, err = region.GetRegion().GetGeoInfo(clientIP)
+		if err != nil {
+			log.Warnf("rankDownloadNodes GetGeoInfo err:%s,ip:%s", err.Error(), clientIP)
+		}
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rank := func(list []*routeNode, factor float64) []*routeNode {
+		for _, n := range list {
+			n.score = factor * ispRouteFactor(n.node, clientGeo) * routeScore(n.node, clientGeo) * (1 + routeJitter*r.Float64())
+		}
+
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].score > list[j].score
+		})
+		return list
+	}
+
+	edges := make([]*routeNode, 0)
+	for _, node := range m.findEdgeNodes(deviceIDs, nil) {
+		// users can not connect to the edge behind restricted nat
+		if !m.reachabilityManager.isRoutable(node.deviceInfo.DeviceId) {
+			continue
+		}
+		// the edge in reverse mode is downloaded through the relay
+		if node.reverse && node.relayURL == "" {
+			continue
+		}
+		edges = append(edges, &routeNode{node: &node.Node, downloadAPI: node.nodeAPI})
+	}
+
+	candidates := make([]*routeNode, 0)
+	for _, node := range m.findCandidateNodes(deviceIDs, nil) {
+		candidates = append(candidates, &routeNode{node: &node.Node, downloadAPI: node.nodeAPI})
+	}
+
+	out := append(rank(edges, 1), rank(candidates, candidateRouteFactor)...)
+	if len(out) == 0 {
+		return nil, xerrors.Errorf("%s , whit cid:%s", ErrNodeNotFind, cid)
+	}
+
+	return out, nil
+}
+
+// findNodeDownloadInfos download infos of the best nodes for the client, the first is preferred
+func (m *NodeManager) findNodeDownloadInfos(cid, clientIP string, max int) ([]api.DownloadInfo, []string, error) {
+	nodes, err := m.rankDownloadNodes(cid, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	infos := make([]api.DownloadInfo, 0, max)
+	deviceIDs := make([]string, 0, max)
+	for _, n := range nodes {
+		if len(infos) >= max {
+			break
+		}
+
+		// the client is the node itself, its receipts inflate the rewards
+		if clientIP != "" && n.node.deviceInfo.ExternalIp == clientIP {
+			continue
+		}
+
+		info, err := n.downloadAPI.GetDownloadInfo(context.Background())
+		if err != nil {
+			log.Warnf("findNodeDownloadInfos GetDownloadInfo err:%s,deviceID:%s", err.Error(), n.node.deviceInfo.DeviceId)
+			continue
+		}
+		info.URL = relayDownloadURL(n.node, info.URL)
+		info.Score = n.score
+
+		infos = append(infos, info)
+		deviceIDs = append(deviceIDs, n.node.deviceInfo.DeviceId)
+	}
+
+	if len(infos) == 0 {
+		return nil, nil, xerrors.Errorf("%s , whit cid:%s", ErrNodeNotFind, cid)
+	}
+
+	return infos, deviceIDs, nil
+}
@@ -0,0 +1,242 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/cert"
+	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/repo"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"golang.org/x/xerrors"
+)
+
+const (
+	ticketKeyName = "download-ticket-private"
+
+	// user download ticket expire time
+	downloadTicketExpireAfter = 30 * time.Minute
+	// node cache ticket expire time, cache requests may wait in node queue
+	cacheTicketExpireAfter = 2 * time.Hour
+
+	// a client ip or client key can get the tickets in the window,
+	// the receipts of the clients are rewarded only in the tickets
+	clientTicketWindow = time.Hour
+	maxClientTickets   = 3600
+)
+
+// key to sign download tickets, nodes verify tickets with the public key
+var ticketKey *ecdsa.PrivateKey
+
+func initTicketKey(lr repo.LockedRepo) error {
+	key, err := cert.LoadOrCreateKey(lr, ticketKeyName)
+	if err != nil {
+		return err
+	}
+
+	ticketKey = key
+	return nil
+}
+
+func ticketPublicKey() ([]byte, error) {
+	if ticketKey == nil {
+		return nil, xerrors.New("ticket key not init")
+	}
+
+	return x509.MarshalPKIXPublicKey(&ticketKey.PublicKey)
+}
+
+// issueTicket sign the download ticket of the blocks on device
+func issueTicket(deviceID string, ticket *token.Ticket, expireAfter time.Duration) (string, error) {
+	if ticketKey == nil {
+		return "", xerrors.New("ticket key not init")
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	ticket.StandardClaims = jwt.StandardClaims{
+		Id:        id.String(),
+		Audience:  deviceID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(expireAfter).Unix(),
+	}
+
+	return token.GenerateTicket(ticketKey, ticket)
+}
+
+// newTicketWithReq check the ticket request, return the ticket and the cid to find node
+func newTicketWithReq(ctx context.Context, req api.DownloadTicketReq) (*token.Ticket, string, error) {
+	cid := req.RootCid
+	if cid == "" {
+		if len(req.Cids) < 1 {
+			return nil, "", xerrors.New(ErrCidIsNil)
+		}
+		cid = req.Cids[0]
+	}
+
+	if req.MaxBytes < 0 {
+		return nil, "", xerrors.Errorf("max bytes err:%d", req.MaxBytes)
+	}
+
+	// nodes get receipts by the tickets of themselves
+	if deviceID := handler.GetPeerID(ctx); deviceID != "" {
+		return nil, "", xerrors.Errorf("node %s can not request download ticket", deviceID)
+	}
+
+	ip := handler.GetRequestIP(ctx)
+	if req.ClientIP != "" && req.ClientIP != ip {
+		// only locator can request ticket for other client
+		if !auth.HasPerm(ctx, nil, api.PermAdmin) {
+			return nil, "", xerrors.Errorf("no permission to set client ip %s", req.ClientIP)
+		}
+		ip = req.ClientIP
+	}
+
+	ticket := &token.Ticket{
+		ClientIP:  ip,
+		Cids:      req.Cids,
+		RootCid:   req.RootCid,
+		MaxBytes:  req.MaxBytes,
+		ClientKey: req.ClientKey,
+	}
+
+	if err := checkTicketRate(ticket); err != nil {
+		return nil, "", err
+	}
+
+	return ticket, cid, nil
+}
+
+// checkTicketRate the tickets of the client ip and the client key are limited in the window
+func checkTicketRate(ticket *token.Ticket) error {
+	clients := []string{"ip:" + ticket.ClientIP}
+	if len(ticket.ClientKey) > 0 {
+		h := sha256.Sum256(ticket.ClientKey)
+		clients = append(clients, "key:"+hex.EncodeToString(h[:16]))
+	}
+
+	for _, client := range clients {
+		count, err := cache.GetDB().IncrClientTickets(client, clientTicketWindow)
+		if err != nil {
+			return err
+		}
+
+		if count > maxClientTickets {
+			return xerrors.Errorf("tickets of client %s exceed %d in %s", client, maxClientTickets, clientTicketWindow)
+		}
+	}
+
+	return nil
+}
+
+// newDownloadInfo find the best node with the cid and issue a download ticket of the node
+func (s *Scheduler) newDownloadInfo(cid string, ticket *token.Ticket) (api.DownloadInfo, error) {
+	if err := checkTicketDenied(cid, ticket); err != nil {
+		return api.DownloadInfo{}, err
+	}
+
+	if err := checkTicketBandwidth(ticket); err != nil {
+		return api.DownloadInfo{}, err
+	}
+
+	holders, err := cidHolders(ticket.Cids)
+	if err != nil {
+		return api.DownloadInfo{}, err
+	}
+
+	info, deviceID, err := s.nodeManager.findNodeDownloadInfo(cid, ticket.ClientIP)
+	if err != nil {
+		return info, err
+	}
+
+	tk, err := issueTicket(deviceID, ticketOfDevice(ticket, deviceID, holders), downloadTicketExpireAfter)
+	if err != nil {
+		return api.DownloadInfo{}, err
+	}
+
+	info.Token = tk
+	return info, nil
+}
+
+// newDownloadInfos ordered fallback nodes with the cid, every node has its own ticket
+func (s *Scheduler) newDownloadInfos(cid string, ticket *token.Ticket, max int) ([]api.DownloadInfo, error) {
+	if err := checkTicketDenied(cid, ticket); err != nil {
+		return nil, err
+	}
+
+	if err := checkTicketBandwidth(ticket); err != nil {
+		return nil, err
+	}
+
+	holders, err := cidHolders(ticket.Cids)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, deviceIDs, err := s.nodeManager.findNodeDownloadInfos(cid, ticket.ClientIP, max)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range infos {
+		tk, err := issueTicket(deviceIDs[i], ticketOfDevice(ticket, deviceIDs[i], holders), downloadTicketExpireAfter)
+		if err != nil {
+			return nil, err
+		}
+
+		infos[i].Token = tk
+	}
+
+	return infos, nil
+}
+
+// cidHolders cid:devices hold the block of the cid
+func cidHolders(cids []string) (map[string]map[string]struct{}, error) {
+	holders := make(map[string]map[string]struct{}, len(cids))
+	for _, cid := range cids {
+		if _, ok := holders[cid]; ok {
+			continue
+		}
+
+		deviceIDs, err := persistent.GetDB().GetNodesWithCacheList(cid)
+		if err != nil {
+			return nil, err
+		}
+
+		devices := make(map[string]struct{}, len(deviceIDs))
+		for _, deviceID := range deviceIDs {
+			devices[deviceID] = struct{}{}
+		}
+		holders[cid] = devices
+	}
+
+	return holders, nil
+}
+
+// ticketOfDevice copy of the ticket with only the cids held by the device,
+// the ticket can not download the blocks from the device which does not hold them
+func ticketOfDevice(ticket *token.Ticket, deviceID string, holders map[string]map[string]struct{}) *token.Ticket {
+	t := *ticket
+	t.Cids = make([]string, 0, len(ticket.Cids))
+	for _, cid := range ticket.Cids {
+		if _, ok := holders[cid][deviceID]; ok {
+			t.Cids = append(t.Cids, cid)
+		}
+	}
+
+	return &t
+}
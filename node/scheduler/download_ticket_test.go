@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/handler"
+)
+
+func TestTicketOfDevice(t *testing.T) {
+	d := newFakeDB()
+	d.blocks["a"] = []string{"e_1", "e_2"}
+	d.blocks["b"] = []string{"e_1"}
+	d.blocks["c"] = []string{"e_2"}
+
+	ticket := &token.Ticket{Cids: []string{"a", "b", "c", "d"}, MaxBytes: 100}
+
+	holders, err := cidHolders(ticket.Cids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]string{
+		"e_1": {"a", "b"},
+		"e_2": {"a", "c"},
+		"e_3": {},
+	}
+
+	for deviceID, cids := range cases {
+		out := ticketOfDevice(ticket, deviceID, holders)
+		if !reflect.DeepEqual(out.Cids, cids) {
+			t.Errorf("cids of %s: got %v, want %v", deviceID, out.Cids, cids)
+		}
+
+		if out.MaxBytes != ticket.MaxBytes {
+			t.Errorf("max bytes of %s changed", deviceID)
+		}
+	}
+
+	if len(ticket.Cids) != 4 {
+		t.Error("cids of the requested ticket changed")
+	}
+}
+
+func TestTicketRequest(t *testing.T) {
+	c := newFakeCache()
+
+	ctx := context.WithValue(context.Background(), handler.RequestIP{}, "1.1.1.1")
+	req := api.DownloadTicketReq{Cids: []string{"a"}, ClientKey: []byte("client key")}
+
+	ticket, cid, err := newTicketWithReq(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cid != "a" || ticket.ClientIP != "1.1.1.1" {
+		t.Errorf("ticket of cid %s ip %s", cid, ticket.ClientIP)
+	}
+
+	nodeCtx := context.WithValue(ctx, handler.PeerID{}, "e_1")
+	if _, _, err := newTicketWithReq(nodeCtx, req); err == nil {
+		t.Error("node request ticket")
+	}
+
+	if _, _, err := newTicketWithReq(ctx, api.DownloadTicketReq{Cids: []string{"a"}, ClientIP: "2.2.2.2"}); err == nil {
+		t.Error("client set ip of other client")
+	}
+
+	c.clientTickets["ip:1.1.1.1"] = maxClientTickets
+	if _, _, err := newTicketWithReq(ctx, req); err == nil {
+		t.Error("tickets of client ip over limit")
+	}
+
+	// the client key is limited from other ips
+	for client := range c.clientTickets {
+		c.clientTickets[client] = maxClientTickets
+	}
+	otherCtx := context.WithValue(context.Background(), handler.RequestIP{}, "3.3.3.3")
+	if _, _, err := newTicketWithReq(otherCtx, req); err == nil {
+		t.Error("tickets of client key over limit")
+	}
+
+	if _, _, err := newTicketWithReq(otherCtx, api.DownloadTicketReq{Cids: []string{"a"}}); err != nil {
+		t.Errorf("ticket of other client: %v", err)
+	}
+}
@@ -20,6 +20,9 @@ func (e *Election) initElectionTask() {
 	// election timewheel
 	e.timewheelElection = timewheel.New(time.Second, 3600, func(_ interface{}) {
 		e.timewheelElection.AddTimer((time.Duration(e.electionTime)*60-1)*time.Second, "election", nil)
+		if !isLeader() {
+			return
+		}
 		err := e.startElection()
 		if err != nil {
 			log.Panicf("startElection err:%s", err.Error())
@@ -9,9 +9,11 @@ import (
 
 	// "github.com/linguohua/titan/node/device"
 
+	"github.com/filecoin-project/go-jsonrpc/auth"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/api/client"
+	"github.com/linguohua/titan/lib/token"
 	"github.com/linguohua/titan/node/common"
 	"github.com/linguohua/titan/node/handler"
 
@@ -20,6 +22,7 @@ import (
 	"github.com/linguohua/titan/node/scheduler/db/cache"
 	"github.com/linguohua/titan/node/scheduler/db/persistent"
 	"github.com/linguohua/titan/node/secret"
+	"github.com/linguohua/titan/region"
 	"golang.org/x/xerrors"
 )
 
@@ -43,6 +46,12 @@ const (
 	ErrCidIsNil = "Cid Is Nil"
 	// ErrCacheIDIsNil
 	ErrCacheIDIsNil = "CacheID Is Nil"
+	// ErrSelectorInvalid carfile selector invalid
+	ErrSelectorInvalid = "Selector Invalid"
+	// ErrSecretMismatch secret mismatch or revoked
+	ErrSecretMismatch = "Secret Mismatch"
+	// ErrSchedulerStandby scheduler is not the leader of the server
+	ErrSchedulerStandby = "Scheduler Is Standby"
 )
 
 const (
@@ -60,16 +69,30 @@ func NewLocalScheduleNode(lr repo.LockedRepo, port int) api.Scheduler {
 	election := newElection(pool)
 	validate := newValidate(pool, manager)
 	dataManager := newDataManager(manager)
+	rewardManager := newRewardManager(manager)
+	reputationManager := newReputationManager(manager)
+	leaderElector := newLeaderElector(func() {
+		// recover the state of the failed leader
+		dataManager.recoverRunningTasks()
+		reputationManager.updateReputations()
+	}, func() {
+		// nodes reconnect to the new leader by locator
+		manager.disconnectAllNodes()
+		dataManager.clearRunningTasks()
+	})
 
 	s := &Scheduler{
-		CommonAPI:      common.NewCommonAPI(manager.updateLastRequestTime),
-		nodeManager:    manager,
-		validatePool:   pool,
-		election:       election,
-		validate:       validate,
-		dataManager:    dataManager,
-		locatorManager: locatorManager,
-		serverPort:     port,
+		CommonAPI:         common.NewCommonAPI(manager.updateLastRequestTime),
+		nodeManager:       manager,
+		validatePool:      pool,
+		election:          election,
+		validate:          validate,
+		dataManager:       dataManager,
+		locatorManager:    locatorManager,
+		rewardManager:     rewardManager,
+		reputationManager: reputationManager,
+		leaderElector:     leaderElector,
+		serverPort:        port,
 	}
 
 	sec, err := secret.APISecret(lr)
@@ -78,6 +101,16 @@ func NewLocalScheduleNode(lr repo.LockedRepo, port int) api.Scheduler {
 	}
 	s.APISecret = sec
 
+	err = initNodeTokenKey(lr)
+	if err != nil {
+		log.Panicf("NewLocalScheduleNode failed:%s", err.Error())
+	}
+
+	err = initTicketKey(lr)
+	if err != nil {
+		log.Panicf("NewLocalScheduleNode failed:%s", err.Error())
+	}
+
 	return s
 }
 
@@ -85,52 +118,85 @@ func NewLocalScheduleNode(lr repo.LockedRepo, port int) api.Scheduler {
 type Scheduler struct {
 	common.CommonAPI
 
-	nodeManager    *NodeManager
-	validatePool   *ValidatePool
-	election       *Election
-	validate       *Validate
-	dataManager    *DataManager
-	locatorManager *LocatorManager
+	nodeManager       *NodeManager
+	validatePool      *ValidatePool
+	election          *Election
+	validate          *Validate
+	dataManager       *DataManager
+	locatorManager    *LocatorManager
+	rewardManager     *RewardManager
+	reputationManager *ReputationManager
+	leaderElector     *LeaderElector
 
 	serverPort int
 }
 
+// nodeToken token of scheduler calling the node, it is only accepted by the node of deviceID
+func (s *Scheduler) nodeToken(ctx context.Context, deviceID string) ([]byte, error) {
+	return s.AuthNew(ctx, []auth.Permission{api.PermRead, api.PermWrite, api.PermAdmin, api.NodePermission(deviceID)})
+}
+
 // EdgeNodeConnect edge connect
 func (s *Scheduler) EdgeNodeConnect(ctx context.Context, port int, token string) (externalIP string, err error) {
 	ip := handler.GetRequestIP(ctx)
-	url := fmt.Sprintf("http://%s:%d/rpc/v0", ip, port)
 	log.Infof("EdgeNodeConnect ip:%s,port:%d", ip, port)
 
+	if !isLeader() {
+		return "", xerrors.New(ErrSchedulerStandby)
+	}
+
 	deviceID, err := verifySecret(token, api.NodeEdge)
 	if err != nil {
 		log.Errorf("EdgeNodeConnect verifySecret err:%s", err.Error())
 		return "", err
 	}
 
-	t, err := s.AuthNew(ctx, api.AllPermissions)
+	if s.nodeManager.restrictionManager.isBanned(deviceID, ip) {
+		return "", xerrors.Errorf("edge %s or ip %s is banned", deviceID, ip)
+	}
+
+	url, err := nodeURL(ctx, deviceID, port)
 	if err != nil {
-		return "", xerrors.Errorf("creating auth token for remote connection: %s", err.Error())
+		log.Errorf("EdgeNodeConnect nodeURL err:%s", err.Error())
+		return "", err
+	}
+
+	err = s.connectEdge(ctx, deviceID, ip, url, false, "")
+	if err != nil {
+		return "", err
+	}
+
+	return ip, nil
+}
+
+// connectEdge connect back to the edge and make it online,
+// relayURL is the download url prefix of the edge in reverse mode
+func (s *Scheduler) connectEdge(ctx context.Context, deviceID, ip, url string, reverse bool, relayURL string) error {
+	t, err := s.nodeToken(ctx, deviceID)
+	if err != nil {
+		return xerrors.Errorf("creating auth token for remote connection: %s", err.Error())
 	}
 
 	headers := http.Header{}
 	headers.Add("Authorization", "Bearer "+string(t))
 	// Connect to scheduler
 	// log.Infof("EdgeNodeConnect edge url:%v", url)
+	setNodeTLS(url, deviceID)
 	edgeAPI, closer, err := client.NewEdge(ctx, url, headers)
 	if err != nil {
 		log.Errorf("EdgeNodeConnect NewEdge err:%s,url:%s", err.Error(), url)
-		return "", err
+		return err
 	}
 
 	// load device info
 	deviceInfo, err := edgeAPI.DeviceInfo(ctx)
 	if err != nil {
 		log.Errorf("EdgeNodeConnect DeviceInfo err:%s", err.Error())
-		return "", err
+		return err
 	}
 
 	if deviceID != deviceInfo.DeviceId {
-		return "", xerrors.Errorf("deviceID mismatch %s,%s", deviceID, deviceInfo.DeviceId)
+		return xerrors.Errorf("deviceID mismatch %s,%s", deviceID, deviceInfo.DeviceId)
 	}
 
 	deviceInfo.NodeType = api.NodeEdge
@@ -143,6 +209,8 @@ func (s *Scheduler) EdgeNodeConnect(ctx context.Context, port int, token string)
 		Node: Node{
 			addr:       url,
 			deviceInfo: deviceInfo,
+			reverse:    reverse,
+			relayURL:   relayURL,
 		},
 	}
 
@@ -155,16 +223,23 @@ func (s *Scheduler) EdgeNodeConnect(ctx context.Context, port int, token string)
 	err = s.nodeManager.edgeOnline(edgeNode)
 	if err != nil {
 		log.Errorf("EdgeNodeConnect addEdgeNode err:%s,deviceID:%s", err.Error(), deviceInfo.DeviceId)
-		return "", err
+		return err
 	}
 
 	deviceInfo.IpLocation = edgeNode.geoInfo.Geo
+	deviceInfo.Operator = edgeNode.deviceInfo.Operator
 	err = s.nodeManager.SetDeviceInfo(deviceID, deviceInfo)
 	if err != nil {
 		log.Errorf("EdgeNodeConnect set device info: %s", err.Error())
-		return "", err
+		return err
+	}
+
+	if !reverse {
+		go s.nodeManager.reachabilityManager.probe(edgeNode)
 	}
 
+	go initDownloadLimits(deviceID, edgeAPI)
+
 	// edgeNode.getCacheFailCids()
 	// if cids != nil && len(cids) > 0 {
 	// 	reqDatas, _ := edgeNode.getReqCacheDatas(s, cids, true)
@@ -180,7 +255,7 @@ func (s *Scheduler) EdgeNodeConnect(ctx context.Context, port int, token string)
 	// notify locator
 	s.locatorManager.notifyNodeStatusToLocator(deviceID, true)
 
-	return ip, nil
+	return nil
 }
 
 // ValidateBlockResult Validate Block Result
@@ -193,30 +268,237 @@ func (s *Scheduler) ValidateBlockResult(ctx context.Context, validateResults api
 	return err
 }
 
-// DownloadBlockResult user download block result
+// DownloadBlockResult user download block result,
+// it is reported by node and only for statistics, rewards are credited by download receipts
 func (s *Scheduler) DownloadBlockResult(ctx context.Context, stat api.DownloadStat) error {
-	// TODO check cid
-
-	// add reward
-	if err := cache.GetDB().IncrDeviceReward(stat.DeviceID, 1); err != nil {
-		return err
-	}
+	recordDownloadStat(stat)
 
 	return persistent.GetDB().AddDownloadInfo(stat.DeviceID, &api.BlockDownloadInfo{
 		DeviceID:  stat.DeviceID,
 		BlockCID:  stat.Cid,
-		Reward:    1,
 		BlockSize: int64(stat.BlockSize),
 		Speed:     stat.DownloadSpeed,
 	})
 }
 
+// SubmitDownloadReceipts verify download receipts signed by user and credit rewards to the node of the token
+func (s *Scheduler) SubmitDownloadReceipts(ctx context.Context, token string, receipts []api.DownloadReceipt) (api.DownloadReceiptResult, error) {
+	deviceID, err := nodeOfRequest(ctx, token)
+	if err != nil {
+		return api.DownloadReceiptResult{}, err
+	}
+
+	return submitReceipts(deviceID, s.nodeManager.getNodeExternalIP(deviceID), receipts)
+}
+
+// SubmitDownloadStats download statistics aggregated by cid, client and hour on the node
+func (s *Scheduler) SubmitDownloadStats(ctx context.Context, token string, stats []api.DownloadStat) error {
+	deviceID, err := nodeOfRequest(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	infos := make([]*api.BlockDownloadInfo, 0, len(stats))
+	for _, stat := range stats {
+		stat.DeviceID = deviceID
+		recordDownloadStat(stat)
+
+		infos = append(infos, &api.BlockDownloadInfo{
+			DeviceID:  deviceID,
+			BlockCID:  stat.Cid,
+			BlockSize: int64(stat.BlockSize),
+			Speed:     stat.DownloadSpeed,
+		})
+	}
+
+	return persistent.GetDB().AddDownloadInfos(infos)
+}
+
+// SetRewardFormula set the formula of node income
+func (s *Scheduler) SetRewardFormula(ctx context.Context, formula api.RewardFormula) error {
+	return cache.GetDB().SetRewardFormula(formula)
+}
+
+// GetRewardFormula get the formula of node income
+func (s *Scheduler) GetRewardFormula(ctx context.Context) (api.RewardFormula, error) {
+	return getRewardFormula(), nil
+}
+
+// BindDeviceUser bind the device to user
+func (s *Scheduler) BindDeviceUser(ctx context.Context, deviceID, userID string) error {
+	if deviceID == "" || userID == "" {
+		return xerrors.New("parameter is nil")
+	}
+
+	return persistent.GetDB().SetDeviceUser(deviceID, userID)
+}
+
+// GetDeviceIncome income summary of device
+func (s *Scheduler) GetDeviceIncome(ctx context.Context, deviceID string) (api.IncomeDailyRes, error) {
+	return s.getDeviceIncome(deviceID)
+}
+
+// GetUserIncome income summary of all devices of user
+func (s *Scheduler) GetUserIncome(ctx context.Context, userID string) (api.IndexPageRes, error) {
+	return s.getUserIncome(userID)
+}
+
+// GetIncomeDaily daily income of device in month, month format 2006-01
+func (s *Scheduler) GetIncomeDaily(ctx context.Context, deviceID, month string) (api.IncomeDaily, error) {
+	return getIncomeDaily(deviceID, month)
+}
+
+// GetHourDataOfDaily hourly online data of device in date, date format 2006-01-02
+func (s *Scheduler) GetHourDataOfDaily(ctx context.Context, deviceID, date string) (api.HourDataOfDaily, error) {
+	return getHourDataOfDaily(deviceID, date)
+}
+
+// GetReputationRanking devices sorted by reputation score, limit 0 is unlimited
+func (s *Scheduler) GetReputationRanking(ctx context.Context, nodeType api.NodeTypeName, limit int) ([]api.ReputationInfo, error) {
+	return getReputationRanking(nodeType, limit), nil
+}
+
+// AddNodeRestriction quarantine or ban a device, ip or cidr
+func (s *Scheduler) AddNodeRestriction(ctx context.Context, restriction api.NodeRestriction) error {
+	restriction.Operator = handler.GetRequestIP(ctx)
+	return s.nodeManager.restrictionManager.addRestriction(&restriction)
+}
+
+// RemoveNodeRestriction remove the restriction of the target
+func (s *Scheduler) RemoveNodeRestriction(ctx context.Context, target, reason string) error {
+	return s.nodeManager.restrictionManager.removeRestriction(target, reason, handler.GetRequestIP(ctx))
+}
+
+// ListNodeRestrictions all restrictions, include the expired
+func (s *Scheduler) ListNodeRestrictions(ctx context.Context) ([]api.NodeRestriction, error) {
+	list, err := persistent.GetDB().GetNodeRestrictions()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.NodeRestriction, 0, len(list))
+	for _, info := range list {
+		out = append(out, *info)
+	}
+
+	return out, nil
+}
+
+// ListNodeRestrictionLogs audit logs of restrictions, target empty is all
+func (s *Scheduler) ListNodeRestrictionLogs(ctx context.Context, target string, limit int) ([]api.NodeRestrictionLog, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	list, err := persistent.GetDB().GetNodeRestrictionLogs(target, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.NodeRestrictionLog, 0, len(list))
+	for _, info := range list {
+		out = append(out, *info)
+	}
+
+	return out, nil
+}
+
+// SetAreaPolicy add or update the policy of the area served
+func (s *Scheduler) SetAreaPolicy(ctx context.Context, policy api.AreaPolicy) error {
+	policy.Operator = handler.GetRequestIP(ctx)
+	return s.nodeManager.areaManager.setPolicy(&policy)
+}
+
+// RemoveAreaPolicy remove the policy of the area, the area in config is still served
+func (s *Scheduler) RemoveAreaPolicy(ctx context.Context, area string) error {
+	return s.nodeManager.areaManager.removePolicy(area, handler.GetRequestIP(ctx))
+}
+
+// ListAreaPolicies policies of the areas served, include the config
+func (s *Scheduler) ListAreaPolicies(ctx context.Context) ([]api.AreaPolicy, error) {
+	return s.nodeManager.areaManager.listPolicies(), nil
+}
+
+// AddIPAllowlist accept the ip or cidr whatever its area
+func (s *Scheduler) AddIPAllowlist(ctx context.Context, entry api.IPAllowlist) error {
+	entry.Operator = handler.GetRequestIP(ctx)
+	return s.nodeManager.areaManager.addAllowlist(&entry)
+}
+
+// RemoveIPAllowlist remove the ip or cidr from allowlist
+func (s *Scheduler) RemoveIPAllowlist(ctx context.Context, target string) error {
+	return s.nodeManager.areaManager.removeAllowlist(target, handler.GetRequestIP(ctx))
+}
+
+// LookupIPGeo location and isp of the ip, to check the geo db and override table
+func (s *Scheduler) LookupIPGeo(ctx context.Context, ip string) (api.IPGeoInfo, error) {
+	if ip == "" {
+		ip = handler.GetRequestIP(ctx)
+	}
+
+	geoInfo, err := region.GetRegion().GetGeoInfo(ip)
+	if err != nil {
+		return api.IPGeoInfo{}, err
+	}
+
+	return api.IPGeoInfo{
+		IP:         geoInfo.IP,
+		Geo:        geoInfo.Geo,
+		Country:    geoInfo.Country,
+		Province:   geoInfo.Province,
+		City:       geoInfo.City,
+		ISP:        geoInfo.ISP,
+		ASN:        geoInfo.ASN,
+		Latitude:   geoInfo.Latitude,
+		Longitude:  geoInfo.Longitude,
+		Overridden: geoInfo.Overridden,
+	}, nil
+}
+
+// ProbeNodeReachability probe the online edge now
+func (s *Scheduler) ProbeNodeReachability(ctx context.Context, deviceID string) (api.NodeReachability, error) {
+	node := s.nodeManager.getEdgeNode(deviceID)
+	if node == nil {
+		return api.NodeReachability{}, xerrors.Errorf("%s:%s", ErrNodeNotFind, deviceID)
+	}
+
+	return s.nodeManager.reachabilityManager.probe(node), nil
+}
+
+// GetNodeReachability last probe result of the online edge
+func (s *Scheduler) GetNodeReachability(ctx context.Context, deviceID string) (api.NodeReachability, error) {
+	return s.nodeManager.reachabilityManager.get(deviceID)
+}
+
+// ListIPAllowlists all ips and cidrs of allowlist
+func (s *Scheduler) ListIPAllowlists(ctx context.Context) ([]api.IPAllowlist, error) {
+	list, err := persistent.GetDB().GetIPAllowlists()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.IPAllowlist, 0, len(list))
+	for _, info := range list {
+		out = append(out, *info)
+	}
+
+	return out, nil
+}
+
 // CacheContinue Cache Continue
 func (s *Scheduler) CacheContinue(ctx context.Context, cid, cacheID string) error {
 	if cid == "" || cacheID == "" {
 		return xerrors.New("parameter is nil")
 	}
 
+	if isDenied(cid) {
+		return xerrors.Errorf("cid %s is denied", cid)
+	}
+
+	if err := checkCarfileOwner(ctx, cid); err != nil {
+		return err
+	}
+
 	return s.dataManager.cacheContinue(cid, cacheID)
 }
 
@@ -235,7 +517,39 @@ func (s *Scheduler) RegisterNode(ctx context.Context, nodeType api.NodeType) (ap
 
 // GetToken get token
 func (s *Scheduler) GetToken(ctx context.Context, deviceID, secret string) (string, error) {
-	return generateToken(deviceID, secret)
+	return issueToken(deviceID, secret)
+}
+
+// GetNodeCert sign the node tls certificate request
+func (s *Scheduler) GetNodeCert(ctx context.Context, deviceID, secret string, csr []byte) (api.NodeCertInfo, error) {
+	return issueNodeCert(deviceID, secret, csr)
+}
+
+// GetDownloadCert sign the server certificate of the node download server
+func (s *Scheduler) GetDownloadCert(ctx context.Context, deviceID, secret string, csr []byte) (api.DownloadCertInfo, error) {
+	return issueDownloadCert(deviceID, secret, handler.GetRequestIP(ctx), csr)
+}
+
+// RevokeNodeSecret revoke the device secret, the node can not connect until secret rotate
+func (s *Scheduler) RevokeNodeSecret(ctx context.Context, deviceID string) error {
+	err := revokeSecret(deviceID)
+	if err != nil {
+		return err
+	}
+
+	s.nodeManager.nodeOffline(deviceID)
+	return nil
+}
+
+// RotateNodeSecret create a new secret for device, old secret and tokens are invalid
+func (s *Scheduler) RotateNodeSecret(ctx context.Context, deviceID string) (api.NodeRegisterInfo, error) {
+	info, err := rotateSecret(deviceID)
+	if err != nil {
+		return info, err
+	}
+
+	s.nodeManager.nodeOffline(deviceID)
+	return info, nil
 }
 
 // DeleteBlockRecords  Delete Block Record
@@ -263,6 +577,10 @@ func (s *Scheduler) RemoveCarfile(ctx context.Context, carfileID string) error {
 		return xerrors.Errorf(ErrCidIsNil)
 	}
 
+	if err := checkCarfileOwner(ctx, carfileID); err != nil {
+		return err
+	}
+
 	return s.dataManager.removeCarfile(carfileID)
 }
 
@@ -276,6 +594,10 @@ func (s *Scheduler) RemoveCache(ctx context.Context, carfileID, cacheID string)
 		return xerrors.Errorf(ErrCacheIDIsNil)
 	}
 
+	if err := checkCarfileOwner(ctx, carfileID); err != nil {
+		return err
+	}
+
 	return s.dataManager.removeCache(carfileID, cacheID)
 }
 
@@ -348,18 +670,39 @@ func (s *Scheduler) RemoveCache(ctx context.Context, carfileID, cacheID string)
 // 	return errorMap, err
 // }
 
-// CacheCarfile Cache Carfile
-func (s *Scheduler) CacheCarfile(ctx context.Context, cid string, reliability int) error {
+// CacheCarfile Cache Carfile, carfile methods are of read permission, the caller must be admin or the tenant of the carfile
+func (s *Scheduler) CacheCarfile(ctx context.Context, cid string, reliability int, selector string) error {
 	if cid == "" {
 		return xerrors.New("cid is nil")
 	}
 
-	return s.dataManager.cacheData(cid, reliability)
+	if isDenied(cid) {
+		return xerrors.Errorf("cid %s is denied", cid)
+	}
+
+	_, err := parseCarfileSelector(selector)
+	if err != nil {
+		return err
+	}
+
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	if tenantID != "" {
+		err = checkTenantCache(tenantID, dataKey(cid, selector), reliability)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.dataManager.cacheData(cid, reliability, selector, tenantID)
 }
 
-// ListDatas List Datas
+// ListDatas List Datas, tenant only list its own datas
 func (s *Scheduler) ListDatas(ctx context.Context, page int) (api.DataListInfo, error) {
-	count, totalPage, list, err := persistent.GetDB().GetDataCidWithPage(page)
+	count, totalPage, list, err := persistent.GetDB().GetDataCidWithPage(page, handler.GetTenant(ctx))
 	if err != nil {
 		return api.DataListInfo{}, err
 	}
@@ -376,7 +719,7 @@ func (s *Scheduler) ShowDataTask(ctx context.Context, cid string) (api.CacheData
 	}
 
 	d := s.dataManager.findData(cid, false)
-	if d != nil {
+	if d != nil && (handler.GetTenant(ctx) == "" || handler.GetTenant(ctx) == d.owner) {
 		return dataToCacheDataInfo(d), nil
 	}
 
@@ -465,29 +808,13 @@ func (s *Scheduler) FindNodeWithBlock(ctx context.Context, cid string) (string,
 	return "", nil
 }
 
-// GetDownloadInfosWithBlocks find node
+// GetDownloadInfosWithBlocks find nodes for every cid, ordered by route score of the client
 func (s *Scheduler) GetDownloadInfosWithBlocks(ctx context.Context, cids []string) (map[string][]api.DownloadInfo, error) {
 	if len(cids) < 1 {
 		return nil, xerrors.New("cids is nil")
 	}
 
-	// geoInfo, err := region.GetRegion().GetGeoInfo(ip)
-	// if err != nil {
-	// 	log.Warnf("getNodeURLWithData GetGeoInfo err:%s,ip:%s", err.Error(), ip)
-	// }
-
-	infoMap := make(map[string][]api.DownloadInfo)
-
-	// for _, cid := range cids {
-	// info, err := s.nodeManager.findNodeDownloadInfo(cid)
-	// if err != nil {
-	// 	continue
-	// }
-
-	// infoMap[cid] = info
-	// }
-
-	return infoMap, nil
+	return s.GetDownloadTicketsWithBlocks(ctx, api.DownloadTicketReq{Cids: cids}, maxDownloadFallbacks)
 }
 
 // GetDownloadInfoWithBlocks find node
@@ -503,8 +830,9 @@ func (s *Scheduler) GetDownloadInfoWithBlocks(ctx context.Context, cids []string
 
 	infoMap := make(map[string]api.DownloadInfo)
 
+	ip := handler.GetRequestIP(ctx)
 	for _, cid := range cids {
-		info, err := s.nodeManager.findNodeDownloadInfo(cid)
+		info, err := s.newDownloadInfo(cid, &token.Ticket{ClientIP: ip, Cids: []string{cid}})
 		if err != nil {
 			continue
 		}
@@ -526,22 +854,99 @@ func (s *Scheduler) GetDownloadInfoWithBlock(ctx context.Context, cid string) (a
 	// 	log.Warnf("getNodeURLWithData GetGeoInfo err:%s,ip:%s", err.Error(), ip)
 	// }
 
-	return s.nodeManager.findNodeDownloadInfo(cid)
+	return s.newDownloadInfo(cid, &token.Ticket{ClientIP: handler.GetRequestIP(ctx), Cids: []string{cid}})
+}
+
+// GetDownloadTicket find a node and issue a download ticket for the cids or carfile
+func (s *Scheduler) GetDownloadTicket(ctx context.Context, req api.DownloadTicketReq) (api.DownloadInfo, error) {
+	ticket, cid, err := newTicketWithReq(ctx, req)
+	if err != nil {
+		return api.DownloadInfo{}, err
+	}
+
+	return s.newDownloadInfo(cid, ticket)
+}
+
+// GetDownloadTickets ordered fallback nodes for the cids or carfile, every node has its own ticket
+func (s *Scheduler) GetDownloadTickets(ctx context.Context, req api.DownloadTicketReq, max int) ([]api.DownloadInfo, error) {
+	if max <= 0 || max > maxDownloadFallbacks {
+		max = maxDownloadFallbacks
+	}
+
+	ticket, cid, err := newTicketWithReq(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newDownloadInfos(cid, ticket, max)
+}
+
+// GetDownloadTicketsWithBlocks find nodes for every cid of the req, every cid has its own ticket,
+// locator find all cids of the user in one call
+func (s *Scheduler) GetDownloadTicketsWithBlocks(ctx context.Context, req api.DownloadTicketReq, max int) (map[string][]api.DownloadInfo, error) {
+	if max <= 0 || max > maxDownloadFallbacks {
+		max = maxDownloadFallbacks
+	}
+
+	req.RootCid = ""
+	ticket, _, err := newTicketWithReq(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	infoMap := make(map[string][]api.DownloadInfo)
+	var lastErr error
+	for _, cid := range req.Cids {
+		t := *ticket
+		t.Cids = []string{cid}
+
+		infos, err := s.newDownloadInfos(cid, &t, max)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		infoMap[cid] = infos
+	}
+
+	if len(infoMap) == 0 {
+		return nil, lastErr
+	}
+
+	return infoMap, nil
+}
+
+// GetTicketPublicKey public key to verify download tickets
+func (s *Scheduler) GetTicketPublicKey(ctx context.Context) ([]byte, error) {
+	return ticketPublicKey()
 }
 
 // CandidateNodeConnect Candidate connect
 func (s *Scheduler) CandidateNodeConnect(ctx context.Context, port int, token string) (externalIP string, err error) {
 	ip := handler.GetRequestIP(ctx)
-	url := fmt.Sprintf("http://%s:%d/rpc/v0", ip, port)
 	log.Infof("CandidateNodeConnect ip:%s,port:%d", ip, port)
 
+	if !isLeader() {
+		return "", xerrors.New(ErrSchedulerStandby)
+	}
+
 	deviceID, err := verifySecret(token, api.NodeCandidate)
 	if err != nil {
 		log.Errorf("CandidateNodeConnect verifySecret err:%s", err.Error())
 		return "", err
 	}
 
-	t, err := s.AuthNew(ctx, api.AllPermissions)
+	if s.nodeManager.restrictionManager.isBanned(deviceID, ip) {
+		return "", xerrors.Errorf("candidate %s or ip %s is banned", deviceID, ip)
+	}
+
+	url, err := nodeURL(ctx, deviceID, port)
+	if err != nil {
+		log.Errorf("CandidateNodeConnect nodeURL err:%s", err.Error())
+		return "", err
+	}
+
+	t, err := s.nodeToken(ctx, deviceID)
 	if err != nil {
 		return "", xerrors.Errorf("creating auth token for remote connection: %s", err.Error())
 	}
@@ -550,6 +955,7 @@ func (s *Scheduler) CandidateNodeConnect(ctx context.Context, port int, token st
 	headers.Add("Authorization", "Bearer "+string(t))
 	// Connect to scheduler
 	// log.Infof("EdgeNodeConnect edge url:%v", url)
+	setNodeTLS(url, deviceID)
 	candicateAPI, closer, err := client.NewCandicate(ctx, url, headers)
 	if err != nil {
 		log.Errorf("CandidateNodeConnect NewCandicate err:%s,url:%s", err.Error(), url)
@@ -593,12 +999,15 @@ func (s *Scheduler) CandidateNodeConnect(ctx context.Context, port int, token st
 	}
 
 	deviceInfo.IpLocation = candidateNode.geoInfo.Geo
+	deviceInfo.Operator = candidateNode.deviceInfo.Operator
 	err = s.nodeManager.SetDeviceInfo(deviceID, deviceInfo)
 	if err != nil {
 		log.Errorf("CandidateNodeConnect set device info: %s", err.Error())
 		return "", err
 	}
 
+	go initDownloadLimits(deviceID, candidateNode.nodeAPI)
+
 	// cids := candidateNode.getCacheFailCids()
 	// if cids != nil && len(cids) > 0 {
 	// 	reqDatas, _ := candidateNode.getReqCacheDatas(s, cids, false)
@@ -695,6 +1104,7 @@ func (s *Scheduler) GetDevicesInfo(ctx context.Context, deviceID string) (api.De
 	}
 
 	deviceInfo.DeviceStatus = getDeviceStatus(isOnline)
+	deviceInfo.Reputation = reputationScore(deviceID)
 
 	return deviceInfo, nil
 }
@@ -729,7 +1139,9 @@ func (s *Scheduler) ValidateSwitch(ctx context.Context, open bool) error {
 
 // StateNetwork State Network
 func (s *Scheduler) StateNetwork(ctx context.Context) (api.StateNetwork, error) {
-	return s.nodeManager.state, nil
+	state := s.nodeManager.state
+	state.ISPs = s.nodeManager.ispStats()
+	return state, nil
 }
 
 // LocatorConnect Locator Connect
@@ -742,6 +1154,11 @@ func (s *Scheduler) LocatorConnect(ctx context.Context, port int, areaID, locato
 		return xerrors.Errorf("area err:%s", areaID)
 	}
 
+	// locator connect again in every health probe
+	if s.locatorManager.isLocatorConnected(locatorID, url) {
+		return nil
+	}
+
 	headers := http.Header{}
 	headers.Add("Authorization", "Bearer "+string(locatorToken))
 	// Connect to scheduler
@@ -752,11 +1169,38 @@ func (s *Scheduler) LocatorConnect(ctx context.Context, port int, areaID, locato
 		return err
 	}
 
-	s.locatorManager.addLocator(&Location{locatorID: locatorID, nodeAPI: locationAPI, closer: closer})
+	s.locatorManager.addLocator(&Location{locatorID: locatorID, nodeAPI: locationAPI, closer: closer, url: url})
+
+	return nil
+}
+
+// ResignLeader hand over the leader to standby scheduler, before restart or upgrade
+func (s *Scheduler) ResignLeader(ctx context.Context) error {
+	if !isLeader() {
+		return xerrors.New(ErrSchedulerStandby)
+	}
 
+	s.leaderElector.resign()
 	return nil
 }
 
+// GetSchedulerLoad online nodes and capacity of the scheduler, probed by locator
+func (s *Scheduler) GetSchedulerLoad(ctx context.Context) (api.SchedulerLoad, error) {
+	load := api.SchedulerLoad{Capacity: nodeCapacity, Standby: !isLeader()}
+
+	s.nodeManager.edgeNodeMap.Range(func(key, value interface{}) bool {
+		load.OnlineEdges++
+		return true
+	})
+
+	s.nodeManager.candidateNodeMap.Range(func(key, value interface{}) bool {
+		load.OnlineCandidates++
+		return true
+	})
+
+	return load, nil
+}
+
 func (s *Scheduler) GetDownloadInfo(ctx context.Context, deviceID string) ([]*api.BlockDownloadInfo, error) {
 	return persistent.GetDB().GetDownloadInfo(deviceID)
 }
@@ -764,11 +1208,12 @@ func (s *Scheduler) GetDownloadInfo(ctx context.Context, deviceID string) ([]*ap
 // ShowDataTasks Show Data Tasks
 func (s *Scheduler) ShowDataTasks(ctx context.Context) ([]api.CacheDataInfo, error) {
 	infos := make([]api.CacheDataInfo, 0)
+	tenantID := handler.GetTenant(ctx)
 
 	s.dataManager.runningTaskMap.Range(func(key, value interface{}) bool {
 		// cid := key.(string)
 		data := value.(*Data)
-		if data != nil {
+		if data != nil && (tenantID == "" || tenantID == data.owner) {
 			infos = append(infos, dataToCacheDataInfo(data))
 		}
 		return true
@@ -781,10 +1226,13 @@ func dataToCacheDataInfo(d *Data) api.CacheDataInfo {
 	info := api.CacheDataInfo{}
 	if d != nil {
 		info.Cid = d.cid
+		info.RootCid = d.rootCid
+		info.Selector = d.selectorStr()
 		info.TotalSize = d.totalSize
 		info.NeedReliability = d.needReliability
 		info.CurReliability = d.reliability
 		info.Blocks = d.totalBlocks
+		info.Owner = d.owner
 
 		caches := make([]api.CacheInfo, 0)
 
@@ -0,0 +1,135 @@
+package scheduler
+
+import (
+	"sort"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/region"
+)
+
+// score of the cross isp node is reduced, it is still the fallback of same isp nodes
+const crossISPRouteFactor = 0.6
+
+// ispRouteFactor the node of the same isp as the client is preferred
+func ispRouteFactor(node *Node, clientGeo *region.GeoInfo) float64 {
+	if clientGeo == nil || clientGeo.ISP == "" || node.deviceInfo.Operator == "" {
+		return 1
+	}
+
+	if clientGeo.ISP == node.deviceInfo.Operator {
+		return 1
+	}
+
+	return crossISPRouteFactor
+}
+
+// nodeISP isp of the online node, empty if unknown or offline
+func (m *NodeManager) nodeISP(deviceID string) string {
+	if e := m.getEdgeNode(deviceID); e != nil {
+		return e.deviceInfo.Operator
+	}
+
+	if c := m.getCandidateNode(deviceID); c != nil {
+		return c.deviceInfo.Operator
+	}
+
+	return ""
+}
+
+// preferLeastHeldISP edges of the isp holding the fewest copies, the copies are spread across isps
+func (m *NodeManager) preferLeastHeldISP(edges []*EdgeNode, holders map[string]string) []*EdgeNode {
+	held := make(map[string]int)
+	for deviceID := range holders {
+		if isp := m.nodeISP(deviceID); isp != "" {
+			held[isp]++
+		}
+	}
+
+	least := -1
+	for _, e := range edges {
+		isp := e.deviceInfo.Operator
+		if isp == "" {
+			continue
+		}
+
+		if least < 0 || held[isp] < least {
+			least = held[isp]
+		}
+	}
+
+	if least < 0 {
+		// isp of nodes are unknown
+		return edges
+	}
+
+	out := make([]*EdgeNode, 0, len(edges))
+	for _, e := range edges {
+		if isp := e.deviceInfo.Operator; isp != "" && held[isp] == least {
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
+
+// sameISPCandidates candidates of the isp, all if none of them is the isp
+func sameISPCandidates(candidates []*CandidateNode, isp string) []*CandidateNode {
+	if isp == "" {
+		return candidates
+	}
+
+	out := make([]*CandidateNode, 0, len(candidates))
+	for _, c := range candidates {
+		if c.deviceInfo.Operator == isp {
+			out = append(out, c)
+		}
+	}
+
+	if len(out) == 0 {
+		return candidates
+	}
+
+	return out
+}
+
+// ispStats online nodes of each isp, sorted by isp
+func (m *NodeManager) ispStats() []api.ISPStat {
+	stats := make(map[string]*api.ISPStat)
+	get := func(isp string) *api.ISPStat {
+		s, ok := stats[isp]
+		if !ok {
+			s = &api.ISPStat{ISP: isp}
+			stats[isp] = s
+		}
+		return s
+	}
+
+	m.edgeNodeMap.Range(func(key, value interface{}) bool {
+		if node := value.(*EdgeNode); node != nil {
+			s := get(node.deviceInfo.Operator)
+			s.OnlineEdges++
+			s.BandwidthUp += node.deviceInfo.BandwidthUp
+		}
+		return true
+	})
+
+	m.candidateNodeMap.Range(func(key, value interface{}) bool {
+		if node := value.(*CandidateNode); node != nil {
+			s := get(node.deviceInfo.Operator)
+			s.OnlineCandidates++
+			s.BandwidthUp += node.deviceInfo.BandwidthUp
+		}
+		return true
+	})
+
+	out := make([]api.ISPStat, 0, len(stats))
+	for _, s := range stats {
+		out = append(out, *s)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ISP < out[j].ISP
+	})
+
+	return out
+}
@@ -0,0 +1,209 @@
+package scheduler
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/region"
+)
+
+// ispRegion isp of the client ips in table
+type ispRegion map[string]string
+
+func (r ispRegion) GetGeoInfo(ip string) (*region.GeoInfo, error) {
+	info := r.DefaultGeoInfo(ip)
+	info.ISP = r[ip]
+	return info, nil
+}
+
+func (r ispRegion) DefaultGeoInfo(ip string) *region.GeoInfo {
+	return &region.GeoInfo{IP: ip, Geo: "unknown-unknown-unknown"}
+}
+
+// newTestISPNodes online nodes of the isps, the node of empty isp is unknown
+func newTestISPNodes(edges, candidates map[string]string) *NodeManager {
+	m := &NodeManager{}
+	m.restrictionManager = &RestrictionManager{nodeManager: m}
+	m.reachabilityManager = newReachabilityManager(m)
+
+	for deviceID, isp := range edges {
+		info := api.DevicesInfo{DeviceId: deviceID, Operator: isp, BandwidthUp: 100}
+		m.edgeNodeMap.Store(deviceID, &EdgeNode{Node: Node{deviceInfo: info}})
+	}
+
+	for deviceID, isp := range candidates {
+		info := api.DevicesInfo{DeviceId: deviceID, Operator: isp, BandwidthUp: 1000}
+		m.candidateNodeMap.Store(deviceID, &CandidateNode{Node: Node{deviceInfo: info}})
+	}
+
+	return m
+}
+
+func deviceIDsOf(edges []*EdgeNode) []string {
+	out := make([]string, 0, len(edges))
+	for _, e := range edges {
+		out = append(out, e.deviceInfo.DeviceId)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestISPRouteFactor(t *testing.T) {
+	node := &Node{deviceInfo: api.DevicesInfo{Operator: region.ISPChinaTelecom}}
+	unknown := &Node{}
+
+	cases := []struct {
+		name string
+		node *Node
+		geo  *region.GeoInfo
+		want float64
+	}{
+		{"same isp", node, &region.GeoInfo{ISP: region.ISPChinaTelecom}, 1},
+		{"cross isp", node, &region.GeoInfo{ISP: region.ISPChinaUnicom}, crossISPRouteFactor},
+		{"unknown client isp", node, &region.GeoInfo{}, 1},
+		{"client without geo", node, nil, 1},
+		{"unknown node isp", unknown, &region.GeoInfo{ISP: region.ISPChinaUnicom}, 1},
+	}
+
+	for _, c := range cases {
+		if got := ispRouteFactor(c.node, c.geo); got != c.want {
+			t.Errorf("%s: factor %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRankDownloadNodesISP(t *testing.T) {
+	db := newFakeDB()
+	db.blocks["c1"] = []string{"e_ct", "e_cu"}
+
+	old := region.GetRegion()
+	region.SetRegion(ispRegion{"1.1.1.1": region.ISPChinaUnicom, "2.2.2.2": region.ISPChinaMobile})
+	t.Cleanup(func() { region.SetRegion(old) })
+
+	m := newTestISPNodes(map[string]string{"e_ct": region.ISPChinaTelecom, "e_cu": region.ISPChinaUnicom}, nil)
+
+	// the jitter of score is less than the cross isp factor
+	for i := 0; i < 20; i++ {
+		nodes, err := m.rankDownloadNodes("c1", "1.1.1.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(nodes) != 2 || nodes[0].node.deviceInfo.DeviceId != "e_cu" {
+			t.Fatalf("same isp node is not the first: %v", nodes)
+		}
+	}
+
+	// the cross isp nodes are the fallback if no node of the client isp
+	nodes, err := m.rankDownloadNodes("c1", "2.2.2.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Errorf("cross isp nodes are not the fallback: %v", nodes)
+	}
+
+	// the client isp is unknown
+	nodes, err = m.rankDownloadNodes("c1", "3.3.3.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Errorf("nodes for client of unknown isp: %v", nodes)
+	}
+}
+
+func TestPreferLeastHeldISP(t *testing.T) {
+	m := newTestISPNodes(map[string]string{
+		"e_ct1": region.ISPChinaTelecom,
+		"e_ct2": region.ISPChinaTelecom,
+		"e_cu1": region.ISPChinaUnicom,
+		"e_cu2": region.ISPChinaUnicom,
+		"e_cm1": region.ISPChinaMobile,
+		"e_x":   "",
+	}, nil)
+
+	holders := map[string]string{"e_ct1": "", "e_cu1": ""}
+	got := deviceIDsOf(m.preferLeastHeldISP(m.findEdgeNodes(nil, holders), holders))
+	if !reflect.DeepEqual(got, []string{"e_cm1"}) {
+		t.Errorf("edges of the least held isp: %v", got)
+	}
+
+	// holders offline are not counted
+	holders = map[string]string{"e_ct1": "", "offline": ""}
+	got = deviceIDsOf(m.preferLeastHeldISP(m.findEdgeNodes(nil, holders), holders))
+	if !reflect.DeepEqual(got, []string{"e_cm1", "e_cu1", "e_cu2"}) {
+		t.Errorf("edges of the least held isps: %v", got)
+	}
+
+	// the copies are placed on every isp before the second copy on one isp
+	holders = map[string]string{}
+	for i := 0; i < 3; i++ {
+		cs := m.preferLeastHeldISP(m.findEdgeNodes(nil, holders), holders)
+		if len(cs) == 0 {
+			t.Fatal("no edge to place the copy")
+		}
+		holders[cs[0].deviceInfo.DeviceId] = ""
+	}
+
+	isps := make(map[string]bool)
+	for deviceID := range holders {
+		isps[m.nodeISP(deviceID)] = true
+	}
+	if len(isps) != 3 || isps[""] {
+		t.Errorf("copies are not spread across isps: %v", holders)
+	}
+
+	// isp of all edges are unknown
+	unknown := newTestISPNodes(map[string]string{"e_1": "", "e_2": ""}, nil)
+	got = deviceIDsOf(unknown.preferLeastHeldISP(unknown.findEdgeNodes(nil, nil), nil))
+	if !reflect.DeepEqual(got, []string{"e_1", "e_2"}) {
+		t.Errorf("edges of unknown isp: %v", got)
+	}
+}
+
+func TestSameISPCandidates(t *testing.T) {
+	m := newTestISPNodes(nil, map[string]string{"c_ct": region.ISPChinaTelecom, "c_cm": region.ISPChinaMobile})
+	all := m.findCandidateNodes(nil, nil)
+
+	ids := func(candidates []*CandidateNode) []string {
+		out := make([]string, 0, len(candidates))
+		for _, c := range candidates {
+			out = append(out, c.deviceInfo.DeviceId)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	if got := ids(sameISPCandidates(all, region.ISPChinaTelecom)); !reflect.DeepEqual(got, []string{"c_ct"}) {
+		t.Errorf("candidates of same isp: %v", got)
+	}
+
+	// all candidates are the fallback
+	if got := ids(sameISPCandidates(all, region.ISPChinaUnicom)); len(got) != 2 {
+		t.Errorf("candidates of other isp: %v", got)
+	}
+
+	if got := ids(sameISPCandidates(all, "")); len(got) != 2 {
+		t.Errorf("candidates of unknown isp: %v", got)
+	}
+}
+
+func TestISPStats(t *testing.T) {
+	m := newTestISPNodes(
+		map[string]string{"e_ct1": region.ISPChinaTelecom, "e_ct2": region.ISPChinaTelecom, "e_x": ""},
+		map[string]string{"c_ct": region.ISPChinaTelecom, "c_cu": region.ISPChinaUnicom},
+	)
+
+	want := []api.ISPStat{
+		{ISP: "", OnlineEdges: 1, BandwidthUp: 100},
+		{ISP: region.ISPChinaTelecom, OnlineEdges: 2, OnlineCandidates: 1, BandwidthUp: 1200},
+		{ISP: region.ISPChinaUnicom, OnlineCandidates: 1, BandwidthUp: 1000},
+	}
+
+	if got := m.ispStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("isp stats: got %v, want %v", got, want)
+	}
+}
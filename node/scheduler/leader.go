@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/ouqiang/timewheel"
+)
+
+const (
+	// leader lease of the server, renewed before expired
+	leaderLease = 30 * time.Second
+	// node owner lease, renewed by keepalive
+	nodeOwnerLease = 3 * time.Minute
+)
+
+var (
+	// schedulerID id of the scheduler in the server, unique for each replica
+	schedulerID = uuid.New().String()
+	// 1 if the scheduler is the leader of the server
+	leaderState int32
+	// unix nano time the leader lease expired, measured from the start of the last successful renew
+	leaderLeaseExpire int64
+)
+
+// SetSchedulerID set the id of the scheduler replica, random if not set
+func SetSchedulerID(id string) {
+	if id != "" {
+		schedulerID = id
+	}
+}
+
+// isLeader only the leader run singleton jobs and serve nodes, the others are standby,
+// the leader stop leader-only jobs once its lease is expired, before other scheduler can take over
+func isLeader() bool {
+	return atomic.LoadInt32(&leaderState) == 1 && time.Now().UnixNano() < atomic.LoadInt64(&leaderLeaseExpire)
+}
+
+// LeaderElector elect the leader of the server by redis lease
+type LeaderElector struct {
+	onElected func()
+	onDemoted func()
+
+	renewTimewheel *timewheel.TimeWheel
+	renewTime      int // renew time interval (second)
+
+	// campaign of the timewheel and resign of the rpc are serialized
+	lock sync.Mutex
+	// no campaign after resign, wait other scheduler take over
+	resignUntil time.Time
+}
+
+func newLeaderElector(onElected, onDemoted func()) *LeaderElector {
+	e := &LeaderElector{
+		onElected: onElected,
+		onDemoted: onDemoted,
+		renewTime: 10,
+	}
+
+	e.campaign()
+	e.initRenewTimewheel()
+
+	return e
+}
+
+func (e *LeaderElector) initRenewTimewheel() {
+	e.renewTimewheel = timewheel.New(1*time.Second, 3600, func(_ interface{}) {
+		e.renewTimewheel.AddTimer(time.Duration(e.renewTime-1)*time.Second, "Leader", nil)
+		e.campaign()
+	})
+	e.renewTimewheel.Start()
+	e.renewTimewheel.AddTimer(time.Duration(e.renewTime-1)*time.Second, "Leader", nil)
+}
+
+// campaign acquire or renew the leader lease
+func (e *LeaderElector) campaign() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if time.Now().Before(e.resignUntil) {
+		return
+	}
+
+	start := time.Now()
+	ok, err := cache.GetDB().AcquireLeader(schedulerID, leaderLease)
+	if err != nil {
+		// holder of the lease is unknown, keep the state, the leader-only jobs stop after the lease expired
+		log.Errorf("AcquireLeader err:%s", err.Error())
+		return
+	}
+
+	state := int32(0)
+	if ok {
+		state = 1
+		atomic.StoreInt64(&leaderLeaseExpire, start.Add(leaderLease).UnixNano())
+	}
+
+	old := atomic.SwapInt32(&leaderState, state)
+	if old == state {
+		return
+	}
+
+	if ok {
+		log.Warnf("scheduler %s is elected as leader of %s", schedulerID, serverArea)
+		if e.onElected != nil {
+			e.onElected()
+		}
+		return
+	}
+
+	log.Warnf("scheduler %s is demoted to standby", schedulerID)
+	if e.onDemoted != nil {
+		e.onDemoted()
+	}
+}
+
+// resign release the leader lease, other scheduler take over without waiting the lease expired
+func (e *LeaderElector) resign() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if atomic.SwapInt32(&leaderState, 0) == 0 {
+		return
+	}
+	e.resignUntil = time.Now().Add(leaderLease)
+
+	err := cache.GetDB().ReleaseLeader(schedulerID)
+	if err != nil {
+		log.Errorf("ReleaseLeader err:%s", err.Error())
+	}
+
+	if e.onDemoted != nil {
+		e.onDemoted()
+	}
+}
+
+// renewNodeOwner the node is owned by the scheduler until the lease expired
+func renewNodeOwner(deviceID string) {
+	err := cache.GetDB().SetNodeOwner(deviceID, schedulerID, nodeOwnerLease)
+	if err != nil {
+		log.Errorf("SetNodeOwner err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+}
+
+// isNodeOwnedByOther the node has connected to other scheduler after failover
+func isNodeOwnedByOther(deviceID string) bool {
+	owner, err := cache.GetDB().GetNodeOwner(deviceID)
+	if err != nil {
+		if !cache.GetDB().IsNilErr(err) {
+			log.Errorf("GetNodeOwner err:%s,deviceID:%s", err.Error(), deviceID)
+		}
+		return false
+	}
+
+	return owner != schedulerID
+}
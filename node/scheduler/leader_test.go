@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// electTestLeader the scheduler is elected as leader in the test
+func electTestLeader(t *testing.T) *LeaderElector {
+	e := &LeaderElector{}
+	e.campaign()
+	if !isLeader() {
+		t.Fatal("scheduler is not elected")
+	}
+
+	t.Cleanup(func() {
+		atomic.StoreInt32(&leaderState, 0)
+		atomic.StoreInt64(&leaderLeaseExpire, 0)
+	})
+
+	return e
+}
+
+func TestLeaderCampaign(t *testing.T) {
+	c := newFakeCache()
+
+	elected, demoted := 0, 0
+	e := electTestLeader(t)
+	e.onElected = func() { elected++ }
+	e.onDemoted = func() { demoted++ }
+
+	// redis err in the lease, keep the leader
+	c.leaderErr = xerrors.New("redis timeout")
+	e.campaign()
+	if !isLeader() || demoted != 0 {
+		t.Fatal("leader demoted by redis err in the lease")
+	}
+
+	// lease expired without renew, leader-only jobs stop, but not demoted before other take over
+	atomic.StoreInt64(&leaderLeaseExpire, time.Now().Add(-time.Second).UnixNano())
+	e.campaign()
+	if isLeader() {
+		t.Fatal("leader-only jobs run after the lease expired")
+	}
+
+	if demoted != 0 {
+		t.Fatal("leader demoted without other holder")
+	}
+
+	// renewed after redis recovered
+	c.leaderErr = nil
+	e.campaign()
+	if !isLeader() || elected != 0 {
+		t.Fatal("leader not renewed after redis recovered")
+	}
+
+	// other scheduler hold the lease
+	c.leader = "other"
+	e.campaign()
+	if isLeader() || demoted != 1 {
+		t.Fatal("leader not demoted after other scheduler hold the lease")
+	}
+
+	c.leader = ""
+	e.campaign()
+	if !isLeader() || elected != 1 {
+		t.Fatal("scheduler not elected after the lease released")
+	}
+}
+
+func TestLeaderResign(t *testing.T) {
+	c := newFakeCache()
+
+	e := electTestLeader(t)
+	e.resign()
+
+	if isLeader() || c.leader != "" {
+		t.Fatal("leader lease not released by resign")
+	}
+
+	// no campaign after resign, other scheduler take over
+	e.campaign()
+	if isLeader() {
+		t.Fatal("campaign after resign")
+	}
+}
+
+func TestLeaderResignConcurrent(t *testing.T) {
+	newFakeCache()
+
+	e := electTestLeader(t)
+
+	// resign of the rpc and campaign of the timewheel, checked by go test -race
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			e.resign()
+		}()
+		go func() {
+			defer wg.Done()
+			e.campaign()
+		}()
+	}
+	wg.Wait()
+
+	e.resign()
+	if isLeader() {
+		t.Fatal("leader after resign")
+	}
+}
@@ -1,9 +1,22 @@
 package scheduler
 
-import "context"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// timeout of device status notify
+	locatorNotifyTimeout = 3 * time.Second
+	// locator is removed after continuous notify fail times, it connect again by health probe
+	maxLocatorNotifyFails = 3
+)
 
 // LocatorManager Locator Manager
 type LocatorManager struct {
+	lk         sync.RWMutex
 	locatorMap map[string]*Location
 	port       int
 }
@@ -15,18 +28,75 @@ func newLoactorManager(port int) *LocatorManager {
 	}
 }
 
+// isLocatorConnected the locator replica is connected with the url
+func (m *LocatorManager) isLocatorConnected(locatorID, url string) bool {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	locator, ok := m.locatorMap[locatorID]
+	return ok && locator.url == url
+}
+
 func (m *LocatorManager) addLocator(location *Location) {
+	m.lk.Lock()
+	old, ok := m.locatorMap[location.locatorID]
 	m.locatorMap[location.locatorID] = location
+	m.lk.Unlock()
+
+	if ok && old.closer != nil {
+		old.closer()
+	}
+}
+
+func (m *LocatorManager) removeLocator(location *Location) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if m.locatorMap[location.locatorID] != location {
+		return
+	}
+
+	delete(m.locatorMap, location.locatorID)
+	if location.closer != nil {
+		location.closer()
+	}
 }
 
+// notifyNodeStatusToLocator notify every locator replica, the status is idempotent
 func (m *LocatorManager) notifyNodeStatusToLocator(deviceID string, isOnline bool) {
+	m.lk.RLock()
+	locators := make([]*Location, 0, len(m.locatorMap))
 	for _, locator := range m.locatorMap {
 		if locator != nil && locator.nodeAPI != nil {
-			if isOnline {
-				locator.nodeAPI.DeviceOnline(context.Background(), deviceID, serverArea, m.port)
-			} else {
-				locator.nodeAPI.DeviceOffline(context.Background(), deviceID)
-			}
+			locators = append(locators, locator)
 		}
 	}
+	m.lk.RUnlock()
+
+	for _, locator := range locators {
+		go m.notifyLocator(locator, deviceID, isOnline)
+	}
+}
+
+func (m *LocatorManager) notifyLocator(locator *Location, deviceID string, isOnline bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), locatorNotifyTimeout)
+	defer cancel()
+
+	var err error
+	if isOnline {
+		err = locator.nodeAPI.DeviceOnline(ctx, deviceID, serverArea, m.port)
+	} else {
+		err = locator.nodeAPI.DeviceOffline(ctx, deviceID, m.port)
+	}
+
+	if err == nil {
+		atomic.StoreInt32(&locator.notifyFails, 0)
+		return
+	}
+
+	log.Warnf("notify device %s status to locator %s err:%s", deviceID, locator.locatorID, err.Error())
+	if fails := atomic.AddInt32(&locator.notifyFails, 1); fails == maxLocatorNotifyFails {
+		log.Errorf("remove locator %s after %d notify fails", locator.locatorID, fails)
+		m.removeLocator(locator)
+	}
 }
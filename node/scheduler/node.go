@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
 	"github.com/linguohua/titan/node/scheduler/db/cache"
 	"github.com/linguohua/titan/node/scheduler/db/persistent"
 	"github.com/linguohua/titan/region"
@@ -19,6 +20,9 @@ type Location struct {
 	nodeAPI   api.Locator
 	closer    jsonrpc.ClientCloser
 	locatorID string
+	url       string
+	// continuous notify fail times
+	notifyFails int32
 }
 
 // EdgeNode Edge node
@@ -46,6 +50,11 @@ type Node struct {
 
 	addr string
 
+	// reverse connection mode, the edge is called through the tunnel
+	reverse bool
+	// relay of the edge in reverse mode, empty if no relay
+	relayURL string
+
 	lastRequestTime time.Time
 }
 
@@ -81,6 +90,8 @@ func (n *Node) setNodeOnline(typeName api.NodeTypeName) error {
 		return err
 	}
 
+	renewNodeOwner(deviceID)
+
 	// err = cache.GetDB().SetNodeToGeoList(deviceID, geoInfo.Geo)
 	// if err != nil {
 	// 	log.Errorf("SetNodeToGeoList err:%v,deviceID:%v,Geo:%v", err.Error(), deviceID, geoInfo.Geo)
@@ -103,7 +114,17 @@ func (n *Node) setNodeOffline(deviceID string, geoInfo *region.GeoInfo, nodeType
 	// 	log.Warnf("node offline RemoveNodeWithGeoList err : %v ,deviceID : %v", err.Error(), deviceID)
 	// }
 
-	err := persistent.GetDB().SetNodeInfo(deviceID, &persistent.NodeInfo{
+	if isNodeOwnedByOther(deviceID) {
+		log.Infof("node %s is owned by other scheduler, skip offline", deviceID)
+		return
+	}
+
+	err := cache.GetDB().RemoveNodeOwner(deviceID, schedulerID)
+	if err != nil {
+		log.Errorf("node offline RemoveNodeOwner err : %s ,deviceID : %s", err.Error(), deviceID)
+	}
+
+	err = persistent.GetDB().SetNodeInfo(deviceID, &persistent.NodeInfo{
 		Geo:      geoInfo.Geo,
 		LastTime: lastTime.Format("2006-01-02 15:04:05"),
 		IsOnline: 0,
@@ -186,6 +207,8 @@ func (n *Node) getReqCacheDatas(nodeManager *NodeManager, cids []string, carFile
 			continue
 		}
 
+		// download from the candidate of the same isp
+		candidates = sameISPCandidates(candidates, n.deviceInfo.Operator)
 		candidate := candidates[randomNum(0, len(candidates))]
 
 		deviceID := candidate.deviceInfo.DeviceId
@@ -203,7 +226,20 @@ func (n *Node) getReqCacheDatas(nodeManager *NodeManager, cids []string, carFile
 	for deviceID, list := range csMap {
 		node := nodeManager.getCandidateNode(deviceID)
 		if node != nil {
-			reqList = append(reqList, api.ReqCacheData{BlockInfos: list, CandidateURL: node.addr, CardFileCid: carFileCid, CacheID: cacheID})
+			cidList := make([]string, 0, len(list))
+			for _, info := range list {
+				cidList = append(cidList, info.Cid)
+			}
+
+			// node download blocks from candidate with the ticket
+			tk, err := issueTicket(deviceID, &token.Ticket{Cids: cidList}, cacheTicketExpireAfter)
+			if err != nil {
+				log.Errorf("deviceID:%s,issueTicket:%s", deviceID, err.Error())
+				notFindCandidateDatas = append(notFindCandidateDatas, list...)
+				continue
+			}
+
+			reqList = append(reqList, api.ReqCacheData{BlockInfos: list, CandidateURL: node.addr, CardFileCid: carFileCid, CacheID: cacheID, DownloadTicket: tk})
 		} else {
 			notFindCandidateDatas = append(notFindCandidateDatas, list...)
 		}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/api/client"
+	"github.com/linguohua/titan/node/cert"
+	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/repo"
+	"golang.org/x/xerrors"
+)
+
+var (
+	nodeCA *cert.CA
+	// tls config with the scheduler certificate, scheduler connect back to nodes with it
+	schedulerTLS *tls.Config
+	// node must connect with tls certificate
+	requireNodeTLS bool
+
+	// ca of the download server certificates
+	downloadCA *cert.CA
+	// per-node hostnames of the download servers are under it
+	downloadDomain string
+)
+
+// InitNodeTLS load the ca of scheduler and return the tls config of scheduler rpc server
+func InitNodeTLS(lr repo.LockedRepo, require bool) (*tls.Config, error) {
+	ca, err := cert.NewCA(lr)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := cert.LoadOrCreateKey(lr, cert.KeyName)
+	if err != nil {
+		return nil, err
+	}
+
+	certDER, err := ca.IssueCert(&key.PublicKey, fmt.Sprintf("scheduler_%s", serverArea), nodeTypeName(api.NodeScheduler))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := cert.NewTLSConfig(key, certDER, ca.CertDER())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("node ca fingerprint:%s", cert.Fingerprint(ca.CertDER()))
+
+	schedulerTLS = cfg
+	nodeCA = ca
+	requireNodeTLS = require
+
+	return cfg, nil
+}
+
+func issueNodeCert(deviceID, secret string, csr []byte) (api.NodeCertInfo, error) {
+	if nodeCA == nil {
+		return api.NodeCertInfo{}, xerrors.New("node tls not init")
+	}
+
+	info, err := checkSecret(deviceID, secret)
+	if err != nil {
+		return api.NodeCertInfo{}, err
+	}
+
+	certDER, err := nodeCA.IssueNodeCert(csr, deviceID, nodeTypeName(api.NodeType(info.NodeType)))
+	if err != nil {
+		return api.NodeCertInfo{}, xerrors.Errorf("issue cert err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+
+	return api.NodeCertInfo{Cert: certDER, CACert: nodeCA.CertDER()}, nil
+}
+
+// InitDownloadTLS set the ca and domain of the download server certificates,
+// the node ca is used if ca files not set, it must be called after InitNodeTLS
+func InitDownloadTLS(domain, caCertPath, caKeyPath string) error {
+	downloadDomain = domain
+	downloadCA = nodeCA
+
+	if caCertPath == "" {
+		return nil
+	}
+
+	ca, err := cert.LoadCA(caCertPath, caKeyPath)
+	if err != nil {
+		return xerrors.Errorf("load download ca: %w", err)
+	}
+
+	downloadCA = ca
+	return nil
+}
+
+func issueDownloadCert(deviceID, secret, ip string, csr []byte) (api.DownloadCertInfo, error) {
+	if downloadCA == nil {
+		return api.DownloadCertInfo{}, xerrors.New("download tls not init")
+	}
+
+	_, err := checkSecret(deviceID, secret)
+	if err != nil {
+		return api.DownloadCertInfo{}, err
+	}
+
+	hostname := cert.DownloadHostname(deviceID, downloadDomain)
+	certDER, err := downloadCA.IssueDownloadCert(csr, deviceID, hostname, ip)
+	if err != nil {
+		return api.DownloadCertInfo{}, xerrors.Errorf("issue download cert err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+
+	return api.DownloadCertInfo{Certs: [][]byte{certDER, downloadCA.CertDER()}, Hostname: hostname}, nil
+}
+
+// nodeURL rpc url of the node, node connect with tls certificate is connected back by tls
+func nodeURL(ctx context.Context, deviceID string, port int) (string, error) {
+	ip := handler.GetRequestIP(ctx)
+	return nodeHostURL(ctx, deviceID, fmt.Sprintf("%s:%d", ip, port))
+}
+
+// nodeHostURL rpc url of the node at the host
+func nodeHostURL(ctx context.Context, deviceID, host string) (string, error) {
+	peerID := handler.GetPeerID(ctx)
+	if peerID == "" {
+		if requireNodeTLS {
+			return "", xerrors.Errorf("node tls certificate required,deviceID:%s", deviceID)
+		}
+
+		return fmt.Sprintf("http://%s/rpc/v0", host), nil
+	}
+
+	if peerID != deviceID {
+		return "", xerrors.Errorf("certificate device %s mismatch %s", peerID, deviceID)
+	}
+
+	return fmt.Sprintf("https://%s/rpc/v0", host), nil
+}
+
+// setNodeTLS the node at the url is connected with the scheduler certificate, it must present the certificate of the device
+func setNodeTLS(url, deviceID string) {
+	if schedulerTLS == nil {
+		return
+	}
+
+	client.SetAddrTLSConfig(url, cert.WithPeerCheck(schedulerTLS, cert.ExpectCommonName(deviceID)))
+}
+
+// nodeTypeName organizational unit of the certificate
+func nodeTypeName(nodeType api.NodeType) string {
+	switch nodeType {
+	case api.NodeEdge:
+		return string(api.TypeNameEdge)
+	case api.NodeCandidate:
+		return string(api.TypeNameCandidate)
+	case api.NodeScheduler:
+		return cert.UnitScheduler
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/common"
+	"github.com/linguohua/titan/node/helper"
+)
+
+func TestNodeToken(t *testing.T) {
+	s := &Scheduler{CommonAPI: common.CommonAPI{APISecret: jwt.NewHS256([]byte("test-key"))}}
+	ctx := context.Background()
+
+	tk, err := s.nodeToken(ctx, "e_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AuthVerifyRequest(ctx, string(tk)); err == nil {
+		t.Error("node token is accepted by scheduler")
+	}
+
+	perms, err := helper.NodeAuthVerify("e_1", s.AuthVerify)(ctx, string(tk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(perms, []auth.Permission{api.PermRead, api.PermWrite, api.PermAdmin}) {
+		t.Errorf("permissions of node token: %v", perms)
+	}
+
+	if _, err := helper.NodeAuthVerify("e_2", s.AuthVerify)(ctx, string(tk)); err == nil {
+		t.Error("node token is accepted by other node")
+	}
+
+	// tokens created by the scheduler secret still call the node
+	admin, err := s.AuthNew(ctx, api.AllPermissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := helper.NodeAuthVerify("e_1", s.AuthVerify)(ctx, string(admin)); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,7 +1,6 @@
 package scheduler
 
 import (
-	"context"
 	"sort"
 	"sync"
 	"time"
@@ -9,6 +8,7 @@ import (
 	"github.com/linguohua/titan/api"
 	"github.com/linguohua/titan/node/scheduler/db/cache"
 	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"github.com/linguohua/titan/node/tunnel"
 	"github.com/ouqiang/timewheel"
 	"golang.org/x/xerrors"
 )
@@ -34,11 +34,15 @@ type NodeManager struct {
 	timewheelKeepalive *timewheel.TimeWheel
 	keepaliveTime      float64 // keepalive time interval (minute)
 
-	validatePool   *ValidatePool
-	locatorManager *LocatorManager
+	validatePool        *ValidatePool
+	locatorManager      *LocatorManager
+	restrictionManager  *RestrictionManager
+	areaManager         *AreaManager
+	reachabilityManager *ReachabilityManager
+	// tunnels of edges in reverse connection mode
+	tunnelHub *tunnel.Hub
 
 	state api.StateNetwork
-	// areaManager *AreaManager
 }
 
 func newNodeManager(pool *ValidatePool, locatorManager *LocatorManager) *NodeManager {
@@ -46,9 +50,12 @@ func newNodeManager(pool *ValidatePool, locatorManager *LocatorManager) *NodeMan
 		keepaliveTime:  0.5,
 		validatePool:   pool,
 		locatorManager: locatorManager,
-		// areaManager:   &AreaManager{},
 	}
 
+	nodeManager.restrictionManager = newRestrictionManager(nodeManager)
+	nodeManager.areaManager = newAreaManager(nodeManager)
+	nodeManager.reachabilityManager = newReachabilityManager(nodeManager)
+	nodeManager.tunnelHub = tunnel.NewHub(nodeManager.tunnelClosed)
 	nodeManager.stateNetwork()
 	nodeManager.initKeepaliveTimewheel()
 
@@ -91,6 +98,9 @@ func (m *NodeManager) nodeKeepalive() {
 		if err != nil {
 			log.Warnf("IncrNodeOnlineTime err:%s,deviceID:%s", err.Error(), deviceID)
 		}
+		incrRewardStat(deviceID, cache.RewardFieldOnlineMinutes, m.keepaliveTime)
+		incrReputation(deviceID, cache.ReputationFieldOnlineMinutes, m.keepaliveTime)
+		renewNodeOwner(deviceID)
 
 		return true
 	})
@@ -116,6 +126,9 @@ func (m *NodeManager) nodeKeepalive() {
 		if err != nil {
 			log.Warnf("IncrNodeOnlineTime err:%s,deviceID:%s", err.Error(), deviceID)
 		}
+		incrRewardStat(deviceID, cache.RewardFieldOnlineMinutes, m.keepaliveTime)
+		incrReputation(deviceID, cache.ReputationFieldOnlineMinutes, m.keepaliveTime)
+		renewNodeOwner(deviceID)
 
 		return true
 	})
@@ -134,13 +147,14 @@ func (m *NodeManager) edgeOnline(node *EdgeNode) error {
 	// 	log.Warnf("edgeOnline GetGeoInfo err:%v,node:%v", err, node.deviceInfo.ExternalIp)
 	// }
 
-	isOk, geoInfo := ipLegality(node.deviceInfo.ExternalIp)
-	if !isOk {
-		log.Errorf("edgeOnline err DeviceId:%s,ip%s,geo:%s", deviceID, node.deviceInfo.ExternalIp, geoInfo.Geo)
-		return xerrors.Errorf(ErrAreaNotExist, geoInfo.Geo, node.deviceInfo.ExternalIp)
+	geoInfo, err := m.areaManager.nodeArea(deviceID, node.deviceInfo.ExternalIp, api.TypeNameEdge)
+	if err != nil {
+		log.Errorf("edgeOnline err DeviceId:%s,ip%s,geo:%s,err:%s", deviceID, node.deviceInfo.ExternalIp, geoInfo.Geo, err.Error())
+		return err
 	}
 
 	node.geoInfo = geoInfo
+	node.deviceInfo.Operator = geoInfo.ISP
 
 	nodeOld := m.getEdgeNode(deviceID)
 	if nodeOld != nil {
@@ -149,7 +163,7 @@ func (m *NodeManager) edgeOnline(node *EdgeNode) error {
 		nodeOld = nil
 	}
 
-	err := node.setNodeOnline(api.TypeNameEdge)
+	err = node.setNodeOnline(api.TypeNameEdge)
 	if err != nil {
 		return err
 	}
@@ -175,6 +189,24 @@ func (m *NodeManager) getEdgeNode(deviceID string) *EdgeNode {
 	return nil
 }
 
+// getNodeExternalIP external ip of the online node, or of the cached device info
+func (m *NodeManager) getNodeExternalIP(deviceID string) string {
+	if node := m.getEdgeNode(deviceID); node != nil {
+		return node.deviceInfo.ExternalIp
+	}
+
+	if node := m.getCandidateNode(deviceID); node != nil {
+		return node.deviceInfo.ExternalIp
+	}
+
+	info, err := cache.GetDB().GetDeviceInfo(deviceID)
+	if err != nil {
+		return ""
+	}
+
+	return info.ExternalIp
+}
+
 func (m *NodeManager) getNodeArea(deviceID string) string {
 	e := m.getEdgeNode(deviceID)
 	if e != nil {
@@ -199,12 +231,44 @@ func (m *NodeManager) edgeOffline(node *EdgeNode) {
 	m.edgeNodeMap.Delete(deviceID)
 	// m.areaManager.removeEdge(node)
 	m.validatePool.removeEdge(deviceID)
+	m.reachabilityManager.remove(deviceID)
 
 	node.setNodeOffline(deviceID, node.geoInfo, api.TypeNameEdge, node.lastRequestTime)
 
 	m.locatorManager.notifyNodeStatusToLocator(deviceID, false)
 }
 
+// nodeOffline disconnect a online node
+func (m *NodeManager) nodeOffline(deviceID string) {
+	if edge := m.getEdgeNode(deviceID); edge != nil {
+		m.edgeOffline(edge)
+		return
+	}
+
+	if candidate := m.getCandidateNode(deviceID); candidate != nil {
+		m.candidateOffline(candidate)
+	}
+}
+
+// disconnectAllNodes disconnect all nodes when the scheduler is standby
+func (m *NodeManager) disconnectAllNodes() {
+	deviceIDs := make([]string, 0)
+
+	m.edgeNodeMap.Range(func(key, value interface{}) bool {
+		deviceIDs = append(deviceIDs, key.(string))
+		return true
+	})
+
+	m.candidateNodeMap.Range(func(key, value interface{}) bool {
+		deviceIDs = append(deviceIDs, key.(string))
+		return true
+	})
+
+	for _, deviceID := range deviceIDs {
+		m.nodeOffline(deviceID)
+	}
+}
+
 func (m *NodeManager) candidateOnline(node *CandidateNode) error {
 	deviceID := node.deviceInfo.DeviceId
 
@@ -215,13 +279,14 @@ func (m *NodeManager) candidateOnline(node *CandidateNode) error {
 	// if err != nil {
 	// 	log.Warnf("candidateOnline GetGeoInfo err:%v,ExternalIp:%v", err, node.deviceInfo.ExternalIp)
 	// }
-	isOk, geoInfo := ipLegality(node.deviceInfo.ExternalIp)
-	if !isOk {
-		log.Errorf("candidateOnline err DeviceId:%s,ip%s,geo:%s", deviceID, node.deviceInfo.ExternalIp, geoInfo.Geo)
-		return xerrors.Errorf(ErrAreaNotExist, geoInfo.Geo, node.deviceInfo.ExternalIp)
+	geoInfo, err := m.areaManager.nodeArea(deviceID, node.deviceInfo.ExternalIp, api.TypeNameCandidate)
+	if err != nil {
+		log.Errorf("candidateOnline err DeviceId:%s,ip%s,geo:%s,err:%s", deviceID, node.deviceInfo.ExternalIp, geoInfo.Geo, err.Error())
+		return err
 	}
 
 	node.geoInfo = geoInfo
+	node.deviceInfo.Operator = geoInfo.ISP
 
 	nodeOld := m.getCandidateNode(deviceID)
 	if nodeOld != nil {
@@ -230,7 +295,7 @@ func (m *NodeManager) candidateOnline(node *CandidateNode) error {
 		nodeOld = nil
 	}
 
-	err := node.setNodeOnline(api.TypeNameCandidate)
+	err = node.setNodeOnline(api.TypeNameCandidate)
 	if err != nil {
 		// log.Errorf("addCandidateNode NodeOnline err:%v", err)
 		return err
@@ -274,6 +339,11 @@ func (m *NodeManager) candidateOffline(node *CandidateNode) {
 	m.locatorManager.notifyNodeStatusToLocator(deviceID, false)
 }
 
+// isNodeRestricted quarantined or banned node is not used for placement and routing
+func (m *NodeManager) isNodeRestricted(node *Node) bool {
+	return m.restrictionManager.isRestricted(node.deviceInfo.DeviceId, node.deviceInfo.ExternalIp)
+}
+
 func (m *NodeManager) findEdgeNodes(useDeviceIDs []string, filterDeviceIDs map[string]string) []*EdgeNode {
 	if filterDeviceIDs == nil {
 		filterDeviceIDs = make(map[string]string)
@@ -292,7 +362,7 @@ func (m *NodeManager) findEdgeNodes(useDeviceIDs []string, filterDeviceIDs map[s
 			}
 
 			node := m.getEdgeNode(dID)
-			if node != nil {
+			if node != nil && !m.isNodeRestricted(&node.Node) {
 				list = append(list, node)
 			}
 		}
@@ -305,7 +375,7 @@ func (m *NodeManager) findEdgeNodes(useDeviceIDs []string, filterDeviceIDs map[s
 				return true
 			}
 
-			if node == nil {
+			if node == nil || m.isNodeRestricted(&node.Node) {
 				return true
 			}
 			list = append(list, node)
@@ -350,7 +420,7 @@ func (m *NodeManager) findCandidateNodes(useDeviceIDs []string, filterDeviceIDs
 			}
 			// node, ok := eMap[dID]
 			node := m.getCandidateNode(dID)
-			if node != nil {
+			if node != nil && !m.isNodeRestricted(&node.Node) {
 				list = append(list, node)
 			}
 		}
@@ -363,7 +433,7 @@ func (m *NodeManager) findCandidateNodes(useDeviceIDs []string, filterDeviceIDs
 				return true
 			}
 
-			if node == nil {
+			if node == nil || m.isNodeRestricted(&node.Node) {
 				return true
 			}
 			list = append(list, node)
@@ -495,31 +565,14 @@ func (m *NodeManager) updateLastRequestTime(deviceID string) {
 	}
 }
 
-// getNodeURLWithData find device
-func (m *NodeManager) findNodeDownloadInfo(cid string) (api.DownloadInfo, error) {
-	var downloadInfo api.DownloadInfo
-	deviceIDs, err := persistent.GetDB().GetNodesWithCacheList(cid)
+// findNodeDownloadInfo find the best node with the cid for the client, return the download info and device id of the node
+func (m *NodeManager) findNodeDownloadInfo(cid, clientIP string) (api.DownloadInfo, string, error) {
+	infos, deviceIDs, err := m.findNodeDownloadInfos(cid, clientIP, 1)
 	if err != nil {
-		return downloadInfo, err
-	}
-
-	if len(deviceIDs) <= 0 {
-		return downloadInfo, xerrors.Errorf("%s , whit cid:%s", ErrNodeNotFind, cid)
-	}
-
-	nodeEs := m.findEdgeNodes(deviceIDs, nil)
-	if nodeEs != nil {
-		node := nodeEs[randomNum(0, len(nodeEs))]
-		return node.nodeAPI.GetDownloadInfo(context.Background())
-	}
-
-	nodeCs := m.findCandidateNodes(deviceIDs, nil)
-	if nodeCs != nil {
-		node := nodeCs[randomNum(0, len(nodeCs))]
-		return node.nodeAPI.GetDownloadInfo(context.Background())
+		return api.DownloadInfo{}, "", err
 	}
 
-	return downloadInfo, xerrors.Errorf("%s , whit cid:%s", ErrNodeNotFind, cid)
+	return infos[0], deviceIDs[0], nil
 }
 
 // getCandidateNodesWithData find device
@@ -1,13 +1,17 @@
 package scheduler
 
 import (
-	"crypto/sha1"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/handler"
 	"github.com/linguohua/titan/node/scheduler/db/persistent"
 	"golang.org/x/xerrors"
 )
@@ -20,15 +24,20 @@ func registerNode(nodeType api.NodeType) (api.NodeRegisterInfo, error) {
 		return info, err
 	}
 
-	secret := newSecret(deviceID)
+	secret, err := newSecret()
+	if err != nil {
+		return info, err
+	}
 
-	err = persistent.GetDB().BindRegisterInfo(secret, deviceID, nodeType)
+	// only the secret hash is saved
+	err = persistent.GetDB().BindRegisterInfo(hashSecret(secret), deviceID, nodeType)
 	if err != nil {
 		return info, err
 	}
 
 	info.DeviceID = deviceID
 	info.Secret = secret
+	info.NodeType = int(nodeType)
 
 	return info, nil
 }
@@ -55,33 +64,146 @@ func newDeviceID(nodeType api.NodeType) (string, error) {
 	return "", xerrors.Errorf("nodetype err:%d", nodeType)
 }
 
-func newSecret(input string) string {
-	c := sha1.New()
-	c.Write([]byte(input))
+func newSecret() (string, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// isSecretHash the saved secret is a sha256 hash, the secrets registered before hashing are saved as plaintext,
+// they are derivable from the device id and are not accepted
+func isSecretHash(saved string) bool {
+	if len(saved) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(saved)
+	return err == nil
+}
+
+func hashSecret(secret string) string {
+	c := sha256.New()
+	c.Write([]byte(secret))
 	bytes := c.Sum(nil)
 	return hex.EncodeToString(bytes)
 }
 
+// checkSecret check the device secret with the saved hash
+func checkSecret(deviceID, secret string) (*api.NodeRegisterInfo, error) {
+	info, err := persistent.GetDB().GetRegisterInfo(deviceID)
+	if err != nil {
+		return nil, xerrors.Errorf("info err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+
+	if info.Secret == "" {
+		return nil, xerrors.Errorf("err:%s,deviceID:%s", ErrSecretMismatch, deviceID)
+	}
+
+	if !isSecretHash(info.Secret) {
+		return nil, xerrors.Errorf("err:%s,deviceID:%s, legacy secret must be rotated by admin", ErrSecretMismatch, deviceID)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(info.Secret), []byte(hashSecret(secret))) != 1 {
+		return nil, xerrors.Errorf("err:%s,deviceID:%s", ErrSecretMismatch, deviceID)
+	}
+
+	return info, nil
+}
+
+// issueToken check the device secret and issue a node token
+func issueToken(deviceID, secret string) (string, error) {
+	info, err := checkSecret(deviceID, secret)
+	if err != nil {
+		return "", err
+	}
+
+	return generateToken(deviceID, api.NodeType(info.NodeType), info.Secret)
+}
+
 func verifySecret(token string, nodeType api.NodeType) (string, error) {
-	deviceID, secret, err := parseToken(token)
+	deviceID, tokenNodeType, info, err := verifyToken(token)
+	if err != nil {
+		return deviceID, err
+	}
+
+	if info.NodeType != int(nodeType) || tokenNodeType != nodeType {
+		return deviceID, xerrors.Errorf("err:%s,deviceID:%s,nodeType:%v,info_n:%v", "node type mismatch", deviceID, nodeType, info.NodeType)
+	}
+
+	return deviceID, nil
+}
+
+// verifyToken check the node token is bound to the current secret of the device
+func verifyToken(token string) (string, api.NodeType, *api.NodeRegisterInfo, error) {
+	deviceID, nodeType, secretHash, err := parseToken(token)
+	if err != nil {
+		return deviceID, nodeType, nil, xerrors.Errorf("token err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+
+	info, err := persistent.GetDB().GetRegisterInfo(deviceID)
 	if err != nil {
-		return deviceID, xerrors.Errorf("token err:%s,deviceID:%s,secret:%s", err.Error(), deviceID, secret)
+		return deviceID, nodeType, nil, xerrors.Errorf("info err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+
+	// secret revoked or rotated
+	if info.Secret == "" || subtle.ConstantTimeCompare([]byte(info.Secret), []byte(secretHash)) != 1 {
+		return deviceID, nodeType, nil, xerrors.Errorf("err:%s,deviceID:%s", ErrSecretMismatch, deviceID)
+	}
+
+	return deviceID, nodeType, info, nil
+}
+
+// nodeOfRequest device of the tls certificate or the node token,
+// token is required if request is not from tls client, device of the token must be the device of the certificate
+func nodeOfRequest(ctx context.Context, token string) (string, error) {
+	peerID := handler.GetPeerID(ctx)
+	if token == "" {
+		if peerID == "" {
+			return "", xerrors.New("node token or tls certificate is required")
+		}
+		return peerID, nil
+	}
+
+	deviceID, _, _, err := verifyToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	if peerID != "" && peerID != deviceID {
+		return "", xerrors.Errorf("certificate device %s mismatch %s", peerID, deviceID)
 	}
 
 	return deviceID, nil
+}
+
+func revokeSecret(deviceID string) error {
+	_, err := persistent.GetDB().GetRegisterInfo(deviceID)
+	if err != nil {
+		return xerrors.Errorf("info err:%s,deviceID:%s", err.Error(), deviceID)
+	}
 
-	// info, err := persistent.GetDB().GetRegisterInfo(deviceID)
-	// if err != nil {
-	// 	return deviceID, xerrors.Errorf("info err:%s,deviceID:%s,secret:%s", err.Error(), deviceID, secret)
-	// }
+	return persistent.GetDB().UpdateRegisterSecret(deviceID, "")
+}
+
+func rotateSecret(deviceID string) (api.NodeRegisterInfo, error) {
+	info, err := persistent.GetDB().GetRegisterInfo(deviceID)
+	if err != nil {
+		return api.NodeRegisterInfo{}, xerrors.Errorf("info err:%s,deviceID:%s", err.Error(), deviceID)
+	}
 
-	// if info.Secret != secret {
-	// 	return deviceID, xerrors.Errorf("err:%s,deviceID:%s,secret:%s,info_s:%s", "secret mismatch", deviceID, secret, info.Secret)
-	// }
+	secret, err := newSecret()
+	if err != nil {
+		return api.NodeRegisterInfo{}, err
+	}
 
-	// if info.NodeType != int(nodeType) {
-	// 	return deviceID, xerrors.Errorf("err:%s,deviceID:%s,nodeType:%v,info_n:%v", "node type mismatch", deviceID, nodeType, info.NodeType)
-	// }
+	err = persistent.GetDB().UpdateRegisterSecret(deviceID, hashSecret(secret))
+	if err != nil {
+		return api.NodeRegisterInfo{}, err
+	}
 
-	// return deviceID, nil
+	return api.NodeRegisterInfo{DeviceID: deviceID, Secret: secret, NodeType: info.NodeType, CreateTime: info.CreateTime}, nil
 }
@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/handler"
+)
+
+func TestSecret(t *testing.T) {
+	db := newFakeDB()
+	nodeTokenKey = []byte("test-key")
+
+	info, err := registerNode(api.NodeEdge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ := db.GetRegisterInfo(info.DeviceID)
+	if saved.Secret == info.Secret || !isSecretHash(saved.Secret) {
+		t.Fatalf("secret should be saved as hash")
+	}
+
+	if _, err := checkSecret(info.DeviceID, "wrong"); err == nil {
+		t.Errorf("wrong secret should be rejected")
+	}
+
+	token, err := issueToken(info.DeviceID, info.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deviceID, err := verifySecret(token, api.NodeEdge)
+	if err != nil || deviceID != info.DeviceID {
+		t.Fatalf("verify token err:%v, deviceID:%s", err, deviceID)
+	}
+
+	if _, err := verifySecret(token, api.NodeCandidate); err == nil {
+		t.Errorf("token of edge should be rejected for candidate")
+	}
+
+	if _, err := rotateSecret(info.DeviceID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifySecret(token, api.NodeEdge); err == nil {
+		t.Errorf("token of rotated secret should be rejected")
+	}
+
+	if err := revokeSecret(info.DeviceID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkSecret(info.DeviceID, ""); err == nil {
+		t.Errorf("revoked secret should be rejected")
+	}
+}
+
+func TestLegacySecret(t *testing.T) {
+	db := newFakeDB()
+	nodeTokenKey = []byte("test-key")
+
+	// secrets registered before hashing are sha1 hex of device id saved as plaintext
+	legacy := "0a4d55a8d778e5022fab701977c5d840bbc486d0"
+	db.BindRegisterInfo(legacy, "e_legacy", api.NodeEdge)
+
+	if _, err := issueToken("e_legacy", legacy); err == nil {
+		t.Fatal("legacy plaintext secret should be rejected")
+	}
+
+	info, err := rotateSecret("e_legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := issueToken("e_legacy", info.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifySecret(token, api.NodeEdge); err != nil {
+		t.Errorf("token of rotated secret err:%v", err)
+	}
+
+	// the hash can not be used as the secret
+	saved, _ := db.GetRegisterInfo("e_legacy")
+	if _, err := checkSecret("e_legacy", saved.Secret); err == nil {
+		t.Errorf("hash should not be accepted as secret")
+	}
+}
+
+func TestTokenExpire(t *testing.T) {
+	db := newFakeDB()
+	nodeTokenKey = []byte("test-key")
+
+	info, err := registerNode(api.NodeEdge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ := db.GetRegisterInfo(info.DeviceID)
+
+	claims := jwt.MapClaims{
+		"deviceID":   info.DeviceID,
+		"nodeType":   int(api.NodeEdge),
+		"secretHash": saved.Secret,
+		"exp":        time.Now().Add(-time.Minute).Unix(),
+	}
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(nodeTokenKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifySecret(expired, api.NodeEdge); err == nil {
+		t.Error("expired token is accepted")
+	}
+
+	token, err := issueToken(info.DeviceID, info.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp, _ := parsed.Claims.(jwt.MapClaims)["exp"].(float64)
+	if time.Until(time.Unix(int64(exp), 0)) > nodeTokenExpire || time.Until(time.Unix(int64(exp), 0)) < nodeTokenExpire-time.Minute {
+		t.Errorf("token expire %v mismatch", time.Unix(int64(exp), 0))
+	}
+}
+
+func TestNodeOfRequest(t *testing.T) {
+	newFakeDB()
+	nodeTokenKey = []byte("test-key")
+
+	info, err := registerNode(api.NodeEdge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := issueToken(info.DeviceID, info.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := nodeOfRequest(ctx, ""); err == nil {
+		t.Error("request without token and certificate is accepted")
+	}
+
+	if deviceID, err := nodeOfRequest(ctx, token); err != nil || deviceID != info.DeviceID {
+		t.Errorf("node of token err:%v, deviceID:%s", err, deviceID)
+	}
+
+	if _, err := nodeOfRequest(ctx, "forged"); err == nil {
+		t.Error("forged token is accepted")
+	}
+
+	tlsCtx := context.WithValue(ctx, handler.PeerID{}, info.DeviceID)
+	if deviceID, err := nodeOfRequest(tlsCtx, ""); err != nil || deviceID != info.DeviceID {
+		t.Errorf("node of certificate err:%v, deviceID:%s", err, deviceID)
+	}
+
+	otherCtx := context.WithValue(ctx, handler.PeerID{}, "e_other")
+	if _, err := nodeOfRequest(otherCtx, token); err == nil {
+		t.Error("token of other device than the certificate is accepted")
+	}
+}
@@ -1,33 +1,78 @@
 package scheduler
 
 import (
+	"time"
+
 	"github.com/dgrijalva/jwt-go"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/repo"
+	"github.com/linguohua/titan/node/secret"
+	"golang.org/x/xerrors"
 )
 
-// nowDate = time.Now().Format("2006-01-02 15")
-// secret  = fmt.Sprintf("%v%v", nowDate, "xxxx")
+// node gets the token again before it expired
+const nodeTokenExpire = 24 * time.Hour
+
+// key to sign node tokens, load from scheduler repo keystore
+var nodeTokenKey []byte
+
+func initNodeTokenKey(lr repo.LockedRepo) error {
+	key, err := secret.NodeTokenSecret(lr)
+	if err != nil {
+		return err
+	}
+
+	nodeTokenKey = key
+	return nil
+}
 
-var secretKey = "00112233"
+// token bind to the secret hash, so token invalid after secret revoke or rotate
+func generateToken(deviceID string, nodeType api.NodeType, secretHash string) (string, error) {
+	if len(nodeTokenKey) == 0 {
+		return "", xerrors.New("node token key not init")
+	}
 
-func generateToken(deviceID, secret string) (string, error) {
 	dict := make(jwt.MapClaims)
 	dict["deviceID"] = deviceID
-	dict["secret"] = secret
+	dict["nodeType"] = int(nodeType)
+	dict["secretHash"] = secretHash
+	dict["exp"] = time.Now().Add(nodeTokenExpire).Unix()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, dict)
-	return token.SignedString([]byte(secretKey))
+	return token.SignedString(nodeTokenKey)
 }
 
-func parseToken(token string) (string, string, error) {
+func parseToken(token string) (deviceID string, nodeType api.NodeType, secretHash string, err error) {
+	if len(nodeTokenKey) == 0 {
+		err = xerrors.New("node token key not init")
+		return
+	}
+
 	claim, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, xerrors.Errorf("unexpected signing method:%v", token.Header["alg"])
+		}
+		return nodeTokenKey, nil
 	})
 	if err != nil {
-		return "", "", err
+		return
 	}
 
-	deviceID := claim.Claims.(jwt.MapClaims)["deviceID"].(string)
-	secret := claim.Claims.(jwt.MapClaims)["secret"].(string)
+	claims, ok := claim.Claims.(jwt.MapClaims)
+	if !ok {
+		err = xerrors.New("token claims err")
+		return
+	}
+
+	deviceID, _ = claims["deviceID"].(string)
+	secretHash, _ = claims["secretHash"].(string)
+	// json number
+	t, _ := claims["nodeType"].(float64)
+	nodeType = api.NodeType(t)
+
+	if deviceID == "" || secretHash == "" {
+		err = xerrors.New("token claims err")
+	}
 
-	return deviceID, secret, nil
+	return
 }
@@ -0,0 +1,236 @@
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// timeout of the whole probe of a edge
+	reachabilityProbeTimeout = 15 * time.Second
+	// timeout of dialing the address by scheduler
+	reachabilityDialTimeout = 3 * time.Second
+	// candidates probe the edge from other addresses
+	reachabilityProbers = 2
+)
+
+// ReachabilityManager nat detection of edges
+type ReachabilityManager struct {
+	nodeManager *NodeManager
+
+	// deviceID:*api.NodeReachability
+	results sync.Map
+}
+
+func newReachabilityManager(nodeManager *NodeManager) *ReachabilityManager {
+	return &ReachabilityManager{nodeManager: nodeManager}
+}
+
+// natType nat type of the edge, unknown if it is not probed yet
+func (r *ReachabilityManager) natType(deviceID string) string {
+	if v, ok := r.results.Load(deviceID); ok {
+		return v.(*api.NodeReachability).NatType
+	}
+
+	return api.NatTypeUnknown
+}
+
+// isRoutable users can download from the edge, the edge not probed yet is allowed
+func (r *ReachabilityManager) isRoutable(deviceID string) bool {
+	switch r.natType(deviceID) {
+	case api.NatTypeNoNAT, api.NatTypeFullCone, api.NatTypeUnknown:
+		return true
+	}
+
+	return false
+}
+
+// isUnreachable none can connect to the edge
+func (r *ReachabilityManager) isUnreachable(deviceID string) bool {
+	return r.natType(deviceID) == api.NatTypeUnreachable
+}
+
+func (r *ReachabilityManager) get(deviceID string) (api.NodeReachability, error) {
+	v, ok := r.results.Load(deviceID)
+	if !ok {
+		return api.NodeReachability{}, xerrors.Errorf("%s is not probed", deviceID)
+	}
+
+	return *v.(*api.NodeReachability), nil
+}
+
+func (r *ReachabilityManager) remove(deviceID string) {
+	r.results.Delete(deviceID)
+}
+
+// reachableEdges edges without the unreachable, the copy on them can not be downloaded
+func (m *NodeManager) reachableEdges(edges []*EdgeNode) []*EdgeNode {
+	out := make([]*EdgeNode, 0, len(edges))
+	for _, e := range edges {
+		if !m.reachabilityManager.isUnreachable(e.deviceInfo.DeviceId) {
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
+
+// probe scheduler and candidates dial the rpc and download address of the edge
+func (r *ReachabilityManager) probe(node *EdgeNode) api.NodeReachability {
+	deviceID := node.deviceInfo.DeviceId
+
+	ctx, cancel := context.WithTimeout(context.Background(), reachabilityProbeTimeout)
+	defer cancel()
+
+	result := api.NodeReachability{
+		DeviceID:        deviceID,
+		RPCAddr:         urlHost(node.addr),
+		CandidateProbes: make(map[string][]bool),
+		ProbeTime:       time.Now(),
+	}
+
+	addrs := []string{result.RPCAddr}
+	info, err := node.nodeAPI.GetDownloadInfo(ctx)
+	if err != nil {
+		log.Warnf("probe reachability GetDownloadInfo err:%s,deviceID:%s", err.Error(), deviceID)
+	} else if host := urlHost(info.URL); host != "" {
+		result.DownloadAddr = host
+		addrs = append(addrs, host)
+	}
+
+	result.SchedulerProbe = dialAddrs(ctx, addrs)
+
+	var lk sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range r.probers() {
+		wg.Add(1)
+		go func(c *CandidateNode) {
+			defer wg.Done()
+
+			probes, err := c.nodeAPI.CheckReachability(ctx, addrs)
+			if err != nil {
+				log.Warnf("probe reachability CheckReachability err:%s,candidate:%s", err.Error(), c.deviceInfo.DeviceId)
+				return
+			}
+
+			lk.Lock()
+			result.CandidateProbes[c.deviceInfo.DeviceId] = probes
+			lk.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	result.NatType, result.NatRatio = classifyNat(node.deviceInfo, result)
+
+	if r.nodeManager.getEdgeNode(deviceID) != node {
+		// the edge is offline or reconnected while probing
+		return result
+	}
+
+	r.results.Store(deviceID, &result)
+	if err := cache.GetDB().SetDeviceNat(deviceID, result.NatType, result.NatRatio); err != nil {
+		log.Errorf("probe reachability SetDeviceNat err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+
+	log.Infof("probe reachability deviceID:%s,nat:%s,ratio:%.0f", deviceID, result.NatType, result.NatRatio)
+	return result
+}
+
+// probers random online candidates
+func (r *ReachabilityManager) probers() []*CandidateNode {
+	candidates := r.nodeManager.findCandidateNodes(nil, nil)
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	if len(candidates) > reachabilityProbers {
+		candidates = candidates[:reachabilityProbers]
+	}
+
+	return candidates
+}
+
+// classifyNat the prober reach the edge if it connect to all the addresses
+func classifyNat(info api.DevicesInfo, result api.NodeReachability) (string, float64) {
+	attempts, successes := 0, 0
+	reached := func(probes []bool) bool {
+		ok := len(probes) > 0
+		for _, p := range probes {
+			attempts++
+			if p {
+				successes++
+			} else {
+				ok = false
+			}
+		}
+		return ok
+	}
+
+	byScheduler := reached(result.SchedulerProbe)
+	byCandidate := false
+	for _, probes := range result.CandidateProbes {
+		if reached(probes) {
+			byCandidate = true
+		}
+	}
+
+	ratio := 0.0
+	if attempts > 0 {
+		ratio = float64(successes) * 100 / float64(attempts)
+	}
+
+	switch {
+	case byCandidate && info.InternalIp != "" && info.InternalIp == info.ExternalIp:
+		return api.NatTypeNoNAT, ratio
+	case byCandidate:
+		return api.NatTypeFullCone, ratio
+	case len(result.CandidateProbes) == 0 && byScheduler:
+		return api.NatTypeUnknown, ratio
+	case byScheduler:
+		return api.NatTypeRestricted, ratio
+	}
+
+	return api.NatTypeUnreachable, ratio
+}
+
+// dialAddrs dial the addresses concurrently, true if connected
+func dialAddrs(ctx context.Context, addrs []string) []bool {
+	results := make([]bool, len(addrs))
+
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+
+			dialer := net.Dialer{Timeout: reachabilityDialTimeout}
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return
+			}
+			conn.Close()
+			results[i] = true
+		}(i, addr)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// urlHost host:port of the url, empty if invalid
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/linguohua/titan/api"
+)
+
+// fakeEdgeAPI download address of the edge
+type fakeEdgeAPI struct {
+	api.Edge
+	downloadURL string
+}
+
+func (e *fakeEdgeAPI) GetDownloadInfo(ctx context.Context) (api.DownloadInfo, error) {
+	return api.DownloadInfo{URL: e.downloadURL}, nil
+}
+
+// fakeProber candidate reach the edge if reach is set
+type fakeProber struct {
+	api.Candidate
+	reach bool
+}
+
+func (c *fakeProber) CheckReachability(ctx context.Context, addrs []string) ([]bool, error) {
+	out := make([]bool, len(addrs))
+	for i := range out {
+		out[i] = c.reach
+	}
+	return out, nil
+}
+
+func TestClassifyNat(t *testing.T) {
+	public := api.DevicesInfo{InternalIp: "8.8.8.8", ExternalIp: "8.8.8.8"}
+	behindNat := api.DevicesInfo{InternalIp: "192.168.1.2", ExternalIp: "8.8.8.8"}
+
+	cases := []struct {
+		name   string
+		info   api.DevicesInfo
+		result api.NodeReachability
+		want   string
+	}{
+		{"public ip", public, api.NodeReachability{
+			SchedulerProbe:  []bool{true, true},
+			CandidateProbes: map[string][]bool{"c_1": {true, true}},
+		}, api.NatTypeNoNAT},
+		{"full cone", behindNat, api.NodeReachability{
+			SchedulerProbe:  []bool{true, true},
+			CandidateProbes: map[string][]bool{"c_1": {false, true}, "c_2": {true, true}},
+		}, api.NatTypeFullCone},
+		{"restricted", behindNat, api.NodeReachability{
+			SchedulerProbe:  []bool{true, true},
+			CandidateProbes: map[string][]bool{"c_1": {false, false}},
+		}, api.NatTypeRestricted},
+		{"download address not reached by candidate", behindNat, api.NodeReachability{
+			SchedulerProbe:  []bool{true, true},
+			CandidateProbes: map[string][]bool{"c_1": {true, false}},
+		}, api.NatTypeRestricted},
+		{"no candidate", behindNat, api.NodeReachability{
+			SchedulerProbe: []bool{true, true},
+		}, api.NatTypeUnknown},
+		{"unreachable", behindNat, api.NodeReachability{
+			SchedulerProbe:  []bool{false, false},
+			CandidateProbes: map[string][]bool{"c_1": {false, false}},
+		}, api.NatTypeUnreachable},
+		{"nothing probed", behindNat, api.NodeReachability{}, api.NatTypeUnreachable},
+	}
+
+	for _, c := range cases {
+		if got, _ := classifyNat(c.info, c.result); got != c.want {
+			t.Errorf("%s: nat %s, want %s", c.name, got, c.want)
+		}
+	}
+
+	_, ratio := classifyNat(behindNat, api.NodeReachability{
+		SchedulerProbe:  []bool{true, true},
+		CandidateProbes: map[string][]bool{"c_1": {false, false}},
+	})
+	if ratio != 50 {
+		t.Errorf("nat ratio %v, want 50", ratio)
+	}
+}
+
+func TestIsRoutable(t *testing.T) {
+	r := newReachabilityManager(&NodeManager{})
+
+	for natType, want := range map[string]bool{
+		api.NatTypeNoNAT:       true,
+		api.NatTypeFullCone:    true,
+		api.NatTypeRestricted:  false,
+		api.NatTypeUnreachable: false,
+	} {
+		r.results.Store("e_1", &api.NodeReachability{NatType: natType})
+		if got := r.isRoutable("e_1"); got != want {
+			t.Errorf("edge of nat %s routable %v, want %v", natType, got, want)
+		}
+	}
+
+	if !r.isRoutable("not_probed") {
+		t.Error("edge not probed yet is not routable")
+	}
+}
+
+func TestProbeReachability(t *testing.T) {
+	c := newFakeCache()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	addr := lis.Addr().String()
+	m := &NodeManager{}
+	m.restrictionManager = &RestrictionManager{nodeManager: m}
+	m.reachabilityManager = newReachabilityManager(m)
+
+	edge := &EdgeNode{
+		nodeAPI: &fakeEdgeAPI{downloadURL: "https://" + addr + "/block/get"},
+		Node:    Node{deviceInfo: api.DevicesInfo{DeviceId: "e_1", InternalIp: "192.168.1.2", ExternalIp: "8.8.8.8"}, addr: "https://" + addr + "/rpc/v0"},
+	}
+	m.edgeNodeMap.Store("e_1", edge)
+
+	prober := &CandidateNode{nodeAPI: &fakeProber{}, Node: Node{deviceInfo: api.DevicesInfo{DeviceId: "c_1"}}}
+	m.candidateNodeMap.Store("c_1", prober)
+
+	// only the scheduler reach the edge
+	result := m.reachabilityManager.probe(edge)
+	if result.NatType != api.NatTypeRestricted || !reflect.DeepEqual(result.SchedulerProbe, []bool{true, true}) {
+		t.Fatalf("probe result %+v", result)
+	}
+
+	if m.reachabilityManager.isRoutable("e_1") {
+		t.Error("edge behind restricted nat is routable")
+	}
+
+	if c.nats["e_1"] != api.NatTypeRestricted {
+		t.Errorf("nat type saved %s", c.nats["e_1"])
+	}
+
+	prober.nodeAPI = &fakeProber{reach: true}
+	if result := m.reachabilityManager.probe(edge); result.NatType != api.NatTypeFullCone {
+		t.Fatalf("probe result %+v", result)
+	}
+
+	if !m.reachabilityManager.isRoutable("e_1") {
+		t.Error("edge behind full cone nat is not routable")
+	}
+
+	// the result of the edge reconnected while probing is dropped
+	m.edgeNodeMap.Store("e_1", &EdgeNode{Node: edge.Node})
+	prober.nodeAPI = &fakeProber{}
+	m.reachabilityManager.probe(edge)
+	if m.reachabilityManager.natType("e_1") != api.NatTypeFullCone {
+		t.Error("result of the old connection is saved")
+	}
+}
+
+func TestRankDownloadNodesReachability(t *testing.T) {
+	db := newFakeDB()
+	db.blocks["c1"] = []string{"e_open", "e_restricted", "e_unreachable", "e_new"}
+
+	m := &NodeManager{}
+	m.restrictionManager = &RestrictionManager{nodeManager: m}
+	m.reachabilityManager = newReachabilityManager(m)
+
+	nats := map[string]string{
+		"e_open":        api.NatTypeFullCone,
+		"e_restricted":  api.NatTypeRestricted,
+		"e_unreachable": api.NatTypeUnreachable,
+	}
+	for _, deviceID := range db.blocks["c1"] {
+		m.edgeNodeMap.Store(deviceID, &EdgeNode{Node: Node{deviceInfo: api.DevicesInfo{DeviceId: deviceID}}})
+		if natType, ok := nats[deviceID]; ok {
+			m.reachabilityManager.results.Store(deviceID, &api.NodeReachability{DeviceID: deviceID, NatType: natType})
+		}
+	}
+
+	nodes, err := m.rankDownloadNodes("c1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routed := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		routed = append(routed, n.node.deviceInfo.DeviceId)
+	}
+	sort.Strings(routed)
+
+	if !reflect.DeepEqual(routed, []string{"e_new", "e_open"}) {
+		t.Errorf("edges routed to users: %v", routed)
+	}
+
+	// the copy on the restricted edge is still downloaded by nodes
+	if got := deviceIDsOf(m.reachableEdges(m.findEdgeNodes(nil, nil))); !reflect.DeepEqual(got, []string{"e_new", "e_open", "e_restricted"}) {
+		t.Errorf("reachable edges: %v", got)
+	}
+}
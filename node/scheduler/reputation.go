@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"github.com/ouqiang/timewheel"
+)
+
+const (
+	// score of the device without any event
+	defaultReputation = 50.0
+	// events older than half life count half
+	reputationHalfLife = 7 * 24 * time.Hour
+	// latency of this value (ms) score 0.5
+	reputationLatencyRef = 100.0
+
+	uptimeWeight   = 0.3
+	validateWeight = 0.3
+	downloadWeight = 0.2
+	cacheWeight    = 0.1
+	latencyWeight  = 0.1
+)
+
+// reputations latest reputation of devices, deviceID:*api.ReputationInfo
+var reputations sync.Map
+
+// ReputationManager decay the event counters of devices and update the scores
+type ReputationManager struct {
+	nodeManager *NodeManager
+
+	updateTimewheel *timewheel.TimeWheel
+	updateTime      int // update time interval (minute)
+}
+
+func newReputationManager(nodeManager *NodeManager) *ReputationManager {
+	m := &ReputationManager{
+		nodeManager: nodeManager,
+		updateTime:  60,
+	}
+
+	// scores are loaded at startup, placement and routing do not wait the first update
+	go loadReputations()
+
+	// scores are updated when the scheduler is elected as leader
+	m.initUpdateTimewheel()
+
+	return m
+}
+
+func (m *ReputationManager) initUpdateTimewheel() {
+	m.updateTimewheel = timewheel.New(1*time.Second, 3600, func(_ interface{}) {
+		m.updateTimewheel.AddTimer(time.Duration(m.updateTime*60-1)*time.Second, "Reputation", nil)
+		if !isLeader() {
+			// standby scheduler load the scores updated by leader
+			loadReputations()
+			return
+		}
+		m.decayReputations()
+		m.updateReputations()
+	})
+	m.updateTimewheel.Start()
+	m.updateTimewheel.AddTimer(time.Duration(m.updateTime*60-1)*time.Second, "Reputation", nil)
+}
+
+func incrReputation(deviceID, field string, value float64) {
+	err := cache.GetDB().IncrReputationStats(deviceID, map[string]float64{field: value})
+	if err != nil {
+		log.Errorf("IncrReputationStats err:%s,deviceID:%s,field:%s", err.Error(), deviceID, field)
+	}
+}
+
+// decayReputations decay all counters and add the expected online time of the interval
+func (m *ReputationManager) decayReputations() {
+	stats, err := cache.GetDB().GetReputationStats()
+	if err != nil {
+		log.Errorf("decayReputations GetReputationStats err:%s", err.Error())
+		return
+	}
+
+	factor := math.Pow(0.5, float64(time.Duration(m.updateTime)*time.Minute)/float64(reputationHalfLife))
+	for _, stat := range stats {
+		if !isLeader() {
+			log.Warn("decayReputations stopped, leader lease is lost")
+			return
+		}
+
+		// decay by increments, events reported meanwhile are kept
+		values := map[string]float64{
+			cache.ReputationFieldOnlineMinutes:   stat.OnlineMinutes * (factor - 1),
+			cache.ReputationFieldExpectedMinutes: stat.ExpectedMinutes*(factor-1) + float64(m.updateTime),
+			cache.ReputationFieldValidateSuccess: stat.ValidateSuccess * (factor - 1),
+			cache.ReputationFieldValidateFail:    stat.ValidateFail * (factor - 1),
+			cache.ReputationFieldDownloadSuccess: stat.DownloadSuccess * (factor - 1),
+			cache.ReputationFieldDownloadFail:    stat.DownloadFail * (factor - 1),
+			cache.ReputationFieldCacheSuccess:    stat.CacheSuccess * (factor - 1),
+			cache.ReputationFieldCacheFail:       stat.CacheFail * (factor - 1),
+		}
+
+		err = cache.GetDB().IncrReputationStats(stat.DeviceID, values)
+		if err != nil {
+			log.Errorf("decayReputations IncrReputationStats err:%s,deviceID:%s", err.Error(), stat.DeviceID)
+		}
+	}
+}
+
+// loadReputations compute the scores of devices from the stats
+func loadReputations() []*api.ReputationInfo {
+	stats, err := cache.GetDB().GetReputationStats()
+	if err != nil {
+		log.Errorf("loadReputations GetReputationStats err:%s", err.Error())
+		return nil
+	}
+
+	infos := make([]*api.ReputationInfo, 0, len(stats))
+	for _, stat := range stats {
+		info := computeReputation(stat)
+		reputations.Store(info.DeviceID, info)
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// updateReputations compute the scores and save the history
+func (m *ReputationManager) updateReputations() {
+	infos := loadReputations()
+	if len(infos) == 0 {
+		return
+	}
+
+	histories := make([]*persistent.ReputationHistory, 0, len(infos))
+	for _, info := range infos {
+		histories = append(histories, &persistent.ReputationHistory{
+			DeviceID: info.DeviceID,
+			Score:    info.Score,
+			Uptime:   info.Uptime,
+			Validate: info.Validate,
+			Download: info.Download,
+			Cache:    info.Cache,
+			Latency:  info.Latency,
+		})
+
+		err := cache.GetDB().SetDeviceReputation(info.DeviceID, info.Score)
+		if err != nil {
+			log.Errorf("updateReputations SetDeviceReputation err:%s,deviceID:%s", err.Error(), info.DeviceID)
+		}
+	}
+
+	err := persistent.GetDB().SaveReputationHistory(histories)
+	if err != nil {
+		log.Errorf("updateReputations SaveReputationHistory err:%s", err.Error())
+	}
+}
+
+func successRatio(success, fail float64) float64 {
+	// laplace smoothing, no event is 0.5
+	return (success + 1) / (success + fail + 2)
+}
+
+func computeReputation(stat *cache.ReputationStat) *api.ReputationInfo {
+	info := &api.ReputationInfo{
+		DeviceID: stat.DeviceID,
+		Uptime:   0.5,
+		Validate: successRatio(stat.ValidateSuccess, stat.ValidateFail),
+		Download: successRatio(stat.DownloadSuccess, stat.DownloadFail),
+		Cache:    successRatio(stat.CacheSuccess, stat.CacheFail),
+		Latency:  0.5,
+	}
+
+	if stat.ExpectedMinutes > 0 {
+		info.Uptime = math.Min(stat.OnlineMinutes/stat.ExpectedMinutes, 1)
+	}
+
+	if device, err := cache.GetDB().GetDeviceInfo(stat.DeviceID); err == nil {
+		info.NodeType = device.NodeType
+		if device.Latency > 0 {
+			info.Latency = reputationLatencyRef / (reputationLatencyRef + device.Latency)
+		}
+	}
+
+	info.Score = 100 * (uptimeWeight*info.Uptime +
+		validateWeight*info.Validate +
+		downloadWeight*info.Download +
+		cacheWeight*info.Cache +
+		latencyWeight*info.Latency)
+
+	return info
+}
+
+// reputationScore score of the device, can be used for placement, election and routing
+func reputationScore(deviceID string) float64 {
+	if v, ok := reputations.Load(deviceID); ok {
+		return v.(*api.ReputationInfo).Score
+	}
+
+	return defaultReputation
+}
+
+// pickByReputation random device, weighted by reputation score
+func pickByReputation(r *rand.Rand, deviceIDs []string) string {
+	if len(deviceIDs) == 0 {
+		return ""
+	}
+
+	return deviceIDs[selectByReputation(r, deviceIDs)]
+}
+
+// selectByReputation random index of the devices, weighted by reputation score
+func selectByReputation(r *rand.Rand, deviceIDs []string) int {
+	total := 0.0
+	weights := make([]float64, len(deviceIDs))
+	for i, deviceID := range deviceIDs {
+		// low score node still has a little chance
+		weights[i] = math.Max(reputationScore(deviceID), 1)
+		total += weights[i]
+	}
+
+	n := r.Float64() * total
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+
+	return len(deviceIDs) - 1
+}
+
+func getReputationRanking(nodeType api.NodeTypeName, limit int) []api.ReputationInfo {
+	list := make([]api.ReputationInfo, 0)
+	reputations.Range(func(key, value interface{}) bool {
+		info := value.(*api.ReputationInfo)
+
+		switch nodeType {
+		case api.TypeNameEdge:
+			if info.NodeType != api.NodeEdge {
+				return true
+			}
+		case api.TypeNameCandidate, api.TypeNameValidator:
+			if info.NodeType != api.NodeCandidate {
+				return true
+			}
+		}
+
+		list = append(list, *info)
+		return true
+	})
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+
+	return list
+}
@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+)
+
+func TestComputeReputation(t *testing.T) {
+	newFakeCache()
+
+	// no event, every part is 0.5
+	info := computeReputation(&cache.ReputationStat{DeviceID: "e_new"})
+	if math.Abs(info.Score-50) > 1e-9 {
+		t.Errorf("score of new device %f", info.Score)
+	}
+
+	good := computeReputation(&cache.ReputationStat{
+		DeviceID:        "e_good",
+		OnlineMinutes:   600,
+		ExpectedMinutes: 600,
+		ValidateSuccess: 100,
+		DownloadSuccess: 100,
+		CacheSuccess:    100,
+	})
+
+	bad := computeReputation(&cache.ReputationStat{
+		DeviceID:        "e_bad",
+		OnlineMinutes:   60,
+		ExpectedMinutes: 600,
+		ValidateFail:    100,
+		DownloadFail:    100,
+		CacheFail:       100,
+	})
+
+	if !(good.Score > info.Score && info.Score > bad.Score) {
+		t.Errorf("scores good:%f, new:%f, bad:%f", good.Score, info.Score, bad.Score)
+	}
+
+	if good.Uptime != 1 || math.Abs(bad.Uptime-0.1) > 1e-9 {
+		t.Errorf("uptime good:%f, bad:%f", good.Uptime, bad.Uptime)
+	}
+
+	// online more than expected is not more than 1
+	over := computeReputation(&cache.ReputationStat{DeviceID: "e_over", OnlineMinutes: 900, ExpectedMinutes: 600})
+	if over.Uptime != 1 {
+		t.Errorf("uptime over expected %f", over.Uptime)
+	}
+}
+
+func TestLoadReputations(t *testing.T) {
+	c := newFakeCache()
+	c.reputationStats = []*cache.ReputationStat{
+		{DeviceID: "e_good", OnlineMinutes: 600, ExpectedMinutes: 600, ValidateSuccess: 100, DownloadSuccess: 100, CacheSuccess: 100},
+	}
+
+	if reputationScore("e_good") != defaultReputation {
+		t.Fatal("score loaded before")
+	}
+
+	infos := loadReputations()
+	if len(infos) != 1 {
+		t.Fatalf("infos %d", len(infos))
+	}
+	defer reputations.Delete("e_good")
+
+	if reputationScore("e_good") != infos[0].Score {
+		t.Errorf("score %f not loaded", infos[0].Score)
+	}
+
+	if reputationScore("e_unknown") != defaultReputation {
+		t.Error("score of unknown device is not default")
+	}
+}
+
+func TestPickByReputation(t *testing.T) {
+	newFakeCache()
+
+	reputations.Store("e_high", computeReputation(&cache.ReputationStat{
+		DeviceID: "e_high", OnlineMinutes: 600, ExpectedMinutes: 600, ValidateSuccess: 100, DownloadSuccess: 100, CacheSuccess: 100,
+	}))
+	reputations.Store("e_low", computeReputation(&cache.ReputationStat{
+		DeviceID: "e_low", OnlineMinutes: 60, ExpectedMinutes: 600, ValidateFail: 100, DownloadFail: 100, CacheFail: 100,
+	}))
+	defer reputations.Delete("e_high")
+	defer reputations.Delete("e_low")
+
+	r := rand.New(rand.NewSource(1))
+	picks := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		picks[pickByReputation(r, []string{"e_low", "e_high"})]++
+	}
+
+	ratio := float64(picks["e_high"]) / float64(picks["e_low"])
+	want := reputationScore("e_high") / reputationScore("e_low")
+	if math.Abs(ratio-want)/want > 0.1 {
+		t.Errorf("picks %v, ratio %f, want %f", picks, ratio, want)
+	}
+
+	if pickByReputation(r, nil) != "" {
+		t.Error("pick from no device")
+	}
+}
@@ -0,0 +1,280 @@
+package scheduler
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"github.com/ouqiang/timewheel"
+	"golang.org/x/xerrors"
+)
+
+const (
+	autoQuarantineOperator = "auto"
+	autoQuarantineDuration = 24 * time.Hour
+)
+
+// node is quarantined after continuous validate fail times, 0 is disable
+var autoQuarantineFails int64 = 3
+
+// SetAutoQuarantineFails set the continuous validate fail times to quarantine a node, 0 is disable
+func SetAutoQuarantineFails(fails int64) {
+	autoQuarantineFails = fails
+}
+
+type cidrRestriction struct {
+	ipNet *net.IPNet
+	info  *api.NodeRestriction
+}
+
+// RestrictionManager quarantined and banned devices, ips and cidrs
+type RestrictionManager struct {
+	lk      sync.RWMutex
+	devices map[string]*api.NodeRestriction
+	ips     map[string]*api.NodeRestriction
+	cidrs   []*cidrRestriction
+
+	nodeManager *NodeManager
+
+	reloadTimewheel *timewheel.TimeWheel
+	reloadTime      int // reload time interval (minute)
+}
+
+func newRestrictionManager(nodeManager *NodeManager) *RestrictionManager {
+	m := &RestrictionManager{
+		nodeManager: nodeManager,
+		devices:     make(map[string]*api.NodeRestriction),
+		ips:         make(map[string]*api.NodeRestriction),
+		reloadTime:  1,
+	}
+
+	err := m.reload()
+	if err != nil {
+		log.Errorf("newRestrictionManager reload err:%s", err.Error())
+	}
+
+	m.initReloadTimewheel()
+
+	return m
+}
+
+func (m *RestrictionManager) initReloadTimewheel() {
+	// restrictions may be changed by other scheduler of the area
+	m.reloadTimewheel = timewheel.New(1*time.Second, 3600, func(_ interface{}) {
+		m.reloadTimewheel.AddTimer(time.Duration(m.reloadTime*60-1)*time.Second, "Restriction", nil)
+		err := m.reload()
+		if err != nil {
+			log.Errorf("restriction reload err:%s", err.Error())
+		}
+	})
+	m.reloadTimewheel.Start()
+	m.reloadTimewheel.AddTimer(time.Duration(m.reloadTime*60-1)*time.Second, "Restriction", nil)
+}
+
+func (m *RestrictionManager) reload() error {
+	list, err := persistent.GetDB().GetNodeRestrictions()
+	if err != nil {
+		return err
+	}
+
+	devices := make(map[string]*api.NodeRestriction)
+	ips := make(map[string]*api.NodeRestriction)
+	cidrs := make([]*cidrRestriction, 0)
+
+	for _, info := range list {
+		switch info.TargetType {
+		case api.RestrictionTargetDevice:
+			devices[info.Target] = info
+		case api.RestrictionTargetIP:
+			ips[info.Target] = info
+		case api.RestrictionTargetCIDR:
+			_, ipNet, err := net.ParseCIDR(info.Target)
+			if err != nil {
+				log.Errorf("restriction reload cidr %s err:%s", info.Target, err.Error())
+				continue
+			}
+			cidrs = append(cidrs, &cidrRestriction{ipNet: ipNet, info: info})
+		}
+	}
+
+	m.lk.Lock()
+	m.devices = devices
+	m.ips = ips
+	m.cidrs = cidrs
+	m.lk.Unlock()
+
+	m.disconnectBannedNodes()
+
+	return nil
+}
+
+func isRestrictionValid(info *api.NodeRestriction) bool {
+	return info != nil && (info.ExpireTime == 0 || info.ExpireTime > time.Now().Unix())
+}
+
+// find the restriction of the node, ban is prior to quarantine
+func (m *RestrictionManager) find(deviceID, ip string) *api.NodeRestriction {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	candidates := []*api.NodeRestriction{m.devices[deviceID], m.ips[ip]}
+	if addr := net.ParseIP(ip); addr != nil {
+		for _, c := range m.cidrs {
+			if c.ipNet.Contains(addr) {
+				candidates = append(candidates, c.info)
+			}
+		}
+	}
+
+	var out *api.NodeRestriction
+	for _, info := range candidates {
+		if !isRestrictionValid(info) {
+			continue
+		}
+
+		if out == nil || info.Action == api.RestrictionBan {
+			out = info
+		}
+	}
+
+	return out
+}
+
+func (m *RestrictionManager) isBanned(deviceID, ip string) bool {
+	info := m.find(deviceID, ip)
+	return info != nil && info.Action == api.RestrictionBan
+}
+
+// isRestricted node can not be used for placement and routing
+func (m *RestrictionManager) isRestricted(deviceID, ip string) bool {
+	return m.find(deviceID, ip) != nil
+}
+
+func checkRestriction(info *api.NodeRestriction) error {
+	if info.Action != api.RestrictionQuarantine && info.Action != api.RestrictionBan {
+		return xerrors.Errorf("unknown restriction action:%s", info.Action)
+	}
+
+	switch info.TargetType {
+	case api.RestrictionTargetDevice:
+		if info.Target == "" {
+			return xerrors.New("restriction target is nil")
+		}
+	case api.RestrictionTargetIP:
+		if net.ParseIP(info.Target) == nil {
+			return xerrors.Errorf("restriction target %s is not ip", info.Target)
+		}
+	case api.RestrictionTargetCIDR:
+		_, ipNet, err := net.ParseCIDR(info.Target)
+		if err != nil {
+			return xerrors.Errorf("restriction target %s is not cidr", info.Target)
+		}
+		// normalize the cidr, the target is the primary key
+		info.Target = ipNet.String()
+	default:
+		return xerrors.Errorf("unknown restriction target type:%s", info.TargetType)
+	}
+
+	return nil
+}
+
+func (m *RestrictionManager) addRestriction(info *api.NodeRestriction) error {
+	err := checkRestriction(info)
+	if err != nil {
+		return err
+	}
+
+	info.CreatedTime = time.Now().Unix()
+	err = persistent.GetDB().SetNodeRestriction(info)
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("node restriction %s %s:%s by %s, reason:%s", info.Action, info.TargetType, info.Target, info.Operator, info.Reason)
+
+	return m.reload()
+}
+
+func (m *RestrictionManager) removeRestriction(target, reason, operator string) error {
+	err := persistent.GetDB().RemoveNodeRestriction(target, reason, operator)
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("node restriction %s removed by %s, reason:%s", target, operator, reason)
+
+	return m.reload()
+}
+
+// disconnectBannedNodes banned nodes are disconnected, they can not connect again
+func (m *RestrictionManager) disconnectBannedNodes() {
+	banned := make([]string, 0)
+
+	m.nodeManager.edgeNodeMap.Range(func(key, value interface{}) bool {
+		node := value.(*EdgeNode)
+		if node != nil && m.isBanned(node.deviceInfo.DeviceId, node.deviceInfo.ExternalIp) {
+			banned = append(banned, node.deviceInfo.DeviceId)
+		}
+		return true
+	})
+
+	m.nodeManager.candidateNodeMap.Range(func(key, value interface{}) bool {
+		node := value.(*CandidateNode)
+		if node != nil && m.isBanned(node.deviceInfo.DeviceId, node.deviceInfo.ExternalIp) {
+			banned = append(banned, node.deviceInfo.DeviceId)
+		}
+		return true
+	})
+
+	for _, deviceID := range banned {
+		log.Warnf("disconnect banned node:%s", deviceID)
+		m.nodeManager.nodeOffline(deviceID)
+	}
+}
+
+// validateFailed quarantine the node after continuous validate fail
+func (m *RestrictionManager) validateFailed(deviceID string) {
+	if autoQuarantineFails <= 0 {
+		return
+	}
+
+	count, err := cache.GetDB().IncrNodeValidateFail(deviceID)
+	if err != nil {
+		log.Errorf("IncrNodeValidateFail err:%s,deviceID:%s", err.Error(), deviceID)
+		return
+	}
+
+	if count < autoQuarantineFails {
+		return
+	}
+
+	if m.isRestricted(deviceID, m.nodeManager.getNodeExternalIP(deviceID)) {
+		return
+	}
+
+	err = m.addRestriction(&api.NodeRestriction{
+		Target:     deviceID,
+		TargetType: api.RestrictionTargetDevice,
+		Action:     api.RestrictionQuarantine,
+		Reason:     "continuous validate fail",
+		Operator:   autoQuarantineOperator,
+		ExpireTime: time.Now().Add(autoQuarantineDuration).Unix(),
+	})
+	if err != nil {
+		log.Errorf("auto quarantine err:%s,deviceID:%s", err.Error(), deviceID)
+		return
+	}
+
+	// count again after the quarantine expired
+	m.validateSucceeded(deviceID)
+}
+
+func (m *RestrictionManager) validateSucceeded(deviceID string) {
+	err := cache.GetDB().ResetNodeValidateFail(deviceID)
+	if err != nil {
+		log.Errorf("ResetNodeValidateFail err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+}
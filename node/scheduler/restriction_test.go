@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/linguohua/titan/api"
+)
+
+func TestValidateFailed(t *testing.T) {
+	db := newFakeDB()
+	newFakeCache()
+
+	db.restrictions["1.1.1.1"] = &api.NodeRestriction{
+		Target:     "1.1.1.1",
+		TargetType: api.RestrictionTargetIP,
+		Action:     api.RestrictionQuarantine,
+	}
+
+	nodeManager := &NodeManager{}
+	m := &RestrictionManager{nodeManager: nodeManager}
+	nodeManager.restrictionManager = m
+	if err := m.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, info := range []api.DevicesInfo{{DeviceId: "e_1", ExternalIp: "1.1.1.1"}, {DeviceId: "e_2", ExternalIp: "2.2.2.2"}} {
+		nodeManager.edgeNodeMap.Store(info.DeviceId, &EdgeNode{Node: Node{deviceInfo: info}})
+	}
+
+	for i := int64(0); i < autoQuarantineFails; i++ {
+		m.validateFailed("e_1")
+		m.validateFailed("e_2")
+	}
+
+	// e_1 is quarantined by its ip already
+	if _, ok := db.restrictions["e_1"]; ok {
+		t.Error("node restricted by ip is quarantined again")
+	}
+
+	info, ok := db.restrictions["e_2"]
+	if !ok || info.Action != api.RestrictionQuarantine || info.Operator != autoQuarantineOperator {
+		t.Fatalf("node not quarantined after %d validate fails", autoQuarantineFails)
+	}
+
+	if !m.isRestricted("e_2", "2.2.2.2") {
+		t.Error("quarantined node is not restricted")
+	}
+}
@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/helper"
+	"github.com/linguohua/titan/node/tunnel"
+	"github.com/linguohua/titan/region"
+	"golang.org/x/xerrors"
+)
+
+// TunnelHandler accept the tunnels of edges in reverse connection mode
+func (s *Scheduler) TunnelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLeader() {
+			http.Error(w, ErrSchedulerStandby, http.StatusServiceUnavailable)
+			return
+		}
+
+		deviceID, err := verifySecret(r.Header.Get(tunnel.HeaderToken), api.NodeEdge)
+		if err != nil {
+			log.Errorf("TunnelHandler verifySecret err:%s", err.Error())
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		ip := handler.GetRequestIP(r.Context())
+		if s.nodeManager.restrictionManager.isBanned(deviceID, ip) {
+			http.Error(w, fmt.Sprintf("edge %s or ip %s is banned", deviceID, ip), http.StatusForbidden)
+			return
+		}
+
+		if err := s.nodeManager.tunnelHub.Accept(deviceID, w, r); err != nil {
+			log.Errorf("TunnelHandler accept err:%s,deviceID:%s", err.Error(), deviceID)
+		}
+	})
+}
+
+// EdgeNodeReverseConnect edge connect through the tunnel, the tunnel must be established before
+func (s *Scheduler) EdgeNodeReverseConnect(ctx context.Context, token string) (api.ReverseConnectInfo, error) {
+	ip := handler.GetRequestIP(ctx)
+	log.Infof("EdgeNodeReverseConnect ip:%s", ip)
+
+	if !isLeader() {
+		return api.ReverseConnectInfo{}, xerrors.New(ErrSchedulerStandby)
+	}
+
+	deviceID, err := verifySecret(token, api.NodeEdge)
+	if err != nil {
+		log.Errorf("EdgeNodeReverseConnect verifySecret err:%s", err.Error())
+		return api.ReverseConnectInfo{}, err
+	}
+
+	if s.nodeManager.restrictionManager.isBanned(deviceID, ip) {
+		return api.ReverseConnectInfo{}, xerrors.Errorf("edge %s or ip %s is banned", deviceID, ip)
+	}
+
+	addr, err := s.nodeManager.tunnelHub.Listen(deviceID, tunnel.TargetRPC)
+	if err != nil {
+		return api.ReverseConnectInfo{}, err
+	}
+
+	url, err := nodeHostURL(ctx, deviceID, addr)
+	if err != nil {
+		log.Errorf("EdgeNodeReverseConnect nodeURL err:%s", err.Error())
+		return api.ReverseConnectInfo{}, err
+	}
+
+	info := api.ReverseConnectInfo{ExternalIP: ip}
+	relayURL, err := s.nodeManager.assignRelay(ctx, deviceID, ip, &info)
+	if err != nil {
+		// rpc still work, but users can not download from the edge
+		log.Warnf("EdgeNodeReverseConnect assignRelay err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+
+	err = s.connectEdge(ctx, deviceID, ip, url, true, relayURL)
+	if err != nil {
+		return api.ReverseConnectInfo{}, err
+	}
+
+	return info, nil
+}
+
+// assignRelay choose a candidate of the same isp to relay the edge, return the relay url of the edge
+func (m *NodeManager) assignRelay(ctx context.Context, deviceID, ip string, info *api.ReverseConnectInfo) (string, error) {
+	isp := ""
+	if geoInfo, err := region.GetRegion().GetGeoInfo(ip); err == nil {
+		isp = geoInfo.ISP
+	}
+
+	candidates := sameISPCandidates(m.findCandidateNodes(nil, nil), isp)
+	if len(candidates) == 0 {
+		return "", xerrors.New("no candidate to relay")
+	}
+
+	c := candidates[mrand.Intn(len(candidates))]
+
+	tunnelURL, err := tunnel.WebsocketURL(c.addr)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := newRelayKey()
+	if err != nil {
+		return "", err
+	}
+
+	err = c.nodeAPI.AllowRelay(ctx, deviceID, key)
+	if err != nil {
+		return "", err
+	}
+
+	info.RelayTunnelURL = tunnelURL
+	info.RelayKey = key
+
+	return fmt.Sprintf("http://%s%s%s", urlHost(c.addr), tunnel.RelayPath, deviceID), nil
+}
+
+// tunnelClosed the edge in reverse mode is offline when its tunnel closed
+func (m *NodeManager) tunnelClosed(deviceID string) {
+	node := m.getEdgeNode(deviceID)
+	if node != nil && node.reverse {
+		m.edgeOffline(node)
+	}
+}
+
+// relayDownloadURL download url of the edge for users
+func relayDownloadURL(node *Node, url string) string {
+	if node.relayURL == "" {
+		return url
+	}
+
+	return node.relayURL + helper.DownloadSrvPath
+}
+
+// validateURL rpc url of the node for validator candidates
+func validateURL(node *Node) string {
+	if node.relayURL == "" {
+		return node.addr
+	}
+
+	return node.relayURL + "/rpc/v0"
+}
+
+func newRelayKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
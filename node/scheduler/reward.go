@@ -0,0 +1,409 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"github.com/ouqiang/timewheel"
+	"golang.org/x/xerrors"
+)
+
+const (
+	gibibyte = 1024 * 1024 * 1024
+
+	dayLayout   = "20060102"
+	monthLayout = "2006-01"
+	dateLayout  = "2006-01-02"
+
+	// peak hours for online ratio, [begin, end)
+	peakHourBegin = 18
+	peakHourEnd   = 24
+)
+
+var defaultRewardFormula = api.RewardFormula{
+	PerDownloadGiB:     1,
+	PerDownload:        0.001,
+	PerOnlineHour:      0.1,
+	PerStorageGiBHour:  0.001,
+	PerValidateSuccess: 0.1,
+	PerValidateFail:    -0.5,
+}
+
+// RewardManager settle the reward stats of nodes to income every hour
+type RewardManager struct {
+	nodeManager *NodeManager
+
+	settleTimewheel *timewheel.TimeWheel
+	settleTime      int // settle time interval (minute)
+}
+
+func newRewardManager(nodeManager *NodeManager) *RewardManager {
+	m := &RewardManager{
+		nodeManager: nodeManager,
+		settleTime:  10,
+	}
+
+	m.initSettleTimewheel()
+
+	return m
+}
+
+func (m *RewardManager) initSettleTimewheel() {
+	m.settleTimewheel = timewheel.New(1*time.Second, 3600, func(_ interface{}) {
+		m.settleTimewheel.AddTimer(time.Duration(m.settleTime*60-1)*time.Second, "SettleReward", nil)
+		if !isLeader() {
+			return
+		}
+		m.settleRewards()
+	})
+	m.settleTimewheel.Start()
+	m.settleTimewheel.AddTimer(time.Duration(m.settleTime*60-1)*time.Second, "SettleReward", nil)
+}
+
+func getRewardFormula() api.RewardFormula {
+	formula, err := cache.GetDB().GetRewardFormula()
+	if err != nil {
+		if !cache.GetDB().IsNilErr(err) {
+			log.Errorf("GetRewardFormula err:%s", err.Error())
+		}
+		return defaultRewardFormula
+	}
+
+	return formula
+}
+
+// settleRewards settle the stats of finished hours,
+// the stat of a finished hour is not changed, settle it again replace the same income
+func (m *RewardManager) settleRewards() {
+	hour := time.Now().Format(cache.RewardHourLayout)
+
+	stats, err := cache.GetDB().GetRewardStats(hour)
+	if err != nil {
+		log.Errorf("settleRewards GetRewardStats err:%s", err.Error())
+		return
+	}
+
+	formula := getRewardFormula()
+	today := time.Now().Format(dayLayout)
+
+	for _, stat := range stats {
+		if !isLeader() {
+			log.Warn("settleRewards stopped, leader lease is lost")
+			return
+		}
+
+		income := m.statToIncome(stat, formula)
+
+		err = persistent.GetDB().SaveDeviceIncome(income)
+		if err != nil {
+			log.Errorf("settleRewards SaveDeviceIncome err:%s,deviceID:%s,hour:%s", err.Error(), stat.DeviceID, stat.Hour)
+			continue
+		}
+
+		if income.Hour[:len(dayLayout)] == today {
+			updateTodayReward(stat.DeviceID, today)
+		}
+
+		err = cache.GetDB().RemoveRewardStat(stat.DeviceID, stat.Hour)
+		if err != nil {
+			log.Errorf("settleRewards RemoveRewardStat err:%s,deviceID:%s,hour:%s", err.Error(), stat.DeviceID, stat.Hour)
+		}
+	}
+}
+
+// updateTodayReward reward of today is the sum of the saved incomes of today
+func updateTodayReward(deviceID, today string) {
+	incomes, err := persistent.GetDB().GetDeviceIncomes([]string{deviceID}, today+"00", today+"23")
+	if err != nil {
+		log.Errorf("updateTodayReward GetDeviceIncomes err:%s,deviceID:%s", err.Error(), deviceID)
+		return
+	}
+
+	reward := 0.0
+	for _, income := range incomes {
+		reward += income.Income
+	}
+
+	err = cache.GetDB().SetDeviceTodayReward(deviceID, reward)
+	if err != nil {
+		log.Errorf("updateTodayReward SetDeviceTodayReward err:%s,deviceID:%s", err.Error(), deviceID)
+	}
+}
+
+func (m *RewardManager) statToIncome(stat *cache.RewardStat, formula api.RewardFormula) *persistent.DeviceIncome {
+	income := &persistent.DeviceIncome{
+		DeviceID:        stat.DeviceID,
+		Hour:            stat.Hour,
+		DownloadBytes:   int64(stat.DownloadBytes),
+		DownloadCount:   int64(stat.DownloadCount),
+		OnlineMinutes:   stat.OnlineMinutes,
+		ValidateSuccess: int64(stat.ValidateSuccess),
+		ValidateFail:    int64(stat.ValidateFail),
+	}
+
+	if info, err := persistent.GetDB().GetRegisterInfo(stat.DeviceID); err == nil {
+		income.UserID = info.UserID
+	}
+
+	// storage is only counted while the node is online
+	if info, err := cache.GetDB().GetDeviceInfo(stat.DeviceID); err == nil {
+		income.StorageBytes = int64(info.DiskSpace * info.DiskUsage / 100)
+	}
+
+	onlineHours := stat.OnlineMinutes / 60
+	income.Income = stat.DownloadBytes/gibibyte*formula.PerDownloadGiB +
+		stat.DownloadCount*formula.PerDownload +
+		onlineHours*formula.PerOnlineHour +
+		float64(income.StorageBytes)/gibibyte*onlineHours*formula.PerStorageGiBHour +
+		stat.ValidateSuccess*formula.PerValidateSuccess +
+		stat.ValidateFail*formula.PerValidateFail
+
+	return income
+}
+
+func incrRewardStat(deviceID, field string, value float64) {
+	err := cache.GetDB().IncrRewardStat(deviceID, field, value)
+	if err != nil {
+		log.Errorf("IncrRewardStat err:%s,deviceID:%s,field:%s", err.Error(), deviceID, field)
+	}
+}
+
+// dailyIncomes income and online minutes of every day, key is day format 20060102
+func dailyIncomes(deviceIDs []string, from, to time.Time) (map[string]float64, map[string]float64, error) {
+	incomes, err := persistent.GetDB().GetDeviceIncomes(deviceIDs, from.Format(dayLayout)+"00", to.Format(dayLayout)+"23")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	income := make(map[string]float64)
+	online := make(map[string]float64)
+	for _, info := range incomes {
+		day := info.Hour[:len(dayLayout)]
+		income[day] += info.Income
+		online[day] += info.OnlineMinutes
+	}
+
+	return income, online, nil
+}
+
+type incomeSummary struct {
+	today      float64
+	yesterday  float64
+	sevenDays  float64
+	month      float64
+	cumulative float64
+	daily      map[string]float64
+	online     map[string]float64
+}
+
+func summaryIncome(deviceIDs []string) (*incomeSummary, error) {
+	now := time.Now()
+	income, online, err := dailyIncomes(deviceIDs, now.AddDate(0, 0, -29), now)
+	if err != nil {
+		return nil, err
+	}
+
+	cumulative, err := persistent.GetDB().GetDeviceIncomeSum(deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &incomeSummary{
+		today:      income[now.Format(dayLayout)],
+		yesterday:  income[now.AddDate(0, 0, -1).Format(dayLayout)],
+		cumulative: cumulative,
+		daily:      make(map[string]float64),
+		online:     online,
+	}
+
+	for i := 0; i < 30; i++ {
+		day := now.AddDate(0, 0, -i)
+		v := income[day.Format(dayLayout)]
+		if i < 7 {
+			out.sevenDays += v
+		}
+		out.month += v
+		out.daily[day.Format(dateLayout)] = v
+	}
+
+	return out, nil
+}
+
+func (s *Scheduler) getDeviceIncome(deviceID string) (api.IncomeDailyRes, error) {
+	out := api.IncomeDailyRes{}
+
+	summary, err := summaryIncome([]string{deviceID})
+	if err != nil {
+		return out, err
+	}
+
+	out.DailyIncome = summary.daily
+	out.TodayProfit = summary.today
+	out.YesterdayProfit = summary.yesterday
+	out.SevenDaysProfit = summary.sevenDays
+	out.MonthProfit = summary.month
+	out.CumulativeProfit = summary.cumulative
+	out.OnlineTime = fmt.Sprintf("%.2fh", summary.online[time.Now().Format(dayLayout)]/60)
+
+	if summary.yesterday != 0 {
+		out.DefYesterday = fmt.Sprintf("%+.2f%%", (summary.today-summary.yesterday)/summary.yesterday*100)
+	}
+
+	// peak online ratio of yesterday
+	yesterday := time.Now().AddDate(0, 0, -1).Format(dayLayout)
+	incomes, err := persistent.GetDB().GetDeviceIncomes([]string{deviceID},
+		fmt.Sprintf("%s%02d", yesterday, peakHourBegin), fmt.Sprintf("%s%02d", yesterday, peakHourEnd-1))
+	if err != nil {
+		return out, err
+	}
+
+	peakMinutes := 0.0
+	for _, info := range incomes {
+		peakMinutes += info.OnlineMinutes
+	}
+	out.HighOnlineRatio = fmt.Sprintf("%.2f%%", peakMinutes/float64((peakHourEnd-peakHourBegin)*60)*100)
+
+	return out, nil
+}
+
+func (s *Scheduler) getUserIncome(userID string) (api.IndexPageRes, error) {
+	out := api.IndexPageRes{}
+
+	state, err := cache.GetDB().GetDeviceStat()
+	if err != nil {
+		return out, err
+	}
+	out.AllMinerInfo = state.AllMinerInfo
+
+	s.nodeManager.edgeNodeMap.Range(func(key, value interface{}) bool {
+		out.OnlineEdgeNode++
+		return true
+	})
+	s.nodeManager.candidateNodeMap.Range(func(key, value interface{}) bool {
+		out.OnlineCandidate++
+		if ok, err := cache.GetDB().IsNodeInValidatorList(key.(string)); err == nil && ok {
+			out.OnlineVerifier++
+		}
+		return true
+	})
+
+	deviceIDs, err := persistent.GetDB().GetUserDevices(userID)
+	if err != nil {
+		return out, err
+	}
+
+	out.TotalNum = len(deviceIDs)
+	for _, deviceID := range deviceIDs {
+		if s.nodeManager.getEdgeNode(deviceID) != nil || s.nodeManager.getCandidateNode(deviceID) != nil {
+			out.OnlineNum++
+		} else {
+			out.OfflineNum++
+		}
+
+		info, err := cache.GetDB().GetDeviceInfo(deviceID)
+		if err == nil && info.SuspiciousCount > 0 {
+			out.AbnormalNum++
+		}
+	}
+
+	if len(deviceIDs) == 0 {
+		return out, nil
+	}
+
+	summary, err := summaryIncome(deviceIDs)
+	if err != nil {
+		return out, err
+	}
+
+	out.TodayProfit = summary.today
+	out.YesterdayProfit = summary.yesterday
+	out.SevenDaysProfit = summary.sevenDays
+	out.MonthProfit = summary.month
+	out.CumulativeProfit = summary.cumulative
+
+	return out, nil
+}
+
+func getIncomeDaily(deviceID, month string) (api.IncomeDaily, error) {
+	out := api.IncomeDaily{DeviceId: deviceID, DateStr: month}
+
+	begin, err := time.ParseInLocation(monthLayout, month, time.Local)
+	if err != nil {
+		return out, xerrors.Errorf("month %s format err:%s", month, err.Error())
+	}
+	end := begin.AddDate(0, 1, -1)
+
+	if info, err := persistent.GetDB().GetRegisterInfo(deviceID); err == nil {
+		out.UserId = info.UserID
+	}
+
+	income, online, err := dailyIncomes([]string{deviceID}, begin, end)
+	if err != nil {
+		return out, err
+	}
+
+	incomeDaily := make(map[string]float64)
+	onlineDaily := make(map[string]float64)
+	for day := begin; !day.After(end); day = day.AddDate(0, 0, 1) {
+		key := fmt.Sprintf("%02d", day.Day())
+		incomeDaily[key] = income[day.Format(dayLayout)]
+		onlineDaily[key] = online[day.Format(dayLayout)]
+	}
+
+	buf, err := json.Marshal(incomeDaily)
+	if err != nil {
+		return out, err
+	}
+	out.JsonDaily = string(buf)
+
+	buf, err = json.Marshal(onlineDaily)
+	if err != nil {
+		return out, err
+	}
+	out.OnlineJsonDaily = string(buf)
+
+	return out, nil
+}
+
+func getHourDataOfDaily(deviceID, date string) (api.HourDataOfDaily, error) {
+	out := api.HourDataOfDaily{DeviceId: deviceID, Date: date}
+
+	day, err := time.ParseInLocation(dateLayout, date, time.Local)
+	if err != nil {
+		return out, xerrors.Errorf("date %s format err:%s", date, err.Error())
+	}
+
+	if info, err := persistent.GetDB().GetRegisterInfo(deviceID); err == nil {
+		out.UserId = info.UserID
+	}
+
+	incomes, err := persistent.GetDB().GetDeviceIncomes([]string{deviceID}, day.Format(dayLayout)+"00", day.Format(dayLayout)+"23")
+	if err != nil {
+		return out, err
+	}
+
+	// key 01 is the first hour of the day
+	onlineHourly := make(map[string]float64)
+	for i := 1; i <= 24; i++ {
+		onlineHourly[fmt.Sprintf("%02d", i)] = 0
+	}
+	for _, info := range incomes {
+		var hour int
+		if _, err := fmt.Sscanf(info.Hour[len(dayLayout):], "%d", &hour); err != nil {
+			continue
+		}
+		onlineHourly[fmt.Sprintf("%02d", hour+1)] += info.OnlineMinutes
+	}
+
+	buf, err := json.Marshal(onlineHourly)
+	if err != nil {
+		return out, err
+	}
+	out.OnlineJsonDaily = string(buf)
+
+	return out, nil
+}
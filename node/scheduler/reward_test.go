@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/linguohua/titan/node/scheduler/db/cache"
+	"golang.org/x/xerrors"
+)
+
+func TestSettleRewards(t *testing.T) {
+	d := newFakeDB()
+	c := newFakeCache()
+	electTestLeader(t)
+
+	today := time.Now().Format(dayLayout)
+	yesterday := time.Now().AddDate(0, 0, -1).Format(dayLayout)
+
+	c.rewardStats = []*cache.RewardStat{
+		{DeviceID: "e_1", Hour: today + "00", DownloadBytes: 2 * gibibyte, DownloadCount: 1000, OnlineMinutes: 60, ValidateSuccess: 1},
+		{DeviceID: "e_1", Hour: yesterday + "23", DownloadCount: 1000},
+	}
+	// stats are settled again when they are not removed
+	c.removeErr = xerrors.New("redis offline")
+
+	m := &RewardManager{}
+	m.settleRewards()
+	m.settleRewards()
+
+	income := d.incomes["e_1/"+today+"00"]
+	if income == nil {
+		t.Fatal("income of the hour not saved")
+	}
+
+	// 2 GiB, 1000 downloads, 1 online hour and 1 validate success with the default formula
+	if want := 3.2; math.Abs(income.Income-want) > 1e-9 {
+		t.Errorf("income %f, want %f", income.Income, want)
+	}
+
+	if income.DownloadCount != 1000 || income.OnlineMinutes != 60 {
+		t.Errorf("income settled twice %+v", income)
+	}
+
+	if reward := c.todayReward["e_1"]; math.Abs(reward-3.2) > 1e-9 {
+		t.Errorf("today reward %f", reward)
+	}
+
+	if len(d.incomes) != 2 {
+		t.Errorf("incomes %d", len(d.incomes))
+	}
+
+	c.removeErr = nil
+	m.settleRewards()
+
+	if len(c.rewardStats) != 0 {
+		t.Error("settled stats not removed")
+	}
+}
@@ -0,0 +1,341 @@
+package scheduler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	ipldselector "github.com/ipld/go-ipld-prime/traversal/selector"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"golang.org/x/xerrors"
+)
+
+// carfileSelector selects the part of a carfile DAG to cache.
+// A selector is a list of clauses separated by ';':
+//
+//	path:/dir/file   UnixFS sub-path, cache the blocks on the path and the whole sub-DAG under it
+//	range:from-to    byte range of the file under the path, 'to' is inclusive and can be omitted
+//	depth:n          cache links up to n levels below the path
+//
+// The empty selector caches the whole DAG.
+//
+// An IPLD selector in dag-json is accepted if it selects the same, see parseIPLDSelector.
+type carfileSelector struct {
+	str   string
+	path  []string
+	depth int // 0 is unlimited
+
+	hasRange   bool
+	rangeStart int64
+	rangeEnd   int64 // -1 is end of file
+}
+
+// the clauses supported by carfileSelector
+const selectorClauses = "path, range and depth"
+
+// dagPos position of a block in the carfile DAG
+type dagPos struct {
+	depth  int
+	offset int64
+}
+
+func parseCarfileSelector(str string) (*carfileSelector, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(str, "{") {
+		return parseIPLDSelector(str)
+	}
+
+	s := &carfileSelector{str: str, rangeEnd: -1}
+
+	for _, clause := range strings.Split(str, ";") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+
+		kv := strings.SplitN(clause, ":", 2)
+		if len(kv) != 2 {
+			return nil, xerrors.Errorf("%s:%s", ErrSelectorInvalid, clause)
+		}
+
+		value := strings.TrimSpace(kv[1])
+		switch kv[0] {
+		case "path":
+			for _, seg := range strings.Split(value, "/") {
+				if seg != "" {
+					s.path = append(s.path, seg)
+				}
+			}
+		case "depth":
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth <= 0 {
+				return nil, xerrors.Errorf("%s:%s", ErrSelectorInvalid, clause)
+			}
+			s.depth = depth
+		case "range":
+			r := strings.SplitN(value, "-", 2)
+			if len(r) != 2 {
+				return nil, xerrors.Errorf("%s:%s", ErrSelectorInvalid, clause)
+			}
+
+			start, err := strconv.ParseInt(r[0], 10, 64)
+			if err != nil || start < 0 {
+				return nil, xerrors.Errorf("%s:%s", ErrSelectorInvalid, clause)
+			}
+
+			end := int64(-1)
+			if r[1] != "" {
+				end, err = strconv.ParseInt(r[1], 10, 64)
+				if err != nil || end < start {
+					return nil, xerrors.Errorf("%s:%s", ErrSelectorInvalid, clause)
+				}
+			}
+
+			s.hasRange = true
+			s.rangeStart = start
+			s.rangeEnd = end
+		default:
+			return nil, xerrors.Errorf("%s:unsupported clause %s, use clauses of %s", ErrSelectorInvalid, clause, selectorClauses)
+		}
+	}
+
+	return s, nil
+}
+
+// dataKey data is tracked per carfile and selector
+func dataKey(cid, selector string) string {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return cid
+	}
+
+	h := sha1.Sum([]byte(selector))
+	return fmt.Sprintf("%s_%s", cid, hex.EncodeToString(h[:4]))
+}
+
+// selectLinks returns the links of a block at pos that match the selector,
+// and the position of each selected link.
+// Link sizes are the cumulative dag sizes, so a byte range can
+// include one extra leaf on either edge when leaves are not raw blocks.
+func (s *carfileSelector) selectLinks(pos dagPos, links, names []string, sizes []uint64) map[string]dagPos {
+	selected := make(map[string]dagPos)
+
+	if pos.depth < len(s.path) {
+		for i, link := range links {
+			if i < len(names) && names[i] == s.path[pos.depth] {
+				selected[link] = dagPos{depth: pos.depth + 1}
+			}
+		}
+		return selected
+	}
+
+	if s.depth > 0 && pos.depth-len(s.path) >= s.depth {
+		return selected
+	}
+
+	offset := pos.offset
+	for i, link := range links {
+		size := int64(0)
+		if i < len(sizes) {
+			size = int64(sizes[i])
+		}
+
+		start := offset
+		offset += size
+
+		if s.hasRange {
+			if offset <= s.rangeStart && size > 0 {
+				continue
+			}
+			if s.rangeEnd >= 0 && start > s.rangeEnd {
+				continue
+			}
+		}
+
+		selected[link] = dagPos{depth: pos.depth + 1, offset: start}
+	}
+
+	return selected
+}
+
+func (p dagPos) String() string {
+	return fmt.Sprintf("%d,%d", p.depth, p.offset)
+}
+
+func parseDagPos(str string) (dagPos, error) {
+	v := strings.Split(str, ",")
+	if len(v) != 2 {
+		return dagPos{}, xerrors.Errorf("dag pos %s invalid", str)
+	}
+
+	depth, err := strconv.Atoi(v[0])
+	if err != nil {
+		return dagPos{}, err
+	}
+
+	offset, err := strconv.ParseInt(v[1], 10, 64)
+	if err != nil {
+		return dagPos{}, err
+	}
+
+	return dagPos{depth: depth, offset: offset}, nil
+}
+
+// parseIPLDSelector the IPLD selector explores the UnixFS path by fields, then
+// matches the node at the path, the subset of the matcher is the byte range of the file,
+// or explores the links below the path recursively, the depth limit is the depth.
+//
+//	{"~":{"as":"unixfs",">":{"f":{"f>":{"dir":{"f":{"f>":{"file":{".":{"subset":{"[":0,"]":1048576}}}}}}}}}}}
+//	{"f":{"f>":{"dir":{"R":{"l":{"depth":2},":>":{"a":{">":{"@":{}}}}}}}}}
+//
+// The scheduler knows only the links of the blocks, other selectors are rejected.
+func parseIPLDSelector(str string) (*carfileSelector, error) {
+	node, err := selectorparse.ParseJSONSelector(str)
+	if err != nil {
+		return nil, xerrors.Errorf("%s:%s", ErrSelectorInvalid, err.Error())
+	}
+
+	if _, err := ipldselector.CompileSelector(node); err != nil {
+		return nil, xerrors.Errorf("%s:%s", ErrSelectorInvalid, err.Error())
+	}
+
+	s := &carfileSelector{str: str, rangeEnd: -1}
+	unsupported := func(key string) error {
+		return xerrors.Errorf("%s:unsupported ipld selector %s, explore fields then match or explore recursively", ErrSelectorInvalid, key)
+	}
+
+	for {
+		key, body, err := selectorEntry(node)
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case ipldselector.SelectorKey_ExploreInterpretAs:
+			if as := selectorString(body, ipldselector.SelectorKey_As); as != "unixfs" {
+				return nil, xerrors.Errorf("%s:interpret as %s is not supported", ErrSelectorInvalid, as)
+			}
+			node, _ = body.LookupByString(ipldselector.SelectorKey_Next)
+			continue
+
+		case ipldselector.SelectorKey_ExploreFields:
+			fields, _ := body.LookupByString(ipldselector.SelectorKey_Fields)
+			if fields.Length() != 1 {
+				return nil, unsupported("of fields not one")
+			}
+
+			k, v, _ := fields.MapIterator().Next()
+			name, _ := k.AsString()
+			s.path = append(s.path, name)
+			node = v
+			continue
+
+		case ipldselector.SelectorKey_Matcher:
+			if subset, err := body.LookupByString(ipldselector.SelectorKey_Subset); err == nil {
+				from, _ := subset.LookupByString(ipldselector.SelectorKey_From)
+				to, _ := subset.LookupByString(ipldselector.SelectorKey_To)
+				s.rangeStart, _ = from.AsInt()
+				s.rangeEnd, _ = to.AsInt()
+				if s.rangeEnd <= s.rangeStart {
+					return nil, xerrors.Errorf("%s:empty subset", ErrSelectorInvalid)
+				}
+				// the subset end is exclusive
+				s.rangeEnd--
+				s.hasRange = true
+			}
+			return s, nil
+
+		case ipldselector.SelectorKey_ExploreRecursive:
+			limit, _ := body.LookupByString(ipldselector.SelectorKey_Limit)
+			if depth, err := limit.LookupByString(ipldselector.SelectorKey_LimitDepth); err == nil {
+				d, _ := depth.AsInt()
+				if d <= 0 {
+					return nil, xerrors.Errorf("%s:recursive depth %d", ErrSelectorInvalid, d)
+				}
+				s.depth = int(d)
+			}
+
+			if _, err := body.LookupByString(ipldselector.SelectorKey_StopAt); err == nil {
+				return nil, unsupported(ipldselector.SelectorKey_StopAt)
+			}
+
+			sequence, _ := body.LookupByString(ipldselector.SelectorKey_Sequence)
+			if !isExploreAllRecursive(sequence) {
+				return nil, unsupported("sequence of recursive")
+			}
+			return s, nil
+
+		default:
+			return nil, unsupported(key)
+		}
+	}
+}
+
+// isExploreAllRecursive the sequence explores all links to the recursive edge,
+// the nodes may be matched meanwhile by the union with matcher
+func isExploreAllRecursive(node datamodel.Node) bool {
+	key, body, err := selectorEntry(node)
+	if err != nil {
+		return false
+	}
+
+	switch key {
+	case ipldselector.SelectorKey_ExploreAll:
+		next, _ := body.LookupByString(ipldselector.SelectorKey_Next)
+		k, _, err := selectorEntry(next)
+		return err == nil && k == ipldselector.SelectorKey_ExploreRecursiveEdge
+
+	case ipldselector.SelectorKey_ExploreUnion:
+		explored := false
+		it := body.ListIterator()
+		for !it.Done() {
+			_, member, _ := it.Next()
+			if k, _, err := selectorEntry(member); err == nil && k == ipldselector.SelectorKey_Matcher {
+				continue
+			}
+			if !isExploreAllRecursive(member) {
+				return false
+			}
+			explored = true
+		}
+		return explored
+	}
+
+	return false
+}
+
+// selectorEntry the key and body of the selector, the compiled selector is a map of single entry
+func selectorEntry(node datamodel.Node) (string, datamodel.Node, error) {
+	if node == nil || node.Kind() != datamodel.Kind_Map || node.Length() != 1 {
+		return "", nil, xerrors.Errorf("%s:selector must be a map of single entry", ErrSelectorInvalid)
+	}
+
+	k, v, err := node.MapIterator().Next()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, err := k.AsString()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return key, v, nil
+}
+
+func selectorString(node datamodel.Node, key string) string {
+	v, err := node.LookupByString(key)
+	if err != nil {
+		return ""
+	}
+
+	str, _ := v.AsString()
+	return str
+}
@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectLinks(t *testing.T) {
+	s, err := parseCarfileSelector("path:/a/b;range:100-250")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := []string{"l1", "l2", "l3"}
+	names := []string{"a", "b", "c"}
+
+	selected := s.selectLinks(dagPos{}, links, names, nil)
+	if len(selected) != 1 || selected["l1"].depth != 1 {
+		t.Errorf("path depth 0 selected:%v", selected)
+	}
+
+	selected = s.selectLinks(dagPos{depth: 1}, links, names, nil)
+	if len(selected) != 1 || selected["l2"].depth != 2 {
+		t.Errorf("path depth 1 selected:%v", selected)
+	}
+
+	// file under the path, leaves cover [0,100) [100,200) [200,300)
+	selected = s.selectLinks(dagPos{depth: 2}, links, []string{"", "", ""}, []uint64{100, 100, 100})
+	if len(selected) != 2 || selected["l2"].offset != 100 || selected["l3"].offset != 200 {
+		t.Errorf("range selected:%v", selected)
+	}
+
+	s, err = parseCarfileSelector("depth:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.selectLinks(dagPos{}, links, names, nil)) != 3 {
+		t.Errorf("depth 1 should select all root links")
+	}
+
+	if len(s.selectLinks(dagPos{depth: 1}, links, names, nil)) != 0 {
+		t.Errorf("depth 1 should not select links below root links")
+	}
+
+	for _, str := range []string{"foo:1", "depth:0", "range:10-5", "range:x", `{"R":{"l":{"none":{}}}}`} {
+		if _, err := parseCarfileSelector(str); err == nil {
+			t.Errorf("selector %s should be invalid", str)
+		}
+	}
+
+	if dataKey("cid", "") != "cid" || dataKey("cid", "depth:1") == dataKey("cid", "depth:2") {
+		t.Errorf("data key error")
+	}
+}
+
+func TestParseIPLDSelector(t *testing.T) {
+	cases := map[string]string{
+		// unixfs path and byte range of the file
+		`{"~":{"as":"unixfs",">":{"f":{"f>":{"dir":{"f":{"f>":{"file":{".":{"subset":{"[":0,"]":1048576}}}}}}}}}}}`: "path:/dir/file;range:0-1048575",
+		// the whole sub-DAG under the path
+		`{"f":{"f>":{"dir":{".":{}}}}}`: "path:/dir",
+		// links below the path in depth
+		`{"f":{"f>":{"dir":{"R":{"l":{"depth":2},":>":{"a":{">":{"@":{}}}}}}}}}`: "path:/dir;depth:2",
+		// explore all recursively of go-ipld-prime
+		`{"R":{"l":{"none":{}},":>":{"|":[{".":{}},{"a":{">":{"@":{}}}}]}}}`: "",
+	}
+
+	for str, clauses := range cases {
+		s, err := parseCarfileSelector(str)
+		if err != nil {
+			t.Errorf("selector %s: %v", str, err)
+			continue
+		}
+
+		want := &carfileSelector{rangeEnd: -1}
+		if clauses != "" {
+			if want, err = parseCarfileSelector(clauses); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want.str = str
+		if !reflect.DeepEqual(s, want) {
+			t.Errorf("selector %s: got %+v, want %+v", str, s, want)
+		}
+	}
+
+	for _, str := range []string{
+		`{"R":{"l":{"none":{}}}}`,
+		`{"i":{"i":0,">":{".":{}}}}`,
+		`{"~":{"as":"bytes",">":{".":{}}}}`,
+		`{"f":{"f>":{"a":{".":{}},"b":{".":{}}}}}`,
+		`{"R":{"l":{"none":{}},":>":{"a":{">":{"@":{}}}},"!":{"f":{"f>":{"a":{".":{}}}}}}}`,
+		`{"R":{"l":{"none":{}},":>":{"f":{"f>":{"a":{"@":{}}}}}}}`,
+		`{".":{"subset":{"[":10,"]":10}}}`,
+		`{"f":`,
+	} {
+		if _, err := parseCarfileSelector(str); err == nil {
+			t.Errorf("selector %s should be rejected", str)
+		}
+	}
+}
+
+func TestCarfileOfCache(t *testing.T) {
+	db := newFakeDB()
+	db.caches["ended"] = dataKey("root", "path:/a")
+
+	cacheCarfiles.Store("running", dataKey("root", "depth:1"))
+	defer cacheCarfiles.Delete("running")
+
+	if id, err := carfileOfCache("running"); err != nil || id != dataKey("root", "depth:1") {
+		t.Errorf("data key of running cache %s, err:%v", id, err)
+	}
+
+	// the ended cache is read from db and not kept
+	if id, err := carfileOfCache("ended"); err != nil || id != dataKey("root", "path:/a") {
+		t.Errorf("data key of ended cache %s, err:%v", id, err)
+	}
+
+	if _, ok := cacheCarfiles.Load("ended"); ok {
+		t.Error("ended cache is kept in memory")
+	}
+
+	if _, err := carfileOfCache("unknown"); err == nil {
+		t.Error("data key of unknown cache")
+	}
+}
@@ -0,0 +1,436 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// tenants are reloaded after this time, quotas and disabled changed by other schedulers take effect
+	tenantCacheExpire = time.Minute
+)
+
+type cachedTenant struct {
+	tenant   *api.Tenant
+	loadTime time.Time
+}
+
+// tenantCache tenant id:tenant
+type tenantCache struct {
+	lock    sync.Mutex
+	tenants map[string]*cachedTenant
+}
+
+var tenants = &tenantCache{tenants: make(map[string]*cachedTenant)}
+
+// SetTenant add or update the tenant, created time of the tenant is not changed by update
+func (s *Scheduler) SetTenant(ctx context.Context, tenant api.Tenant) error {
+	tenant.ID = strings.TrimSpace(tenant.ID)
+	if tenant.ID == "" {
+		return xerrors.New("tenant id is nil")
+	}
+
+	if tenant.StorageQuota < 0 || tenant.ReplicaQuota < 0 || tenant.BandwidthQuota < 0 {
+		return xerrors.Errorf("tenant %s quota err", tenant.ID)
+	}
+
+	tenant.CreatedTime = time.Now().Unix()
+
+	err := persistent.GetDB().SetTenant(&tenant)
+	if err != nil {
+		return err
+	}
+
+	tenants.lock.Lock()
+	delete(tenants.tenants, tenant.ID)
+	tenants.lock.Unlock()
+
+	return nil
+}
+
+// ListTenants all tenants
+func (s *Scheduler) ListTenants(ctx context.Context) ([]api.Tenant, error) {
+	list, err := persistent.GetDB().GetTenants()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.Tenant, 0, len(list))
+	for _, tenant := range list {
+		out = append(out, *tenant)
+	}
+
+	return out, nil
+}
+
+// GetTenantUsage storage of the carfiles and bandwidth in the month of the tenant,
+// tenant can only get the usage of itself
+func (s *Scheduler) GetTenantUsage(ctx context.Context, tenantID, month string) (api.TenantUsage, error) {
+	if caller := handler.GetTenant(ctx); caller != "" {
+		if tenantID != "" && tenantID != caller {
+			return api.TenantUsage{}, xerrors.Errorf("no permission to get usage of tenant %s", tenantID)
+		}
+		tenantID = caller
+	} else if !auth.HasPerm(ctx, nil, api.PermAdmin) {
+		return api.TenantUsage{}, xerrors.New("permission denied, admin or tenant token is required")
+	}
+
+	if tenantID == "" {
+		return api.TenantUsage{}, xerrors.New("tenant id is nil")
+	}
+
+	if month == "" {
+		month = time.Now().Format(monthLayout)
+	} else if _, err := time.Parse(monthLayout, month); err != nil {
+		return api.TenantUsage{}, xerrors.Errorf("month %s err:%s", month, err.Error())
+	}
+
+	tenant, err := loadTenant(tenantID)
+	if err != nil {
+		return api.TenantUsage{}, err
+	}
+
+	carfiles, size, err := persistent.GetDB().GetTenantStorage(tenantID)
+	if err != nil {
+		return api.TenantUsage{}, err
+	}
+
+	bandwidth, err := persistent.GetDB().GetTenantBandwidth(tenantID, month)
+	if err != nil {
+		return api.TenantUsage{}, err
+	}
+
+	return api.TenantUsage{
+		TenantID:       tenantID,
+		Month:          month,
+		Carfiles:       carfiles,
+		StorageBytes:   size,
+		BandwidthBytes: bandwidth,
+		Tenant:         *tenant,
+	}, nil
+}
+
+// AuthNew the token with tenant permission is of the tenant, tenant token can not have admin permission
+func (s *Scheduler) AuthNew(ctx context.Context, perms []auth.Permission) ([]byte, error) {
+	tenantID, err := tenantOfPermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+
+	if tenantID != "" {
+		for _, perm := range perms {
+			if perm == api.PermAdmin {
+				return nil, xerrors.Errorf("token of tenant %s can not have admin permission", tenantID)
+			}
+		}
+
+		tenant, err := loadTenant(tenantID)
+		if err != nil {
+			return nil, err
+		}
+
+		if tenant.Disabled {
+			return nil, xerrors.Errorf("tenant %s is disabled", tenantID)
+		}
+	}
+
+	return s.CommonAPI.AuthNew(ctx, perms)
+}
+
+// AuthVerify verify the token for nodes and locators, token of tenant is only allowed to read
+func (s *Scheduler) AuthVerify(ctx context.Context, token string) ([]auth.Permission, error) {
+	perms, err := s.CommonAPI.AuthVerify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantID, err := tenantOfPermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+
+	if tenantID != "" {
+		return []auth.Permission{api.PermRead}, nil
+	}
+
+	return perms, nil
+}
+
+// AuthVerifyRequest verify the token of the rpc request of scheduler, set the tenant of the request,
+// the token issued for calling the node is refused
+func (s *Scheduler) AuthVerifyRequest(ctx context.Context, token string) ([]auth.Permission, error) {
+	perms, err := s.CommonAPI.AuthVerify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, perm := range perms {
+		if deviceID := api.NodeOfPermission(perm); deviceID != "" {
+			return nil, xerrors.Errorf("token of node %s can not call scheduler", deviceID)
+		}
+	}
+
+	tenantID, err := tenantOfPermissions(perms)
+	if err != nil {
+		return nil, err
+	}
+
+	if tenantID == "" {
+		return perms, nil
+	}
+
+	tenant, err := loadTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if tenant.Disabled {
+		return nil, xerrors.Errorf("tenant %s is disabled", tenantID)
+	}
+
+	handler.SetTenant(ctx, tenantID)
+
+	// tenant token only call the read methods, the carfile methods check the tenant of the caller by callerTenant
+	return []auth.Permission{api.PermRead}, nil
+}
+
+func tenantOfPermissions(perms []auth.Permission) (string, error) {
+	tenantID := ""
+	for _, perm := range perms {
+		id := api.TenantOfPermission(perm)
+		if id == "" {
+			continue
+		}
+
+		if tenantID != "" && tenantID != id {
+			return "", xerrors.New("token can only be of one tenant")
+		}
+		tenantID = id
+	}
+
+	return tenantID, nil
+}
+
+// loadTenant the tenant in cache or db
+func loadTenant(tenantID string) (*api.Tenant, error) {
+	tenants.lock.Lock()
+	defer tenants.lock.Unlock()
+
+	if c, ok := tenants.tenants[tenantID]; ok && time.Since(c.loadTime) < tenantCacheExpire {
+		return c.tenant, nil
+	}
+
+	tenant, err := persistent.GetDB().GetTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if tenant == nil {
+		return nil, xerrors.Errorf("tenant %s not found", tenantID)
+	}
+
+	tenants.tenants[tenantID] = &cachedTenant{tenant: tenant, loadTime: time.Now()}
+	return tenant, nil
+}
+
+// callerTenant tenant of the caller, empty for admin
+func callerTenant(ctx context.Context) (string, error) {
+	if auth.HasPerm(ctx, nil, api.PermAdmin) {
+		return "", nil
+	}
+
+	tenantID := handler.GetTenant(ctx)
+	if tenantID == "" {
+		return "", xerrors.New("permission denied, admin or tenant token is required")
+	}
+
+	return tenantID, nil
+}
+
+// carfileOwner owner of the carfile, exist is false if carfile not found,
+// it is read from db every time, the carfile may be removed or recreated by other schedulers
+func carfileOwner(carfileID string) (owner string, exist bool, err error) {
+	info, err := persistent.GetDB().GetDataInfo(carfileID)
+	if err != nil {
+		return "", false, err
+	}
+
+	if info == nil {
+		return "", false, nil
+	}
+
+	return info.Owner, true, nil
+}
+
+// checkCarfileOwner only admin and the tenant of the carfile can change the carfile
+func checkCarfileOwner(ctx context.Context, carfileID string) error {
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	if tenantID == "" {
+		return nil
+	}
+
+	owner, exist, err := carfileOwner(carfileID)
+	if err != nil {
+		return err
+	}
+
+	if !exist {
+		return xerrors.Errorf("%s:%s", ErrCidNotFind, carfileID)
+	}
+
+	if owner != tenantID {
+		return xerrors.Errorf("carfile %s is not owned by tenant %s", carfileID, tenantID)
+	}
+
+	return nil
+}
+
+// checkTenantCache check the carfile owner and quotas of the tenant before cache,
+// storage of the carfile is unknown before cached, so the tenant can not cache new carfile after the quota is used up
+func checkTenantCache(tenantID, carfileID string, reliability int) error {
+	tenant, err := loadTenant(tenantID)
+	if err != nil {
+		return err
+	}
+
+	owner, exist, err := carfileOwner(carfileID)
+	if err != nil {
+		return err
+	}
+
+	if exist && owner != tenantID {
+		return xerrors.Errorf("carfile %s is not owned by tenant %s", carfileID, tenantID)
+	}
+
+	if tenant.ReplicaQuota > 0 && reliability > tenant.ReplicaQuota {
+		return xerrors.Errorf("reliability %d exceed replica quota %d of tenant %s", reliability, tenant.ReplicaQuota, tenantID)
+	}
+
+	if tenant.StorageQuota > 0 {
+		_, size, err := persistent.GetDB().GetTenantStorage(tenantID)
+		if err != nil {
+			return err
+		}
+
+		if size >= tenant.StorageQuota {
+			return xerrors.Errorf("storage %d exceed storage quota %d of tenant %s", size, tenant.StorageQuota, tenantID)
+		}
+	}
+
+	return nil
+}
+
+// checkTicketBandwidth the root cid is owned by the carfile and the selector caches of it, which may be of different tenants,
+// the ticket is refused after all the tenants of them are disabled or used up the bandwidth quota of the month,
+// the downloaded bytes are counted to the tenant of the cache which served them
+func checkTicketBandwidth(ticket *token.Ticket) error {
+	if ticket.RootCid == "" {
+		return nil
+	}
+
+	owners, err := persistent.GetDB().GetRootOwners(ticket.RootCid)
+	if err != nil {
+		return err
+	}
+
+	month := time.Now().Format(monthLayout)
+
+	var lastErr error
+	for _, owner := range owners {
+		err := checkTenantBandwidth(owner, month)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		return xerrors.Errorf("carfile %s:%w", ticket.RootCid, lastErr)
+	}
+
+	return nil
+}
+
+// checkTenantBandwidth the tenant is not disabled and the bandwidth of the month is in quota, no owner is unlimited
+func checkTenantBandwidth(owner, month string) error {
+	if owner == "" {
+		return nil
+	}
+
+	tenant, err := loadTenant(owner)
+	if err != nil {
+		return err
+	}
+
+	if tenant.Disabled {
+		return xerrors.Errorf("tenant %s is disabled", owner)
+	}
+
+	if tenant.BandwidthQuota <= 0 {
+		return nil
+	}
+
+	used, err := persistent.GetDB().GetTenantBandwidth(owner, month)
+	if err != nil {
+		return err
+	}
+
+	if used >= tenant.BandwidthQuota {
+		return xerrors.Errorf("tenant %s exceed bandwidth quota %d", owner, tenant.BandwidthQuota)
+	}
+
+	return nil
+}
+
+// addTenantBandwidth count the bytes downloaded from the caches into the bandwidth of the tenants of their carfiles
+func addTenantBandwidth(cacheBytes map[string]int64) {
+	month := time.Now().Format(monthLayout)
+
+	ownerBytes := make(map[string]int64)
+	// carfile id:owner of this time
+	owners := make(map[string]string)
+	for cacheID, bytes := range cacheBytes {
+		carfileID, err := carfileOfCache(cacheID)
+		if err != nil {
+			log.Errorf("addTenantBandwidth carfileOfCache err:%s,cacheID:%s", err.Error(), cacheID)
+			continue
+		}
+
+		owner, ok := owners[carfileID]
+		if !ok {
+			owner, _, err = carfileOwner(carfileID)
+			if err != nil {
+				log.Errorf("addTenantBandwidth carfileOwner err:%s,carfileID:%s", err.Error(), carfileID)
+				continue
+			}
+			owners[carfileID] = owner
+		}
+
+		if owner != "" {
+			ownerBytes[owner] += bytes
+		}
+	}
+
+	infos := make([]*persistent.TenantBandwidth, 0, len(ownerBytes))
+	for owner, bytes := range ownerBytes {
+		infos = append(infos, &persistent.TenantBandwidth{TenantID: owner, Month: month, Bytes: bytes})
+	}
+
+	err := persistent.GetDB().AddTenantBandwidths(infos)
+	if err != nil {
+		log.Errorf("AddTenantBandwidths err:%s", err.Error())
+	}
+}
@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/linguohua/titan/api"
+	"github.com/linguohua/titan/lib/token"
+	"github.com/linguohua/titan/node/common"
+	"github.com/linguohua/titan/node/handler"
+	"github.com/linguohua/titan/node/scheduler/db/persistent"
+)
+
+// newTestTenants tenants in a new fake db, the cached tenants are reset
+func newTestTenants(t *testing.T, list ...api.Tenant) *fakeDB {
+	db := newFakeDB()
+	for i := range list {
+		if err := db.SetTenant(&list[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reset := func() {
+		tenants.lock.Lock()
+		tenants.tenants = make(map[string]*cachedTenant)
+		tenants.lock.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+
+	return db
+}
+
+// tenantCtx context of the request with the token of the tenant, by the handler of the rpc server
+func tenantCtx(t *testing.T, tenantID string) context.Context {
+	var ctx context.Context
+	h := handler.New(&auth.Handler{
+		Verify: func(ctx context.Context, token string) ([]auth.Permission, error) {
+			handler.SetTenant(ctx, token)
+			return []auth.Permission{api.PermRead}, nil
+		},
+		Next: func(w http.ResponseWriter, r *http.Request) {
+			ctx = r.Context()
+		},
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/rpc/v0", nil)
+	r.Header.Set("Authorization", "Bearer "+tenantID)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if ctx == nil || handler.GetTenant(ctx) != tenantID {
+		t.Fatalf("tenant %s not set in context", tenantID)
+	}
+
+	return ctx
+}
+
+func TestCheckCarfileOwner(t *testing.T) {
+	db := newTestTenants(t, api.Tenant{ID: "t1"}, api.Tenant{ID: "t2"})
+	db.dataInfos["c1"] = &persistent.DataInfo{CID: "c1", Owner: "t1"}
+
+	adminCtx := auth.WithPerm(context.Background(), []auth.Permission{api.PermAdmin})
+	for _, cid := range []string{"c1", "unknown"} {
+		if err := checkCarfileOwner(adminCtx, cid); err != nil {
+			t.Errorf("admin change carfile %s: %v", cid, err)
+		}
+	}
+
+	if err := checkCarfileOwner(tenantCtx(t, "t1"), "c1"); err != nil {
+		t.Errorf("owner change carfile: %v", err)
+	}
+
+	if err := checkCarfileOwner(tenantCtx(t, "t2"), "c1"); err == nil {
+		t.Error("tenant change carfile of other tenant")
+	}
+
+	if err := checkCarfileOwner(tenantCtx(t, "t1"), "unknown"); err == nil {
+		t.Error("tenant change carfile not found")
+	}
+
+	readCtx := auth.WithPerm(context.Background(), []auth.Permission{api.PermRead})
+	if err := checkCarfileOwner(readCtx, "c1"); err == nil {
+		t.Error("change carfile without admin or tenant token")
+	}
+}
+
+func TestCheckTenantCache(t *testing.T) {
+	db := newTestTenants(t,
+		api.Tenant{ID: "t1", StorageQuota: 1000, ReplicaQuota: 3},
+		api.Tenant{ID: "t2"},
+	)
+	db.dataInfos["c1"] = &persistent.DataInfo{CID: "c1", Owner: "t1", TotalSize: 100, NeedReliability: 3}
+
+	if err := checkTenantCache("t1", "c1", 3); err != nil {
+		t.Errorf("cache own carfile in quota: %v", err)
+	}
+
+	if err := checkTenantCache("t1", "c2", 2); err != nil {
+		t.Errorf("cache new carfile in quota: %v", err)
+	}
+
+	if err := checkTenantCache("t1", "c2", 4); err == nil {
+		t.Error("reliability over replica quota is allowed")
+	}
+
+	if err := checkTenantCache("t2", "c1", 1); err == nil {
+		t.Error("tenant cache carfile of other tenant")
+	}
+
+	if err := checkTenantCache("t2", "c2", 10); err != nil {
+		t.Errorf("tenant without quota cache carfile: %v", err)
+	}
+
+	if err := checkTenantCache("unknown", "c2", 1); err == nil {
+		t.Error("tenant not found cache carfile")
+	}
+
+	// storage is used up after the carfiles cached
+	db.dataInfos["c3"] = &persistent.DataInfo{CID: "c3", Owner: "t1", TotalSize: 300, NeedReliability: 3}
+	if err := checkTenantCache("t1", "c4", 1); err == nil {
+		t.Error("cache new carfile over storage quota is allowed")
+	}
+}
+
+func TestCarfileOwnerChanged(t *testing.T) {
+	db := newTestTenants(t, api.Tenant{ID: "t1"}, api.Tenant{ID: "t2"})
+	db.dataInfos["c1"] = &persistent.DataInfo{CID: "c1", Owner: "t1"}
+
+	if err := checkCarfileOwner(tenantCtx(t, "t1"), "c1"); err != nil {
+		t.Fatalf("owner change carfile: %v", err)
+	}
+
+	// carfile removed and recreated by other scheduler
+	db.dataInfos["c1"] = &persistent.DataInfo{CID: "c1", Owner: "t2"}
+
+	if err := checkCarfileOwner(tenantCtx(t, "t1"), "c1"); err == nil {
+		t.Error("old owner change carfile recreated by other tenant")
+	}
+
+	if err := checkCarfileOwner(tenantCtx(t, "t2"), "c1"); err != nil {
+		t.Errorf("new owner change carfile: %v", err)
+	}
+}
+
+func TestTenantPermission(t *testing.T) {
+	newTestTenants(t, api.Tenant{ID: "t1"})
+
+	s := &Scheduler{CommonAPI: common.CommonAPI{APISecret: jwt.NewHS256([]byte("test-key"))}}
+	adminCtx := auth.WithPerm(context.Background(), []auth.Permission{api.PermAdmin})
+
+	tk, err := s.AuthNew(adminCtx, []auth.Permission{api.PermRead, api.PermWrite, api.TenantPermission("t1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx context.Context
+	h := handler.New(&auth.Handler{
+		Verify: s.AuthVerifyRequest,
+		Next: func(w http.ResponseWriter, r *http.Request) {
+			ctx = r.Context()
+		},
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/rpc/v0", nil)
+	r.Header.Set("Authorization", "Bearer "+string(tk))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if ctx == nil || handler.GetTenant(ctx) != "t1" {
+		t.Fatal("tenant not set in context")
+	}
+
+	if auth.HasPerm(ctx, nil, api.PermWrite) {
+		t.Error("tenant token has write permission")
+	}
+
+	// node methods are refused by the permissioned api
+	if err := api.PermissionedSchedulerAPI(s).DownloadBlockResult(ctx, api.DownloadStat{}); err == nil {
+		t.Error("tenant call node method")
+	}
+
+	if _, err := s.AuthNew(adminCtx, []auth.Permission{api.PermAdmin, api.TenantPermission("t1")}); err == nil {
+		t.Error("tenant token with admin permission is created")
+	}
+}
+
+func TestCheckTicketBandwidth(t *testing.T) {
+	db := newTestTenants(t,
+		api.Tenant{ID: "t1", BandwidthQuota: 100},
+		api.Tenant{ID: "t2", BandwidthQuota: 100},
+		api.Tenant{ID: "t3", Disabled: true},
+	)
+	db.dataInfos["root"] = &persistent.DataInfo{CID: "root", Owner: "t1"}
+	db.dataInfos[dataKey("root", "path:a")] = &persistent.DataInfo{CID: dataKey("root", "path:a"), RootCID: "root", Owner: "t2"}
+	db.dataInfos["other"] = &persistent.DataInfo{CID: "other", Owner: "t3"}
+
+	month := time.Now().Format(monthLayout)
+
+	if err := checkTicketBandwidth(&token.Ticket{RootCid: "root"}); err != nil {
+		t.Errorf("ticket in quota: %v", err)
+	}
+
+	// the selector cache of t2 still serve the root
+	db.AddTenantBandwidths([]*persistent.TenantBandwidth{{TenantID: "t1", Month: month, Bytes: 100}})
+	if err := checkTicketBandwidth(&token.Ticket{RootCid: "root"}); err != nil {
+		t.Errorf("ticket of root with selector cache in quota: %v", err)
+	}
+
+	db.AddTenantBandwidths([]*persistent.TenantBandwidth{{TenantID: "t2", Month: month, Bytes: 100}})
+	if err := checkTicketBandwidth(&token.Ticket{RootCid: "root"}); err == nil {
+		t.Error("ticket of root over quota of all tenants is allowed")
+	}
+
+	if err := checkTicketBandwidth(&token.Ticket{RootCid: "other"}); err == nil {
+		t.Error("ticket of disabled tenant is allowed")
+	}
+
+	if err := checkTicketBandwidth(&token.Ticket{RootCid: "unknown"}); err != nil {
+		t.Errorf("ticket of carfile without owner: %v", err)
+	}
+}
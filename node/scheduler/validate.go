@@ -50,6 +50,9 @@ func (v *Validate) initValidateTask() {
 	// validate timewheel
 	v.timewheelValidate = timewheel.New(time.Second, 3600, func(_ interface{}) {
 		v.timewheelValidate.AddTimer((time.Duration(v.validateTime)*60-1)*time.Second, "validate", nil)
+		if !isLeader() {
+			return
+		}
 		err := v.startValidate()
 		if err != nil {
 			log.Panicf("startValidate err:%s", err.Error())
@@ -97,7 +100,7 @@ func (v *Validate) getReqValidates(validatorID string, list []string) ([]api.Req
 			addr = candidateNode.Node.addr
 			nodeType = api.NodeCandidate
 		} else {
-			addr = edgeNode.Node.addr
+			addr = validateURL(&edgeNode.Node)
 			nodeType = api.NodeEdge
 		}
 
@@ -185,6 +188,9 @@ func (v *Validate) saveValidateResult(rID string, deviceID string, validatorID s
 		if err != nil {
 			return err
 		}
+		incrRewardStat(deviceID, cache.RewardFieldValidateSuccess, 1)
+		incrReputation(deviceID, cache.ReputationFieldValidateSuccess, 1)
+		v.nodeManager.restrictionManager.validateSucceeded(deviceID)
 		return nil
 	}
 
@@ -193,6 +199,9 @@ func (v *Validate) saveValidateResult(rID string, deviceID string, validatorID s
 		if err != nil {
 			return err
 		}
+		incrRewardStat(deviceID, cache.RewardFieldValidateFail, 1)
+		incrReputation(deviceID, cache.ReputationFieldValidateFail, 1)
+		v.nodeManager.restrictionManager.validateFailed(deviceID)
 	}
 
 	return nil
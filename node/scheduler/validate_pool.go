@@ -174,7 +174,7 @@ func (p *ValidatePool) generateRandomValidator(candidateNodeMap map[string]*Cand
 
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	for len(veriftorMap) < count {
-		num := r.Intn(mLen)
+		num := selectByReputation(r, cList)
 		exist := false
 
 		vID := cList[num]
@@ -17,8 +17,9 @@ import (
 )
 
 const (
-	JWTSecretName   = "auth-jwt-private" //nolint:gosec
-	KTJwtHmacSecret = "jwt-hmac-secret"  //nolint:gosec
+	JWTSecretName       = "auth-jwt-private"   //nolint:gosec
+	NodeTokenSecretName = "node-token-private" //nolint:gosec
+	KTJwtHmacSecret     = "jwt-hmac-secret"    //nolint:gosec
 )
 
 type JwtPayload struct {
@@ -71,3 +72,35 @@ func APISecret(lr repo.LockedRepo) (*jwt.HMACSHA, error) {
 
 	return jwt.NewHS256(key.PrivateKey), nil
 }
+
+// NodeTokenSecret key for scheduler to sign node tokens
+func NodeTokenSecret(lr repo.LockedRepo) ([]byte, error) {
+	keystore, err := lr.KeyStore()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keystore.Get(NodeTokenSecretName)
+
+	if errors.Is(err, types.ErrKeyInfoNotFound) {
+		log.Warn("Generating new node token secret")
+
+		sk, err := ioutil.ReadAll(io.LimitReader(rand.Reader, 32))
+		if err != nil {
+			return nil, err
+		}
+
+		key = types.KeyInfo{
+			Type:       KTJwtHmacSecret,
+			PrivateKey: sk,
+		}
+
+		if err := keystore.Put(NodeTokenSecretName, key); err != nil {
+			return nil, xerrors.Errorf("writing node token secret: %w", err)
+		}
+	} else if err != nil {
+		return nil, xerrors.Errorf("could not get node token secret: %w", err)
+	}
+
+	return key.PrivateKey, nil
+}
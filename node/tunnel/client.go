@@ -0,0 +1,177 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-yamux/v3"
+	"github.com/linguohua/titan/api/client"
+)
+
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+	dialLocalTimeout  = 5 * time.Second
+)
+
+// Client keep the outbound tunnel of the edge, the streams opened by the peer
+// are forwarded to the local servers of the targets
+type Client struct {
+	url    string
+	header http.Header
+	// header got before each connect, header is used if nil
+	headerFunc func() http.Header
+	// target:local address
+	targets map[string]string
+
+	lk sync.Mutex
+	// closed when the tunnel is established, renewed after the tunnel closed
+	ready chan struct{}
+	// increased every time the tunnel is established
+	generation uint64
+}
+
+// NewClient the tunnel is established by Run
+func NewClient(url string, header http.Header, targets map[string]string) *Client {
+	return &Client{
+		url:     url,
+		header:  header,
+		targets: targets,
+		ready:   make(chan struct{}),
+	}
+}
+
+// SetHeaderFunc the header is got by f before each connect, for the header expires
+func (c *Client) SetHeaderFunc(f func() http.Header) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.headerFunc = f
+}
+
+// Run connect and reconnect the tunnel until ctx done
+func (c *Client) Run(ctx context.Context) {
+	delay := reconnectMinDelay
+	for {
+		session, err := c.connect(ctx)
+		if err != nil {
+			log.Warnf("connect tunnel %s err:%s", c.url, err.Error())
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+
+			delay *= 2
+			if delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+			continue
+		}
+
+		delay = reconnectMinDelay
+		log.Infof("tunnel %s connected", c.url)
+
+		c.serve(ctx, session)
+
+		log.Warnf("tunnel %s closed", c.url)
+	}
+}
+
+func (c *Client) connect(ctx context.Context) (*yamux.Session, error) {
+	c.lk.Lock()
+	header, headerFunc := c.header, c.headerFunc
+	c.lk.Unlock()
+
+	if headerFunc != nil {
+		header = headerFunc()
+	}
+
+	conn, _, err := client.Dialer.DialContext(ctx, c.url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return yamux.Server(newWSConn(conn), nil, nil)
+}
+
+func (c *Client) serve(ctx context.Context, session *yamux.Session) {
+	c.lk.Lock()
+	c.generation++
+	close(c.ready)
+	c.lk.Unlock()
+
+	defer func() {
+		c.lk.Lock()
+		c.ready = make(chan struct{})
+		c.lk.Unlock()
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-session.CloseChan():
+		}
+	}()
+
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+
+		go c.forward(stream)
+	}
+}
+
+// forward the stream to the local server of the target
+func (c *Client) forward(stream net.Conn) {
+	target, conn, err := readTarget(stream)
+	if err != nil {
+		stream.Close()
+		return
+	}
+
+	addr, ok := c.targets[target]
+	if !ok {
+		log.Warnf("tunnel unknown target %s", target)
+		stream.Close()
+		return
+	}
+
+	local, err := net.DialTimeout("tcp", addr, dialLocalTimeout)
+	if err != nil {
+		log.Errorf("tunnel dial %s err:%s", addr, err.Error())
+		stream.Close()
+		return
+	}
+
+	pipe(conn, local)
+}
+
+// WaitConnected wait the tunnel established
+func (c *Client) WaitConnected(ctx context.Context) error {
+	c.lk.Lock()
+	ready := c.ready
+	c.lk.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Generation changed when the tunnel is reconnected, the edge should connect to scheduler again
+func (c *Client) Generation() uint64 {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	return c.generation
+}
@@ -0,0 +1,60 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn net.Conn over websocket binary messages, for the multiplexer of the tunnel
+type wsConn struct {
+	*websocket.Conn
+	reader io.Reader
+}
+
+func newWSConn(c *websocket.Conn) net.Conn {
+	return &wsConn{Conn: c}
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, r, err := c.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = r
+		}
+
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			// end of the message
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	err := c.WriteMessage(websocket.BinaryMessage, b)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.SetWriteDeadline(t)
+}
@@ -0,0 +1,209 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/libp2p/go-yamux/v3"
+	"golang.org/x/xerrors"
+)
+
+var upgrader = websocket.Upgrader{
+	// edges are not browsers
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Hub tunnels of the edges connected in reverse mode
+type Hub struct {
+	lk sync.Mutex
+	// deviceID:session
+	sessions map[string]*yamux.Session
+
+	// called when the tunnel of the device closed
+	onClose func(deviceID string)
+
+	transport *http.Transport
+}
+
+// NewHub onClose can be nil
+func NewHub(onClose func(deviceID string)) *Hub {
+	h := &Hub{
+		sessions: make(map[string]*yamux.Session),
+		onClose:  onClose,
+	}
+
+	h.transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// host of the proxy request is target.deviceID
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+
+			i := strings.Index(host, ".")
+			if i < 0 {
+				return nil, xerrors.Errorf("invalid tunnel address %s", addr)
+			}
+
+			return h.Open(ctx, host[i+1:], host[:i])
+		},
+	}
+
+	return h
+}
+
+// Accept upgrade the request to the tunnel of the device, the old tunnel of the device is closed
+func (h *Hub) Accept(deviceID string, w http.ResponseWriter, r *http.Request) error {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	session, err := yamux.Client(newWSConn(conn), nil, nil)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	h.lk.Lock()
+	old := h.sessions[deviceID]
+	h.sessions[deviceID] = session
+	h.lk.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	log.Infof("tunnel of %s accepted from %s", deviceID, r.RemoteAddr)
+
+	go func() {
+		<-session.CloseChan()
+
+		h.lk.Lock()
+		current := h.sessions[deviceID] == session
+		if current {
+			delete(h.sessions, deviceID)
+		}
+		h.lk.Unlock()
+
+		if current {
+			log.Infof("tunnel of %s closed", deviceID)
+			if h.onClose != nil {
+				h.onClose(deviceID)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// IsConnected the device has tunnel
+func (h *Hub) IsConnected(deviceID string) bool {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	_, ok := h.sessions[deviceID]
+	return ok
+}
+
+// Close the tunnel of the device
+func (h *Hub) Close(deviceID string) {
+	h.lk.Lock()
+	session := h.sessions[deviceID]
+	h.lk.Unlock()
+
+	if session != nil {
+		session.Close()
+	}
+}
+
+// Open a stream to the target server of the device
+func (h *Hub) Open(ctx context.Context, deviceID, target string) (net.Conn, error) {
+	h.lk.Lock()
+	session := h.sessions[deviceID]
+	h.lk.Unlock()
+
+	if session == nil {
+		return nil, xerrors.Errorf("%s has no tunnel", deviceID)
+	}
+
+	stream, err := session.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeTarget(stream, target); err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// Listen loopback address forwarded to the target server of the device,
+// for the clients can not dial by custom dialer, the listener is closed with the tunnel
+func (h *Hub) Listen(deviceID, target string) (string, error) {
+	h.lk.Lock()
+	session := h.sessions[deviceID]
+	h.lk.Unlock()
+
+	if session == nil {
+		return "", xerrors.Errorf("%s has no tunnel", deviceID)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	go func() {
+		<-session.CloseChan()
+		l.Close()
+	}()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				stream, err := h.Open(context.Background(), deviceID, target)
+				if err != nil {
+					log.Warnf("tunnel open %s err:%s", deviceID, err.Error())
+					c.Close()
+					return
+				}
+
+				pipe(c, stream)
+			}()
+		}
+	}()
+
+	return l.Addr().String(), nil
+}
+
+// ReverseProxy proxy the requests to the target server of the device, prefix of the path is stripped
+func (h *Hub) ReverseProxy(deviceID, target, prefix string) http.Handler {
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = target + "." + deviceID
+			r.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+			r.Host = r.URL.Host
+
+			// the client ip is bound to the download tickets, X-Real-IP of the client is replaced
+			r.Header.Del("X-Real-IP")
+			if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				r.Header.Set("X-Real-IP", ip)
+			}
+		},
+		Transport: h.transport,
+	}
+}
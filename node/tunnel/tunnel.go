@@ -0,0 +1,118 @@
+package tunnel
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("tunnel")
+
+const (
+	// Path of the tunnel endpoint of scheduler and relay candidate
+	Path = "/tunnel/v0"
+	// RelayPath prefix of the relay endpoint of candidate, followed by device id
+	RelayPath = "/relay/"
+
+	// HeaderToken node token of the edge, verified by scheduler
+	HeaderToken = "Node-Token"
+	// HeaderDeviceID device id of the edge, for relay candidate
+	HeaderDeviceID = "Device-ID"
+	// HeaderRelayKey key issued by scheduler, verified by relay candidate
+	HeaderRelayKey = "Relay-Key"
+
+	// TargetRPC rpc server of the edge
+	TargetRPC = "rpc"
+	// TargetDownload download server of the edge
+	TargetDownload = "download"
+)
+
+// writeTarget the first line of the stream is the target
+func writeTarget(c net.Conn, target string) error {
+	_, err := c.Write([]byte(target + "\n"))
+	return err
+}
+
+// readTarget return the target and the conn to read the rest of the stream
+func readTarget(c net.Conn) (string, net.Conn, error) {
+	r := bufio.NewReader(c)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", nil, err
+	}
+
+	return strings.TrimSpace(line), &bufferedConn{Conn: c, r: r}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// pipe copy between the conns until one of them closed
+func pipe(a, b net.Conn) {
+	var once sync.Once
+	closeAll := func() {
+		a.Close()
+		b.Close()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(a, b)
+		once.Do(closeAll)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(b, a)
+		once.Do(closeAll)
+	}()
+	wg.Wait()
+}
+
+// LocalAddr address to dial the local server listen on the address
+func LocalAddr(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// WebsocketURL tunnel url of the http server, the path is replaced by Path
+func WebsocketURL(addr string) (string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", xerrors.Errorf("unknown scheme %s", u.Scheme)
+	}
+	u.Path = Path
+
+	return u.String(), nil
+}
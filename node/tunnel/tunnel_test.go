@@ -0,0 +1,107 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTunnel(t *testing.T) {
+	// echo server behind the edge
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+
+	hub := NewHub(nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := hub.Accept(r.Header.Get(HeaderDeviceID), w, r); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	url, err := WebsocketURL(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{}
+	header.Set(HeaderDeviceID, "e_test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := NewClient(url, header, map[string]string{TargetRPC: l.Addr().String()})
+	go c.Run(ctx)
+
+	if err := c.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the hub may register the session after the client connected
+	for !hub.IsConnected("e_test") {
+		select {
+		case <-ctx.Done():
+			t.Fatal("tunnel not accepted")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	addr, err := hub.Listen("e_test", TargetRPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := []byte("hello edge")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != string(msg) {
+		t.Fatalf("want %s, got %s", msg, buf)
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	cases := map[string]string{
+		"0.0.0.0:3000":     "127.0.0.1:3000",
+		":3000":            "127.0.0.1:3000",
+		"192.168.0.2:3000": "192.168.0.2:3000",
+	}
+
+	for listen, want := range cases {
+		if got := LocalAddr(listen); got != want {
+			t.Errorf("LocalAddr(%s) want %s, got %s", listen, want, got)
+		}
+	}
+}
@@ -3,37 +3,98 @@ package region
 import (
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/oschwald/geoip2-golang"
 	"golang.org/x/xerrors"
 )
 
-// var reader *geoip2.Reader
-
 // TypeGeoLite GeoLite
 func TypeGeoLite() string {
 	return "GeoLite"
 }
 
-// InitGeoLite init
-func InitGeoLite(dbPath string) (Region, error) {
-	gl := &geoLite{dbPath}
+// InitGeoLite init, the mmdb readers are cached and reloaded when the files change
+func InitGeoLite(dbPath, asnPath string) (Region, error) {
+	gl := &geoLite{dbPath: dbPath, asnPath: asnPath}
 
-	db, err := geoip2.Open(gl.dbPath)
+	err := gl.loadCity()
 	if err != nil {
 		return gl, err
 	}
-	defer db.Close()
-	// reader = db
+	watchFile(dbPath, func() {
+		if err := gl.loadCity(); err != nil {
+			log.Errorf("reload geo db %s err:%s", dbPath, err.Error())
+		}
+	})
+
+	if asnPath == "" {
+		return gl, nil
+	}
+
+	err = gl.loadASN()
+	if err != nil {
+		return gl, err
+	}
+	watchFile(asnPath, func() {
+		if err := gl.loadASN(); err != nil {
+			log.Errorf("reload asn db %s err:%s", asnPath, err.Error())
+		}
+	})
 
 	return gl, nil
 }
 
 type geoLite struct {
 	dbPath string
+	// asn mmdb, optional
+	asnPath string
+
+	// readers are closed on reload, lookup hold the read lock
+	lk   sync.RWMutex
+	city *geoip2.Reader
+	asn  *geoip2.Reader
 }
 
-func (g geoLite) DefaultGeoInfo(ip string) *GeoInfo {
+func (g *geoLite) loadCity() error {
+	db, err := geoip2.Open(g.dbPath)
+	if err != nil {
+		return err
+	}
+
+	g.lk.Lock()
+	old := g.city
+	g.city = db
+	g.lk.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	log.Infof("geo db %s loaded", g.dbPath)
+	return nil
+}
+
+func (g *geoLite) loadASN() error {
+	db, err := geoip2.Open(g.asnPath)
+	if err != nil {
+		return err
+	}
+
+	g.lk.Lock()
+	old := g.asn
+	g.asn = db
+	g.lk.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	log.Infof("asn db %s loaded", g.asnPath)
+	return nil
+}
+
+func (g *geoLite) DefaultGeoInfo(ip string) *GeoInfo {
 	return &GeoInfo{
 		City:      unknown,
 		Country:   unknown,
@@ -45,20 +106,29 @@ func (g geoLite) DefaultGeoInfo(ip string) *GeoInfo {
 	}
 }
 
-func (g geoLite) GetGeoInfo(ip string) (*GeoInfo, error) {
+func (g *geoLite) GetGeoInfo(ip string) (*GeoInfo, error) {
 	geoInfo := g.DefaultGeoInfo(ip)
 	if ip == "" {
 		return geoInfo, xerrors.New("ip is nil")
 	}
 
-	db, err := geoip2.Open(g.dbPath)
-	if err != nil {
-		return geoInfo, err
-	}
-	defer db.Close()
 	// If you are using strings that may be invalid, check that ip is not nil
 	ipA := net.ParseIP(ip)
-	record, err := db.City(ipA)
+	if ipA == nil {
+		return geoInfo, xerrors.Errorf("invalid ip:%s", ip)
+	}
+
+	g.lk.RLock()
+	defer g.lk.RUnlock()
+
+	if g.asn != nil {
+		if record, err := g.asn.ASN(ipA); err == nil {
+			geoInfo.ASN = record.AutonomousSystemNumber
+			geoInfo.ISP = NormalizeISP(record.AutonomousSystemOrganization)
+		}
+	}
+
+	record, err := g.city.City(ipA)
 	if err != nil {
 		return geoInfo, err
 	}
@@ -0,0 +1,38 @@
+package region
+
+import "strings"
+
+// carriers of china
+const (
+	ISPChinaTelecom = "CT"
+	ISPChinaUnicom  = "CU"
+	ISPChinaMobile  = "CM"
+)
+
+// keywords of asn organization, lower case
+var ispKeywords = []struct {
+	isp      string
+	keywords []string
+}{
+	{ISPChinaTelecom, []string{"chinanet", "china telecom", "chinatelecom"}},
+	{ISPChinaUnicom, []string{"unicom", "cncgroup", "china169", "china netcom"}},
+	{ISPChinaMobile, []string{"china mobile", "chinamobile", "cmnet"}},
+}
+
+// NormalizeISP carrier code of the asn organization, the organization is returned if unknown
+func NormalizeISP(org string) string {
+	lower := strings.ToLower(org)
+	for _, k := range ispKeywords {
+		if strings.EqualFold(org, k.isp) {
+			return k.isp
+		}
+
+		for _, keyword := range k.keywords {
+			if strings.Contains(lower, keyword) {
+				return k.isp
+			}
+		}
+	}
+
+	return org
+}
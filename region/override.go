@@ -0,0 +1,183 @@
+package region
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// overrideEntry geo of the ip range, empty field is not overridden
+type overrideEntry struct {
+	ipNet    *net.IPNet
+	country  string
+	province string
+	city     string
+	isp      string
+}
+
+// overrideRegion cidr to area table layered over the base region,
+// for private, carrier-nat and mislocated ip ranges
+type overrideRegion struct {
+	base Region
+	path string
+
+	lk sync.RWMutex
+	// longest prefix first
+	entries []*overrideEntry
+}
+
+// initOverride the table file is reloaded when it changes
+func initOverride(base Region, path string) (*overrideRegion, error) {
+	o := &overrideRegion{base: base, path: path}
+
+	err := o.load()
+	if err != nil {
+		return o, err
+	}
+
+	watchFile(path, func() {
+		if err := o.load(); err != nil {
+			log.Errorf("reload geo override %s err:%s", path, err.Error())
+		}
+	})
+
+	return o, nil
+}
+
+// parseOverrides line format: cidr,country,province,city,isp
+// empty line and line start with # are ignored
+func parseOverrides(lines []string) ([]*overrideEntry, error) {
+	entries := make([]*overrideEntry, 0, len(lines))
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 || len(fields) > 5 {
+			return nil, xerrors.Errorf("line %d: want cidr,country,province,city,isp", i+1)
+		}
+		for len(fields) < 5 {
+			fields = append(fields, "")
+		}
+
+		cidr := strings.TrimSpace(fields[0])
+		if !strings.Contains(cidr, "/") {
+			// single ip
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, xerrors.Errorf("line %d: %w", i+1, err)
+		}
+
+		entries = append(entries, &overrideEntry{
+			ipNet:    ipNet,
+			country:  strings.TrimSpace(fields[1]),
+			province: strings.TrimSpace(fields[2]),
+			city:     strings.TrimSpace(fields[3]),
+			isp:      NormalizeISP(strings.TrimSpace(fields[4])),
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		oi, _ := entries[i].ipNet.Mask.Size()
+		oj, _ := entries[j].ipNet.Mask.Size()
+		return oi > oj
+	})
+
+	return entries, nil
+}
+
+func (o *overrideRegion) load() error {
+	f, err := os.Open(o.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	entries, err := parseOverrides(lines)
+	if err != nil {
+		return err
+	}
+
+	o.lk.Lock()
+	o.entries = entries
+	o.lk.Unlock()
+
+	log.Infof("geo override %s loaded, %d ip ranges", o.path, len(entries))
+	return nil
+}
+
+func (o *overrideRegion) find(ip net.IP) *overrideEntry {
+	o.lk.RLock()
+	defer o.lk.RUnlock()
+
+	for _, e := range o.entries {
+		if e.ipNet.Contains(ip) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func (o *overrideRegion) DefaultGeoInfo(ip string) *GeoInfo {
+	return o.base.DefaultGeoInfo(ip)
+}
+
+func (o *overrideRegion) GetGeoInfo(ip string) (*GeoInfo, error) {
+	geoInfo, err := o.base.GetGeoInfo(ip)
+
+	ipA := net.ParseIP(ip)
+	if ipA == nil {
+		return geoInfo, err
+	}
+
+	e := o.find(ipA)
+	if e == nil {
+		return geoInfo, err
+	}
+
+	if geoInfo == nil {
+		geoInfo = o.base.DefaultGeoInfo(ip)
+	}
+
+	if e.country != "" {
+		geoInfo.Country = e.country
+	}
+	if e.province != "" {
+		geoInfo.Province = e.province
+	}
+	if e.city != "" {
+		geoInfo.City = e.city
+	}
+	if e.isp != "" {
+		geoInfo.ISP = e.isp
+	}
+	geoInfo.Geo = fmt.Sprintf("%s%s%s%s%s", geoInfo.Country, separate, geoInfo.Province, separate, geoInfo.City)
+	geoInfo.Overridden = true
+
+	return geoInfo, nil
+}
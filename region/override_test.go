@@ -0,0 +1,49 @@
+package region
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseOverrides(t *testing.T) {
+	lines := []string{
+		"# private ranges",
+		"10.0.0.0/8,CN,GD,Shenzhen,lan",
+		"",
+		"10.1.0.0/16,CN,GX,Nanning",
+		"100.64.0.1,CN",
+	}
+
+	entries, err := parseOverrides(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("want 3 entries, got %d", len(entries))
+	}
+
+	o := &overrideRegion{entries: entries}
+
+	e := o.find(net.ParseIP("10.1.2.3"))
+	if e == nil || e.province != "GX" {
+		t.Fatalf("longest prefix not matched: %+v", e)
+	}
+
+	e = o.find(net.ParseIP("10.2.2.3"))
+	if e == nil || e.city != "Shenzhen" || e.isp != "lan" {
+		t.Fatalf("range not matched: %+v", e)
+	}
+
+	if e = o.find(net.ParseIP("100.64.0.1")); e == nil || e.province != "" {
+		t.Fatalf("single ip not matched: %+v", e)
+	}
+
+	if e = o.find(net.ParseIP("8.8.8.8")); e != nil {
+		t.Fatalf("unexpected match: %+v", e)
+	}
+
+	if _, err := parseOverrides([]string{"not-a-cidr,CN"}); err == nil {
+		t.Fatal("want error of invalid cidr")
+	}
+}
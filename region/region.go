@@ -1,14 +1,20 @@
 package region
 
 import (
+	"math"
 	"strings"
 
+	logging "github.com/ipfs/go-log/v2"
 	"golang.org/x/xerrors"
 )
 
+var log = logging.Logger("region")
+
 const (
 	unknown  = "unknown"
 	separate = "-"
+
+	earthRadiusKm = 6371.0
 )
 
 // Region geo interface
@@ -26,17 +32,30 @@ type GeoInfo struct {
 	Longitude float64
 	IP        string
 	Geo       string
+	ISP       string
+	ASN       uint
+	// geo is from the override table
+	Overridden bool
+}
+
+// Config files of region
+type Config struct {
+	GeoDBPath string
+	// asn mmdb for isp lookup, optional
+	ASNDBPath string
+	// cidr to area table over the geo db, optional
+	OverridePath string
 }
 
 var region Region
 
 // NewRegion New Region
-func NewRegion(dbPath, geoType string) error {
+func NewRegion(cfg Config, geoType string) error {
 	var err error
 
 	switch geoType {
 	case TypeGeoLite():
-		region, err = InitGeoLite(dbPath)
+		region, err = InitGeoLite(cfg.GeoDBPath, cfg.ASNDBPath)
 	default:
 		// panic("unknown Region type")
 		err = xerrors.New("unknown Region type")
@@ -46,6 +65,11 @@ func NewRegion(dbPath, geoType string) error {
 	// 	e := fmt.Sprintf("NewRegion err:%v , path:%v", err, dbPath)
 	// 	panic(e)
 	// }
+	if err != nil || cfg.OverridePath == "" {
+		return err
+	}
+
+	region, err = initOverride(region, cfg.OverridePath)
 	return err
 }
 
@@ -54,6 +78,11 @@ func GetRegion() Region {
 	return region
 }
 
+// SetRegion Set Region
+func SetRegion(r Region) {
+	region = r
+}
+
 // StringGeoToGeoInfo geo
 func StringGeoToGeoInfo(geo string) *GeoInfo {
 	geos := strings.Split(geo, separate)
@@ -63,3 +92,35 @@ func StringGeoToGeoInfo(geo string) *GeoInfo {
 
 	return &GeoInfo{Country: geos[0], Province: geos[1], City: geos[2]}
 }
+
+// DistanceKm great circle distance of two geo, return false if the location is unknown
+func DistanceKm(g1, g2 *GeoInfo) (float64, bool) {
+	if g1 == nil || g2 == nil {
+		return 0, false
+	}
+
+	if (g1.Latitude == 0 && g1.Longitude == 0) || (g2.Latitude == 0 && g2.Longitude == 0) {
+		return 0, false
+	}
+
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	lat1, lat2 := toRad(g1.Latitude), toRad(g2.Latitude)
+	dLat := lat2 - lat1
+	dLon := toRad(g2.Longitude - g1.Longitude)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a))), true
+}
+
+// AreaMatchLevel count of the same leading parts of two geo, format country-province-city
+func AreaMatchLevel(geo1, geo2 string) int {
+	g1 := strings.Split(strings.ToLower(geo1), separate)
+	g2 := strings.Split(strings.ToLower(geo2), separate)
+
+	level := 0
+	for level < len(g1) && level < len(g2) && g1[level] == g2[level] && g1[level] != unknown {
+		level++
+	}
+
+	return level
+}
@@ -0,0 +1,37 @@
+package region
+
+import (
+	"os"
+	"time"
+)
+
+// interval to check the files change
+var watchInterval = time.Minute
+
+// watchFile call onChange when the modify time or size of the file changed
+func watchFile(path string, onChange func()) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		log.Errorf("watch file %s err:%s", path, err.Error())
+	}
+
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			newStat, err := os.Stat(path)
+			if err != nil {
+				// the file may be replaced now
+				continue
+			}
+
+			if stat != nil && newStat.ModTime().Equal(stat.ModTime()) && newStat.Size() == stat.Size() {
+				continue
+			}
+
+			stat = newStat
+			onChange()
+		}
+	}()
+}